@@ -49,7 +49,7 @@ func InitRouter() {
 	}
 
 	// 注册设备路由到 /api/v1
-	devicerouter.InitDeviceRouter(g)
+	devicerouter.InitDeviceRouter(g, authMiddleware)
 
 	// 注册业务路由
 	// TODO: 这里可存放业务路由，里边并无实际路由只有演示代码
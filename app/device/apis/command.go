@@ -1,11 +1,16 @@
 package apis
 
 import (
+	"errors"
+	"net/http"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/go-admin-team/go-admin-core/sdk/api"
 
 	"opt-switch/app/device/service"
 	"opt-switch/app/device/service/dto"
+	"opt-switch/pkg/device"
 )
 
 // CommandAPI handles command execution HTTP requests
@@ -22,9 +27,12 @@ type CommandAPI struct {
 // @Param request body dto.CommandExecuteReq true "Command execution request"
 // @Success 200 {object} response.Response{data=dto.CommandExecuteResp}
 // @Failure 400 {object} response.Response
+// @Failure 403 {object} response.Response "Command denied by policy"
+// @Failure 428 {object} response.Response{data=device.ConfirmationRequiredError} "Command requires confirmation, resubmit with confirmToken"
 // @Failure 429 {object} response.Response "Service busy, please try again later"
 // @Failure 500 {object} response.Response
 // @Router /api/v1/device/command/execute [post]
+// @Security Bearer
 func (e *CommandAPI) ExecuteCommand(c *gin.Context) {
 	req := dto.CommandExecuteReq{}
 	s := service.CommandService{}
@@ -40,6 +48,9 @@ func (e *CommandAPI) ExecuteCommand(c *gin.Context) {
 
 	resp, err := s.ExecuteCommand(c, &req)
 	if err != nil {
+		if confirmationRequired(&e.Api, err) {
+			return
+		}
 		statusCode, msg := s.MapError(err)
 		e.Error(statusCode, err, msg)
 		return
@@ -57,9 +68,12 @@ func (e *CommandAPI) ExecuteCommand(c *gin.Context) {
 // @Param request body dto.BatchCommandReq true "Batch command request"
 // @Success 200 {object} response.Response{data=dto.BatchCommandResp}
 // @Failure 400 {object} response.Response
+// @Failure 403 {object} response.Response "Command denied by policy"
+// @Failure 428 {object} response.Response{data=device.ConfirmationRequiredError} "Command requires confirmation, resubmit with confirmToken"
 // @Failure 429 {object} response.Response "Service busy, please try again later"
 // @Failure 500 {object} response.Response
 // @Router /api/v1/device/command/batch [post]
+// @Security Bearer
 func (e *CommandAPI) ExecuteBatch(c *gin.Context) {
 	req := dto.BatchCommandReq{}
 	s := service.CommandService{}
@@ -75,6 +89,9 @@ func (e *CommandAPI) ExecuteBatch(c *gin.Context) {
 
 	resp, err := s.ExecuteBatch(c, &req)
 	if err != nil {
+		if confirmationRequired(&e.Api, err) {
+			return
+		}
 		statusCode, msg := s.MapError(err)
 		e.Error(statusCode, err, msg)
 		return
@@ -85,16 +102,27 @@ func (e *CommandAPI) ExecuteBatch(c *gin.Context) {
 
 // GetHistory retrieves command execution history
 // @Summary Get command execution history
-// @Description Retrieves historical command execution records from log file
+// @Description Retrieves command execution records, newest first, from the sys_command_history table or, before it is migrated, from the execution log and its rotated backups. Total counts every matching record.
 // @Tags device
 // @Accept json
 // @Produce json
 // @Param limit query int true "Limit number of records" minimum(1) maximum(1000)
-// @Param offset query int true "Offset for pagination" minimum(0)
+// @Param offset query int false "Offset for pagination" minimum(0)
+// @Param deviceId query int false "Inventory device id, all devices when omitted"
+// @Param userId query string false "User id"
+// @Param username query string false "Username"
+// @Param command query string false "Substring of the command"
+// @Param commandRegex query string false "Regular expression matched against the command"
+// @Param success query bool false "Only successful or failed commands"
+// @Param since query int false "Unix seconds, inclusive"
+// @Param until query int false "Unix seconds, inclusive"
+// @Param clientIp query string false "Client IP"
+// @Param sessionId query string false "Terminal session id"
 // @Success 200 {object} response.Response{data=dto.CommandHistoryResp}
-// @Failure 400 {object} response.Response
+// @Failure 400 {object} response.Response "Invalid parameter, e.g. the command regex"
 // @Failure 500 {object} response.Response
 // @Router /api/v1/device/command/history [get]
+// @Security Bearer
 func (e *CommandAPI) GetHistory(c *gin.Context) {
 	req := dto.CommandHistoryReq{}
 	s := service.CommandService{}
@@ -110,48 +138,201 @@ func (e *CommandAPI) GetHistory(c *gin.Context) {
 
 	resp, err := s.GetHistory(&req)
 	if err != nil {
-		e.Error(500, err, "Failed to get history")
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
 		return
 	}
 
 	e.OK(resp, "History retrieved successfully")
 }
 
+// ExportHistory streams the command history as a file
+// @Summary Export command execution history
+// @Description Streams every matching record, oldest first, as CSV (with a header line, times in RFC 3339) or as
+// @Description NDJSON (one JSON record per line, times in unix seconds). The filters are those of the history query.
+// @Tags device
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param format query string false "csv (default) or ndjson"
+// @Param from query string false "Unix seconds or RFC 3339, inclusive"
+// @Param to query string false "Unix seconds or RFC 3339, inclusive"
+// @Param deviceId query int false "Inventory device id, all devices when omitted"
+// @Param userId query string false "User id"
+// @Param username query string false "Username"
+// @Param command query string false "Substring of the command"
+// @Param commandRegex query string false "Regular expression matched against the command"
+// @Param success query bool false "Only successful or failed commands"
+// @Param clientIp query string false "Client IP"
+// @Param sessionId query string false "Terminal session id"
+// @Success 200 {file} file
+// @Failure 400 {object} response.Response "Invalid parameter"
+// @Failure 500 {object} response.Response "Device configuration error"
+// @Router /api/v1/device/command/history/export [get]
+// @Security Bearer
+func (e *CommandAPI) ExportHistory(c *gin.Context) {
+	req := dto.CommandHistoryExportReq{}
+	s := service.CommandService{}
+	err := e.MakeContext(c).
+		MakeService(&s.Service).
+		Bind(&req).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(400, err, err.Error())
+		return
+	}
+
+	export, err := s.PrepareHistoryExport(&req)
+	if err != nil {
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	// the server write timeout is meant for regular requests, a long
+	// history takes longer to download
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		e.Logger.Warnf("command history export: cannot clear write deadline: %v", err)
+	}
+	c.Header("Content-Type", export.ContentType())
+	c.Header("Content-Disposition", `attachment; filename="`+export.FileName()+`"`)
+	c.Status(http.StatusOK)
+
+	// the status is sent, a failure can only cut the file short
+	written, err := export.Write(c.Writer)
+	if err != nil {
+		e.Logger.Errorf("command history export stopped after %d records: %v", written, err)
+	}
+}
+
+// VerifyLog checks the execution log hash chain
+// @Summary Verify the execution log
+// @Description Walks the execution log and its rotated backups and reports the first entry that was modified, removed
+// @Description or inserted, or whether the log ends before the last entry written. Requires log.integrity.
+// @Tags device
+// @Produce json
+// @Success 200 {object} response.Response{data=device.ChainVerification}
+// @Failure 400 {object} response.Response "log.integrity is not enabled"
+// @Failure 500 {object} response.Response
+// @Router /api/v1/device/command/history/verify [get]
+// @Security Bearer
+func (e *CommandAPI) VerifyLog(c *gin.Context) {
+	s := service.CommandService{}
+	err := e.MakeContext(c).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+
+	result, err := s.VerifyLog()
+	if err != nil {
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	e.OK(result, "Execution log verified")
+}
+
 // GetStatus returns the device connection status
 // @Summary Get device connection status
 // @Description Returns the current status of device connections and queue
 // @Tags device
 // @Accept json
 // @Produce json
+// @Param deviceId query int false "Inventory device id, default device when omitted"
 // @Success 200 {object} response.Response{data=dto.DeviceStatusResp}
 // @Failure 500 {object} response.Response
 // @Router /api/v1/device/status [get]
+// @Security Bearer
 func (e *CommandAPI) GetStatus(c *gin.Context) {
+	req := dto.DeviceStatusReq{}
 	s := service.CommandService{}
 	err := e.MakeContext(c).
 		MakeService(&s.Service).
+		Bind(&req).
 		Errors
 	if err != nil {
 		e.Logger.Error(err)
-		e.Error(500, err, err.Error())
+		e.Error(400, err, err.Error())
 		return
 	}
 
-	resp := s.GetStatus()
+	resp := s.GetStatus(&req)
 	e.OK(resp, "Status retrieved successfully")
 }
 
+// GetMetrics returns a switch telemetry series
+// @Summary Get switch telemetry
+// @Description Returns a series collected by the telemetry collector (interface rates and errors, CPU, memory, temperature, power supplies and fans), one per instance, merged into points of step seconds
+// @Tags device
+// @Accept json
+// @Produce json
+// @Param deviceId query int false "Inventory device id, default device when omitted"
+// @Param name query string true "Series, e.g. interface_in_bps or cpu_usage_percent"
+// @Param label query string false "Instance, e.g. an interface, all when omitted"
+// @Param from query string false "Unix seconds or RFC 3339, an hour before to by default"
+// @Param to query string false "Unix seconds or RFC 3339, now by default"
+// @Param step query int false "Seconds per point, about 300 points when omitted"
+// @Success 200 {object} response.Response{data=device.TelemetryResult}
+// @Failure 400 {object} response.Response "Invalid parameter or telemetry storage not available"
+// @Router /api/v1/device/metrics [get]
+// @Security Bearer
+func (e *CommandAPI) GetMetrics(c *gin.Context) {
+	req := dto.DeviceMetricsReq{}
+	s := service.CommandService{}
+	err := e.MakeContext(c).
+		MakeService(&s.Service).
+		Bind(&req).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(400, err, err.Error())
+		return
+	}
+
+	result, err := s.GetMetrics(&req)
+	if err != nil {
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	e.OK(result, "Metrics retrieved successfully")
+}
+
 // GetDeviceInfo is a simple health check endpoint
 // @Summary Get device information
-// @Description Returns basic device information
+// @Description Returns basic device information and the available protocols with their capabilities
 // @Tags device
 // @Accept json
 // @Produce json
 // @Success 200 {object} response.Response
-// @Router /api/v1/device [get]
+// @Router /device [get]
 func (e *CommandAPI) GetDeviceInfo(c *gin.Context) {
+	e.MakeContext(c)
 	e.OK(gin.H{
-		"status": "online",
-		"type":   "switch",
+		"status":    "online",
+		"type":      "switch",
+		"protocols": device.Protocols(),
 	}, "Device is online")
 }
+
+// confirmationRequired answers with the confirmation token when err reports
+// that the command policy requires confirmation. The commands run once they
+// are submitted again with the token.
+func confirmationRequired(e *api.Api, err error) bool {
+	var confirm *device.ConfirmationRequiredError
+	if !errors.As(err, &confirm) {
+		return false
+	}
+	e.Custom(gin.H{
+		"code": 428,
+		"msg":  "命令需要确认，请携带 confirmToken 重新提交",
+		"data": confirm,
+	})
+	return true
+}
@@ -0,0 +1,185 @@
+package apis
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"opt-switch/app/device/service"
+	"opt-switch/app/device/service/dto"
+)
+
+// jobKeepAlive is the interval of SSE comments keeping idle streams open
+const jobKeepAlive = 15 * time.Second
+
+// SubmitJob runs commands as an asynchronous job
+// @Summary Submit an asynchronous command job
+// @Description Queues commands on the device and returns the job immediately. Poll the job or subscribe to its events for the results.
+// @Tags device
+// @Accept json
+// @Produce json
+// @Param request body dto.CommandJobReq true "Command job request"
+// @Success 200 {object} response.Response{data=device.JobSnapshot}
+// @Failure 400 {object} response.Response
+// @Failure 403 {object} response.Response "Command denied by policy"
+// @Failure 428 {object} response.Response{data=device.ConfirmationRequiredError} "Command requires confirmation, resubmit with confirmToken"
+// @Failure 429 {object} response.Response "Too many jobs, please try again later"
+// @Router /api/v1/device/command/jobs [post]
+// @Security Bearer
+func (e *CommandAPI) SubmitJob(c *gin.Context) {
+	req := dto.CommandJobReq{}
+	s := service.CommandService{}
+	err := e.MakeContext(c).
+		MakeService(&s.Service).
+		Bind(&req).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(400, err, err.Error())
+		return
+	}
+
+	job, err := s.SubmitJob(c, &req)
+	if err != nil {
+		if confirmationRequired(&e.Api, err) {
+			return
+		}
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	e.OK(job, "Job submitted")
+}
+
+// GetJob returns the status and the results of a job so far
+// @Summary Get a command job
+// @Description Returns the status of a job and the results of the commands that finished. Finished jobs are kept for device.jobs.result_ttl seconds.
+// @Tags device
+// @Produce json
+// @Param id path string true "Job id"
+// @Success 200 {object} response.Response{data=device.JobSnapshot}
+// @Failure 404 {object} response.Response "Job not found or expired"
+// @Router /api/v1/device/command/jobs/{id} [get]
+// @Security Bearer
+func (e *CommandAPI) GetJob(c *gin.Context) {
+	req := dto.CommandJobGetReq{}
+	s := service.CommandService{}
+	err := e.MakeContext(c).
+		MakeService(&s.Service).
+		Bind(&req, nil).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(400, err, err.Error())
+		return
+	}
+
+	job, err := s.GetJob(c, req.Id)
+	if err != nil {
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	e.OK(job.Snapshot(), "Job retrieved successfully")
+}
+
+// CancelJob cancels a job
+// @Summary Cancel a command job
+// @Description Skips the commands of a job that have not run and interrupts the running one
+// @Tags device
+// @Produce json
+// @Param id path string true "Job id"
+// @Success 200 {object} response.Response{data=device.JobSnapshot}
+// @Failure 404 {object} response.Response "Job not found or expired"
+// @Router /api/v1/device/command/jobs/{id}/cancel [post]
+// @Security Bearer
+func (e *CommandAPI) CancelJob(c *gin.Context) {
+	req := dto.CommandJobGetReq{}
+	s := service.CommandService{}
+	err := e.MakeContext(c).
+		MakeService(&s.Service).
+		Bind(&req, nil).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(400, err, err.Error())
+		return
+	}
+
+	job, err := s.CancelJob(c, req.Id)
+	if err != nil {
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	e.OK(job, "Job cancelled")
+}
+
+// JobEvents streams the progress of a job as Server-Sent Events
+// @Summary Subscribe to a command job
+// @Description Streams a "snapshot" event with the current job state, then a "result" event per finished command
+// @Description and "status" events on state changes. The stream ends when the job finishes.
+// @Tags device
+// @Produce text/event-stream
+// @Param id path string true "Job id"
+// @Param token query string false "JWT, for EventSource clients that cannot set the Authorization header"
+// @Success 200 {object} device.JobEvent
+// @Failure 404 {object} response.Response "Job not found or expired"
+// @Router /api/v1/device/command/jobs/{id}/events [get]
+// @Security Bearer
+func (e *CommandAPI) JobEvents(c *gin.Context) {
+	req := dto.CommandJobGetReq{}
+	s := service.CommandService{}
+	err := e.MakeContext(c).
+		MakeService(&s.Service).
+		Bind(&req, nil).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(400, err, err.Error())
+		return
+	}
+
+	job, err := s.GetJob(c, req.Id)
+	if err != nil {
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	snapshot, events, unsubscribe := job.Subscribe()
+	defer unsubscribe()
+
+	// the server write timeout is meant for regular requests, a stream lasts
+	// as long as the job
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		e.Logger.Warnf("job %s: cannot clear write deadline: %v", job.ID(), err)
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("snapshot", snapshot)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(jobKeepAlive)
+	defer keepAlive.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event)
+			return true
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,208 @@
+package apis
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-admin-team/go-admin-core/sdk/api"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth/user"
+	_ "github.com/go-admin-team/go-admin-core/sdk/pkg/response"
+
+	"opt-switch/app/device/models"
+	"opt-switch/app/device/service"
+	"opt-switch/app/device/service/dto"
+)
+
+// ConfigBackup handles device configuration backups
+type ConfigBackup struct {
+	api.Api
+}
+
+// GetPage
+// @Summary 配置备份列表
+// @Description 获取配置备份列表，不含配置内容，默认按时间倒序
+// @Tags 设备
+// @Param deviceId query int false "设备编码"
+// @Param source query string false "来源 job/manual/restore"
+// @Param hash query string false "配置哈希"
+// @Param pageSize query int false "页条数"
+// @Param pageIndex query int false "页码"
+// @Success 200 {object} response.Response{data=response.Page{list=[]models.SysDeviceConfigBackup}} "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/config/backups [get]
+// @Security Bearer
+func (e ConfigBackup) GetPage(c *gin.Context) {
+	s := service.ConfigBackup{}
+	req := dto.ConfigBackupPageReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, binding.Form).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+
+	list := make([]models.SysDeviceConfigBackup, 0)
+	var count int64
+
+	err = s.GetPage(&req, &list, &count)
+	if err != nil {
+		e.Error(500, err, "查询失败")
+		return
+	}
+
+	e.PageOK(list, int(count), req.GetPageIndex(), req.GetPageSize(), "查询成功")
+}
+
+// Get
+// @Summary 获取配置备份
+// @Description 获取单个配置备份，包含配置内容
+// @Tags 设备
+// @Param id path int true "备份编码"
+// @Success 200 {object} response.Response{data=models.SysDeviceConfigBackup} "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/config/backups/{id} [get]
+// @Security Bearer
+func (e ConfigBackup) Get(c *gin.Context) {
+	s := service.ConfigBackup{}
+	req := dto.ConfigBackupGetReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, nil).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+	var object models.SysDeviceConfigBackup
+
+	err = s.Get(&req, &object)
+	if err != nil {
+		e.Error(500, err, fmt.Sprintf("配置备份获取失败！错误详情：%s", err.Error()))
+		return
+	}
+
+	e.OK(object, "查询成功")
+}
+
+// Capture
+// @Summary 立即备份配置
+// @Description 立即执行备份命令，与最新备份相同时不重复保存
+// @Tags 设备
+// @Accept  application/json
+// @Product application/json
+// @Param data body dto.ConfigBackupCaptureReq false "data"
+// @Success 200 {object} response.Response{data=dto.ConfigBackupCaptureResp} "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/config/backups [post]
+// @Security Bearer
+func (e ConfigBackup) Capture(c *gin.Context) {
+	s := service.ConfigBackup{}
+	req := dto.ConfigBackupCaptureReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, binding.JSON).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+
+	resp, err := s.Capture(c.Request.Context(), req.DeviceID, models.BackupSourceManual, user.GetUserId(c), user.GetUserName(c))
+	if err != nil {
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	if !resp.Created {
+		e.OK(resp, "配置未变化，未保存新版本")
+		return
+	}
+	e.OK(resp, "备份成功")
+}
+
+// Diff
+// @Summary 配置备份对比
+// @Description 返回两个配置版本之间的 unified diff
+// @Tags 设备
+// @Param from query int true "源备份编码"
+// @Param to query int true "目标备份编码"
+// @Param context query int false "上下文行数，默认3"
+// @Success 200 {object} response.Response{data=dto.ConfigBackupDiffResp} "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/config/backups/diff [get]
+// @Security Bearer
+func (e ConfigBackup) Diff(c *gin.Context) {
+	s := service.ConfigBackup{}
+	req := dto.ConfigBackupDiffReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, binding.Form).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(400, err, err.Error())
+		return
+	}
+
+	resp, err := s.Diff(&req)
+	if err != nil {
+		e.Error(500, err, fmt.Sprintf("配置对比失败！错误详情：%s", err.Error()))
+		return
+	}
+
+	e.OK(resp, "查询成功")
+}
+
+// Restore
+// @Summary 恢复配置
+// @Description 计算当前运行配置与备份版本的差异，在同一会话中独占下发，完成后重新备份并校验；dryRun 时仅返回将要下发的命令
+// @Tags 设备
+// @Accept  application/json
+// @Product application/json
+// @Param id path int true "备份编码"
+// @Param data body dto.ConfigBackupRestoreReq false "data"
+// @Success 200 {object} response.Response{data=dto.ConfigBackupRestoreResp} "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/config/backups/{id}/restore [post]
+// @Security Bearer
+func (e ConfigBackup) Restore(c *gin.Context) {
+	s := service.ConfigBackup{}
+	req := dto.ConfigBackupRestoreReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, binding.JSON, nil).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+
+	resp, err := s.Restore(c.Request.Context(), &req, user.GetUserId(c), user.GetUserName(c), c.ClientIP())
+	if err != nil {
+		statusCode, msg := s.MapError(err)
+		if statusCode == 500 {
+			msg = fmt.Sprintf("配置恢复失败！错误详情：%s", err.Error())
+		}
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	switch {
+	case resp.DryRun:
+		e.OK(resp, "预览成功")
+	case len(resp.Commands) == 0:
+		e.OK(resp, "配置与备份一致，无需恢复")
+	case !resp.Verified:
+		e.OK(resp, "恢复完成，但运行配置与备份仍有差异")
+	default:
+		e.OK(resp, "恢复成功")
+	}
+}
@@ -0,0 +1,70 @@
+package apis
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-admin-team/go-admin-core/sdk/api"
+
+	"opt-switch/app/device/service"
+	"opt-switch/app/device/service/dto"
+)
+
+// DeviceConfigAPI handles device configuration reload HTTP requests
+type DeviceConfigAPI struct {
+	api.Api
+}
+
+// Reload applies a new device configuration without a restart
+// @Summary Reload device configuration
+// @Description Validates the device block of the settings file in the body, rebuilds the pools whose settings changed after their queued tasks and terminals finished, reopens the execution log when its settings changed and returns the changes. Blank secrets keep the current ones; the settings file is not written.
+// @Tags device
+// @Accept json
+// @Produce json
+// @Param request body dto.DeviceConfigReq true "Device configuration, as settings.device of the settings file"
+// @Success 200 {object} response.Response{data=device.ReloadResult}
+// @Failure 400 {object} response.Response "Invalid configuration, nothing was changed"
+// @Router /api/v1/device/config [put]
+// @Security Bearer
+func (e *DeviceConfigAPI) Reload(c *gin.Context) {
+	req := dto.DeviceConfigReq{}
+	s := service.DeviceConfigService{}
+	err := e.MakeContext(c).
+		MakeService(&s.Service).
+		Bind(&req).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(400, err, err.Error())
+		return
+	}
+
+	result, err := s.Reload(&req)
+	if err != nil {
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	e.OK(result, "Device configuration reloaded")
+}
+
+// LastReload returns the outcome of the last configuration reload
+// @Summary Get last device configuration reload
+// @Description Returns the changes, rebuilt devices and errors of the last reload from the API or the settings file, null before the first one
+// @Tags device
+// @Produce json
+// @Success 200 {object} response.Response{data=device.ReloadResult}
+// @Router /api/v1/device/config/reload [get]
+// @Security Bearer
+func (e *DeviceConfigAPI) LastReload(c *gin.Context) {
+	s := service.DeviceConfigService{}
+	err := e.MakeContext(c).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+
+	e.OK(s.LastReload(), "Last reload retrieved successfully")
+}
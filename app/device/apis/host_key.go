@@ -0,0 +1,116 @@
+package apis
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-admin-team/go-admin-core/sdk/api"
+
+	"opt-switch/app/device/service"
+	"opt-switch/app/device/service/dto"
+)
+
+// HostKeyAPI handles SSH host key HTTP requests
+type HostKeyAPI struct {
+	api.Api
+}
+
+// Get returns the SSH host key of a device
+// @Summary Get device host key
+// @Description Returns the stored SSH host key fingerprints of the device and the pending key it presented when verification failed
+// @Tags device
+// @Produce json
+// @Param deviceId query int false "Inventory device id, default device when omitted"
+// @Success 200 {object} response.Response{data=dto.HostKeyResp}
+// @Failure 400 {object} response.Response "Device protocol does not use SSH"
+// @Failure 404 {object} response.Response
+// @Router /api/v1/device/hostkey [get]
+// @Security Bearer
+func (e *HostKeyAPI) Get(c *gin.Context) {
+	req := dto.HostKeyReq{}
+	s := service.HostKeyService{}
+	err := e.MakeContext(c).
+		MakeService(&s.Service).
+		Bind(&req).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(400, err, err.Error())
+		return
+	}
+
+	resp, err := s.Get(&req)
+	if err != nil {
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	e.OK(resp, "Host key retrieved successfully")
+}
+
+// Accept trusts the pending SSH host key of a device
+// @Summary Accept device host key
+// @Description Replaces the stored SSH host key of the device by the pending key with the given fingerprint
+// @Tags device
+// @Accept json
+// @Produce json
+// @Param request body dto.HostKeyAcceptReq true "Host key accept request"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response "No pending key with the fingerprint, or the key is pinned"
+// @Failure 404 {object} response.Response
+// @Router /api/v1/device/hostkey/accept [post]
+// @Security Bearer
+func (e *HostKeyAPI) Accept(c *gin.Context) {
+	req := dto.HostKeyAcceptReq{}
+	s := service.HostKeyService{}
+	err := e.MakeContext(c).
+		MakeService(&s.Service).
+		Bind(&req).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(400, err, err.Error())
+		return
+	}
+
+	if err := s.Accept(&req); err != nil {
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	e.OK(req.Fingerprint, "Host key accepted")
+}
+
+// Forget removes the stored SSH host key of a device
+// @Summary Forget device host key
+// @Description Removes the stored SSH host key of the device. With the tofu policy the next connection trusts the key presented then.
+// @Tags device
+// @Accept json
+// @Produce json
+// @Param request body dto.HostKeyForgetReq true "Host key forget request"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /api/v1/device/hostkey [delete]
+// @Security Bearer
+func (e *HostKeyAPI) Forget(c *gin.Context) {
+	req := dto.HostKeyForgetReq{}
+	s := service.HostKeyService{}
+	err := e.MakeContext(c).
+		MakeService(&s.Service).
+		Bind(&req).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(400, err, err.Error())
+		return
+	}
+
+	if err := s.Forget(&req); err != nil {
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	e.OK(req.DeviceID, "Host key removed")
+}
@@ -0,0 +1,212 @@
+package apis
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-admin-team/go-admin-core/sdk/api"
+
+	"opt-switch/app/device/service"
+	"opt-switch/app/device/service/dto"
+)
+
+// NetconfAPI handles NETCONF HTTP requests
+type NetconfAPI struct {
+	api.Api
+}
+
+// GetCapabilities returns the NETCONF session capabilities
+// @Summary Get NETCONF capabilities
+// @Description Returns the session id and capabilities advertised in the device hello
+// @Tags device
+// @Produce json
+// @Param deviceId query int false "Inventory device id, default device when omitted"
+// @Success 200 {object} response.Response{data=dto.NetconfCapabilitiesResp}
+// @Failure 400 {object} response.Response "Device protocol is not netconf"
+// @Failure 500 {object} response.Response
+// @Router /api/v1/device/netconf/capabilities [get]
+// @Security Bearer
+func (e *NetconfAPI) GetCapabilities(c *gin.Context) {
+	req := dto.NetconfCapabilitiesReq{}
+	s := service.NetconfService{}
+	err := e.MakeContext(c).
+		MakeService(&s.Service).
+		Bind(&req).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(400, err, err.Error())
+		return
+	}
+
+	resp, err := s.Capabilities(c, &req)
+	if err != nil {
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	e.OK(resp, "Capabilities retrieved successfully")
+}
+
+// Get executes a NETCONF <get>
+// @Summary NETCONF get
+// @Description Retrieves running configuration and state data, optionally filtered by a subtree filter
+// @Tags device
+// @Accept json
+// @Produce json
+// @Param request body dto.NetconfGetReq true "NETCONF get request"
+// @Success 200 {object} response.Response{data=dto.NetconfReplyResp}
+// @Failure 400 {object} response.Response
+// @Failure 403 {object} response.Response "Operation denied by policy"
+// @Failure 428 {object} response.Response{data=device.ConfirmationRequiredError} "Operation requires confirmation, resubmit with confirmToken"
+// @Failure 429 {object} response.Response "Service busy, please try again later"
+// @Failure 500 {object} response.Response
+// @Router /api/v1/device/netconf/get [post]
+// @Security Bearer
+func (e *NetconfAPI) Get(c *gin.Context) {
+	req := dto.NetconfGetReq{}
+	s := service.NetconfService{}
+	err := e.MakeContext(c).
+		MakeService(&s.Service).
+		Bind(&req).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(400, err, err.Error())
+		return
+	}
+
+	resp, err := s.Get(c, &req)
+	if err != nil {
+		if confirmationRequired(&e.Api, err) {
+			return
+		}
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	e.OK(resp, "NETCONF get executed")
+}
+
+// GetConfig executes a NETCONF <get-config>
+// @Summary NETCONF get-config
+// @Description Retrieves all or part of a configuration datastore
+// @Tags device
+// @Accept json
+// @Produce json
+// @Param request body dto.NetconfGetConfigReq true "NETCONF get-config request"
+// @Success 200 {object} response.Response{data=dto.NetconfReplyResp}
+// @Failure 400 {object} response.Response
+// @Failure 403 {object} response.Response "Operation denied by policy"
+// @Failure 428 {object} response.Response{data=device.ConfirmationRequiredError} "Operation requires confirmation, resubmit with confirmToken"
+// @Failure 429 {object} response.Response "Service busy, please try again later"
+// @Failure 500 {object} response.Response
+// @Router /api/v1/device/netconf/get-config [post]
+// @Security Bearer
+func (e *NetconfAPI) GetConfig(c *gin.Context) {
+	req := dto.NetconfGetConfigReq{}
+	s := service.NetconfService{}
+	err := e.MakeContext(c).
+		MakeService(&s.Service).
+		Bind(&req).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(400, err, err.Error())
+		return
+	}
+
+	resp, err := s.GetConfig(c, &req)
+	if err != nil {
+		if confirmationRequired(&e.Api, err) {
+			return
+		}
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	e.OK(resp, "NETCONF get-config executed")
+}
+
+// EditConfig executes a NETCONF <edit-config>
+// @Summary NETCONF edit-config
+// @Description Loads configuration into a datastore, optionally locking it and committing the candidate in the same session
+// @Tags device
+// @Accept json
+// @Produce json
+// @Param request body dto.NetconfEditConfigReq true "NETCONF edit-config request"
+// @Success 200 {object} response.Response{data=dto.NetconfEditConfigResp}
+// @Failure 400 {object} response.Response
+// @Failure 403 {object} response.Response "Operation denied by policy"
+// @Failure 428 {object} response.Response{data=device.ConfirmationRequiredError} "Operation requires confirmation, resubmit with confirmToken"
+// @Failure 429 {object} response.Response "Service busy, please try again later"
+// @Failure 500 {object} response.Response
+// @Router /api/v1/device/netconf/edit-config [post]
+// @Security Bearer
+func (e *NetconfAPI) EditConfig(c *gin.Context) {
+	req := dto.NetconfEditConfigReq{}
+	s := service.NetconfService{}
+	err := e.MakeContext(c).
+		MakeService(&s.Service).
+		Bind(&req).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(400, err, err.Error())
+		return
+	}
+
+	resp, err := s.EditConfig(c, &req)
+	if err != nil {
+		if confirmationRequired(&e.Api, err) {
+			return
+		}
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	e.OK(resp, "NETCONF edit-config executed")
+}
+
+// Commit executes a NETCONF <commit>
+// @Summary NETCONF commit
+// @Description Commits the candidate datastore to the running configuration
+// @Tags device
+// @Accept json
+// @Produce json
+// @Param request body dto.NetconfCommitReq false "NETCONF commit request"
+// @Success 200 {object} response.Response{data=dto.NetconfReplyResp}
+// @Failure 400 {object} response.Response
+// @Failure 403 {object} response.Response "Operation denied by policy"
+// @Failure 428 {object} response.Response{data=device.ConfirmationRequiredError} "Operation requires confirmation, resubmit with confirmToken"
+// @Failure 429 {object} response.Response "Service busy, please try again later"
+// @Failure 500 {object} response.Response
+// @Router /api/v1/device/netconf/commit [post]
+// @Security Bearer
+func (e *NetconfAPI) Commit(c *gin.Context) {
+	req := dto.NetconfCommitReq{}
+	s := service.NetconfService{}
+	err := e.MakeContext(c).
+		MakeService(&s.Service).
+		Bind(&req).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(400, err, err.Error())
+		return
+	}
+
+	resp, err := s.Commit(c, &req)
+	if err != nil {
+		if confirmationRequired(&e.Api, err) {
+			return
+		}
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	e.OK(resp, "NETCONF commit executed")
+}
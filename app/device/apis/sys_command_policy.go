@@ -0,0 +1,188 @@
+package apis
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-admin-team/go-admin-core/sdk/api"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth/user"
+	_ "github.com/go-admin-team/go-admin-core/sdk/pkg/response"
+
+	"opt-switch/app/device/models"
+	"opt-switch/app/device/service"
+	"opt-switch/app/device/service/dto"
+)
+
+// SysCommandPolicy handles command policy rule maintenance
+type SysCommandPolicy struct {
+	api.Api
+}
+
+// GetPage
+// @Summary 命令策略列表
+// @Description 获取命令策略规则列表
+// @Tags 设备
+// @Param roleKey query string false "角色代码"
+// @Param action query string false "动作 allow/deny/confirm"
+// @Param status query int false "状态"
+// @Param pageSize query int false "页条数"
+// @Param pageIndex query int false "页码"
+// @Success 200 {object} response.Response{data=response.Page{list=[]models.SysCommandPolicy}} "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/command/policies [get]
+// @Security Bearer
+func (e SysCommandPolicy) GetPage(c *gin.Context) {
+	s := service.SysCommandPolicy{}
+	req := dto.SysCommandPolicyPageReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, binding.Form).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+
+	list := make([]models.SysCommandPolicy, 0)
+	var count int64
+
+	err = s.GetPage(&req, &list, &count)
+	if err != nil {
+		e.Error(500, err, "查询失败")
+		return
+	}
+
+	e.PageOK(list, int(count), req.GetPageIndex(), req.GetPageSize(), "查询成功")
+}
+
+// Get
+// @Summary 获取命令策略
+// @Description 获取命令策略规则
+// @Tags 设备
+// @Param id path int true "规则编码"
+// @Success 200 {object} response.Response{data=models.SysCommandPolicy} "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/command/policies/{id} [get]
+// @Security Bearer
+func (e SysCommandPolicy) Get(c *gin.Context) {
+	s := service.SysCommandPolicy{}
+	req := dto.SysCommandPolicyGetReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, nil).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+	var object models.SysCommandPolicy
+
+	err = s.Get(&req, &object)
+	if err != nil {
+		e.Error(500, err, fmt.Sprintf("命令策略获取失败！错误详情：%s", err.Error()))
+		return
+	}
+
+	e.OK(object, "查询成功")
+}
+
+// Insert
+// @Summary 添加命令策略
+// @Description 添加命令策略规则。同一角色（含*）的规则中 deny 优先于 confirm，confirm 优先于 allow；角色存在 allow 规则时，未匹配任何 allow 规则的命令被拒绝
+// @Description 终端（伪命令 [terminal]）中输入的命令无法逐条校验：角色存在不匹配 [terminal] 的 deny 或 allow 规则时，该角色不能打开终端；confirm 规则在终端内不生效
+// @Tags 设备
+// @Accept  application/json
+// @Product application/json
+// @Param data body dto.SysCommandPolicyInsertReq true "data"
+// @Success 200 {object} response.Response "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/command/policies [post]
+// @Security Bearer
+func (e SysCommandPolicy) Insert(c *gin.Context) {
+	s := service.SysCommandPolicy{}
+	req := dto.SysCommandPolicyInsertReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, binding.JSON).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+	req.SetCreateBy(user.GetUserId(c))
+	err = s.Insert(&req)
+	if err != nil {
+		e.Error(500, err, fmt.Sprintf("新建命令策略失败！错误详情：%s", err.Error()))
+		return
+	}
+	e.OK(req.GetId(), "创建成功")
+}
+
+// Update
+// @Summary 修改命令策略
+// @Description 修改命令策略规则
+// @Tags 设备
+// @Accept  application/json
+// @Product application/json
+// @Param id path int true "规则编码"
+// @Param data body dto.SysCommandPolicyUpdateReq true "body"
+// @Success 200 {object} response.Response "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/command/policies/{id} [put]
+// @Security Bearer
+func (e SysCommandPolicy) Update(c *gin.Context) {
+	s := service.SysCommandPolicy{}
+	req := dto.SysCommandPolicyUpdateReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, binding.JSON, nil).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+
+	req.SetUpdateBy(user.GetUserId(c))
+
+	err = s.Update(&req)
+	if err != nil {
+		e.Error(500, err, fmt.Sprintf("命令策略更新失败！错误详情：%s", err.Error()))
+		return
+	}
+	e.OK(req.GetId(), "更新成功")
+}
+
+// Delete
+// @Summary 删除命令策略
+// @Description 删除命令策略规则
+// @Tags 设备
+// @Param data body dto.SysCommandPolicyDeleteReq true "请求参数"
+// @Success 200 {object} response.Response "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/command/policies [delete]
+// @Security Bearer
+func (e SysCommandPolicy) Delete(c *gin.Context) {
+	s := service.SysCommandPolicy{}
+	req := dto.SysCommandPolicyDeleteReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, binding.JSON).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+	req.SetUpdateBy(user.GetUserId(c))
+	err = s.Remove(&req)
+	if err != nil {
+		e.Error(500, err, fmt.Sprintf("命令策略删除失败！错误详情：%s", err.Error()))
+		return
+	}
+	e.OK(req.GetId(), "删除成功")
+}
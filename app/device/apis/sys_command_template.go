@@ -0,0 +1,236 @@
+package apis
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-admin-team/go-admin-core/sdk/api"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth/user"
+	_ "github.com/go-admin-team/go-admin-core/sdk/pkg/response"
+
+	"opt-switch/app/device/models"
+	"opt-switch/app/device/service"
+	"opt-switch/app/device/service/dto"
+)
+
+// SysCommandTemplate handles command template maintenance and runs
+type SysCommandTemplate struct {
+	api.Api
+}
+
+// GetPage
+// @Summary 命令模板列表
+// @Description 获取命令模板列表
+// @Tags 设备
+// @Param templateId query int false "模板编码"
+// @Param name query string false "模板名称"
+// @Param status query int false "状态"
+// @Param pageSize query int false "页条数"
+// @Param pageIndex query int false "页码"
+// @Success 200 {object} response.Response{data=response.Page{list=[]models.SysCommandTemplate}} "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/command/templates [get]
+// @Security Bearer
+func (e SysCommandTemplate) GetPage(c *gin.Context) {
+	s := service.SysCommandTemplate{}
+	req := dto.SysCommandTemplatePageReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, binding.Form).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+
+	list := make([]models.SysCommandTemplate, 0)
+	var count int64
+
+	err = s.GetPage(&req, &list, &count)
+	if err != nil {
+		e.Error(500, err, "查询失败")
+		return
+	}
+
+	e.PageOK(list, int(count), req.GetPageIndex(), req.GetPageSize(), "查询成功")
+}
+
+// Get
+// @Summary 获取命令模板
+// @Description 获取命令模板
+// @Tags 设备
+// @Param id path int true "模板编码"
+// @Success 200 {object} response.Response{data=models.SysCommandTemplate} "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/command/templates/{id} [get]
+// @Security Bearer
+func (e SysCommandTemplate) Get(c *gin.Context) {
+	s := service.SysCommandTemplate{}
+	req := dto.SysCommandTemplateGetReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, nil).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+	var object models.SysCommandTemplate
+
+	err = s.Get(&req, &object)
+	if err != nil {
+		e.Error(500, err, fmt.Sprintf("命令模板获取失败！错误详情：%s", err.Error()))
+		return
+	}
+
+	e.OK(object, "查询成功")
+}
+
+// Insert
+// @Summary 添加命令模板
+// @Description 添加命令模板，模板内容为 Go text/template，渲染后每个非空行为一条命令；参数类型 string/int/enum/ipv4/cidr/interface
+// @Tags 设备
+// @Accept  application/json
+// @Product application/json
+// @Param data body dto.SysCommandTemplateInsertReq true "data"
+// @Success 200 {object} response.Response "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/command/templates [post]
+// @Security Bearer
+func (e SysCommandTemplate) Insert(c *gin.Context) {
+	s := service.SysCommandTemplate{}
+	req := dto.SysCommandTemplateInsertReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, binding.JSON).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+	req.SetCreateBy(user.GetUserId(c))
+	err = s.Insert(&req)
+	if err != nil {
+		e.Error(500, err, fmt.Sprintf("新建命令模板失败！错误详情：%s", err.Error()))
+		return
+	}
+	e.OK(req.GetId(), "创建成功")
+}
+
+// Update
+// @Summary 修改命令模板
+// @Description 修改命令模板
+// @Tags 设备
+// @Accept  application/json
+// @Product application/json
+// @Param id path int true "模板编码"
+// @Param data body dto.SysCommandTemplateUpdateReq true "body"
+// @Success 200 {object} response.Response "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/command/templates/{id} [put]
+// @Security Bearer
+func (e SysCommandTemplate) Update(c *gin.Context) {
+	s := service.SysCommandTemplate{}
+	req := dto.SysCommandTemplateUpdateReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, binding.JSON, nil).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+
+	req.SetUpdateBy(user.GetUserId(c))
+
+	err = s.Update(&req)
+	if err != nil {
+		e.Error(500, err, fmt.Sprintf("命令模板更新失败！错误详情：%s", err.Error()))
+		return
+	}
+	e.OK(req.GetId(), "更新成功")
+}
+
+// Delete
+// @Summary 删除命令模板
+// @Description 删除命令模板
+// @Tags 设备
+// @Param data body dto.SysCommandTemplateDeleteReq true "请求参数"
+// @Success 200 {object} response.Response "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/command/templates [delete]
+// @Security Bearer
+func (e SysCommandTemplate) Delete(c *gin.Context) {
+	s := service.SysCommandTemplate{}
+	req := dto.SysCommandTemplateDeleteReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, binding.JSON).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+	req.SetUpdateBy(user.GetUserId(c))
+	err = s.Remove(&req)
+	if err != nil {
+		e.Error(500, err, fmt.Sprintf("命令模板删除失败！错误详情：%s", err.Error()))
+		return
+	}
+	e.OK(req.GetId(), "删除成功")
+}
+
+// Run
+// @Summary 执行命令模板
+// @Description 校验参数并渲染模板，渲染出的命令按批量命令执行；dryRun 时仅返回渲染结果
+// @Tags 设备
+// @Accept  application/json
+// @Product application/json
+// @Param id path int true "模板编码"
+// @Param data body dto.CommandTemplateRunReq true "data"
+// @Success 200 {object} response.Response{data=dto.CommandTemplateRunResp} "{"code": 200, "data": [...]}"
+// @Failure 400 {object} response.Response "参数校验失败"
+// @Failure 403 {object} response.Response "命令被策略拒绝"
+// @Failure 428 {object} response.Response{data=device.ConfirmationRequiredError} "命令需要确认，请携带 confirmToken 重新提交"
+// @Failure 429 {object} response.Response "Service busy, please try again later"
+// @Router /api/v1/device/command/template/{id}/run [post]
+// @Security Bearer
+func (e SysCommandTemplate) Run(c *gin.Context) {
+	s := service.SysCommandTemplate{}
+	req := dto.CommandTemplateRunReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, binding.JSON, nil).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+
+	resp, err := s.Run(c, &req)
+	if err != nil {
+		if confirmationRequired(&e.Api, err) {
+			return
+		}
+		statusCode, msg := s.MapError(err)
+		if statusCode == 500 {
+			msg = fmt.Sprintf("命令模板执行失败！错误详情：%s", err.Error())
+		}
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	if req.DryRun {
+		e.OK(resp, "渲染成功")
+		return
+	}
+	e.OK(resp, "执行成功")
+}
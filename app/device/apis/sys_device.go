@@ -0,0 +1,188 @@
+package apis
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-admin-team/go-admin-core/sdk/api"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth/user"
+	_ "github.com/go-admin-team/go-admin-core/sdk/pkg/response"
+
+	"opt-switch/app/device/models"
+	"opt-switch/app/device/service"
+	"opt-switch/app/device/service/dto"
+)
+
+// SysDevice handles the device inventory
+type SysDevice struct {
+	api.Api
+}
+
+// GetPage
+// @Summary 设备列表数据
+// @Description 获取JSON
+// @Tags 设备
+// @Param name query string false "name"
+// @Param protocol query string false "protocol"
+// @Param host query string false "host"
+// @Param status query string false "status"
+// @Param pageSize query int false "页条数"
+// @Param pageIndex query int false "页码"
+// @Success 200 {object} response.Response{data=response.Page{list=[]models.SysDevice}} "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/inventory [get]
+// @Security Bearer
+func (e SysDevice) GetPage(c *gin.Context) {
+	s := service.SysDevice{}
+	req := dto.SysDevicePageReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, binding.Form).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+
+	list := make([]models.SysDevice, 0)
+	var count int64
+
+	err = s.GetPage(&req, &list, &count)
+	if err != nil {
+		e.Error(500, err, "查询失败")
+		return
+	}
+
+	e.PageOK(list, int(count), req.GetPageIndex(), req.GetPageSize(), "查询成功")
+}
+
+// Get
+// @Summary 获取设备信息
+// @Description 获取JSON
+// @Tags 设备
+// @Param id path int true "设备编码"
+// @Success 200 {object} response.Response{data=models.SysDevice} "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/inventory/{id} [get]
+// @Security Bearer
+func (e SysDevice) Get(c *gin.Context) {
+	s := service.SysDevice{}
+	req := dto.SysDeviceGetReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, nil).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+	var object models.SysDevice
+
+	err = s.Get(&req, &object)
+	if err != nil {
+		e.Error(500, err, fmt.Sprintf("设备信息获取失败！错误详情：%s", err.Error()))
+		return
+	}
+
+	e.OK(object, "查询成功")
+}
+
+// Insert
+// @Summary 添加设备
+// @Description 添加设备并启动其连接池
+// @Tags 设备
+// @Accept  application/json
+// @Product application/json
+// @Param data body dto.SysDeviceInsertReq true "data"
+// @Success 200 {object} response.Response "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/inventory [post]
+// @Security Bearer
+func (e SysDevice) Insert(c *gin.Context) {
+	s := service.SysDevice{}
+	req := dto.SysDeviceInsertReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, binding.JSON).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+	req.SetCreateBy(user.GetUserId(c))
+	err = s.Insert(&req)
+	if err != nil {
+		e.Error(500, err, fmt.Sprintf("新建设备失败！错误详情：%s", err.Error()))
+		return
+	}
+	e.OK(req.GetId(), "创建成功")
+}
+
+// Update
+// @Summary 修改设备
+// @Description 修改设备并重建其连接池，密码留空则不修改
+// @Tags 设备
+// @Accept  application/json
+// @Product application/json
+// @Param id path int true "设备编码"
+// @Param data body dto.SysDeviceUpdateReq true "body"
+// @Success 200 {object} response.Response "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/inventory/{id} [put]
+// @Security Bearer
+func (e SysDevice) Update(c *gin.Context) {
+	s := service.SysDevice{}
+	req := dto.SysDeviceUpdateReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, binding.JSON, nil).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+
+	req.SetUpdateBy(user.GetUserId(c))
+
+	err = s.Update(&req)
+	if err != nil {
+		e.Error(500, err, fmt.Sprintf("设备更新失败！错误详情：%s", err.Error()))
+		return
+	}
+	e.OK(req.GetId(), "更新成功")
+}
+
+// Delete
+// @Summary 删除设备
+// @Description 删除设备并停止其连接池
+// @Tags 设备
+// @Param data body dto.SysDeviceDeleteReq true "请求参数"
+// @Success 200 {object} response.Response "{"code": 200, "data": [...]}"
+// @Router /api/v1/device/inventory [delete]
+// @Security Bearer
+func (e SysDevice) Delete(c *gin.Context) {
+	s := service.SysDevice{}
+	req := dto.SysDeviceDeleteReq{}
+	err := e.MakeContext(c).
+		MakeOrm().
+		Bind(&req, binding.JSON).
+		MakeService(&s.Service).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(500, err, err.Error())
+		return
+	}
+	req.SetUpdateBy(user.GetUserId(c))
+	err = s.Remove(&req)
+	if err != nil {
+		e.Error(500, err, fmt.Sprintf("设备删除失败！错误详情：%s", err.Error()))
+		return
+	}
+	e.OK(req.GetId(), "删除成功")
+}
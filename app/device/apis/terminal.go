@@ -0,0 +1,118 @@
+package apis
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-admin-team/go-admin-core/sdk/api"
+	"github.com/gorilla/websocket"
+
+	"opt-switch/app/device/service"
+	"opt-switch/app/device/service/dto"
+	"opt-switch/pkg/device"
+)
+
+// terminalUpgrader upgrades terminal requests. The JWT middleware also
+// accepts the token from the jwt cookie, which browsers send along with
+// requests other sites make, so the origin of the page is checked as well.
+var terminalUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	CheckOrigin:     terminalOriginAllowed,
+}
+
+// terminalOriginAllowed accepts requests without an Origin header, which
+// browsers always send, requests from the origin of the server and requests
+// from the configured terminal.allowed_origins
+func terminalOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	if cfg := device.GetConfig(); cfg != nil {
+		for _, allowed := range cfg.Terminal.AllowedOrigins {
+			if strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TerminalAPI handles interactive terminal sessions
+type TerminalAPI struct {
+	api.Api
+}
+
+// Connect opens an interactive terminal over WebSocket
+// @Summary Interactive device terminal
+// @Description Upgrades to a WebSocket bridged to a shell on a dedicated device connection.
+// @Description Device output is sent as binary frames; the client sends JSON text frames
+// @Description {"type":"input","data":"..."} for keystrokes and {"type":"resize","cols":120,"rows":40} on resize.
+// @Description The command policy decides on the pseudo command [terminal]; the commands typed into the shell are not checked.
+// @Description Roles with deny or allow rules on other commands are therefore denied the terminal.
+// @Tags device
+// @Param deviceId query int false "Inventory device id, default device when omitted"
+// @Param cols query int false "Initial terminal width, default 80"
+// @Param rows query int false "Initial terminal height, default 24"
+// @Param token query string false "JWT, for browsers that cannot set the Authorization header"
+// @Param confirmToken query string false "Token returned when opening a terminal requires confirmation"
+// @Success 101 "Switching Protocols"
+// @Failure 400 {object} response.Response "Device protocol has no interactive terminal"
+// @Failure 403 {object} response.Response "Terminal denied by policy or origin not allowed"
+// @Failure 428 {object} response.Response{data=device.ConfirmationRequiredError} "Terminal requires confirmation, reconnect with confirmToken"
+// @Failure 429 {object} response.Response "Too many terminal sessions or service busy"
+// @Failure 503 {object} response.Response "Device connection failed"
+// @Router /ws/device/terminal [get]
+// @Security Bearer
+func (e *TerminalAPI) Connect(c *gin.Context) {
+	req := dto.TerminalReq{}
+	s := service.TerminalService{}
+	err := e.MakeContext(c).
+		MakeService(&s.Service).
+		Bind(&req).
+		Errors
+	if err != nil {
+		e.Logger.Error(err)
+		e.Error(400, err, err.Error())
+		return
+	}
+
+	// Upgrade checks the origin too, but only after a connection is checked out
+	if !terminalOriginAllowed(c.Request) {
+		err := errors.New("origin not allowed")
+		e.Error(403, err, "Origin not allowed: "+c.GetHeader("Origin"))
+		return
+	}
+
+	terminal, err := s.Open(c, &req)
+	if err != nil {
+		if confirmationRequired(&e.Api, err) {
+			return
+		}
+		statusCode, msg := s.MapError(err)
+		e.Error(statusCode, err, msg)
+		return
+	}
+
+	ws, err := terminalUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already written the HTTP error response
+		e.Logger.Errorf("terminal upgrade failed: %v", err)
+		terminal.Close()
+		return
+	}
+
+	terminal.Serve(ws)
+	e.Logger.Infof("terminal session %s closed", terminal.ID)
+}
@@ -0,0 +1,45 @@
+package apis
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTerminalOrigin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ws/device/terminal", (&TerminalAPI{}).Connect)
+
+	tests := []struct {
+		origin string
+		denied bool
+	}{
+		{"https://evil.example.com", true},
+		{"null", true},
+		{"http://switch.local:8000", false},
+		{"", false}, // not a browser
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://switch.local:8000/ws/device/terminal", nil)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var resp struct {
+			Code int `json:"code"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("origin %q: %v: %s", tt.origin, err, w.Body)
+		}
+		// allowed requests go on to open the terminal, which fails without a device
+		if denied := resp.Code == http.StatusForbidden; denied != tt.denied {
+			t.Errorf("origin %q: response %s, want denied %v", tt.origin, w.Body, tt.denied)
+		}
+	}
+}
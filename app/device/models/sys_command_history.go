@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"opt-switch/pkg/device"
+)
+
+// SysCommandHistory is an entry of the command execution log, kept in the
+// database so that the history can be filtered and counted
+type SysCommandHistory struct {
+	HistoryId  int       `json:"historyId" gorm:"primaryKey;autoIncrement;comment:记录编码"`
+	ExecutedAt time.Time `json:"executedAt" gorm:"index;comment:执行时间"`
+	DeviceId   int       `json:"deviceId" gorm:"index;comment:设备编码"`
+	UserId     string    `json:"userId" gorm:"size:64;index;comment:用户编码"`
+	Username   string    `json:"username" gorm:"size:128;index;comment:用户名"`
+	Command    string    `json:"command" gorm:"type:text;comment:命令"`
+	Output     string    `json:"output,omitempty" gorm:"type:text;comment:输出(log.include_output 开启时)"`
+	OutputSize int       `json:"outputSize" gorm:"comment:输出大小(字节)"`
+	Success    bool      `json:"success" gorm:"index;comment:是否成功"`
+	Error      string    `json:"error,omitempty" gorm:"type:text;comment:错误信息"`
+	Duration   int64     `json:"duration" gorm:"comment:耗时(毫秒)"`
+	ClientIp   string    `json:"clientIp" gorm:"size:64;index;comment:客户端IP"`
+	SessionId  string    `json:"sessionId" gorm:"size:64;index;comment:终端会话"`
+	Policy     string    `json:"policy" gorm:"size:16;comment:命令策略 deny/confirm"`
+}
+
+func (*SysCommandHistory) TableName() string {
+	return "sys_command_history"
+}
+
+// NewSysCommandHistory converts an execution log entry into a record
+func NewSysCommandHistory(log *device.ExecutionLog) SysCommandHistory {
+	return SysCommandHistory{
+		ExecutedAt: time.Unix(log.Timestamp, 0),
+		DeviceId:   log.DeviceID,
+		UserId:     log.UserID,
+		Username:   log.Username,
+		Command:    log.Command,
+		Output:     log.Output,
+		OutputSize: log.OutputSize,
+		Success:    log.Success,
+		Error:      log.Error,
+		Duration:   log.Duration,
+		ClientIp:   log.ClientIP,
+		SessionId:  log.SessionID,
+		Policy:     log.Policy,
+	}
+}
+
+// ExecutionLog converts the record into the device layer entry
+func (e *SysCommandHistory) ExecutionLog() device.ExecutionLog {
+	return device.ExecutionLog{
+		Timestamp:  e.ExecutedAt.Unix(),
+		DeviceID:   e.DeviceId,
+		UserID:     e.UserId,
+		Username:   e.Username,
+		Command:    e.Command,
+		Output:     e.Output,
+		OutputSize: e.OutputSize,
+		Success:    e.Success,
+		Error:      e.Error,
+		Duration:   e.Duration,
+		ClientIP:   e.ClientIp,
+		SessionID:  e.SessionId,
+		Policy:     e.Policy,
+	}
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"opt-switch/common/models"
+	"opt-switch/pkg/device"
+)
+
+const (
+	PolicyStatusDisabled = 1 // 停用
+	PolicyStatusEnabled  = 2 // 正常
+)
+
+// SysCommandPolicy is a command allow/deny rule of a Casbin role
+type SysCommandPolicy struct {
+	PolicyId int    `json:"policyId" gorm:"primaryKey;autoIncrement;comment:规则编码"`
+	RoleKey  string `json:"roleKey" gorm:"size:128;index;comment:角色代码，*为所有角色"`
+	Action   string `json:"action" gorm:"size:16;comment:动作 allow/deny/confirm"`
+	Pattern  string `json:"pattern" gorm:"size:255;comment:命令正则"`
+	Status   int    `json:"status" gorm:"size:1;comment:状态 1停用 2正常"`
+	Remark   string `json:"remark" gorm:"size:255;comment:备注"`
+	models.ControlBy
+	models.ModelTime
+}
+
+func (*SysCommandPolicy) TableName() string {
+	return "sys_command_policy"
+}
+
+func (e *SysCommandPolicy) Generate() models.ActiveRecord {
+	o := *e
+	return &o
+}
+
+func (e *SysCommandPolicy) GetId() interface{} {
+	return e.PolicyId
+}
+
+// Enabled reports whether the rule takes part in the policy
+func (e *SysCommandPolicy) Enabled() bool {
+	return e.Status != PolicyStatusDisabled
+}
+
+// PolicyRule converts the record into the device layer rule
+func (e *SysCommandPolicy) PolicyRule() device.PolicyRule {
+	return device.PolicyRule{
+		ID:      e.PolicyId,
+		RoleKey: e.RoleKey,
+		Action:  e.Action,
+		Pattern: e.Pattern,
+	}
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"opt-switch/common/models"
+	"opt-switch/pkg/device"
+)
+
+const (
+	TemplateStatusDisabled = 1 // 停用
+	TemplateStatusEnabled  = 2 // 正常
+)
+
+// SysCommandTemplate is a named CLI snippet operators run with typed parameters
+type SysCommandTemplate struct {
+	TemplateId  int                    `json:"templateId" gorm:"primaryKey;autoIncrement;comment:模板编码"`
+	Name        string                 `json:"name" gorm:"size:128;comment:模板名称"`
+	Description string                 `json:"description" gorm:"size:255;comment:描述"`
+	Body        string                 `json:"body" gorm:"type:text;comment:模板内容(text/template)"`
+	Params      []device.TemplateParam `json:"params" gorm:"type:text;serializer:json;comment:参数定义"`
+	Status      int                    `json:"status" gorm:"size:1;comment:状态 1停用 2正常"`
+	models.ControlBy
+	models.ModelTime
+}
+
+func (*SysCommandTemplate) TableName() string {
+	return "sys_command_template"
+}
+
+func (e *SysCommandTemplate) Generate() models.ActiveRecord {
+	o := *e
+	return &o
+}
+
+func (e *SysCommandTemplate) GetId() interface{} {
+	return e.TemplateId
+}
+
+// Enabled reports whether the template may be run
+func (e *SysCommandTemplate) Enabled() bool {
+	return e.Status != TemplateStatusDisabled
+}
+
+// CommandTemplate converts the record into the device layer template
+func (e *SysCommandTemplate) CommandTemplate() *device.CommandTemplate {
+	return &device.CommandTemplate{
+		Name:   e.Name,
+		Body:   e.Body,
+		Params: e.Params,
+	}
+}
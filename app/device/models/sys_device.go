@@ -0,0 +1,131 @@
+package models
+
+import (
+	"gorm.io/gorm"
+
+	"opt-switch/common/models"
+	"opt-switch/pkg/device"
+)
+
+const (
+	DeviceStatusDisabled = 1 // 停用
+	DeviceStatusEnabled  = 2 // 正常
+)
+
+// SysDevice is a switch managed by this instance
+type SysDevice struct {
+	DeviceId int    `json:"deviceId" gorm:"primaryKey;autoIncrement;comment:设备编码"`
+	Name     string `json:"name" gorm:"size:128;comment:设备名称"`
+	Protocol string `json:"protocol" gorm:"size:16;comment:连接协议"`
+	Vendor   string `json:"vendor" gorm:"size:32;comment:设备厂商"`
+	Host     string `json:"host" gorm:"size:128;comment:主机地址"`
+	Port     int    `json:"port" gorm:"comment:端口"`
+	Username string `json:"username" gorm:"size:64;comment:用户名"`
+	Password string `json:"-" gorm:"size:255;comment:密码"`
+	Timeout  int    `json:"timeout" gorm:"comment:连接超时(秒)"`
+	Status   int    `json:"status" gorm:"size:1;comment:状态 1停用 2正常"`
+	Remark   string `json:"remark" gorm:"size:255;comment:备注"`
+	// 特权模式（enable）密码，可为 encrypted: 密文，为空时使用登录密码
+	EnablePassword string `json:"-" gorm:"size:255;comment:特权密码"`
+	// SSH/NETCONF 私钥认证与主机密钥校验，私钥和口令可为 encrypted: 密文
+	PrivateKey           string `json:"-" gorm:"type:text;comment:私钥"`
+	PrivateKeyPassphrase string `json:"-" gorm:"size:255;comment:私钥口令"`
+	HostKeyPolicy        string `json:"hostKeyPolicy" gorm:"size:16;comment:主机密钥策略 tofu strict insecure"`
+	HostKeyFingerprint   string `json:"hostKeyFingerprint" gorm:"size:128;comment:固定主机密钥指纹"`
+	models.ControlBy
+	models.ModelTime
+}
+
+func (*SysDevice) TableName() string {
+	return "sys_device"
+}
+
+func (e *SysDevice) Generate() models.ActiveRecord {
+	o := *e
+	return &o
+}
+
+func (e *SysDevice) GetId() interface{} {
+	return e.DeviceId
+}
+
+func (e *SysDevice) BeforeCreate(_ *gorm.DB) error {
+	return e.Encrypt()
+}
+
+func (e *SysDevice) BeforeUpdate(_ *gorm.DB) error {
+	return e.Encrypt()
+}
+
+// secrets returns the credential fields of the device
+func (e *SysDevice) secrets() []*string {
+	return []*string{&e.Password, &e.EnablePassword, &e.PrivateKey, &e.PrivateKeyPassphrase}
+}
+
+// Encrypt encrypts the plain credentials of the device with the device
+// vault. Without an encryption key they are stored as entered.
+func (e *SysDevice) Encrypt() error {
+	vault, err := device.GetVault()
+	if err != nil {
+		return err
+	}
+	if !vault.CanEncrypt() {
+		return nil
+	}
+	for _, secret := range e.secrets() {
+		if *secret == "" || device.IsEncrypted(*secret) {
+			continue
+		}
+		if *secret, err = vault.Encrypt(*secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RotateSecrets re-encrypts the credentials of the device with the current
+// key of vault, encrypting plain ones, and reports whether any changed
+func (e *SysDevice) RotateSecrets(vault *device.Vault) (bool, error) {
+	changed := false
+	for _, secret := range e.secrets() {
+		if *secret == "" {
+			continue
+		}
+		var err error
+		rotated := true
+		if device.IsEncrypted(*secret) {
+			*secret, rotated, err = vault.Rotate(*secret)
+		} else {
+			*secret, err = vault.Encrypt(*secret)
+		}
+		if err != nil {
+			return false, err
+		}
+		changed = changed || rotated
+	}
+	return changed, nil
+}
+
+// Enabled reports whether the device should have a connection pool
+func (e *SysDevice) Enabled() bool {
+	return e.Status != DeviceStatusDisabled
+}
+
+// ConnectionConfig converts the device into the device layer connection settings
+func (e *SysDevice) ConnectionConfig() device.ConnectionConfig {
+	return device.ConnectionConfig{
+		Protocol: e.Protocol,
+		Vendor:   e.Vendor,
+		Host:     e.Host,
+		Port:     e.Port,
+		Username: e.Username,
+		Password: e.Password,
+		Timeout:  e.Timeout,
+
+		EnablePassword:       e.EnablePassword,
+		PrivateKey:           e.PrivateKey,
+		PrivateKeyPassphrase: e.PrivateKeyPassphrase,
+		HostKeyPolicy:        e.HostKeyPolicy,
+		HostKeyFingerprint:   e.HostKeyFingerprint,
+	}
+}
@@ -0,0 +1,34 @@
+package models
+
+import "opt-switch/common/models"
+
+const (
+	BackupSourceJob     = "job"     // 定时任务
+	BackupSourceManual  = "manual"  // 手动备份
+	BackupSourceRestore = "restore" // 恢复后校验
+)
+
+// SysDeviceConfigBackup is a snapshot of the running configuration of a device
+type SysDeviceConfigBackup struct {
+	BackupId int    `json:"backupId" gorm:"primaryKey;autoIncrement;comment:备份编码"`
+	DeviceId int    `json:"deviceId" gorm:"index;comment:设备编码"`
+	Hash     string `json:"hash" gorm:"size:64;index;comment:配置哈希(SHA-256)"`
+	Size     int    `json:"size" gorm:"comment:配置大小(字节)"`
+	Source   string `json:"source" gorm:"size:16;comment:来源 job/manual/restore"`
+	Content  string `json:"content,omitempty" gorm:"type:text;comment:配置内容"`
+	models.ControlBy
+	models.ModelTime
+}
+
+func (*SysDeviceConfigBackup) TableName() string {
+	return "sys_device_config_backup"
+}
+
+func (e *SysDeviceConfigBackup) Generate() models.ActiveRecord {
+	o := *e
+	return &o
+}
+
+func (e *SysDeviceConfigBackup) GetId() interface{} {
+	return e.BackupId
+}
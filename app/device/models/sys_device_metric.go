@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"opt-switch/pkg/device"
+)
+
+// SysDeviceMetric is a point of a switch telemetry series: a sample or the
+// aggregate of a 5 minute or hourly period
+type SysDeviceMetric struct {
+	MetricId    int64     `json:"metricId" gorm:"primaryKey;autoIncrement;comment:记录编码"`
+	DeviceId    int       `json:"deviceId" gorm:"index:idx_sys_device_metric_series,priority:1;comment:设备编码"`
+	Name        string    `json:"name" gorm:"size:64;index:idx_sys_device_metric_series,priority:2;comment:指标名称"`
+	Resolution  int       `json:"resolution" gorm:"index:idx_sys_device_metric_series,priority:3;index:idx_sys_device_metric_expiry,priority:1;comment:精度(秒) 0原始采样"`
+	SampledAt   time.Time `json:"sampledAt" gorm:"index:idx_sys_device_metric_series,priority:4;index:idx_sys_device_metric_expiry,priority:2;comment:采样时间或聚合周期开始"`
+	Label       string    `json:"label" gorm:"size:128;comment:实例(接口、传感器等)"`
+	SampleCount int64     `json:"sampleCount" gorm:"comment:采样数"`
+	ValueSum    float64   `json:"valueSum" gorm:"comment:采样值之和"`
+	ValueMin    float64   `json:"valueMin" gorm:"comment:最小值"`
+	ValueMax    float64   `json:"valueMax" gorm:"comment:最大值"`
+}
+
+func (*SysDeviceMetric) TableName() string {
+	return "sys_device_metric"
+}
+
+// NewSysDeviceMetric converts a telemetry point into a record
+func NewSysDeviceMetric(p *device.TelemetryPoint) SysDeviceMetric {
+	return SysDeviceMetric{
+		DeviceId:    p.DeviceID,
+		Name:        p.Name,
+		Resolution:  p.Resolution,
+		SampledAt:   p.Time,
+		Label:       p.Label,
+		SampleCount: p.Count,
+		ValueSum:    p.Sum,
+		ValueMin:    p.Min,
+		ValueMax:    p.Max,
+	}
+}
+
+// TelemetryPoint converts the record into the device layer point
+func (e *SysDeviceMetric) TelemetryPoint() device.TelemetryPoint {
+	return device.TelemetryPoint{
+		DeviceID:   e.DeviceId,
+		Name:       e.Name,
+		Label:      e.Label,
+		Resolution: e.Resolution,
+		Time:       e.SampledAt,
+		Count:      e.SampleCount,
+		Sum:        e.ValueSum,
+		Min:        e.ValueMin,
+		Max:        e.ValueMax,
+	}
+}
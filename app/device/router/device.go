@@ -1,10 +1,16 @@
 package router
 
 import (
+	"context"
+
 	"github.com/gin-gonic/gin"
+	"github.com/go-admin-team/go-admin-core/sdk"
+	jwt "github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth"
 	"go.uber.org/zap"
 
 	"opt-switch/app/device/apis"
+	"opt-switch/app/device/service"
+	"opt-switch/common/middleware"
 	"opt-switch/pkg/device"
 )
 
@@ -24,12 +30,149 @@ func InitDeviceService(log *zap.Logger) error {
 		return nil
 	}
 
+	loadInventory()
+	loadCommandPolicy()
+	loadHistoryStore()
+	loadTelemetryStore()
+
 	logger.Info("Device service initialized")
 	return nil
 }
 
+// loadInventory replaces the settings file device with the sys_device
+// inventory. Without a migrated database the settings file device is kept.
+func loadInventory() {
+	db := sdk.Runtime.GetDbByKey("*")
+	if db == nil {
+		return
+	}
+	if !db.Migrator().HasTable("sys_device") {
+		logger.Info("Device inventory table not found, using settings file device")
+		return
+	}
+
+	loaded, err := service.LoadInventory(db)
+	if err != nil {
+		logger.Warn("Failed to load part of the device inventory", zap.Error(err))
+	}
+	logger.Info("Device inventory loaded", zap.Int("devices", loaded))
+}
+
+// loadCommandPolicy installs the sys_command_policy rules. Without a migrated
+// database every command is allowed.
+func loadCommandPolicy() {
+	db := sdk.Runtime.GetDbByKey("*")
+	if db == nil || !db.Migrator().HasTable("sys_command_policy") {
+		logger.Warn("Command policy table not found, commands are not restricted")
+		return
+	}
+
+	if err := service.LoadCommandPolicy(db); err != nil {
+		// fail closed, a broken rule must not lift the restrictions
+		denyAll, _ := device.NewCommandPolicy([]device.PolicyRule{
+			{RoleKey: device.PolicyAnyRole, Action: device.PolicyDeny, Pattern: ".*"},
+		})
+		device.SetCommandPolicy(denyAll)
+		logger.Error("Failed to load command policy, denying all commands", zap.Error(err))
+		return
+	}
+	logger.Info("Command policy loaded")
+}
+
+// loadHistoryStore answers history queries from sys_command_history. The
+// first time the table is used the execution log is imported in the
+// background. Without a migrated database the log files are read instead.
+func loadHistoryStore() {
+	db := sdk.Runtime.GetDbByKey("*")
+	if db == nil || !db.Migrator().HasTable("sys_command_history") {
+		logger.Info("Command history table not found, reading history from the execution log")
+		return
+	}
+
+	cutoff, err := service.LoadHistoryStore(db)
+	if err != nil {
+		logger.Warn("Failed to load command history table, reading history from the execution log", zap.Error(err))
+		return
+	}
+	logger.Info("Command history table loaded")
+	if cutoff.IsZero() {
+		return
+	}
+
+	config := device.GetConfig().Log
+	go func() {
+		imported, err := service.ImportHistory(db, &config, cutoff)
+		if err != nil {
+			logger.Error("Failed to import execution log into command history", zap.Int("imported", imported), zap.Error(err))
+			return
+		}
+		logger.Info("Execution log imported into command history", zap.Int("entries", imported))
+	}()
+}
+
+// loadTelemetryStore stores the switch telemetry in sys_device_metric.
+// Without a migrated database nothing is collected.
+func loadTelemetryStore() {
+	db := sdk.Runtime.GetDbByKey("*")
+	if db == nil || !db.Migrator().HasTable("sys_device_metric") {
+		if device.GetConfig().Telemetry.Enabled {
+			logger.Warn("Telemetry table not found, switch telemetry is not collected")
+		}
+		return
+	}
+	service.LoadTelemetryStore(db)
+	logger.Info("Telemetry table loaded")
+}
+
 // InitDeviceRouter initializes device routes
-func InitDeviceRouter(router *gin.RouterGroup) {
+func InitDeviceRouter(router *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware) {
+	// Every device API requires authentication and a role granted the route
+	inventoryAPI := apis.SysDevice{}
+	backupAPI := apis.ConfigBackup{}
+	templateAPI := apis.SysCommandTemplate{}
+	policyAPI := apis.SysCommandPolicy{}
+	deviceGroup := router.Group("/api/v1/device")
+	deviceGroup.Use(authMiddleware.MiddlewareFunc()).Use(middleware.AuthCheckRole())
+	{
+		// Casbin matches paths with keyMatch2, so the inventory items live
+		// under their own prefix: /device/:id would also grant /device/config
+		inventoryGroup := deviceGroup.Group("/inventory")
+		{
+			inventoryGroup.GET("", inventoryAPI.GetPage)
+			inventoryGroup.GET("/:id", inventoryAPI.Get)
+			inventoryGroup.POST("", inventoryAPI.Insert)
+			inventoryGroup.PUT("/:id", inventoryAPI.Update)
+			inventoryGroup.DELETE("", inventoryAPI.Delete)
+		}
+
+		backupGroup := deviceGroup.Group("/config/backups")
+		{
+			backupGroup.GET("", backupAPI.GetPage)
+			backupGroup.GET("/diff", backupAPI.Diff)
+			backupGroup.GET("/:id", backupAPI.Get)
+			backupGroup.POST("", backupAPI.Capture)
+			backupGroup.POST("/:id/restore", backupAPI.Restore)
+		}
+
+		templateGroup := deviceGroup.Group("/command/templates")
+		{
+			templateGroup.GET("", templateAPI.GetPage)
+			templateGroup.GET("/:id", templateAPI.Get)
+			templateGroup.POST("", templateAPI.Insert)
+			templateGroup.PUT("/:id", templateAPI.Update)
+			templateGroup.DELETE("", templateAPI.Delete)
+		}
+
+		policyGroup := deviceGroup.Group("/command/policies")
+		{
+			policyGroup.GET("", policyAPI.GetPage)
+			policyGroup.GET("/:id", policyAPI.Get)
+			policyGroup.POST("", policyAPI.Insert)
+			policyGroup.PUT("/:id", policyAPI.Update)
+			policyGroup.DELETE("", policyAPI.Delete)
+		}
+	}
+
 	if !device.IsInitialized() {
 		// Device layer not initialized, skip routes
 		return
@@ -37,21 +180,60 @@ func InitDeviceRouter(router *gin.RouterGroup) {
 
 	commandAPI := &apis.CommandAPI{}
 
-	deviceRouter := router.Group("/device")
+	// Device info endpoint (no auth required for health check)
+	router.GET("/device", commandAPI.GetDeviceInfo)
+
+	// Interactive terminal, next to the ws.WebsocketManager routes
+	terminalAPI := &apis.TerminalAPI{}
+	router.Group("").Use(authMiddleware.MiddlewareFunc()).Use(middleware.AuthCheckRole()).
+		GET("/ws/device/terminal", terminalAPI.Connect)
+
+	commandGroup := deviceGroup.Group("/command")
 	{
-		// Device info endpoint (no auth required for health check)
-		deviceRouter.GET("", commandAPI.GetDeviceInfo)
+		commandGroup.POST("/execute", commandAPI.ExecuteCommand)
+		commandGroup.POST("/batch", commandAPI.ExecuteBatch)
+		commandGroup.GET("/history", commandAPI.GetHistory)
+		commandGroup.GET("/history/export", commandAPI.ExportHistory)
+		commandGroup.GET("/history/verify", commandAPI.VerifyLog)
+		commandGroup.POST("/template/:id/run", templateAPI.Run)
+		commandGroup.POST("/jobs", commandAPI.SubmitJob)
+		commandGroup.GET("/jobs/:id", commandAPI.GetJob)
+		commandGroup.POST("/jobs/:id/cancel", commandAPI.CancelJob)
+		commandGroup.GET("/jobs/:id/events", commandAPI.JobEvents)
+	}
 
-		// Command execution routes (require authentication)
-		commandGroup := deviceRouter.Group("/command")
-		{
-			commandGroup.POST("/execute", commandAPI.ExecuteCommand)
-			commandGroup.POST("/batch", commandAPI.ExecuteBatch)
-			commandGroup.GET("/history", commandAPI.GetHistory)
-		}
+	deviceGroup.GET("/status", commandAPI.GetStatus)
+	deviceGroup.GET("/metrics", commandAPI.GetMetrics)
 
-		// Device status route (require authentication)
-		deviceRouter.GET("/status", commandAPI.GetStatus)
+	hostKeyAPI := &apis.HostKeyAPI{}
+	hostKeyGroup := deviceGroup.Group("/hostkey")
+	{
+		hostKeyGroup.GET("", hostKeyAPI.Get)
+		hostKeyGroup.POST("/accept", hostKeyAPI.Accept)
+		hostKeyGroup.DELETE("", hostKeyAPI.Forget)
+	}
+
+	configAPI := &apis.DeviceConfigAPI{}
+	deviceGroup.PUT("/config", configAPI.Reload)
+	deviceGroup.GET("/config/reload", configAPI.LastReload)
+
+	// NETCONF routes (protocol must be netconf)
+	netconfAPI := &apis.NetconfAPI{}
+	netconfGroup := deviceGroup.Group("/netconf")
+	{
+		netconfGroup.GET("/capabilities", netconfAPI.GetCapabilities)
+		netconfGroup.POST("/get", netconfAPI.Get)
+		netconfGroup.POST("/get-config", netconfAPI.GetConfig)
+		netconfGroup.POST("/edit-config", netconfAPI.EditConfig)
+		netconfGroup.POST("/commit", netconfAPI.Commit)
+	}
+}
+
+// WatchSettings reloads the device configuration when the settings file
+// changes, until ctx is done. See device.WatchSettings.
+func WatchSettings(ctx context.Context, path string) {
+	if logger != nil {
+		device.WatchSettings(ctx, path, logger)
 	}
 }
 
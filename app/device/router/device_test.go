@@ -0,0 +1,144 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/gin-gonic/gin"
+	coreLogger "github.com/go-admin-team/go-admin-core/logger"
+	"github.com/go-admin-team/go-admin-core/sdk"
+	jwt "github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth"
+	"go.uber.org/zap"
+
+	"opt-switch/common/middleware/handler"
+	"opt-switch/config"
+	"opt-switch/pkg/device"
+)
+
+// casbinModel is the model of go-admin's casbin setup
+const casbinModel = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && (keyMatch2(r.obj, p.obj) || keyMatch(r.obj, p.obj)) && (r.act == p.act || p.act == "*")
+`
+
+// newTestRouter returns the device routes behind JWT authentication and an
+// enforcer granting the editor role the inventory item routes only
+func newTestRouter(t *testing.T) (*gin.Engine, *jwt.GinJWTMiddleware) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	dir := t.TempDir()
+	config.ExtConfig.Device = config.DeviceConfig{
+		Connection: config.DeviceConnectionConfig{
+			Protocol: "ssh", Host: "192.0.2.1", Port: 22, Username: "admin", Password: "admin",
+		},
+		Log: config.DeviceLogConfig{Enabled: true, File: filepath.Join(dir, "device.log")},
+	}
+	if err := device.Initialize(zap.NewNop()); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := model.NewModelFromString(casbinModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enforcer, err := casbin.NewSyncedEnforcer(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range [][]string{
+		{"editor", "/api/v1/device/inventory/:id", "GET"},
+		{"editor", "/api/v1/device/inventory/:id", "PUT"},
+	} {
+		if _, err := enforcer.AddPolicy(p[0], p[1], p[2]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sdk.Runtime.SetCasbin("*", enforcer)
+	sdk.Runtime.SetLogger(coreLogger.DefaultLogger)
+
+	auth, err := jwt.New(&jwt.GinJWTMiddleware{
+		Realm:           "test zone",
+		Key:             []byte("secret"),
+		Timeout:         time.Hour,
+		PayloadFunc:     handler.PayloadFunc,
+		IdentityHandler: handler.IdentityHandler,
+		Authorizator:    handler.Authorizator,
+		Unauthorized:    handler.Unauthorized,
+		TokenLookup:     "header: Authorization",
+		TokenHeadName:   "Bearer",
+		TimeFunc:        time.Now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	InitDeviceRouter(&r.RouterGroup, auth)
+	return r, auth
+}
+
+func TestDeviceRoutesRequireRole(t *testing.T) {
+	r, auth := newTestRouter(t)
+	token, _, err := auth.TokenGenerator(map[string]interface{}{
+		"user": handler.SysUser{UserId: 2, Username: "editor"},
+		"role": handler.SysRole{RoleId: 2, RoleKey: "editor"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := func(method, path, token string) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp struct {
+			Code int `json:"code"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, path, err, w.Body)
+		}
+		return resp.Code
+	}
+
+	routes := []struct{ method, path string }{
+		{http.MethodPost, "/api/v1/device/command/execute"},
+		{http.MethodPost, "/api/v1/device/command/batch"},
+		{http.MethodGet, "/api/v1/device/command/history"},
+		{http.MethodPut, "/api/v1/device/config"},
+		{http.MethodGet, "/api/v1/device/status"},
+		{http.MethodGet, "/api/v1/device/hostkey"},
+	}
+	for _, route := range routes {
+		if got := code(route.method, route.path, ""); got != http.StatusUnauthorized {
+			t.Errorf("%s %s without token: code %d, want 401", route.method, route.path, got)
+		}
+		// the inventory item policies do not grant the singleton routes
+		if got := code(route.method, route.path, token); got != http.StatusForbidden {
+			t.Errorf("%s %s as editor: code %d, want 403", route.method, route.path, got)
+		}
+	}
+
+	if got := code(http.MethodPut, "/api/v1/device/inventory/2", token); got == http.StatusForbidden || got == http.StatusUnauthorized {
+		t.Errorf("granted inventory route: code %d", got)
+	}
+}
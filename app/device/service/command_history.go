@@ -0,0 +1,192 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"opt-switch/app/device/models"
+	"opt-switch/pkg/device"
+)
+
+const historyImportBatch = 500
+
+// likeEscaper escapes the LIKE wildcards of a substring, '!' is the escape
+// character on every supported database
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// historyStore keeps the command history in sys_command_history
+type historyStore struct {
+	db *gorm.DB
+}
+
+// Append stores a batch of execution log entries
+func (s *historyStore) Append(entries []device.ExecutionLog) error {
+	records := make([]models.SysCommandHistory, len(entries))
+	for i := range entries {
+		records[i] = models.NewSysCommandHistory(&entries[i])
+	}
+	return s.db.CreateInBatches(records, historyImportBatch).Error
+}
+
+// filter selects the rows matching q, except for the command regex which is
+// not portable SQL
+func (s *historyStore) filter(q *device.HistoryQuery) *gorm.DB {
+	db := s.db.Model(&models.SysCommandHistory{})
+	if q.DeviceID != 0 {
+		db = db.Where("device_id = ?", q.DeviceID)
+	}
+	if q.UserID != "" {
+		db = db.Where("user_id = ?", q.UserID)
+	}
+	if q.Username != "" {
+		db = db.Where("username = ?", q.Username)
+	}
+	if q.ClientIP != "" {
+		db = db.Where("client_ip = ?", q.ClientIP)
+	}
+	if q.SessionID != "" {
+		db = db.Where("session_id = ?", q.SessionID)
+	}
+	if q.Success != nil {
+		db = db.Where("success = ?", *q.Success)
+	}
+	if !q.Since.IsZero() {
+		db = db.Where("executed_at >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		db = db.Where("executed_at <= ?", q.Until)
+	}
+	if q.Command != "" {
+		db = db.Where("command LIKE ? ESCAPE '!'", "%"+likeEscaper.Replace(q.Command)+"%")
+	}
+	return db.Session(&gorm.Session{})
+}
+
+// Query returns a page of the matching entries, newest first, and their
+// total. The command regex is applied while reading the rows the other
+// filters select.
+func (s *historyStore) Query(q *device.HistoryQuery) ([]device.ExecutionLog, int64, error) {
+	db := s.filter(q)
+	ordered := db.Order("executed_at DESC").Order("history_id DESC")
+
+	list := []device.ExecutionLog{}
+	var total int64
+	if q.CommandRegex == "" {
+		if err := db.Count(&total).Error; err != nil {
+			return nil, 0, err
+		}
+		var records []models.SysCommandHistory
+		if err := ordered.Offset(q.Offset).Limit(q.Limit).Find(&records).Error; err != nil {
+			return nil, 0, err
+		}
+		for i := range records {
+			list = append(list, records[i].ExecutionLog())
+		}
+		return list, total, nil
+	}
+
+	for offset := 0; ; offset += historyImportBatch {
+		var records []models.SysCommandHistory
+		if err := ordered.Offset(offset).Limit(historyImportBatch).Find(&records).Error; err != nil {
+			return nil, 0, err
+		}
+		for i := range records {
+			if !q.MatchCommand(records[i].Command) {
+				continue
+			}
+			if total >= int64(q.Offset) && len(list) < q.Limit {
+				list = append(list, records[i].ExecutionLog())
+			}
+			total++
+		}
+		if len(records) < historyImportBatch {
+			return list, total, nil
+		}
+	}
+}
+
+// Scan calls fn for every matching entry, oldest first. The rows are read
+// in batches continuing after the last row read, so that an export neither
+// holds a query open nor skips rows added meanwhile.
+func (s *historyStore) Scan(q *device.HistoryQuery, fn func(device.ExecutionLog) error) error {
+	db := s.filter(q)
+	var last *models.SysCommandHistory
+	for {
+		batch := db
+		if last != nil {
+			batch = batch.Where("executed_at > ? OR (executed_at = ? AND history_id > ?)",
+				last.ExecutedAt, last.ExecutedAt, last.HistoryId)
+		}
+		var records []models.SysCommandHistory
+		err := batch.Order("executed_at").Order("history_id").Limit(historyImportBatch).Find(&records).Error
+		if err != nil {
+			return err
+		}
+		for i := range records {
+			if !q.MatchCommand(records[i].Command) {
+				continue
+			}
+			if err := fn(records[i].ExecutionLog()); err != nil {
+				return err
+			}
+		}
+		if len(records) < historyImportBatch {
+			return nil
+		}
+		last = &records[len(records)-1]
+	}
+}
+
+// LoadHistoryStore installs sys_command_history as the command history of
+// the device layer. It returns the time before which the execution log still
+// has to be imported, zero when the table already holds the history.
+func LoadHistoryStore(db *gorm.DB) (time.Time, error) {
+	var count int64
+	if err := db.Model(&models.SysCommandHistory{}).Count(&count).Error; err != nil {
+		return time.Time{}, err
+	}
+
+	var cutoff time.Time
+	if count == 0 {
+		cutoff = time.Now()
+	}
+	device.SetHistoryStore(&historyStore{db: db})
+	return cutoff, nil
+}
+
+// ImportHistory copies the entries of the execution log and its rotated
+// backups written before cutoff into sys_command_history. Later entries
+// reach the table through the history store.
+func ImportHistory(db *gorm.DB, config *device.LogConfig, cutoff time.Time) (int, error) {
+	store := &historyStore{db: db}
+	imported := 0
+	batch := make([]device.ExecutionLog, 0, historyImportBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := store.Append(batch); err != nil {
+			return err
+		}
+		imported += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	err := device.ReadHistory(config, func(entry device.ExecutionLog) error {
+		if entry.Timestamp >= cutoff.Unix() {
+			return nil
+		}
+		batch = append(batch, entry)
+		if len(batch) == historyImportBatch {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return imported, err
+	}
+	return imported, flush()
+}
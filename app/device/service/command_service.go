@@ -3,9 +3,11 @@ package service
 import (
 	"context"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth/user"
 
 	"opt-switch/app/device/service/dto"
 	"opt-switch/pkg/device"
@@ -25,18 +27,28 @@ func NewCommandService() *CommandService {
 
 // ExecuteCommand executes a single command
 func (s *CommandService) ExecuteCommand(c *gin.Context, req *dto.CommandExecuteReq) (*dto.CommandExecuteResp, error) {
+	deviceID, pool, err := s.resolveDevice(req.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get timeout from request or config
-	timeout := time.Duration(device.GetConfig().Pool.CommandTimeout) * time.Second
+	timeout := time.Duration(pool.Config().Pool.CommandTimeout) * time.Second
 	if req.Timeout > 0 {
 		timeout = time.Duration(req.Timeout) * time.Second
 	}
 
-	// Extract user info for logging
+	// Extract user info for logging and the command policy
 	userID, username, clientIP := s.extractUserInfo(c)
 
 	// Execute command
-	ctx := context.Background()
-	results, err := device.GetPool().Execute(ctx, []string{req.Command}, timeout)
+	priority, err := device.ParsePriority(req.Priority, device.PriorityInteractive)
+	if err != nil {
+		return nil, err
+	}
+	ctx := device.WithPrincipal(c.Request.Context(), s.principal(c, req.ConfirmToken))
+	ctx = device.WithPriority(ctx, priority)
+	results, err := pool.Execute(ctx, []string{req.Command}, timeout)
 	if err != nil {
 		s.Log.Errorf("Failed to execute command: %v", err)
 		return nil, err
@@ -51,7 +63,7 @@ func (s *CommandService) ExecuteCommand(c *gin.Context, req *dto.CommandExecuteR
 	// Log execution asynchronously
 	go func() {
 		if device.GetLogger() != nil {
-			_ = device.GetLogger().LogFromResult(result, userID, username, clientIP)
+			_ = device.GetLogger().LogFromResult(result, deviceID, userID, username, clientIP)
 		}
 	}()
 
@@ -63,24 +75,37 @@ func (s *CommandService) ExecuteCommand(c *gin.Context, req *dto.CommandExecuteR
 		Duration: result.Duration,
 		Error:    result.Error,
 	}
+	if req.Parse {
+		parseResult(pool, resp)
+	}
 
 	return resp, nil
 }
 
 // ExecuteBatch executes multiple commands
 func (s *CommandService) ExecuteBatch(c *gin.Context, req *dto.BatchCommandReq) (*dto.BatchCommandResp, error) {
+	deviceID, pool, err := s.resolveDevice(req.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get timeout from request or config
-	timeout := time.Duration(device.GetConfig().Pool.CommandTimeout) * time.Second
+	timeout := time.Duration(pool.Config().Pool.CommandTimeout) * time.Second
 	if req.Timeout > 0 {
 		timeout = time.Duration(req.Timeout) * time.Second
 	}
 
-	// Extract user info for logging
+	// Extract user info for logging and the command policy
 	userID, username, clientIP := s.extractUserInfo(c)
 
 	// Execute commands
-	ctx := context.Background()
-	results, err := device.GetPool().Execute(ctx, req.Commands, timeout)
+	priority, err := device.ParsePriority(req.Priority, device.PriorityInteractive)
+	if err != nil {
+		return nil, err
+	}
+	ctx := device.WithPrincipal(c.Request.Context(), s.principal(c, req.ConfirmToken))
+	ctx = device.WithPriority(ctx, priority)
+	results, err := pool.Execute(ctx, req.Commands, timeout)
 	if err != nil {
 		s.Log.Errorf("Failed to execute batch commands: %v", err)
 		return nil, err
@@ -90,7 +115,7 @@ func (s *CommandService) ExecuteBatch(c *gin.Context, req *dto.BatchCommandReq)
 	go func() {
 		if device.GetLogger() != nil {
 			for _, result := range results {
-				_ = device.GetLogger().LogFromResult(result, userID, username, clientIP)
+				_ = device.GetLogger().LogFromResult(result, deviceID, userID, username, clientIP)
 			}
 		}
 	}()
@@ -108,6 +133,9 @@ func (s *CommandService) ExecuteBatch(c *gin.Context, req *dto.BatchCommandReq)
 			Duration: result.Duration,
 			Error:    result.Error,
 		}
+		if req.Parse {
+			parseResult(pool, &respResults[i])
+		}
 		if result.Success {
 			successCount++
 		} else {
@@ -123,51 +151,148 @@ func (s *CommandService) ExecuteBatch(c *gin.Context, req *dto.BatchCommandReq)
 	}, nil
 }
 
-// GetHistory retrieves command execution history
+// parseResult fills in the structured output of a successful command. The raw
+// output is kept, commands without parser or with unexpected output report why
+// in ParseError instead of failing the request.
+func parseResult(pool *device.ConnectionPool, resp *dto.CommandExecuteResp) {
+	if !resp.Success {
+		return
+	}
+	parsed, err := device.ParseOutput(pool.Config().Connection.Vendor, resp.Command, resp.Output)
+	if err != nil {
+		resp.ParseError = err.Error()
+		return
+	}
+	resp.Parsed = parsed
+}
+
+// GetHistory retrieves a page of the command execution history
 func (s *CommandService) GetHistory(req *dto.CommandHistoryReq) (*dto.CommandHistoryResp, error) {
+	resp := &dto.CommandHistoryResp{
+		History: []dto.CommandHistoryItem{},
+		Limit:   req.Limit,
+		Offset:  req.Offset,
+	}
 	logger := device.GetLogger()
 	if logger == nil {
-		return &dto.CommandHistoryResp{
-			History: []dto.CommandHistoryItem{},
-			Total:   0,
-			Limit:   req.Limit,
-			Offset:  req.Offset,
-		}, nil
+		return resp, nil
 	}
 
-	logs, err := logger.GetHistory(req.Limit, req.Offset)
+	logs, total, err := logger.GetHistory(req.HistoryQuery())
 	if err != nil {
 		s.Log.Errorf("Failed to get command history: %v", err)
 		return nil, err
 	}
 
 	// Map logs to response
-	history := make([]dto.CommandHistoryItem, len(logs))
-	for i, log := range logs {
-		history[i] = dto.CommandHistoryItem{
+	for _, log := range logs {
+		resp.History = append(resp.History, dto.CommandHistoryItem{
 			Timestamp: log.Timestamp,
+			DeviceID:  log.DeviceID,
 			UserID:    log.UserID,
 			Username:  log.Username,
 			Command:   log.Command,
+			Output:    log.Output,
 			Success:   log.Success,
+			Error:     log.Error,
 			Duration:  log.Duration,
 			ClientIP:  log.ClientIP,
-		}
+			SessionID: log.SessionID,
+			Policy:    log.Policy,
+		})
 	}
+	resp.Total = total
 
-	return &dto.CommandHistoryResp{
-		History: history,
-		Total:   len(history),
-		Limit:   req.Limit,
-		Offset:  req.Offset,
-	}, nil
+	return resp, nil
+}
+
+// HistoryExport is a checked export request of the command history
+type HistoryExport struct {
+	format string
+	query  *device.HistoryQuery
+	logger *device.ExecutionLogger
+}
+
+// PrepareHistoryExport checks an export request, so that invalid parameters
+// are reported before the download starts
+func (s *CommandService) PrepareHistoryExport(req *dto.CommandHistoryExportReq) (*HistoryExport, error) {
+	logger := device.GetLogger()
+	if logger == nil {
+		return nil, device.NewDeviceNotConfiguredError()
+	}
+	q, err := req.HistoryQuery()
+	if err != nil {
+		return nil, err
+	}
+	if err := q.Compile(); err != nil {
+		return nil, err
+	}
+	format := req.Format
+	if format == "" {
+		format = device.ExportCSV
+	}
+	return &HistoryExport{format: format, query: q, logger: logger}, nil
+}
+
+// ContentType returns the media type of the export
+func (x *HistoryExport) ContentType() string {
+	return device.ExportContentType(x.format)
+}
+
+// FileName returns the suggested name of the downloaded file
+func (x *HistoryExport) FileName() string {
+	return "command-history-" + time.Now().Format("20060102-150405") + "." + x.format
+}
+
+// Write streams the matching entries to w, oldest first, and returns how
+// many were written
+func (x *HistoryExport) Write(w io.Writer) (int, error) {
+	enc, err := device.NewHistoryEncoder(x.format, w)
+	if err != nil {
+		return 0, err
+	}
+	written := 0
+	err = x.logger.ScanHistory(x.query, func(entry device.ExecutionLog) error {
+		written++
+		return enc.Encode(&entry)
+	})
+	if err != nil {
+		return written, err
+	}
+	return written, enc.Flush()
+}
+
+// VerifyLog checks the hash chain of the execution log
+func (s *CommandService) VerifyLog() (*device.ChainVerification, error) {
+	logger := device.GetLogger()
+	if logger == nil {
+		return nil, device.NewDeviceNotConfiguredError()
+	}
+	result, err := logger.VerifyChain()
+	if err != nil {
+		return nil, err
+	}
+	if !result.Valid {
+		s.Log.Warnf("Execution log hash chain broken: %s line %d: %s", result.Break.File, result.Break.Line, result.Break.Reason)
+	}
+	return result, nil
+}
+
+// GetMetrics returns a switch telemetry series for charts
+func (s *CommandService) GetMetrics(req *dto.DeviceMetricsReq) (*device.TelemetryResult, error) {
+	q, err := req.TelemetryQuery()
+	if err != nil {
+		return nil, err
+	}
+	return device.QueryTelemetry(q)
 }
 
 // GetStatus returns the device connection status
-func (s *CommandService) GetStatus() *dto.DeviceStatusResp {
-	pool := device.GetPool()
-	if pool == nil {
+func (s *CommandService) GetStatus(req *dto.DeviceStatusReq) *dto.DeviceStatusResp {
+	deviceID, pool, err := s.resolveDevice(req.DeviceID)
+	if err != nil {
 		return &dto.DeviceStatusResp{
+			DeviceID:  deviceID,
 			Connected: false,
 		}
 	}
@@ -204,52 +329,138 @@ func (s *CommandService) GetStatus() *dto.DeviceStatusResp {
 		maxQueue = v
 	}
 
+	queued, _ := status["queued_tasks"].([]device.QueuedTask)
+	if queued == nil {
+		queued = []device.QueuedTask{}
+	}
+	waits, _ := status["wait_stats"].(map[string]device.WaitStats)
+	conns, _ := status["connections"].([]device.ConnectionHealth)
+
 	return &dto.DeviceStatusResp{
+		DeviceID:          deviceID,
 		Connected:         connected,
 		TotalConnections:  totalConns,
 		ActiveConnections: activeConns,
 		QueueSize:         queueSize,
 		MaxConnections:    maxConns,
 		MaxQueueSize:      maxQueue,
+		QueuedTasks:       queued,
+		WaitStats:         waits,
+		Connections:       conns,
+		DroppedLogEntries: device.DroppedLogEntries(),
 	}
 }
 
-// extractUserInfo extracts user information from gin context
-func (s *CommandService) extractUserInfo(c *gin.Context) (userID, username, clientIP string) {
-	// Get user ID from context (set by auth middleware)
-	if userIDVal, exists := c.Get("user_id"); exists {
-		if id, ok := userIDVal.(string); ok {
-			userID = id
-		}
+// SubmitJob queues commands as an asynchronous job and returns it before the
+// commands run. Policy denials and confirmations are reported right away.
+func (s *CommandService) SubmitJob(c *gin.Context, req *dto.CommandJobReq) (*device.JobSnapshot, error) {
+	deviceID, pool, err := s.resolveDevice(req.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	jobs := device.GetJobManager()
+	if jobs == nil {
+		return nil, device.NewDeviceNotConfiguredError()
 	}
 
-	// Get username from context
-	if usernameVal, exists := c.Get("username"); exists {
-		if name, ok := usernameVal.(string); ok {
-			username = name
-		}
+	timeout := time.Duration(pool.Config().Pool.CommandTimeout) * time.Second
+	if req.Timeout > 0 {
+		timeout = time.Duration(req.Timeout) * time.Second
+	}
+
+	priority, err := device.ParsePriority(req.Priority, device.PriorityBulk)
+	if err != nil {
+		return nil, err
+	}
+	ctx := device.WithPrincipal(context.Background(), s.principal(c, req.ConfirmToken))
+	ctx = device.WithPriority(ctx, priority)
+	job, err := jobs.Submit(ctx, deviceID, pool, req.Commands, timeout)
+	if err != nil {
+		s.Log.Errorf("Failed to submit command job: %v", err)
+		return nil, err
+	}
+	snapshot := job.Snapshot()
+	return &snapshot, nil
+}
+
+// GetJob returns a job of the caller. Jobs of other users are reported as
+// not found, except to admins.
+func (s *CommandService) GetJob(c *gin.Context, id string) (*device.Job, error) {
+	jobs := device.GetJobManager()
+	if jobs == nil {
+		return nil, device.NewDeviceNotConfiguredError()
+	}
+	job, err := jobs.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID() != user.GetUserIdStr(c) && user.GetRoleName(c) != "admin" {
+		return nil, device.NewJobNotFoundError(id)
 	}
+	return job, nil
+}
 
-	// Get client IP
-	clientIP = c.ClientIP()
+// CancelJob cancels a job of the caller
+func (s *CommandService) CancelJob(c *gin.Context, id string) (*device.JobSnapshot, error) {
+	job, err := s.GetJob(c, id)
+	if err != nil {
+		return nil, err
+	}
+	job.Cancel()
+	snapshot := job.Snapshot()
+	return &snapshot, nil
+}
 
-	return
+// resolveDevice returns the effective device id and its connection pool.
+// id 0 selects the default device.
+func (s *CommandService) resolveDevice(id int) (int, *device.ConnectionPool, error) {
+	if id == 0 {
+		id = device.DefaultDeviceID
+	}
+	pool, err := device.GetDevicePool(id)
+	return id, pool, err
+}
+
+// extractUserInfo extracts user information from the JWT claims
+func (s *CommandService) extractUserInfo(c *gin.Context) (userID, username, clientIP string) {
+	return user.GetUserIdStr(c), user.GetUserName(c), c.ClientIP()
+}
+
+// principal identifies the caller to the command policy by the Casbin role
+// key of the JWT claims
+func (s *CommandService) principal(c *gin.Context, confirmToken string) *device.Principal {
+	userID, username, clientIP := s.extractUserInfo(c)
+	return &device.Principal{
+		UserID:       userID,
+		Username:     username,
+		RoleKey:      user.GetRoleName(c),
+		ClientIP:     clientIP,
+		ConfirmToken: confirmToken,
+	}
 }
 
 // MapError maps device errors to response messages
 func (s *CommandService) MapError(err error) (int, string) {
 	if deviceErr, ok := err.(*device.DeviceError); ok {
 		switch deviceErr.Code {
-		case device.ErrConnectionFailed, device.ErrAuthFailed, device.ErrConnectionClosed:
+		case device.ErrConnectionFailed, device.ErrAuthFailed, device.ErrConnectionClosed, device.ErrHostKeyMismatch:
 			return 503, "Device connection failed: " + err.Error()
 		case device.ErrQueueFull, device.ErrQueueTimeout:
 			return 429, "Service busy, please try again later"
+		case device.ErrSessionLimit:
+			return 429, err.Error()
 		case device.ErrCommandTimeout:
 			return 504, "Command execution timeout"
 		case device.ErrCommandFailed:
 			return 500, "Command execution failed"
+		case device.ErrNotSupported, device.ErrInvalidParam, device.ErrInvalidTemplate:
+			return 400, err.Error()
+		case device.ErrCommandDenied:
+			return 403, err.Error()
 		case device.ErrInvalidConfig, device.ErrDeviceNotConfigured:
 			return 500, "Device configuration error"
+		case device.ErrDeviceNotFound, device.ErrJobNotFound:
+			return 404, err.Error()
 		}
 	}
 
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"opt-switch/app/device/models"
+	"opt-switch/app/device/service/dto"
+	cDto "opt-switch/common/dto"
+	"opt-switch/pkg/device"
+)
+
+// ConfigBackup captures, stores and compares running configuration snapshots
+type ConfigBackup struct {
+	CommandService
+}
+
+// Capture runs the backup command on a device and stores the output unless it
+// matches the latest snapshot of that device. userID and username identify the
+// initiator in the execution log. The end of ctx cancels the backup command.
+func (e *ConfigBackup) Capture(ctx context.Context, deviceID int, source string, userID int, username string) (*dto.ConfigBackupCaptureResp, error) {
+	deviceID, pool, err := e.resolveDevice(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	cfg := pool.Config()
+
+	timeout := time.Duration(cfg.Pool.CommandTimeout) * time.Second
+	results, err := pool.Execute(ctx, []string{cfg.Backup.Command}, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no result returned")
+	}
+	result := results[0]
+
+	if device.GetLogger() != nil {
+		_ = device.GetLogger().LogFromResult(result, deviceID, fmt.Sprint(userID), username, "")
+	}
+	if !result.Success {
+		return nil, device.NewCommandFailedError(errors.New(result.Error))
+	}
+
+	content := device.NormalizeConfig(result.Output)
+	if content == "" {
+		return nil, device.NewCommandFailedError(fmt.Errorf("%q returned no configuration", cfg.Backup.Command))
+	}
+	return e.store(deviceID, content, source, userID, cfg.Backup.IgnorePatterns)
+}
+
+// store saves a normalized configuration as a new snapshot of the device
+// unless it matches the latest one
+func (e *ConfigBackup) store(deviceID int, content, source string, userID int, ignore []string) (*dto.ConfigBackupCaptureResp, error) {
+	hash, err := device.ConfigHash(content, ignore)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest models.SysDeviceConfigBackup
+	err = e.Orm.Select("backup_id", "hash").
+		Where("device_id = ?", deviceID).
+		Order("backup_id desc").
+		First(&latest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		e.Log.Errorf("db error:%s", err)
+		return nil, err
+	}
+	if err == nil && latest.Hash == hash {
+		return &dto.ConfigBackupCaptureResp{
+			BackupId: latest.BackupId,
+			DeviceId: deviceID,
+			Hash:     hash,
+		}, nil
+	}
+
+	data := models.SysDeviceConfigBackup{
+		DeviceId: deviceID,
+		Hash:     hash,
+		Size:     len(content),
+		Source:   source,
+		Content:  content,
+	}
+	data.CreateBy = userID
+	if err := e.Orm.Create(&data).Error; err != nil {
+		e.Log.Errorf("db error:%s", err)
+		return nil, err
+	}
+
+	return &dto.ConfigBackupCaptureResp{
+		BackupId: data.BackupId,
+		DeviceId: deviceID,
+		Hash:     hash,
+		Created:  true,
+	}, nil
+}
+
+// Restore brings the device back to a stored snapshot. The delta between the
+// running configuration and the snapshot is computed and pushed in a single
+// CLI session while the device is held exclusively, then the configuration
+// is read again to verify the result and stored as a "restore" snapshot.
+// In dry-run mode only the commands that would be sent are returned.
+//
+// The end of ctx cancels waiting for the device and reading its configuration.
+// Once the delta is being pushed the restore runs to completion, since
+// stopping it would leave the configuration half applied.
+func (e *ConfigBackup) Restore(ctx context.Context, req *dto.ConfigBackupRestoreReq, userID int, username, clientIP string) (*dto.ConfigBackupRestoreResp, error) {
+	var target models.SysDeviceConfigBackup
+	if err := e.Get(&dto.ConfigBackupGetReq{Id: req.Id}, &target); err != nil {
+		return nil, err
+	}
+
+	deviceID, pool, err := e.resolveDevice(target.DeviceId)
+	if err != nil {
+		return nil, err
+	}
+	cfg := pool.Config()
+
+	timeout := time.Duration(cfg.Pool.CommandTimeout) * time.Second
+	if req.Timeout > 0 {
+		timeout = time.Duration(req.Timeout) * time.Second
+	}
+
+	resp := &dto.ConfigBackupRestoreResp{
+		BackupId: target.BackupId,
+		DeviceId: deviceID,
+		DryRun:   req.DryRun,
+		Commands: []string{},
+	}
+
+	var after string
+	err = pool.Exclusive(ctx, func(conn *device.Connection) error {
+		current, err := e.readConfig(ctx, conn, cfg, timeout)
+		if err != nil {
+			return err
+		}
+
+		delta, err := device.ConfigDelta(current, target.Content, cfg.Backup.IgnorePatterns)
+		if err != nil {
+			return err
+		}
+		if len(delta) == 0 || req.DryRun {
+			after = current
+			if len(delta) > 0 {
+				resp.Commands = wrapConfigMode(cfg, delta)
+			}
+			return nil
+		}
+		resp.Commands = wrapConfigMode(cfg, delta)
+
+		ctx := context.WithoutCancel(ctx)
+		sessionCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		result, err := device.RunConfigSession(sessionCtx, conn.Adapter, resp.Commands)
+		if result != nil {
+			resp.Output = result.Output
+			if device.GetLogger() != nil {
+				_ = device.GetLogger().LogFromResult(result, deviceID, fmt.Sprint(userID), username, clientIP)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		after, err = e.readConfig(ctx, conn, cfg, timeout)
+		return err
+	})
+	if err != nil {
+		return resp, err
+	}
+	if req.DryRun {
+		return resp, nil
+	}
+
+	stored, err := e.store(deviceID, after, models.BackupSourceRestore, userID, cfg.Backup.IgnorePatterns)
+	if err != nil {
+		return resp, err
+	}
+	resp.VerifyBackupId = stored.BackupId
+	resp.Verified = stored.Hash == target.Hash
+	if !resp.Verified {
+		resp.Remaining, _, _ = device.UnifiedDiff(after, target.Content, "running", backupName(&target), 3)
+	}
+	return resp, nil
+}
+
+// readConfig runs the backup command on a checked out connection
+func (e *ConfigBackup) readConfig(ctx context.Context, conn *device.Connection, cfg *device.DeviceConfig, timeout time.Duration) (string, error) {
+	readCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result, err := conn.Adapter.ExecuteCommand(readCtx, cfg.Backup.Command)
+	if err != nil {
+		return "", err
+	}
+	if !result.Success {
+		return "", device.NewCommandFailedError(errors.New(result.Error))
+	}
+	return device.NormalizeConfig(result.Output), nil
+}
+
+func wrapConfigMode(cfg *device.DeviceConfig, delta []string) []string {
+	cmds := make([]string, 0, len(delta)+2)
+	cmds = append(cmds, cfg.Backup.EnterConfig)
+	cmds = append(cmds, delta...)
+	return append(cmds, cfg.Backup.ExitConfig)
+}
+
+// GetPage 获取配置备份列表，不含配置内容
+func (e *ConfigBackup) GetPage(c *dto.ConfigBackupPageReq, list *[]models.SysDeviceConfigBackup, count *int64) error {
+	var data models.SysDeviceConfigBackup
+
+	db := e.Orm.Model(&data).Omit("content")
+	if c.BackupIdOrder == "" {
+		db = db.Order("backup_id desc")
+	}
+	err := db.
+		Scopes(
+			cDto.MakeCondition(c.GetNeedSearch()),
+			cDto.Paginate(c.GetPageSize(), c.GetPageIndex()),
+		).
+		Find(list).Limit(-1).Offset(-1).
+		Count(count).Error
+	if err != nil {
+		e.Log.Errorf("db error:%s \r", err)
+		return err
+	}
+	return nil
+}
+
+// Get 获取配置备份对象
+func (e *ConfigBackup) Get(d *dto.ConfigBackupGetReq, model *models.SysDeviceConfigBackup) error {
+	err := e.Orm.First(model, d.GetId()).Error
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		err = errors.New("查看对象不存在或无权查看")
+		e.Log.Errorf("db error:%s", err)
+		return err
+	}
+	if err != nil {
+		e.Log.Errorf("db error:%s", err)
+		return err
+	}
+	return nil
+}
+
+// Diff returns a unified diff between two stored versions
+func (e *ConfigBackup) Diff(req *dto.ConfigBackupDiffReq) (*dto.ConfigBackupDiffResp, error) {
+	var from, to models.SysDeviceConfigBackup
+	if err := e.Get(&dto.ConfigBackupGetReq{Id: req.From}, &from); err != nil {
+		return nil, err
+	}
+	if err := e.Get(&dto.ConfigBackupGetReq{Id: req.To}, &to); err != nil {
+		return nil, err
+	}
+
+	n := req.Context
+	if n == 0 {
+		n = 3
+	}
+	diff, added, removed := device.UnifiedDiff(from.Content, to.Content,
+		backupName(&from), backupName(&to), n)
+
+	return &dto.ConfigBackupDiffResp{
+		From:    from.BackupId,
+		To:      to.BackupId,
+		Added:   added,
+		Removed: removed,
+		Diff:    diff,
+	}, nil
+}
+
+// backupName labels a version in diff headers
+func backupName(b *models.SysDeviceConfigBackup) string {
+	return fmt.Sprintf("device-%d/backup-%d\t%s", b.DeviceId, b.BackupId, b.CreatedAt.Format(time.RFC3339))
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"errors"
+
+	"opt-switch/app/device/service/dto"
+	"opt-switch/pkg/device"
+)
+
+// DeviceConfigService reloads the device configuration at runtime. It shares
+// error mapping with CommandService.
+type DeviceConfigService struct {
+	CommandService
+}
+
+// Reload applies the device configuration of req without a restart and
+// reports what changed. The settings file is not written, the next change of
+// the file replaces the configuration again.
+func (s *DeviceConfigService) Reload(req *dto.DeviceConfigReq) (*device.ReloadResult, error) {
+	settings := req.DeviceConfig
+	// Like the device inventory, blank secrets keep the current ones
+	if current := device.GetConfig(); current != nil {
+		conn := &settings.Connection
+		if conn.Password == "" {
+			conn.Password = current.Connection.Password
+		}
+		if conn.PrivateKey == "" {
+			conn.PrivateKey = current.Connection.PrivateKey
+		}
+		if conn.PrivateKeyPassphrase == "" {
+			conn.PrivateKeyPassphrase = current.Connection.PrivateKeyPassphrase
+		}
+		if settings.Log.Integrity.Key == "" {
+			settings.Log.Integrity.Key = current.Log.Integrity.Key
+		}
+	}
+
+	result, err := device.ReloadSettings(settings, device.ReloadSourceAPI)
+	if err != nil {
+		// the request is at fault, not the running configuration
+		var deviceErr *device.DeviceError
+		if errors.As(err, &deviceErr) && deviceErr.Code == device.ErrInvalidConfig {
+			return nil, device.NewInvalidParamError(deviceErr.Error())
+		}
+		return nil, err
+	}
+	s.Log.Infof("Device configuration reloaded: %d changes, devices %v rebuilt", len(result.Changes), result.Devices)
+	return result, nil
+}
+
+// LastReload returns the outcome of the last reload from the API or the
+// settings file, nil before the first one
+func (s *DeviceConfigService) LastReload() *device.ReloadResult {
+	return device.LastReload()
+}
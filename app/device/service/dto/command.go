@@ -1,9 +1,21 @@
 package dto
 
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"opt-switch/pkg/device"
+)
+
 // CommandExecuteReq is the request for executing a single command
 type CommandExecuteReq struct {
-	Command string `json:"command" binding:"required"`
-	Timeout int    `json:"timeout"` // seconds, default from config
+	DeviceID     int    `json:"deviceId"` // inventory device id, default device when omitted
+	Command      string `json:"command" binding:"required"`
+	Timeout      int    `json:"timeout"`      // seconds, default from config
+	Parse        bool   `json:"parse"`        // return the output parsed into JSON when a parser exists
+	ConfirmToken string `json:"confirmToken"` // token returned when the command requires confirmation
+	Priority     string `json:"priority"`     // queue class, default interactive
 }
 
 // CommandExecuteResp is the response for executing a command
@@ -11,14 +23,22 @@ type CommandExecuteResp struct {
 	Command  string `json:"command"`
 	Output   string `json:"output,omitempty"`
 	Success  bool   `json:"success"`
-	Duration int64  `json:"duration_ms"`
+	Duration int64  `json:"durationMs"`
 	Error    string `json:"error,omitempty"`
+	// Parsed is the structured output when parse was requested, e.g. a list
+	// of interfaces for show interfaces
+	Parsed     interface{} `json:"parsed,omitempty"`
+	ParseError string      `json:"parseError,omitempty"`
 }
 
 // BatchCommandReq is the request for executing multiple commands
 type BatchCommandReq struct {
-	Commands []string `json:"commands" binding:"required,min=1,max=50"`
-	Timeout  int      `json:"timeout"` // seconds, default from config
+	DeviceID     int      `json:"deviceId"` // inventory device id, default device when omitted
+	Commands     []string `json:"commands" binding:"required,min=1,max=50"`
+	Timeout      int      `json:"timeout"`      // seconds, default from config
+	Parse        bool     `json:"parse"`        // return the outputs parsed into JSON when parsers exist
+	ConfirmToken string   `json:"confirmToken"` // token returned when a command requires confirmation
+	Priority     string   `json:"priority"`     // queue class, default interactive
 }
 
 // BatchCommandResp is the response for executing multiple commands
@@ -29,16 +49,110 @@ type BatchCommandResp struct {
 	Failed  int                  `json:"failed"`
 }
 
+// CommandJobReq is the request for running commands as an asynchronous job
+type CommandJobReq struct {
+	DeviceID     int      `json:"deviceId"` // inventory device id, default device when omitted
+	Commands     []string `json:"commands" binding:"required,min=1,max=50"`
+	Timeout      int      `json:"timeout"`      // seconds per command, default from config
+	ConfirmToken string   `json:"confirmToken"` // token returned when a command requires confirmation
+	Priority     string   `json:"priority"`     // queue class, default bulk
+}
+
+// CommandJobGetReq identifies a command job
+type CommandJobGetReq struct {
+	Id string `uri:"id" binding:"required"`
+}
+
+// CommandHistoryFilter selects command history entries. Empty filters match
+// every entry.
+type CommandHistoryFilter struct {
+	DeviceID     int    `form:"deviceId"` // all devices when omitted
+	UserID       string `form:"userId"`
+	Username     string `form:"username"`
+	Command      string `form:"command"`      // substring of the command
+	CommandRegex string `form:"commandRegex"` // regular expression matched against the command
+	Success      *bool  `form:"success"`
+	ClientIP     string `form:"clientIp"`
+	SessionID    string `form:"sessionId"` // terminal session
+}
+
+// HistoryQuery converts the filter into the device layer query
+func (f *CommandHistoryFilter) HistoryQuery() *device.HistoryQuery {
+	return &device.HistoryQuery{
+		DeviceID:     f.DeviceID,
+		UserID:       f.UserID,
+		Username:     f.Username,
+		Command:      f.Command,
+		CommandRegex: f.CommandRegex,
+		Success:      f.Success,
+		ClientIP:     f.ClientIP,
+		SessionID:    f.SessionID,
+	}
+}
+
 // CommandHistoryReq is the request for querying command history
 type CommandHistoryReq struct {
-	Limit  int `form:"limit" binding:"required,min=1,max=1000"`
-	Offset int `form:"offset" binding:"required,min=0"`
+	CommandHistoryFilter
+	Limit  int   `form:"limit" binding:"required,min=1,max=1000"`
+	Offset int   `form:"offset" binding:"min=0"`
+	Since  int64 `form:"since"` // unix seconds, inclusive
+	Until  int64 `form:"until"` // unix seconds, inclusive
+}
+
+// HistoryQuery converts the request into the device layer query
+func (r *CommandHistoryReq) HistoryQuery() *device.HistoryQuery {
+	q := r.CommandHistoryFilter.HistoryQuery()
+	q.Limit = r.Limit
+	q.Offset = r.Offset
+	if r.Since > 0 {
+		q.Since = time.Unix(r.Since, 0)
+	}
+	if r.Until > 0 {
+		q.Until = time.Unix(r.Until, 0)
+	}
+	return q
+}
+
+// CommandHistoryExportReq is the request for exporting the command history
+type CommandHistoryExportReq struct {
+	CommandHistoryFilter
+	Format string `form:"format" binding:"omitempty,oneof=csv ndjson"` // default csv
+	From   string `form:"from"`                                        // unix seconds or RFC 3339, inclusive
+	To     string `form:"to"`                                          // unix seconds or RFC 3339, inclusive
+}
+
+// HistoryQuery converts the request into the device layer query
+func (r *CommandHistoryExportReq) HistoryQuery() (*device.HistoryQuery, error) {
+	q := r.CommandHistoryFilter.HistoryQuery()
+	var err error
+	if q.Since, err = parseExportTime("from", r.From); err != nil {
+		return nil, err
+	}
+	if q.Until, err = parseExportTime("to", r.To); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// parseExportTime parses unix seconds or an RFC 3339 time, zero when empty
+func parseExportTime(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, device.NewInvalidParamError(fmt.Sprintf("%s must be unix seconds or an RFC 3339 time", name))
+	}
+	return t, nil
 }
 
 // CommandHistoryResp is the response for command history
 type CommandHistoryResp struct {
 	History []CommandHistoryItem `json:"history"`
-	Total   int                  `json:"total"`
+	Total   int64                `json:"total"` // matching entries, not only this page
 	Limit   int                  `json:"limit"`
 	Offset  int                  `json:"offset"`
 }
@@ -46,20 +160,68 @@ type CommandHistoryResp struct {
 // CommandHistoryItem represents a single history item
 type CommandHistoryItem struct {
 	Timestamp int64  `json:"timestamp"`
-	UserID    string `json:"user_id,omitempty"`
+	DeviceID  int    `json:"deviceId,omitempty"`
+	UserID    string `json:"userId,omitempty"`
 	Username  string `json:"username,omitempty"`
 	Command   string `json:"command"`
+	Output    string `json:"output,omitempty"` // recorded when log.include_output is enabled
 	Success   bool   `json:"success"`
-	Duration  int64  `json:"duration_ms"`
-	ClientIP  string `json:"client_ip,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Duration  int64  `json:"durationMs"`
+	ClientIP  string `json:"clientIp,omitempty"`
+	SessionID string `json:"sessionId,omitempty"`
+	Policy    string `json:"policy,omitempty"`
+}
+
+// DeviceStatusReq is the request for device status
+type DeviceStatusReq struct {
+	DeviceID int `form:"deviceId"` // inventory device id, default device when omitted
+}
+
+// DeviceMetricsReq is the request for a switch telemetry series
+type DeviceMetricsReq struct {
+	DeviceID int    `form:"deviceId"`                // inventory device id, default device when omitted
+	Name     string `form:"name" binding:"required"` // series, e.g. cpu_usage_percent
+	Label    string `form:"label"`                   // instance, e.g. an interface, all when omitted
+	From     string `form:"from"`                    // unix seconds or RFC 3339, an hour before to by default
+	To       string `form:"to"`                      // unix seconds or RFC 3339, now by default
+	Step     int    `form:"step" binding:"min=0"`    // seconds per point, about 300 points when omitted
+}
+
+// TelemetryQuery converts the request into the device layer query
+func (r *DeviceMetricsReq) TelemetryQuery() (*device.TelemetryQuery, error) {
+	q := &device.TelemetryQuery{
+		DeviceID: r.DeviceID,
+		Name:     r.Name,
+		Label:    r.Label,
+		Step:     time.Duration(r.Step) * time.Second,
+	}
+	var err error
+	if q.From, err = parseExportTime("from", r.From); err != nil {
+		return nil, err
+	}
+	if q.To, err = parseExportTime("to", r.To); err != nil {
+		return nil, err
+	}
+	return q, nil
 }
 
 // DeviceStatusResp is the response for device status
 type DeviceStatusResp struct {
+	DeviceID          int  `json:"deviceId"`
 	Connected         bool `json:"connected"`
-	TotalConnections  int  `json:"total_connections"`
-	ActiveConnections int  `json:"active_connections"`
-	QueueSize         int  `json:"queue_size"`
-	MaxConnections    int  `json:"max_connections"`
-	MaxQueueSize      int  `json:"max_queue_size"`
+	TotalConnections  int  `json:"totalConnections"`
+	ActiveConnections int  `json:"activeConnections"`
+	QueueSize         int  `json:"queueSize"`
+	MaxConnections    int  `json:"maxConnections"`
+	MaxQueueSize      int  `json:"maxQueueSize"`
+	// QueuedTasks lists the waiting tasks in dispatch order
+	QueuedTasks []device.QueuedTask `json:"queuedTasks"`
+	// WaitStats is the queue wait of the dispatched tasks per priority class
+	WaitStats map[string]device.WaitStats `json:"waitStats"`
+	// Connections reports the health of the pooled connections
+	Connections []device.ConnectionHealth `json:"connections"`
+	// DroppedLogEntries counts the command log entries of all devices the
+	// syslog forwarder and the history store dropped since startup
+	DroppedLogEntries map[string]uint64 `json:"droppedLogEntries"`
 }
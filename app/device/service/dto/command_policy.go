@@ -0,0 +1,103 @@
+package dto
+
+import (
+	"opt-switch/app/device/models"
+	"opt-switch/common/dto"
+	common "opt-switch/common/models"
+)
+
+// SysCommandPolicyPageReq 列表或者搜索使用结构体
+type SysCommandPolicyPageReq struct {
+	dto.Pagination `search:"-"`
+	RoleKey        string `form:"roleKey" search:"type:exact;column:role_key;table:sys_command_policy" comment:"角色代码"`
+	Action         string `form:"action" search:"type:exact;column:action;table:sys_command_policy" comment:"动作"`
+	Status         int    `form:"status" search:"type:exact;column:status;table:sys_command_policy" comment:"状态"`
+}
+
+func (m *SysCommandPolicyPageReq) GetNeedSearch() interface{} {
+	return *m
+}
+
+// SysCommandPolicyInsertReq 增使用的结构体
+type SysCommandPolicyInsertReq struct {
+	PolicyId int    `uri:"id" comment:"规则编码"`
+	RoleKey  string `json:"roleKey" binding:"required" comment:"角色代码，*为所有角色"`
+	Action   string `json:"action" binding:"required,oneof=allow deny confirm" comment:"动作"`
+	Pattern  string `json:"pattern" binding:"required" comment:"命令正则"`
+	Status   int    `json:"status" binding:"omitempty,oneof=1 2" comment:"状态"`
+	Remark   string `json:"remark" comment:"备注"`
+	common.ControlBy
+}
+
+func (s *SysCommandPolicyInsertReq) Generate(model *models.SysCommandPolicy) {
+	model.RoleKey = s.RoleKey
+	model.Action = s.Action
+	model.Pattern = s.Pattern
+	model.Status = s.Status
+	if model.Status == 0 {
+		model.Status = models.PolicyStatusEnabled
+	}
+	model.Remark = s.Remark
+	if s.ControlBy.UpdateBy != 0 {
+		model.UpdateBy = s.UpdateBy
+	}
+	if s.ControlBy.CreateBy != 0 {
+		model.CreateBy = s.CreateBy
+	}
+}
+
+// GetId 获取数据对应的ID
+func (s *SysCommandPolicyInsertReq) GetId() interface{} {
+	return s.PolicyId
+}
+
+// SysCommandPolicyUpdateReq 改使用的结构体
+type SysCommandPolicyUpdateReq struct {
+	PolicyId int    `uri:"id" comment:"规则编码"`
+	RoleKey  string `json:"roleKey" binding:"required" comment:"角色代码，*为所有角色"`
+	Action   string `json:"action" binding:"required,oneof=allow deny confirm" comment:"动作"`
+	Pattern  string `json:"pattern" binding:"required" comment:"命令正则"`
+	Status   int    `json:"status" binding:"omitempty,oneof=1 2" comment:"状态"`
+	Remark   string `json:"remark" comment:"备注"`
+	common.ControlBy
+}
+
+func (s *SysCommandPolicyUpdateReq) Generate(model *models.SysCommandPolicy) {
+	model.PolicyId = s.PolicyId
+	model.RoleKey = s.RoleKey
+	model.Action = s.Action
+	model.Pattern = s.Pattern
+	if s.Status != 0 {
+		model.Status = s.Status
+	}
+	model.Remark = s.Remark
+	if s.ControlBy.UpdateBy != 0 {
+		model.UpdateBy = s.UpdateBy
+	}
+	if s.ControlBy.CreateBy != 0 {
+		model.CreateBy = s.CreateBy
+	}
+}
+
+func (s *SysCommandPolicyUpdateReq) GetId() interface{} {
+	return s.PolicyId
+}
+
+// SysCommandPolicyGetReq 获取单个的结构体
+type SysCommandPolicyGetReq struct {
+	Id int `uri:"id"`
+}
+
+func (s *SysCommandPolicyGetReq) GetId() interface{} {
+	return s.Id
+}
+
+// SysCommandPolicyDeleteReq 删除的结构体
+type SysCommandPolicyDeleteReq struct {
+	Ids []int `json:"ids"`
+	common.ControlBy
+}
+
+func (s *SysCommandPolicyDeleteReq) GetId() interface{} {
+	return s.Ids
+}
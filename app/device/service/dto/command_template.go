@@ -0,0 +1,121 @@
+package dto
+
+import (
+	"opt-switch/app/device/models"
+	"opt-switch/common/dto"
+	common "opt-switch/common/models"
+	"opt-switch/pkg/device"
+)
+
+// SysCommandTemplatePageReq 列表或者搜索使用结构体
+type SysCommandTemplatePageReq struct {
+	dto.Pagination `search:"-"`
+	TemplateId     int    `form:"templateId" search:"type:exact;column:template_id;table:sys_command_template" comment:"模板编码"`
+	Name           string `form:"name" search:"type:contains;column:name;table:sys_command_template" comment:"模板名称"`
+	Status         int    `form:"status" search:"type:exact;column:status;table:sys_command_template" comment:"状态"`
+}
+
+func (m *SysCommandTemplatePageReq) GetNeedSearch() interface{} {
+	return *m
+}
+
+// SysCommandTemplateInsertReq 增使用的结构体
+type SysCommandTemplateInsertReq struct {
+	TemplateId  int                    `uri:"id" comment:"模板编码"`
+	Name        string                 `json:"name" binding:"required" comment:"模板名称"`
+	Description string                 `json:"description" comment:"描述"`
+	Body        string                 `json:"body" binding:"required" comment:"模板内容"`
+	Params      []device.TemplateParam `json:"params" comment:"参数定义"`
+	Status      int                    `json:"status" binding:"omitempty,oneof=1 2" comment:"状态"`
+	common.ControlBy
+}
+
+func (s *SysCommandTemplateInsertReq) Generate(model *models.SysCommandTemplate) {
+	model.Name = s.Name
+	model.Description = s.Description
+	model.Body = s.Body
+	model.Params = s.Params
+	model.Status = s.Status
+	if model.Status == 0 {
+		model.Status = models.TemplateStatusEnabled
+	}
+	if s.ControlBy.UpdateBy != 0 {
+		model.UpdateBy = s.UpdateBy
+	}
+	if s.ControlBy.CreateBy != 0 {
+		model.CreateBy = s.CreateBy
+	}
+}
+
+// GetId 获取数据对应的ID
+func (s *SysCommandTemplateInsertReq) GetId() interface{} {
+	return s.TemplateId
+}
+
+// SysCommandTemplateUpdateReq 改使用的结构体
+type SysCommandTemplateUpdateReq struct {
+	TemplateId  int                    `uri:"id" comment:"模板编码"`
+	Name        string                 `json:"name" binding:"required" comment:"模板名称"`
+	Description string                 `json:"description" comment:"描述"`
+	Body        string                 `json:"body" binding:"required" comment:"模板内容"`
+	Params      []device.TemplateParam `json:"params" comment:"参数定义"`
+	Status      int                    `json:"status" binding:"omitempty,oneof=1 2" comment:"状态"`
+	common.ControlBy
+}
+
+func (s *SysCommandTemplateUpdateReq) Generate(model *models.SysCommandTemplate) {
+	model.TemplateId = s.TemplateId
+	model.Name = s.Name
+	model.Description = s.Description
+	model.Body = s.Body
+	model.Params = s.Params
+	if s.Status != 0 {
+		model.Status = s.Status
+	}
+	if s.ControlBy.UpdateBy != 0 {
+		model.UpdateBy = s.UpdateBy
+	}
+	if s.ControlBy.CreateBy != 0 {
+		model.CreateBy = s.CreateBy
+	}
+}
+
+func (s *SysCommandTemplateUpdateReq) GetId() interface{} {
+	return s.TemplateId
+}
+
+// SysCommandTemplateGetReq 获取单个的结构体
+type SysCommandTemplateGetReq struct {
+	Id int `uri:"id"`
+}
+
+func (s *SysCommandTemplateGetReq) GetId() interface{} {
+	return s.Id
+}
+
+// SysCommandTemplateDeleteReq 删除的结构体
+type SysCommandTemplateDeleteReq struct {
+	Ids []int `json:"ids"`
+	common.ControlBy
+}
+
+func (s *SysCommandTemplateDeleteReq) GetId() interface{} {
+	return s.Ids
+}
+
+// CommandTemplateRunReq renders a template and runs the commands on a device
+type CommandTemplateRunReq struct {
+	Id           int                    `uri:"id"`
+	DeviceID     int                    `json:"deviceId"` // inventory device id, default device when omitted
+	Params       map[string]interface{} `json:"params"`
+	Timeout      int                    `json:"timeout"`      // seconds, default from config
+	DryRun       bool                   `json:"dryRun"`       // only render the commands
+	ConfirmToken string                 `json:"confirmToken"` // token returned when a command requires confirmation
+}
+
+// CommandTemplateRunResp is the result of running a template
+type CommandTemplateRunResp struct {
+	TemplateId int               `json:"templateId"`
+	Commands   []string          `json:"commands"`
+	Result     *BatchCommandResp `json:"result,omitempty"`
+}
@@ -0,0 +1,80 @@
+package dto
+
+import (
+	"opt-switch/common/dto"
+)
+
+// ConfigBackupPageReq 列表或者搜索使用结构体
+type ConfigBackupPageReq struct {
+	dto.Pagination `search:"-"`
+	DeviceId       int    `form:"deviceId" search:"type:exact;column:device_id;table:sys_device_config_backup" comment:"设备编码"`
+	Source         string `form:"source" search:"type:exact;column:source;table:sys_device_config_backup" comment:"来源"`
+	Hash           string `form:"hash" search:"type:exact;column:hash;table:sys_device_config_backup" comment:"配置哈希"`
+	ConfigBackupOrder
+}
+
+// ConfigBackupOrder 排序使用结构体
+type ConfigBackupOrder struct {
+	BackupIdOrder string `form:"backupIdOrder" search:"type:order;column:backup_id;table:sys_device_config_backup"`
+}
+
+func (m *ConfigBackupPageReq) GetNeedSearch() interface{} {
+	return *m
+}
+
+// ConfigBackupGetReq 获取单个的结构体
+type ConfigBackupGetReq struct {
+	Id int `uri:"id"`
+}
+
+func (s *ConfigBackupGetReq) GetId() interface{} {
+	return s.Id
+}
+
+// ConfigBackupCaptureReq triggers a backup outside the schedule
+type ConfigBackupCaptureReq struct {
+	DeviceID int `json:"deviceId"` // inventory device id, default device when omitted
+}
+
+// ConfigBackupCaptureResp is the result of a capture
+type ConfigBackupCaptureResp struct {
+	BackupId int    `json:"backupId"`
+	DeviceId int    `json:"deviceId"`
+	Hash     string `json:"hash"`
+	Created  bool   `json:"created"` // false when the configuration matches the latest snapshot
+}
+
+// ConfigBackupDiffReq selects the two versions to compare
+type ConfigBackupDiffReq struct {
+	From    int `form:"from" binding:"required"`
+	To      int `form:"to" binding:"required"`
+	Context int `form:"context" binding:"omitempty,min=0,max=100"` // lines of context, default 3
+}
+
+// ConfigBackupDiffResp is a unified diff between two versions
+type ConfigBackupDiffResp struct {
+	From    int    `json:"from"`
+	To      int    `json:"to"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	Diff    string `json:"diff"`
+}
+
+// ConfigBackupRestoreReq restores a device to a stored version
+type ConfigBackupRestoreReq struct {
+	Id      int  `uri:"id"`
+	DryRun  bool `json:"dryRun"`  // only return the commands that would be sent
+	Timeout int  `json:"timeout"` // seconds for reading and pushing the configuration, default from config
+}
+
+// ConfigBackupRestoreResp is the result of a restore
+type ConfigBackupRestoreResp struct {
+	BackupId       int      `json:"backupId"`
+	DeviceId       int      `json:"deviceId"`
+	DryRun         bool     `json:"dryRun"`
+	Commands       []string `json:"commands"`                 // commands sent (or to be sent) in one session
+	Output         string   `json:"output,omitempty"`         // device output of the session
+	Verified       bool     `json:"verified"`                 // the running configuration matches the version afterwards
+	VerifyBackupId int      `json:"verifyBackupId,omitempty"` // snapshot taken after the restore
+	Remaining      string   `json:"remaining,omitempty"`      // unified diff still left when not verified
+}
@@ -0,0 +1,9 @@
+package dto
+
+import ext "opt-switch/config"
+
+// DeviceConfigReq is the request to apply a new device block of the settings
+// file. Blank secrets keep the current ones.
+type DeviceConfigReq struct {
+	ext.DeviceConfig
+}
@@ -0,0 +1,25 @@
+package dto
+
+import "opt-switch/pkg/device"
+
+// HostKeyReq is the request for the SSH host key of a device
+type HostKeyReq struct {
+	DeviceID int `form:"deviceId"` // inventory device id, default device when omitted
+}
+
+// HostKeyAcceptReq is the request to trust the pending host key of a device
+type HostKeyAcceptReq struct {
+	DeviceID    int    `json:"deviceId"`
+	Fingerprint string `json:"fingerprint" binding:"required"` // SHA256 fingerprint of the pending key
+}
+
+// HostKeyForgetReq is the request to remove the stored host key of a device
+type HostKeyForgetReq struct {
+	DeviceID int `json:"deviceId"`
+}
+
+// HostKeyResp describes the stored and pending host key of a device
+type HostKeyResp struct {
+	DeviceID int `json:"deviceId"`
+	*device.HostKeyInfo
+}
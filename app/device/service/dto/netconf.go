@@ -0,0 +1,72 @@
+package dto
+
+// NetconfGetReq is the request for a NETCONF <get>
+type NetconfGetReq struct {
+	DeviceID     int    `json:"deviceId"`     // inventory device id, default device when omitted
+	Filter       string `json:"filter"`       // subtree filter XML, optional
+	Timeout      int    `json:"timeout"`      // seconds, default from config
+	ConfirmToken string `json:"confirmToken"` // token returned when the operation requires confirmation
+}
+
+// NetconfGetConfigReq is the request for a NETCONF <get-config>
+type NetconfGetConfigReq struct {
+	DeviceID     int    `json:"deviceId"`
+	Source       string `json:"source" binding:"omitempty,oneof=running candidate startup"` // default running
+	Filter       string `json:"filter"`                                                     // subtree filter XML, optional
+	Timeout      int    `json:"timeout"`                                                    // seconds, default from config
+	ConfirmToken string `json:"confirmToken"`                                               // token returned when the operation requires confirmation
+}
+
+// NetconfEditConfigReq is the request for a NETCONF <edit-config>
+type NetconfEditConfigReq struct {
+	DeviceID         int    `json:"deviceId"`
+	Target           string `json:"target" binding:"omitempty,oneof=running candidate startup"`
+	Config           string `json:"config" binding:"required"` // <config> content XML
+	DefaultOperation string `json:"defaultOperation" binding:"omitempty,oneof=merge replace none"`
+	Lock             bool   `json:"lock"`   // lock the target datastore around the edit
+	Commit           bool   `json:"commit"` // commit the candidate datastore after the edit
+	Timeout          int    `json:"timeout"`
+	ConfirmToken     string `json:"confirmToken"` // token returned when an operation requires confirmation
+}
+
+// NetconfCommitReq is the request for a NETCONF <commit>
+type NetconfCommitReq struct {
+	DeviceID     int    `json:"deviceId"`
+	Timeout      int    `json:"timeout"`
+	ConfirmToken string `json:"confirmToken"` // token returned when the operation requires confirmation
+}
+
+// NetconfCapabilitiesReq is the request for the session capabilities
+type NetconfCapabilitiesReq struct {
+	DeviceID int `form:"deviceId"`
+}
+
+// NetconfRPCError represents a single rpc-error returned by the device
+type NetconfRPCError struct {
+	Type     string `json:"type"`
+	Tag      string `json:"tag"`
+	Severity string `json:"severity"`
+	Path     string `json:"path,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// NetconfReplyResp is the response for a single NETCONF operation
+type NetconfReplyResp struct {
+	Operation string            `json:"operation"`
+	Success   bool              `json:"success"`
+	Data      string            `json:"data,omitempty"`
+	Errors    []NetconfRPCError `json:"errors,omitempty"`
+	Duration  int64             `json:"durationMs"`
+}
+
+// NetconfEditConfigResp is the response for an edit-config, one entry per RPC sent
+type NetconfEditConfigResp struct {
+	Success bool               `json:"success"`
+	Steps   []NetconfReplyResp `json:"steps"`
+}
+
+// NetconfCapabilitiesResp is the response for the session capabilities
+type NetconfCapabilitiesResp struct {
+	SessionID    string   `json:"sessionId"`
+	Capabilities []string `json:"capabilities"`
+}
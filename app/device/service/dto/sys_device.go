@@ -0,0 +1,157 @@
+package dto
+
+import (
+	"opt-switch/app/device/models"
+	"opt-switch/common/dto"
+	common "opt-switch/common/models"
+)
+
+// SysDevicePageReq 列表或者搜索使用结构体
+type SysDevicePageReq struct {
+	dto.Pagination `search:"-"`
+	DeviceId       int    `form:"deviceId" search:"type:exact;column:device_id;table:sys_device" comment:"设备编码"`
+	Name           string `form:"name" search:"type:contains;column:name;table:sys_device" comment:"设备名称"`
+	Protocol       string `form:"protocol" search:"type:exact;column:protocol;table:sys_device" comment:"连接协议"`
+	Vendor         string `form:"vendor" search:"type:exact;column:vendor;table:sys_device" comment:"设备厂商"`
+	Host           string `form:"host" search:"type:contains;column:host;table:sys_device" comment:"主机地址"`
+	Status         int    `form:"status" search:"type:exact;column:status;table:sys_device" comment:"状态"`
+}
+
+func (m *SysDevicePageReq) GetNeedSearch() interface{} {
+	return *m
+}
+
+// SysDeviceInsertReq 增使用的结构体
+type SysDeviceInsertReq struct {
+	DeviceId int    `uri:"id" comment:"设备编码"`
+	Name     string `json:"name" binding:"required" comment:"设备名称"`
+	Protocol string `json:"protocol" binding:"required" comment:"连接协议"`
+	Vendor   string `json:"vendor" comment:"设备厂商"`
+	Host     string `json:"host" binding:"required" comment:"主机地址"`
+	Port     int    `json:"port" binding:"required,min=1,max=65535" comment:"端口"`
+	Username string `json:"username" binding:"required" comment:"用户名"`
+	Password string `json:"password" comment:"密码"`
+	Timeout  int    `json:"timeout" binding:"omitempty,min=1" comment:"连接超时(秒)"`
+	Status   int    `json:"status" binding:"omitempty,oneof=1 2" comment:"状态"`
+	Remark   string `json:"remark" comment:"备注"`
+
+	EnablePassword       string `json:"enablePassword" comment:"特权密码"`
+	PrivateKey           string `json:"privateKey" comment:"私钥 PEM"`
+	PrivateKeyPassphrase string `json:"privateKeyPassphrase" comment:"私钥口令"`
+	HostKeyPolicy        string `json:"hostKeyPolicy" binding:"omitempty,oneof=tofu strict insecure" comment:"主机密钥策略"`
+	HostKeyFingerprint   string `json:"hostKeyFingerprint" comment:"固定主机密钥指纹"`
+	common.ControlBy
+}
+
+func (s *SysDeviceInsertReq) Generate(model *models.SysDevice) {
+	model.Name = s.Name
+	model.Protocol = s.Protocol
+	model.Vendor = s.Vendor
+	model.Host = s.Host
+	model.Port = s.Port
+	model.Username = s.Username
+	model.Password = s.Password
+	model.Timeout = s.Timeout
+	model.EnablePassword = s.EnablePassword
+	model.PrivateKey = s.PrivateKey
+	model.PrivateKeyPassphrase = s.PrivateKeyPassphrase
+	model.HostKeyPolicy = s.HostKeyPolicy
+	model.HostKeyFingerprint = s.HostKeyFingerprint
+	model.Status = s.Status
+	if model.Status == 0 {
+		model.Status = models.DeviceStatusEnabled
+	}
+	model.Remark = s.Remark
+	if s.ControlBy.UpdateBy != 0 {
+		model.UpdateBy = s.UpdateBy
+	}
+	if s.ControlBy.CreateBy != 0 {
+		model.CreateBy = s.CreateBy
+	}
+}
+
+// GetId 获取数据对应的ID
+func (s *SysDeviceInsertReq) GetId() interface{} {
+	return s.DeviceId
+}
+
+// SysDeviceUpdateReq 改使用的结构体
+type SysDeviceUpdateReq struct {
+	DeviceId int    `uri:"id" comment:"设备编码"`
+	Name     string `json:"name" binding:"required" comment:"设备名称"`
+	Protocol string `json:"protocol" binding:"required" comment:"连接协议"`
+	Vendor   string `json:"vendor" comment:"设备厂商"`
+	Host     string `json:"host" binding:"required" comment:"主机地址"`
+	Port     int    `json:"port" binding:"required,min=1,max=65535" comment:"端口"`
+	Username string `json:"username" binding:"required" comment:"用户名"`
+	Password string `json:"password" comment:"密码，留空则不修改"`
+	Timeout  int    `json:"timeout" binding:"omitempty,min=1" comment:"连接超时(秒)"`
+	Status   int    `json:"status" binding:"omitempty,oneof=1 2" comment:"状态"`
+	Remark   string `json:"remark" comment:"备注"`
+
+	EnablePassword       string `json:"enablePassword" comment:"特权密码，留空则不修改"`
+	PrivateKey           string `json:"privateKey" comment:"私钥 PEM，留空则不修改"`
+	PrivateKeyPassphrase string `json:"privateKeyPassphrase" comment:"私钥口令，留空则不修改"`
+	HostKeyPolicy        string `json:"hostKeyPolicy" binding:"omitempty,oneof=tofu strict insecure" comment:"主机密钥策略"`
+	HostKeyFingerprint   string `json:"hostKeyFingerprint" comment:"固定主机密钥指纹"`
+	common.ControlBy
+}
+
+func (s *SysDeviceUpdateReq) Generate(model *models.SysDevice) {
+	model.DeviceId = s.DeviceId
+	model.Name = s.Name
+	model.Protocol = s.Protocol
+	model.Vendor = s.Vendor
+	model.Host = s.Host
+	model.Port = s.Port
+	model.Username = s.Username
+	// the password is never returned to the client, so a blank one keeps the stored value
+	if s.Password != "" {
+		model.Password = s.Password
+	}
+	if s.EnablePassword != "" {
+		model.EnablePassword = s.EnablePassword
+	}
+	if s.PrivateKey != "" {
+		model.PrivateKey = s.PrivateKey
+	}
+	if s.PrivateKeyPassphrase != "" {
+		model.PrivateKeyPassphrase = s.PrivateKeyPassphrase
+	}
+	model.Timeout = s.Timeout
+	model.HostKeyPolicy = s.HostKeyPolicy
+	model.HostKeyFingerprint = s.HostKeyFingerprint
+	if s.Status != 0 {
+		model.Status = s.Status
+	}
+	model.Remark = s.Remark
+	if s.ControlBy.UpdateBy != 0 {
+		model.UpdateBy = s.UpdateBy
+	}
+	if s.ControlBy.CreateBy != 0 {
+		model.CreateBy = s.CreateBy
+	}
+}
+
+func (s *SysDeviceUpdateReq) GetId() interface{} {
+	return s.DeviceId
+}
+
+// SysDeviceGetReq 获取单个的结构体
+type SysDeviceGetReq struct {
+	Id int `uri:"id"`
+}
+
+func (s *SysDeviceGetReq) GetId() interface{} {
+	return s.Id
+}
+
+// SysDeviceDeleteReq 删除的结构体
+type SysDeviceDeleteReq struct {
+	Ids []int `json:"ids"`
+	common.ControlBy
+}
+
+func (s *SysDeviceDeleteReq) GetId() interface{} {
+	return s.Ids
+}
@@ -0,0 +1,19 @@
+package dto
+
+// TerminalReq is the query of a terminal WebSocket upgrade request
+type TerminalReq struct {
+	DeviceID int `form:"deviceId"`                                // inventory device id, default device when omitted
+	Cols     int `form:"cols" binding:"omitempty,min=1,max=1000"` // initial window width, default 80
+	Rows     int `form:"rows" binding:"omitempty,min=1,max=1000"` // initial window height, default 24
+
+	ConfirmToken string `form:"confirmToken"` // token returned when opening a terminal requires confirmation
+}
+
+// TerminalMessage is a message sent by the browser terminal.
+// Type is "input" (Data holds keystrokes) or "resize" (Cols and Rows are set).
+type TerminalMessage struct {
+	Type string `json:"type"`
+	Data string `json:"data,omitempty"`
+	Cols int    `json:"cols,omitempty"`
+	Rows int    `json:"rows,omitempty"`
+}
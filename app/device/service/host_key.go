@@ -0,0 +1,50 @@
+package service
+
+import "opt-switch/app/device/service/dto"
+
+// HostKeyService views and rotates the SSH host keys of the devices. It
+// shares device resolution and error mapping with CommandService.
+type HostKeyService struct {
+	CommandService
+}
+
+// Get returns the stored host key of a device and the key it presented last
+// if that one was rejected
+func (s *HostKeyService) Get(req *dto.HostKeyReq) (*dto.HostKeyResp, error) {
+	deviceID, pool, err := s.resolveDevice(req.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	info, err := pool.HostKey()
+	if err != nil {
+		return nil, err
+	}
+	return &dto.HostKeyResp{DeviceID: deviceID, HostKeyInfo: info}, nil
+}
+
+// Accept replaces the stored host key of a device by the pending one
+func (s *HostKeyService) Accept(req *dto.HostKeyAcceptReq) error {
+	deviceID, pool, err := s.resolveDevice(req.DeviceID)
+	if err != nil {
+		return err
+	}
+	if err := pool.AcceptHostKey(req.Fingerprint); err != nil {
+		return err
+	}
+	s.Log.Infof("Host key %s of device %d accepted", req.Fingerprint, deviceID)
+	return nil
+}
+
+// Forget removes the stored host key of a device, the next connection trusts
+// the key presented then unless the policy is strict
+func (s *HostKeyService) Forget(req *dto.HostKeyForgetReq) error {
+	deviceID, pool, err := s.resolveDevice(req.DeviceID)
+	if err != nil {
+		return err
+	}
+	if err := pool.ForgetHostKey(); err != nil {
+		return err
+	}
+	s.Log.Infof("Host key of device %d removed", deviceID)
+	return nil
+}
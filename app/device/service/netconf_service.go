@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"opt-switch/app/device/service/dto"
+	"opt-switch/pkg/device"
+)
+
+// NetconfService handles NETCONF operations against the device. It shares
+// error mapping and user extraction with CommandService.
+type NetconfService struct {
+	CommandService
+}
+
+// netconfOp is a single NETCONF operation performed on an adapter
+type netconfOp struct {
+	name string
+	rpc  string
+}
+
+// Capabilities returns the capabilities advertised in the server hello
+func (s *NetconfService) Capabilities(c *gin.Context, req *dto.NetconfCapabilitiesReq) (*dto.NetconfCapabilitiesResp, error) {
+	resp := &dto.NetconfCapabilitiesResp{}
+	err := s.withAdapter(c.Request.Context(), nil, req.DeviceID, 0, nil, func(ctx context.Context, deviceID int, nc *device.NETCONFAdapter) error {
+		resp.SessionID = nc.SessionID()
+		resp.Capabilities = nc.Capabilities()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Get executes a NETCONF <get>
+func (s *NetconfService) Get(c *gin.Context, req *dto.NetconfGetReq) (*dto.NetconfReplyResp, error) {
+	return s.single(c, req.DeviceID, req.Timeout, req.ConfirmToken, netconfOp{name: "get", rpc: device.NetconfGet(req.Filter)})
+}
+
+// GetConfig executes a NETCONF <get-config>
+func (s *NetconfService) GetConfig(c *gin.Context, req *dto.NetconfGetConfigReq) (*dto.NetconfReplyResp, error) {
+	return s.single(c, req.DeviceID, req.Timeout, req.ConfirmToken, netconfOp{name: "get-config", rpc: device.NetconfGetConfig(req.Source, req.Filter)})
+}
+
+// Commit executes a NETCONF <commit>
+func (s *NetconfService) Commit(c *gin.Context, req *dto.NetconfCommitReq) (*dto.NetconfReplyResp, error) {
+	return s.single(c, req.DeviceID, req.Timeout, req.ConfirmToken, netconfOp{name: "commit", rpc: "<commit/>"})
+}
+
+// EditConfig executes a NETCONF <edit-config>, optionally locking the target
+// datastore and committing the candidate within the same session. The lock is
+// always released, by closing the session when the client goes away, and a
+// failed candidate edit is discarded.
+func (s *NetconfService) EditConfig(c *gin.Context, req *dto.NetconfEditConfigReq) (*dto.NetconfEditConfigResp, error) {
+	target := req.Target
+	if target == "" {
+		target = device.DatastoreRunning
+		if req.Commit {
+			target = device.DatastoreCandidate
+		}
+	}
+	if req.Commit && target != device.DatastoreCandidate {
+		return nil, device.NewNotSupportedError("commit is only valid for the candidate datastore")
+	}
+
+	// unlock and discard-changes only clean up after the authorized steps
+	ops := []string{device.NetconfCommand("edit-config")}
+	if req.Lock {
+		ops = append(ops, device.NetconfCommand("lock"))
+	}
+	if req.Commit {
+		ops = append(ops, device.NetconfCommand("commit"))
+	}
+
+	userID, username, clientIP := s.extractUserInfo(c)
+	resp := &dto.NetconfEditConfigResp{Steps: []dto.NetconfReplyResp{}}
+
+	err := s.withAdapter(c.Request.Context(), s.principal(c, req.ConfirmToken), req.DeviceID, req.Timeout, ops, func(ctx context.Context, deviceID int, nc *device.NETCONFAdapter) error {
+		run := func(op netconfOp) bool {
+			step, result, err := s.call(ctx, nc, op)
+			if err != nil {
+				step = dto.NetconfReplyResp{Operation: op.name, Errors: []dto.NetconfRPCError{{Message: err.Error()}}}
+				result = &device.CommandResult{Command: op.rpc, Error: err.Error(), Timestamp: time.Now().Unix()}
+			}
+			resp.Steps = append(resp.Steps, step)
+			s.logResult(result, deviceID, userID, username, clientIP)
+			return step.Success
+		}
+
+		if req.Lock {
+			if !run(netconfOp{name: "lock", rpc: device.NetconfLock(target)}) {
+				return nil
+			}
+			defer run(netconfOp{name: "unlock", rpc: device.NetconfUnlock(target)})
+		}
+
+		if !run(netconfOp{name: "edit-config", rpc: device.NetconfEditConfig(target, req.Config, req.DefaultOperation)}) {
+			if target == device.DatastoreCandidate {
+				run(netconfOp{name: "discard-changes", rpc: "<discard-changes/>"})
+			}
+			return nil
+		}
+
+		if req.Commit {
+			if !run(netconfOp{name: "commit", rpc: "<commit/>"}) {
+				run(netconfOp{name: "discard-changes", rpc: "<discard-changes/>"})
+				return nil
+			}
+		}
+
+		// A failed unlock does not undo an applied change, so only the
+		// lock/edit/commit steps decide success.
+		resp.Success = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// single runs one NETCONF operation and logs it
+func (s *NetconfService) single(c *gin.Context, deviceID, timeout int, confirmToken string, op netconfOp) (*dto.NetconfReplyResp, error) {
+	userID, username, clientIP := s.extractUserInfo(c)
+
+	var resp dto.NetconfReplyResp
+	ops := []string{device.NetconfCommand(op.name)}
+	err := s.withAdapter(c.Request.Context(), s.principal(c, confirmToken), deviceID, timeout, ops, func(ctx context.Context, deviceID int, nc *device.NETCONFAdapter) error {
+		step, result, err := s.call(ctx, nc, op)
+		if err != nil {
+			return err
+		}
+		s.logResult(result, deviceID, userID, username, clientIP)
+		resp = step
+		return nil
+	})
+	if err != nil {
+		s.Log.Errorf("NETCONF %s failed: %v", op.name, err)
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// call sends op and maps the reply into a response step and a CommandResult for logging
+func (s *NetconfService) call(ctx context.Context, nc *device.NETCONFAdapter, op netconfOp) (dto.NetconfReplyResp, *device.CommandResult, error) {
+	start := time.Now()
+	reply, err := nc.RPC(ctx, op.rpc)
+	duration := time.Since(start).Milliseconds()
+	if err != nil {
+		return dto.NetconfReplyResp{}, nil, err
+	}
+
+	step := dto.NetconfReplyResp{
+		Operation: op.name,
+		Success:   reply.Err() == nil,
+		Data:      reply.Data,
+		Duration:  duration,
+	}
+	for _, e := range reply.Errors {
+		step.Errors = append(step.Errors, dto.NetconfRPCError{
+			Type:     e.Type,
+			Tag:      e.Tag,
+			Severity: e.Severity,
+			Path:     e.Path,
+			Message:  e.Message,
+		})
+	}
+
+	result := &device.CommandResult{
+		Command:   op.rpc,
+		Output:    reply.Raw,
+		Duration:  duration,
+		Success:   step.Success,
+		Timestamp: time.Now().Unix(),
+	}
+	if rpcErr := reply.Err(); rpcErr != nil {
+		result.Error = rpcErr.Error()
+	}
+	return step, result, nil
+}
+
+// withAdapter checks out a pooled connection of a device and runs fn with its
+// NETCONF adapter once the command policy allows principal the operations
+// ops. timeout is in seconds, 0 uses the configured command timeout. The end
+// of ctx cancels the operation and closes the NETCONF session, which also
+// releases its locks.
+func (s *NetconfService) withAdapter(ctx context.Context, principal *device.Principal, deviceID, timeout int, ops []string, fn func(ctx context.Context, deviceID int, nc *device.NETCONFAdapter) error) error {
+	deviceID, pool, err := s.resolveDevice(deviceID)
+	if err != nil {
+		return err
+	}
+	if principal != nil {
+		if err := pool.Authorize(device.WithPrincipal(ctx, principal), ops); err != nil {
+			return err
+		}
+	}
+
+	d := time.Duration(pool.Config().Pool.CommandTimeout) * time.Second
+	if timeout > 0 {
+		d = time.Duration(timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	return pool.WithConnection(ctx, func(conn *device.Connection) error {
+		nc, ok := conn.Adapter.(*device.NETCONFAdapter)
+		if !ok {
+			return device.NewNotSupportedError("NETCONF operations require the device protocol to be netconf")
+		}
+		return fn(ctx, deviceID, nc)
+	})
+}
+
+// logResult writes a NETCONF operation to the execution log asynchronously
+func (s *NetconfService) logResult(result *device.CommandResult, deviceID int, userID, username, clientIP string) {
+	if result == nil {
+		return
+	}
+	go func() {
+		if device.GetLogger() != nil {
+			_ = device.GetLogger().LogFromResult(result, deviceID, userID, username, clientIP)
+		}
+	}()
+}
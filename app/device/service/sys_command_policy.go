@@ -0,0 +1,141 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/go-admin-team/go-admin-core/sdk/service"
+	"gorm.io/gorm"
+
+	"opt-switch/app/device/models"
+	"opt-switch/app/device/service/dto"
+	cDto "opt-switch/common/dto"
+	"opt-switch/pkg/device"
+)
+
+// SysCommandPolicy manages the command policy rules and keeps the policy of
+// the device layer in sync with them
+type SysCommandPolicy struct {
+	service.Service
+}
+
+// GetPage 获取SysCommandPolicy列表
+func (e *SysCommandPolicy) GetPage(c *dto.SysCommandPolicyPageReq, list *[]models.SysCommandPolicy, count *int64) error {
+	var err error
+	var data models.SysCommandPolicy
+
+	err = e.Orm.Model(&data).
+		Scopes(
+			cDto.MakeCondition(c.GetNeedSearch()),
+			cDto.Paginate(c.GetPageSize(), c.GetPageIndex()),
+		).
+		Find(list).Limit(-1).Offset(-1).
+		Count(count).Error
+	if err != nil {
+		e.Log.Errorf("db error:%s \r", err)
+		return err
+	}
+	return nil
+}
+
+// Get 获取SysCommandPolicy对象
+func (e *SysCommandPolicy) Get(d *dto.SysCommandPolicyGetReq, model *models.SysCommandPolicy) error {
+	err := e.Orm.First(model, d.GetId()).Error
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		err = errors.New("查看对象不存在或无权查看")
+		e.Log.Errorf("db error:%s", err)
+		return err
+	}
+	if err != nil {
+		e.Log.Errorf("db error:%s", err)
+		return err
+	}
+	return nil
+}
+
+// Insert 创建SysCommandPolicy对象并重新加载命令策略
+func (e *SysCommandPolicy) Insert(c *dto.SysCommandPolicyInsertReq) error {
+	var data models.SysCommandPolicy
+	c.Generate(&data)
+
+	err := e.Orm.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&data).Error; err != nil {
+			return err
+		}
+		return LoadCommandPolicy(tx)
+	})
+	if err != nil {
+		e.Log.Errorf("db error:%s", err)
+		return err
+	}
+	c.PolicyId = data.PolicyId
+	return nil
+}
+
+// Update 修改SysCommandPolicy对象并重新加载命令策略
+func (e *SysCommandPolicy) Update(c *dto.SysCommandPolicyUpdateReq) error {
+	var model = models.SysCommandPolicy{}
+	if err := e.Orm.First(&model, c.GetId()).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("无权更新该数据")
+		}
+		e.Log.Errorf("db error:%s", err)
+		return err
+	}
+	c.Generate(&model)
+
+	err := e.Orm.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&model).Error; err != nil {
+			return err
+		}
+		return LoadCommandPolicy(tx)
+	})
+	if err != nil {
+		e.Log.Errorf("db error:%s", err)
+		return err
+	}
+	return nil
+}
+
+// Remove 删除SysCommandPolicy并重新加载命令策略
+func (e *SysCommandPolicy) Remove(d *dto.SysCommandPolicyDeleteReq) error {
+	var data models.SysCommandPolicy
+
+	err := e.Orm.Transaction(func(tx *gorm.DB) error {
+		db := tx.Model(&data).Delete(&data, d.GetId())
+		if err := db.Error; err != nil {
+			return err
+		}
+		if db.RowsAffected == 0 {
+			return errors.New("无权删除该数据")
+		}
+		return LoadCommandPolicy(tx)
+	})
+	if err != nil {
+		e.Log.Errorf("Delete error: %s", err)
+		return err
+	}
+	return nil
+}
+
+// LoadCommandPolicy compiles the enabled rules and installs them as the
+// command policy of the device layer. A rule that does not compile leaves the
+// current policy in place.
+func LoadCommandPolicy(db *gorm.DB) error {
+	var list []models.SysCommandPolicy
+	if err := db.Order("policy_id").Find(&list).Error; err != nil {
+		return err
+	}
+
+	rules := make([]device.PolicyRule, 0, len(list))
+	for i := range list {
+		if list[i].Enabled() {
+			rules = append(rules, list[i].PolicyRule())
+		}
+	}
+	policy, err := device.NewCommandPolicy(rules)
+	if err != nil {
+		return err
+	}
+	device.SetCommandPolicy(policy)
+	return nil
+}
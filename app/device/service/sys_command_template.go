@@ -0,0 +1,148 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"opt-switch/app/device/models"
+	"opt-switch/app/device/service/dto"
+	cDto "opt-switch/common/dto"
+	"opt-switch/pkg/device"
+)
+
+// maxTemplateCommands matches the limit of dto.BatchCommandReq
+const maxTemplateCommands = 50
+
+// SysCommandTemplate manages command templates and runs them on devices
+type SysCommandTemplate struct {
+	CommandService
+}
+
+// GetPage 获取SysCommandTemplate列表
+func (e *SysCommandTemplate) GetPage(c *dto.SysCommandTemplatePageReq, list *[]models.SysCommandTemplate, count *int64) error {
+	var err error
+	var data models.SysCommandTemplate
+
+	err = e.Orm.Model(&data).
+		Scopes(
+			cDto.MakeCondition(c.GetNeedSearch()),
+			cDto.Paginate(c.GetPageSize(), c.GetPageIndex()),
+		).
+		Find(list).Limit(-1).Offset(-1).
+		Count(count).Error
+	if err != nil {
+		e.Log.Errorf("db error:%s \r", err)
+		return err
+	}
+	return nil
+}
+
+// Get 获取SysCommandTemplate对象
+func (e *SysCommandTemplate) Get(d *dto.SysCommandTemplateGetReq, model *models.SysCommandTemplate) error {
+	err := e.Orm.First(model, d.GetId()).Error
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		err = errors.New("查看对象不存在或无权查看")
+		e.Log.Errorf("db error:%s", err)
+		return err
+	}
+	if err != nil {
+		e.Log.Errorf("db error:%s", err)
+		return err
+	}
+	return nil
+}
+
+// Insert 创建SysCommandTemplate对象，模板和参数定义需校验通过
+func (e *SysCommandTemplate) Insert(c *dto.SysCommandTemplateInsertReq) error {
+	var data models.SysCommandTemplate
+	c.Generate(&data)
+	if err := data.CommandTemplate().Validate(); err != nil {
+		return err
+	}
+
+	if err := e.Orm.Create(&data).Error; err != nil {
+		e.Log.Errorf("db error:%s", err)
+		return err
+	}
+	c.TemplateId = data.TemplateId
+	return nil
+}
+
+// Update 修改SysCommandTemplate对象，模板和参数定义需校验通过
+func (e *SysCommandTemplate) Update(c *dto.SysCommandTemplateUpdateReq) error {
+	var model = models.SysCommandTemplate{}
+	if err := e.Orm.First(&model, c.GetId()).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("无权更新该数据")
+		}
+		e.Log.Errorf("db error:%s", err)
+		return err
+	}
+	c.Generate(&model)
+	if err := model.CommandTemplate().Validate(); err != nil {
+		return err
+	}
+
+	if err := e.Orm.Save(&model).Error; err != nil {
+		e.Log.Errorf("db error:%s", err)
+		return err
+	}
+	return nil
+}
+
+// Remove 删除SysCommandTemplate
+func (e *SysCommandTemplate) Remove(d *dto.SysCommandTemplateDeleteReq) error {
+	var data models.SysCommandTemplate
+
+	db := e.Orm.Model(&data).Delete(&data, d.GetId())
+	if err := db.Error; err != nil {
+		e.Log.Errorf("Delete error: %s", err)
+		return err
+	}
+	if db.RowsAffected == 0 {
+		return errors.New("无权删除该数据")
+	}
+	return nil
+}
+
+// Run renders a template with the request parameters and executes the
+// commands as a batch. In dry-run mode only the rendered commands are returned.
+func (e *SysCommandTemplate) Run(c *gin.Context, req *dto.CommandTemplateRunReq) (*dto.CommandTemplateRunResp, error) {
+	var model models.SysCommandTemplate
+	if err := e.Get(&dto.SysCommandTemplateGetReq{Id: req.Id}, &model); err != nil {
+		return nil, err
+	}
+	if !model.Enabled() {
+		return nil, device.NewInvalidTemplateError(fmt.Sprintf("template %d is disabled", model.TemplateId))
+	}
+
+	cmds, err := model.CommandTemplate().Render(req.Params)
+	if err != nil {
+		return nil, err
+	}
+	if len(cmds) > maxTemplateCommands {
+		return nil, device.NewInvalidTemplateError(fmt.Sprintf("template rendered %d commands, at most %d are allowed", len(cmds), maxTemplateCommands))
+	}
+
+	resp := &dto.CommandTemplateRunResp{
+		TemplateId: model.TemplateId,
+		Commands:   cmds,
+	}
+	if req.DryRun {
+		return resp, nil
+	}
+
+	resp.Result, err = e.ExecuteBatch(c, &dto.BatchCommandReq{
+		DeviceID:     req.DeviceID,
+		Commands:     cmds,
+		Timeout:      req.Timeout,
+		ConfirmToken: req.ConfirmToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-admin-team/go-admin-core/sdk/service"
+	"gorm.io/gorm"
+
+	"opt-switch/app/device/models"
+	"opt-switch/app/device/service/dto"
+	cDto "opt-switch/common/dto"
+	"opt-switch/pkg/device"
+)
+
+// SysDevice manages the device inventory and keeps the device registry in
+// sync with it
+type SysDevice struct {
+	service.Service
+}
+
+// GetPage 获取SysDevice列表
+func (e *SysDevice) GetPage(c *dto.SysDevicePageReq, list *[]models.SysDevice, count *int64) error {
+	var err error
+	var data models.SysDevice
+
+	err = e.Orm.Model(&data).
+		Scopes(
+			cDto.MakeCondition(c.GetNeedSearch()),
+			cDto.Paginate(c.GetPageSize(), c.GetPageIndex()),
+		).
+		Find(list).Limit(-1).Offset(-1).
+		Count(count).Error
+	if err != nil {
+		e.Log.Errorf("db error:%s \r", err)
+		return err
+	}
+	return nil
+}
+
+// Get 获取SysDevice对象
+func (e *SysDevice) Get(d *dto.SysDeviceGetReq, model *models.SysDevice) error {
+	var data models.SysDevice
+
+	err := e.Orm.Model(&data).
+		First(model, d.GetId()).Error
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		err = errors.New("查看对象不存在或无权查看")
+		e.Log.Errorf("db error:%s", err)
+		return err
+	}
+	if err != nil {
+		e.Log.Errorf("db error:%s", err)
+		return err
+	}
+	return nil
+}
+
+// Insert 创建SysDevice对象并启动其连接池
+func (e *SysDevice) Insert(c *dto.SysDeviceInsertReq) error {
+	if err := checkProtocol(c.Protocol); err != nil {
+		return err
+	}
+	var data models.SysDevice
+	c.Generate(&data)
+
+	err := e.Orm.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&data).Error; err != nil {
+			return err
+		}
+		return e.sync(&data)
+	})
+	if err != nil {
+		e.Log.Errorf("db error:%s", err)
+		return err
+	}
+	c.DeviceId = data.DeviceId
+	return nil
+}
+
+// Update 修改SysDevice对象并重建其连接池
+func (e *SysDevice) Update(c *dto.SysDeviceUpdateReq) error {
+	if err := checkProtocol(c.Protocol); err != nil {
+		return err
+	}
+	var model = models.SysDevice{}
+	if err := e.Orm.First(&model, c.GetId()).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("无权更新该数据")
+		}
+		e.Log.Errorf("db error:%s", err)
+		return err
+	}
+	c.Generate(&model)
+
+	err := e.Orm.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&model).Error; err != nil {
+			return err
+		}
+		return e.sync(&model)
+	})
+	if err != nil {
+		e.Log.Errorf("db error:%s", err)
+		return err
+	}
+	return nil
+}
+
+// Remove 删除SysDevice并停止其连接池
+func (e *SysDevice) Remove(d *dto.SysDeviceDeleteReq) error {
+	var data models.SysDevice
+
+	db := e.Orm.Model(&data).Delete(&data, d.GetId())
+	if err := db.Error; err != nil {
+		e.Log.Errorf("Delete error: %s", err)
+		return err
+	}
+	if db.RowsAffected == 0 {
+		return errors.New("无权删除该数据")
+	}
+
+	for _, id := range d.Ids {
+		if err := device.UnregisterDevice(id); err != nil {
+			e.Log.Warnf("stop connection pool of device %d: %s", id, err)
+		}
+	}
+	return nil
+}
+
+// checkProtocol rejects protocols without a registered adapter. Adapters can
+// be registered at runtime, so the request binding does not list them.
+func checkProtocol(protocol string) error {
+	if _, ok := device.LookupAdapter(device.ProtocolType(protocol)); !ok {
+		return fmt.Errorf("不支持的连接协议: %s", protocol)
+	}
+	return nil
+}
+
+// sync starts, restarts or stops the connection pool of a device to match its
+// inventory record. A configuration the device layer rejects aborts the write.
+func (e *SysDevice) sync(model *models.SysDevice) error {
+	if !device.IsInitialized() {
+		return nil
+	}
+	if !model.Enabled() {
+		return device.UnregisterDevice(model.DeviceId)
+	}
+	return device.RegisterDevice(model.DeviceId, model.ConnectionConfig())
+}
+
+// LoadInventory registers a connection pool for every enabled device in the
+// inventory and drops pools of devices that are disabled or no longer listed.
+// The settings file device stays registered as long as the inventory has no
+// record of its own for it.
+func LoadInventory(db *gorm.DB) (int, error) {
+	var list []models.SysDevice
+	if err := db.Find(&list).Error; err != nil {
+		return 0, err
+	}
+
+	listed := make(map[int]bool, len(list))
+	enabled := make(map[int]bool, len(list))
+	var firstErr error
+	loaded := 0
+	for i := range list {
+		d := &list[i]
+		listed[d.DeviceId] = true
+		if !d.Enabled() {
+			continue
+		}
+		enabled[d.DeviceId] = true
+		if err := device.RegisterDevice(d.DeviceId, d.ConnectionConfig()); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		loaded++
+	}
+
+	for _, id := range device.GetRegistry().IDs() {
+		if id == device.DefaultDeviceID && !listed[id] {
+			continue
+		}
+		if !enabled[id] {
+			_ = device.UnregisterDevice(id)
+		}
+	}
+	return loaded, firstErr
+}
+
+// RotateSecrets re-encrypts the credentials of every device in the inventory
+// with the current key of vault and returns the number of devices updated
+func RotateSecrets(db *gorm.DB, vault *device.Vault) (int, error) {
+	var list []models.SysDevice
+	if err := db.Find(&list).Error; err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i := range list {
+			d := &list[i]
+			changed, err := d.RotateSecrets(vault)
+			if err != nil {
+				return fmt.Errorf("device %d: %w", d.DeviceId, err)
+			}
+			if !changed {
+				continue
+			}
+			err = tx.Model(d).Select("password", "private_key", "private_key_passphrase").Updates(d).Error
+			if err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/go-admin-team/go-admin-core/logger"
+	"github.com/go-admin-team/go-admin-core/sdk/service"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"opt-switch/app/device/models"
+	"opt-switch/app/device/service/dto"
+	"opt-switch/config"
+	"opt-switch/pkg/device"
+)
+
+var (
+	initDeviceOnce sync.Once
+	logDir         string
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "device-service")
+	if err != nil {
+		panic(err)
+	}
+	logDir = dir
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// initDevice initializes the device layer once for the package with a
+// settings file device that is never dialled: pools connect on demand
+func initDevice(t *testing.T) {
+	t.Helper()
+	initDeviceOnce.Do(func() {
+		config.ExtConfig.Device = config.DeviceConfig{
+			Connection: config.DeviceConnectionConfig{
+				Protocol: "ssh", Host: "192.0.2.1", Port: 22, Username: "admin", Password: "admin",
+			},
+			Log: config.DeviceLogConfig{Enabled: true, File: filepath.Join(logDir, "device.log")},
+		}
+		if err := device.Initialize(zap.NewNop()); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// newTestDB returns an in-memory database with the device tables
+func newTestDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestLoadInventory(t *testing.T) {
+	initDevice(t)
+	db := newTestDB(t, &models.SysDevice{})
+	registry := device.GetRegistry()
+
+	load := func(want ...int) {
+		t.Helper()
+		if _, err := LoadInventory(db); err != nil {
+			t.Fatal(err)
+		}
+		if got := registry.IDs(); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("registered devices = %v, want %v", got, want)
+		}
+	}
+	add := func(id, status int) {
+		t.Helper()
+		err := db.Create(&models.SysDevice{
+			DeviceId: id, Protocol: "ssh", Host: "192.0.2.2", Port: 22, Username: "admin", Password: "admin", Status: status,
+		}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the settings file device stays without an inventory record
+	load(device.DefaultDeviceID)
+	add(2, models.DeviceStatusEnabled)
+	add(3, models.DeviceStatusDisabled)
+	load(device.DefaultDeviceID, 2)
+
+	// a record of its own replaces it, and disabling it stops it
+	add(device.DefaultDeviceID, models.DeviceStatusDisabled)
+	load(2)
+
+	if err := db.Where("device_id = ?", 2).Delete(&models.SysDevice{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	load()
+}
+
+// loopbackAdapter stands in for a transport registered at runtime
+type loopbackAdapter struct{}
+
+func (loopbackAdapter) Connect(ctx context.Context, config *device.ConnectionConfig) error {
+	return nil
+}
+func (loopbackAdapter) Disconnect(ctx context.Context) error { return nil }
+func (loopbackAdapter) IsConnected() bool                    { return true }
+func (loopbackAdapter) ProtocolType() device.ProtocolType    { return "loopback" }
+
+func (loopbackAdapter) ExecuteCommand(ctx context.Context, cmd string) (*device.CommandResult, error) {
+	return &device.CommandResult{Command: cmd, Output: cmd, Success: true}, nil
+}
+
+func TestSysDeviceProtocol(t *testing.T) {
+	initDevice(t)
+	if err := device.RegisterAdapter("loopback", func() device.ProtocolAdapter { return loopbackAdapter{} }); err != nil {
+		t.Fatal(err)
+	}
+	s := &SysDevice{Service: service.Service{
+		Orm: newTestDB(t, &models.SysDevice{}),
+		Log: logger.NewHelper(logger.DefaultLogger),
+	}}
+
+	req := &dto.SysDeviceInsertReq{
+		Name: "sw2", Protocol: "pigeon", Host: "192.0.2.2", Port: 22, Username: "admin", Password: "admin",
+	}
+	if err := s.Insert(req); err == nil {
+		t.Fatal("device with an unregistered protocol inserted")
+	}
+
+	// adapters registered at runtime are accepted like the built-in ones
+	req.Protocol = "loopback"
+	if err := s.Insert(req); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { device.UnregisterDevice(req.DeviceId) })
+	if _, err := device.GetRegistry().Get(req.DeviceId); err != nil {
+		t.Fatalf("device %d not registered: %v", req.DeviceId, err)
+	}
+
+	update := &dto.SysDeviceUpdateReq{
+		DeviceId: req.DeviceId, Name: "sw2", Protocol: "pigeon", Host: "192.0.2.2", Port: 22, Username: "admin",
+	}
+	if err := s.Update(update); err == nil {
+		t.Error("device updated to an unregistered protocol")
+	}
+}
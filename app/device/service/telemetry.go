@@ -0,0 +1,55 @@
+package service
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"opt-switch/app/device/models"
+	"opt-switch/pkg/device"
+)
+
+// telemetryStore keeps the switch telemetry in sys_device_metric
+type telemetryStore struct {
+	db *gorm.DB
+}
+
+// Append stores the points of a collection
+func (s *telemetryStore) Append(points []device.TelemetryPoint) error {
+	records := make([]models.SysDeviceMetric, len(points))
+	for i := range points {
+		records[i] = models.NewSysDeviceMetric(&points[i])
+	}
+	return s.db.CreateInBatches(records, historyImportBatch).Error
+}
+
+// Query returns the points of a series at one resolution, oldest first
+func (s *telemetryStore) Query(q *device.TelemetryQuery, resolution int) ([]device.TelemetryPoint, error) {
+	db := s.db.Model(&models.SysDeviceMetric{}).
+		Where("device_id = ? AND name = ? AND resolution = ?", q.DeviceID, q.Name, resolution).
+		Where("sampled_at >= ? AND sampled_at <= ?", q.From, q.To)
+	if q.Label != "" {
+		db = db.Where("label = ?", q.Label)
+	}
+	var records []models.SysDeviceMetric
+	if err := db.Order("sampled_at").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	points := make([]device.TelemetryPoint, len(records))
+	for i := range records {
+		points[i] = records[i].TelemetryPoint()
+	}
+	return points, nil
+}
+
+// Prune removes the points of a resolution older than before
+func (s *telemetryStore) Prune(resolution int, before time.Time) error {
+	return s.db.Where("resolution = ? AND sampled_at < ?", resolution, before).
+		Delete(&models.SysDeviceMetric{}).Error
+}
+
+// LoadTelemetryStore installs sys_device_metric as the telemetry store of
+// the device layer
+func LoadTelemetryStore(db *gorm.DB) {
+	device.SetTelemetryStore(&telemetryStore{db: db})
+}
@@ -0,0 +1,371 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg/jwtauth/user"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"opt-switch/app/device/service/dto"
+	"opt-switch/pkg/device"
+)
+
+// transcriptChunkSize is the amount of output buffered before a transcript
+// entry is written to the execution log
+const transcriptChunkSize = 64 * 1024
+
+// terminalSessions counts open terminal sessions per user
+var terminalSessions = struct {
+	sync.Mutex
+	byUser map[string]int
+}{byUser: make(map[string]int)}
+
+// TerminalService bridges browser terminals to interactive device shells
+type TerminalService struct {
+	CommandService
+}
+
+// Terminal is an interactive shell on a connection checked out of a device pool
+type Terminal struct {
+	ID          string
+	DeviceID    int
+	idleTimeout time.Duration
+	session     device.TerminalSession
+	release     func()
+	transcript  *transcript
+	closeOnce   sync.Once
+}
+
+// Open checks out a dedicated connection of the requested device and starts
+// a shell on it. It is called before the WebSocket upgrade so that errors can
+// be returned as regular HTTP responses.
+//
+// The command policy decides on opening the shell as the pseudo command
+// device.TerminalCommand. What is typed into the shell is not evaluated, so
+// the policy denies the shell to roles it denies any command.
+func (s *TerminalService) Open(c *gin.Context, req *dto.TerminalReq) (*Terminal, error) {
+	deviceID, pool, err := s.resolveDevice(req.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	ctx := device.WithPrincipal(c.Request.Context(), s.principal(c, req.ConfirmToken))
+	if err := pool.Authorize(ctx, []string{device.TerminalCommand}); err != nil {
+		return nil, err
+	}
+
+	cfg := device.GetConfig().Terminal
+	userID := strconv.Itoa(user.GetUserId(c))
+	if err := acquireTerminalSlot(userID, cfg.MaxSessionsPerUser); err != nil {
+		return nil, err
+	}
+
+	conn, release, err := pool.Checkout(c.Request.Context())
+	if err != nil {
+		releaseTerminalSlot(userID)
+		return nil, err
+	}
+
+	opener, ok := conn.Adapter.(device.TerminalOpener)
+	if !ok {
+		release()
+		releaseTerminalSlot(userID)
+		return nil, device.NewNotSupportedError("interactive terminal is not available for this device protocol")
+	}
+
+	cols, rows := req.Cols, req.Rows
+	if cols <= 0 {
+		cols = 80
+	}
+	if rows <= 0 {
+		rows = 24
+	}
+	session, err := opener.OpenTerminal(c.Request.Context(), cols, rows)
+	if err != nil {
+		release()
+		releaseTerminalSlot(userID)
+		return nil, err
+	}
+
+	t := &Terminal{
+		ID:          uuid.NewString(),
+		DeviceID:    deviceID,
+		idleTimeout: time.Duration(cfg.IdleTimeout) * time.Second,
+		session:     session,
+		transcript: &transcript{
+			deviceID: deviceID,
+			userID:   userID,
+			username: user.GetUserName(c),
+			clientIP: c.ClientIP(),
+			started:  time.Now(),
+		},
+	}
+	t.transcript.sessionID = t.ID
+	t.release = func() {
+		release()
+		releaseTerminalSlot(userID)
+	}
+
+	s.Log.Infof("terminal session %s opened on device %d by user %s", t.ID, deviceID, userID)
+	return t, nil
+}
+
+// Serve streams the shell over ws until either side closes it or the browser
+// stays silent for longer than the idle timeout. Device output is sent as
+// binary frames, browser input arrives as JSON encoded dto.TerminalMessage.
+func (t *Terminal) Serve(ws *websocket.Conn) {
+	defer t.Close()
+
+	var writeMu sync.Mutex
+	closeWS := func(code int, text string) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		msg := websocket.FormatCloseMessage(code, text)
+		_ = ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		_ = ws.Close()
+	}
+
+	// device -> browser
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 4096)
+		for {
+			n, err := t.session.Read(buf)
+			if n > 0 {
+				t.transcript.Write(buf[:n])
+				writeMu.Lock()
+				werr := ws.WriteMessage(websocket.BinaryMessage, buf[:n])
+				writeMu.Unlock()
+				if werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				closeWS(websocket.CloseNormalClosure, "session closed by device")
+				return
+			}
+		}
+	}()
+
+	// browser -> device
+	for {
+		if t.idleTimeout > 0 {
+			_ = ws.SetReadDeadline(time.Now().Add(t.idleTimeout))
+		}
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				t.transcript.reason = "idle timeout"
+				closeWS(websocket.ClosePolicyViolation, "idle timeout")
+			}
+			break
+		}
+
+		var msg dto.TerminalMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		switch msg.Type {
+		case "input":
+			t.transcript.Input(msg.Data)
+			if _, err := t.session.Write([]byte(msg.Data)); err != nil {
+				closeWS(websocket.CloseInternalServerErr, "device write failed")
+			}
+		case "resize":
+			if msg.Cols > 0 && msg.Rows > 0 {
+				_ = t.session.Resize(msg.Cols, msg.Rows)
+			}
+		}
+	}
+
+	_ = t.session.Close()
+	<-done
+}
+
+// Close ends the shell, returns the connection to the pool and flushes the
+// remaining transcript. It is safe to call more than once.
+func (t *Terminal) Close() {
+	t.closeOnce.Do(func() {
+		_ = t.session.Close()
+		t.release()
+		t.transcript.Flush(true)
+	})
+}
+
+func acquireTerminalSlot(userID string, limit int) error {
+	terminalSessions.Lock()
+	defer terminalSessions.Unlock()
+
+	if limit > 0 && terminalSessions.byUser[userID] >= limit {
+		return device.NewSessionLimitError(limit)
+	}
+	terminalSessions.byUser[userID]++
+	return nil
+}
+
+func releaseTerminalSlot(userID string) {
+	terminalSessions.Lock()
+	defer terminalSessions.Unlock()
+
+	if terminalSessions.byUser[userID] <= 1 {
+		delete(terminalSessions.byUser, userID)
+		return
+	}
+	terminalSessions.byUser[userID]--
+}
+
+// transcript records a terminal session to the execution log: the device
+// output in chunks and every line typed into it as an entry of its own,
+// written after the output that preceded it. Lines typed at a password
+// prompt are masked.
+type transcript struct {
+	sessionID string
+	deviceID  int
+	userID    string
+	username  string
+	clientIP  string
+	started   time.Time
+	reason    string
+	buf       bytes.Buffer
+	tail      string // end of the output, to recognise password prompts
+	line      []rune // input since the last line break
+	escape    int    // state of an escape sequence being skipped
+	mu        sync.Mutex
+}
+
+// secretPromptRe matches the end of output asking for a secret
+var secretPromptRe = regexp.MustCompile(`(?i)(password|passphrase|secret)[^\n]*:\s*$`)
+
+// Escape sequence states of the input: after ESC, within a CSI sequence, and
+// before the final character of an SS3 sequence
+const (
+	escapeNone = iota
+	escapeStart
+	escapeCSI
+	escapeSS3
+)
+
+// Write buffers output and writes a transcript entry once a chunk is full
+func (r *transcript) Write(p []byte) {
+	r.mu.Lock()
+	r.buf.Write(p)
+	r.tail += string(p)
+	if len(r.tail) > 256 {
+		r.tail = r.tail[len(r.tail)-256:]
+	}
+	full := r.buf.Len() >= transcriptChunkSize
+	r.mu.Unlock()
+
+	if full {
+		r.Flush(false)
+	}
+}
+
+// Input edits the current input line as the device would: printable
+// characters are appended, backspace removes the last one, Ctrl-C and Ctrl-U
+// discard the line and cursor keys and other escape sequences are ignored.
+// Carriage return or line feed completes the line.
+func (r *transcript) Input(data string) {
+	for _, c := range data {
+		r.mu.Lock()
+		var line string
+		done := false
+		switch {
+		case r.escape == escapeStart && (c == '[' || c == 'O'):
+			r.escape = escapeCSI
+			if c == 'O' {
+				r.escape = escapeSS3
+			}
+		case r.escape == escapeCSI && (c < 0x40 || c > 0x7e):
+		case r.escape != escapeNone:
+			r.escape = escapeNone
+		case c == 0x1b:
+			r.escape = escapeStart
+		case c == '\r' || c == '\n':
+			line, done = string(r.line), len(r.line) > 0
+			if done && secretPromptRe.MatchString(r.tail) {
+				line = "********"
+			}
+			r.line = r.line[:0]
+		case c == 0x7f || c == '\b':
+			if len(r.line) > 0 {
+				r.line = r.line[:len(r.line)-1]
+			}
+		case c == 0x03 || c == 0x15:
+			r.line = r.line[:0]
+		case c == '\t' || !unicode.IsControl(c):
+			r.line = append(r.line, c)
+		}
+		r.mu.Unlock()
+
+		if done {
+			r.Flush(false)
+			r.log(&device.ExecutionLog{
+				Command: device.TerminalCommand + " " + line,
+				Success: true,
+			})
+		}
+	}
+}
+
+// Flush writes the buffered output. The final entry of a session is always
+// written and carries the close reason, if any, and the input typed after
+// the last line break.
+func (r *transcript) Flush(final bool) {
+	r.mu.Lock()
+	output := r.buf.String()
+	r.buf.Reset()
+	var pending string
+	if final {
+		pending = string(r.line)
+		if pending != "" && secretPromptRe.MatchString(r.tail) {
+			pending = "********"
+		}
+		r.line = nil
+	}
+	r.mu.Unlock()
+
+	if pending != "" {
+		r.log(&device.ExecutionLog{Command: device.TerminalCommand + " " + pending, Success: true})
+	}
+	if output == "" && !final {
+		return
+	}
+	entry := &device.ExecutionLog{
+		Command:    device.TerminalCommand,
+		Output:     output,
+		OutputSize: len(output),
+		Success:    true,
+		Duration:   time.Since(r.started).Milliseconds(),
+	}
+	if final && r.reason != "" {
+		entry.Error = r.reason
+	}
+	r.log(entry)
+}
+
+// log writes an entry of the session to the execution log
+func (r *transcript) log(entry *device.ExecutionLog) {
+	logger := device.GetLogger()
+	if logger == nil {
+		return
+	}
+	entry.Timestamp = time.Now().Unix()
+	entry.DeviceID = r.deviceID
+	entry.UserID = r.userID
+	entry.Username = r.username
+	entry.ClientIP = r.clientIP
+	entry.SessionID = r.sessionID
+	_ = logger.LogTranscript(entry)
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"opt-switch/pkg/device"
+)
+
+func TestTranscriptInput(t *testing.T) {
+	initDevice(t)
+	r := &transcript{sessionID: "transcript-test", deviceID: 1, userID: "7", username: "ops", started: time.Now()}
+
+	r.Write([]byte("sw1>"))
+	r.Input("enable\r")
+	r.Write([]byte("enable\r\nPassword: "))
+	r.Input("s3cret\r\n")
+	r.Write([]byte("\r\nsw1#"))
+	// backspaces, a cursor key and a discarded line
+	r.Input("show ver\x7f\x7f\x7fversion\x1b[A\x1bOA\r")
+	r.Input("reload\x03")
+	r.Input("conf")
+	r.reason = "idle timeout"
+	r.Flush(true)
+
+	logs, _, err := device.GetLogger().GetHistory(&device.HistoryQuery{SessionID: "transcript-test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for i := len(logs) - 1; i >= 0; i-- { // newest first
+		got = append(got, logs[i].Command)
+	}
+	want := []string{
+		"[terminal]", "[terminal] enable",
+		"[terminal]", "[terminal] ********",
+		"[terminal]", "[terminal] show version",
+		"[terminal] conf", "[terminal]",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("entries = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if last := logs[0]; last.Error != "idle timeout" || last.Username != "ops" {
+		t.Errorf("final entry = %+v", last)
+	}
+}
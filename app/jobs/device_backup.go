@@ -0,0 +1,74 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-admin-team/go-admin-core/logger"
+	"github.com/go-admin-team/go-admin-core/sdk"
+
+	"opt-switch/app/device/models"
+	"opt-switch/app/device/service"
+	"opt-switch/pkg/device"
+)
+
+// DeviceConfigBackup backs up the running configuration of managed devices.
+// 参数为逗号分隔的设备编码，为空时备份所有已启用的设备。
+type DeviceConfigBackup struct {
+}
+
+func (t DeviceConfigBackup) Exec(arg interface{}) error {
+	if !device.IsInitialized() {
+		return fmt.Errorf("device layer not initialized")
+	}
+
+	ids, err := backupDeviceIDs(arg)
+	if err != nil {
+		return err
+	}
+
+	s := service.ConfigBackup{}
+	s.Orm = sdk.Runtime.GetDbByKey("*")
+	s.Log = logger.NewHelper(sdk.Runtime.GetLogger())
+	if s.Orm == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	var failed []string
+	for _, id := range ids {
+		resp, err := s.Capture(context.Background(), id, models.BackupSourceJob, 0, "sys_job")
+		if err != nil {
+			s.Log.Errorf("[Job] DeviceConfigBackup device %d failed: %v", id, err)
+			failed = append(failed, strconv.Itoa(id))
+			continue
+		}
+		if resp.Created {
+			s.Log.Infof("[Job] DeviceConfigBackup device %d stored backup %d", id, resp.BackupId)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("backup failed for devices %s", strings.Join(failed, ","))
+	}
+	return nil
+}
+
+func backupDeviceIDs(arg interface{}) ([]int, error) {
+	s, _ := arg.(string)
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return device.GetRegistry().IDs(), nil
+	}
+
+	var ids []int
+	for _, part := range strings.Split(s, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid device id %q", part)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -10,7 +10,8 @@ import (
 // 字典 key 可以配置到 自动任务 调用目标 中；
 func InitJob() {
 	jobList = map[string]JobExec{
-		"ExamplesOne": ExamplesOne{},
+		"ExamplesOne":        ExamplesOne{},
+		"DeviceConfigBackup": DeviceConfigBackup{},
 		// ...
 	}
 }
@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -17,16 +18,19 @@ import (
 	"github.com/go-admin-team/go-admin-core/sdk/config"
 	"github.com/go-admin-team/go-admin-core/sdk/pkg"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
 
 	"opt-switch/app/admin/models"
 	"opt-switch/app/admin/router"
+	devicerouter "opt-switch/app/device/router"
 	"opt-switch/app/jobs"
 	"opt-switch/common/database"
 	"opt-switch/common/global"
 	common "opt-switch/common/middleware"
 	"opt-switch/common/middleware/handler"
 	"opt-switch/common/storage"
+	"opt-switch/pkg/device"
 	"opt-switch/web"
 	ext "opt-switch/config"
 )
@@ -68,6 +72,13 @@ func setup() {
 		storage.Setup,
 	)
 
+	// 设备配置位于 settings.device，框架只加载 settings.extend，需单独读取
+	if deviceConfig, found, err := ext.LoadDeviceConfig(configYml); err != nil {
+		log.Errorf("read device settings error, %s", err.Error())
+	} else if found {
+		ext.ExtConfig.Device = deviceConfig
+	}
+
 	//2. 运行时内存优化（在配置读取后立即执行）
 	initRuntime()
 
@@ -92,13 +103,23 @@ func run() error {
 		f()
 	}
 
+	// 关闭服务时取消进行中的请求，使排队或执行中的设备命令随之中止
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
 	srv := &http.Server{
 		Addr:    fmt.Sprintf("%s:%d", config.ApplicationConfig.Host, config.ApplicationConfig.Port),
 		Handler: sdk.Runtime.GetEngine(),
 		ReadTimeout:  time.Duration(config.ApplicationConfig.ReadTimeout) * time.Second,
 		WriteTimeout: time.Duration(config.ApplicationConfig.WriterTimeout) * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
 	}
 
+	// 配置文件变化时热加载设备配置
+	go devicerouter.WatchSettings(baseCtx, configYml)
+
 	go func() {
 		jobs.InitJob()
 		jobs.Setup(sdk.Runtime.GetDb())
@@ -151,6 +172,7 @@ func run() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	log.Info("Shutdown Server ... ")
+	cancelRequests()
 
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("Server Shutdown:", err)
@@ -184,7 +206,13 @@ func initRouter() {
 	if config.SslConfig.Enable {
 		r.Use(handler.TlsHandler())
 	}
-	//r.Use(middleware.Metrics())
+	// Prometheus 指标：HTTP 请求与设备层指标，通过已有的 /api/v1/metrics 暴露
+	if getBoolConfig("application.enableMiddleware.metrics", false) {
+		r.Use(common.Metrics())
+		if err := device.EnableMetrics(prometheus.DefaultRegisterer); err != nil {
+			log.Errorf("Failed to register device metrics: %v", err)
+		}
+	}
 
 	// 条件启用中间件（用于内存优化）
 	// Sentinel 限流中间件
@@ -12,6 +12,7 @@ import (
 
 	"opt-switch/cmd/api"
 	"opt-switch/cmd/config"
+	"opt-switch/cmd/device"
 	"opt-switch/cmd/migrate"
 	"opt-switch/cmd/version"
 )
@@ -47,6 +48,7 @@ func init() {
 	rootCmd.AddCommand(version.StartCmd)
 	rootCmd.AddCommand(config.StartCmd)
 	rootCmd.AddCommand(app.StartCmd)
+	rootCmd.AddCommand(device.StartCmd)
 }
 
 //Execute : apply commands
@@ -0,0 +1,188 @@
+package device
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-admin-team/go-admin-core/config/source/file"
+	"github.com/go-admin-team/go-admin-core/sdk"
+	"github.com/go-admin-team/go-admin-core/sdk/config"
+	"github.com/go-admin-team/go-admin-core/sdk/pkg"
+	"github.com/spf13/cobra"
+
+	"opt-switch/app/device/service"
+	"opt-switch/common/database"
+	ext "opt-switch/config"
+	"opt-switch/pkg/device"
+)
+
+var (
+	configYml string
+	password  string
+	skipDB    bool
+	StartCmd  = &cobra.Command{
+		Use:   "device",
+		Short: "Manage device credentials and the execution log",
+		Long: `Manage the encrypted device credentials and verify the execution log.
+
+The keys are read from DEVICE_ENCRYPTION_KEYS, a comma separated list of id:key
+pairs whose first key encrypts, and DEVICE_ENCRYPTION_KEY, which is key 1.
+Keys are 16, 24 or 32 bytes long.`,
+	}
+	encryptCmd = &cobra.Command{
+		Use:     "encrypt-password",
+		Short:   "Encrypt a device password for the settings file",
+		Example: "go-admin device encrypt-password < password.txt",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return encrypt()
+		},
+	}
+	rotateCmd = &cobra.Command{
+		Use:     "rotate-key",
+		Short:   "Re-encrypt the device credentials with the current key",
+		Example: `DEVICE_ENCRYPTION_KEYS=2:<new key>,1:<old key> go-admin device rotate-key -c config/settings.yml`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return rotate()
+		},
+	}
+	verifyCmd = &cobra.Command{
+		Use:     "verify-log",
+		Short:   "Verify the hash chain of the execution log",
+		Example: "go-admin device verify-log -c config/settings.yml",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return verifyLog()
+		},
+	}
+)
+
+func init() {
+	encryptCmd.Flags().StringVarP(&password, "password", "p", "", "Password to encrypt, read from standard input when omitted")
+	rotateCmd.Flags().StringVarP(&configYml, "config", "c", "config/settings.yml", "Settings file whose secrets are re-encrypted")
+	rotateCmd.Flags().BoolVar(&skipDB, "skip-db", false, "Leave the device inventory in the database alone")
+	verifyCmd.Flags().StringVarP(&configYml, "config", "c", "config/settings.yml", "Settings file with the log settings")
+	StartCmd.AddCommand(encryptCmd, rotateCmd, verifyCmd)
+}
+
+// encrypt prints the ciphertext of a password. Reading it from standard
+// input keeps it out of the shell history.
+func encrypt() error {
+	vault, err := device.NewVaultFromEnv()
+	if err != nil {
+		return err
+	}
+
+	if password == "" {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("read password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		return errors.New("password is empty")
+	}
+
+	secret, err := vault.Encrypt(password)
+	if err != nil {
+		return err
+	}
+	fmt.Println(secret)
+	return nil
+}
+
+// rotate re-encrypts the secrets of the settings file and of the device
+// inventory with the current key. The old keys must still be listed so that
+// the secrets can be decrypted.
+func rotate() error {
+	vault, err := device.NewVaultFromEnv()
+	if err != nil {
+		return err
+	}
+	if !vault.CanEncrypt() {
+		return errors.New("encryption key not set (DEVICE_ENCRYPTION_KEYS or DEVICE_ENCRYPTION_KEY environment variable)")
+	}
+
+	n, err := rotateFile(vault, configYml)
+	if err != nil {
+		return fmt.Errorf("%s: %w", configYml, err)
+	}
+	fmt.Printf("%s: %d secrets re-encrypted with key %s\n", configYml, n, vault.CurrentKeyID())
+
+	if skipDB {
+		return nil
+	}
+	config.ExtendConfig = &ext.ExtConfig
+	config.Setup(file.NewSource(file.WithPath(configYml)), database.Setup)
+	for host, db := range sdk.Runtime.GetDb() {
+		if !db.Migrator().HasTable("sys_device") {
+			continue
+		}
+		n, err := service.RotateSecrets(db, vault)
+		if err != nil {
+			return fmt.Errorf("database %s: %w", host, err)
+		}
+		fmt.Printf("database %s: %d devices re-encrypted\n", host, n)
+	}
+	fmt.Println(pkg.Green("device credentials rotated"))
+	return nil
+}
+
+// rotateFile rewrites the secrets of a text file in place
+func rotateFile(vault *device.Vault, path string) (int, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	out, n, err := vault.RotateText(data)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out, info.Mode().Perm()); err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp, path)
+}
+
+// verifyLog checks the execution log and its backups against the
+// log.integrity key of the settings file. It fails when the chain is broken,
+// so that it can run from cron.
+func verifyLog() error {
+	s, found, err := ext.LoadDeviceConfig(configYml)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%s has no settings.device block", configYml)
+	}
+	cfg := device.ConfigFromSettings(s)
+	result, err := device.VerifyLog(&cfg.Log)
+	if err != nil {
+		return err
+	}
+	for _, file := range result.Files {
+		fmt.Println(file)
+	}
+	if result.Unchained > 0 {
+		fmt.Printf("%d entries written before log.integrity was enabled\n", result.Unchained)
+	}
+	if !result.Valid {
+		b := result.Break
+		return fmt.Errorf("hash chain broken at %s line %d: %s", b.File, b.Line, b.Reason)
+	}
+	if result.Entries == 0 {
+		fmt.Println("no protected entries")
+		return nil
+	}
+	fmt.Println(pkg.Green(fmt.Sprintf("%d entries verified, seq %d to %d", result.Entries, result.FirstSeq, result.LastSeq)))
+	return nil
+}
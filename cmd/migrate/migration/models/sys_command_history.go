@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+type SysCommandHistory struct {
+	HistoryId  int       `json:"historyId" gorm:"primaryKey;autoIncrement;comment:记录编码"`
+	ExecutedAt time.Time `json:"executedAt" gorm:"index;comment:执行时间"`
+	DeviceId   int       `json:"deviceId" gorm:"index;comment:设备编码"`
+	UserId     string    `json:"userId" gorm:"size:64;index;comment:用户编码"`
+	Username   string    `json:"username" gorm:"size:128;index;comment:用户名"`
+	Command    string    `json:"command" gorm:"type:text;comment:命令"`
+	Output     string    `json:"output,omitempty" gorm:"type:text;comment:输出(log.include_output 开启时)"`
+	OutputSize int       `json:"outputSize" gorm:"comment:输出大小(字节)"`
+	Success    bool      `json:"success" gorm:"index;comment:是否成功"`
+	Error      string    `json:"error,omitempty" gorm:"type:text;comment:错误信息"`
+	Duration   int64     `json:"duration" gorm:"comment:耗时(毫秒)"`
+	ClientIp   string    `json:"clientIp" gorm:"size:64;index;comment:客户端IP"`
+	SessionId  string    `json:"sessionId" gorm:"size:64;index;comment:终端会话"`
+	Policy     string    `json:"policy" gorm:"size:16;comment:命令策略 deny/confirm"`
+}
+
+func (SysCommandHistory) TableName() string {
+	return "sys_command_history"
+}
@@ -0,0 +1,16 @@
+package models
+
+type SysCommandPolicy struct {
+	PolicyId int    `json:"policyId" gorm:"primaryKey;autoIncrement;comment:规则编码"`
+	RoleKey  string `json:"roleKey" gorm:"size:128;index;comment:角色代码，*为所有角色"`
+	Action   string `json:"action" gorm:"size:16;comment:动作 allow/deny/confirm"`
+	Pattern  string `json:"pattern" gorm:"size:255;comment:命令正则"`
+	Status   int    `json:"status" gorm:"size:1;comment:状态 1停用 2正常"`
+	Remark   string `json:"remark" gorm:"size:255;comment:备注"`
+	ControlBy
+	ModelTime
+}
+
+func (SysCommandPolicy) TableName() string {
+	return "sys_command_policy"
+}
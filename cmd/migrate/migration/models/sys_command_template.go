@@ -0,0 +1,16 @@
+package models
+
+type SysCommandTemplate struct {
+	TemplateId  int    `json:"templateId" gorm:"primaryKey;autoIncrement;comment:模板编码"`
+	Name        string `json:"name" gorm:"size:128;comment:模板名称"`
+	Description string `json:"description" gorm:"size:255;comment:描述"`
+	Body        string `json:"body" gorm:"type:text;comment:模板内容(text/template)"`
+	Params      string `json:"params" gorm:"type:text;comment:参数定义"`
+	Status      int    `json:"status" gorm:"size:1;comment:状态 1停用 2正常"`
+	ControlBy
+	ModelTime
+}
+
+func (SysCommandTemplate) TableName() string {
+	return "sys_command_template"
+}
@@ -0,0 +1,28 @@
+package models
+
+type SysDevice struct {
+	DeviceId int    `json:"deviceId" gorm:"primaryKey;autoIncrement;comment:设备编码"`
+	Name     string `json:"name" gorm:"size:128;comment:设备名称"`
+	Protocol string `json:"protocol" gorm:"size:16;comment:连接协议"`
+	Vendor   string `json:"vendor" gorm:"size:32;comment:设备厂商"`
+	Host     string `json:"host" gorm:"size:128;comment:主机地址"`
+	Port     int    `json:"port" gorm:"comment:端口"`
+	Username string `json:"username" gorm:"size:64;comment:用户名"`
+	Password string `json:"-" gorm:"size:255;comment:密码"`
+	Timeout  int    `json:"timeout" gorm:"comment:连接超时(秒)"`
+	Status   int    `json:"status" gorm:"size:1;comment:状态 1停用 2正常"`
+	Remark   string `json:"remark" gorm:"size:255;comment:备注"`
+	// 特权模式（enable）密码，可为 encrypted: 密文，为空时使用登录密码
+	EnablePassword string `json:"-" gorm:"size:255;comment:特权密码"`
+	// SSH/NETCONF 私钥认证与主机密钥校验，私钥和口令可为 encrypted: 密文
+	PrivateKey           string `json:"-" gorm:"type:text;comment:私钥"`
+	PrivateKeyPassphrase string `json:"-" gorm:"size:255;comment:私钥口令"`
+	HostKeyPolicy        string `json:"hostKeyPolicy" gorm:"size:16;comment:主机密钥策略 tofu strict insecure"`
+	HostKeyFingerprint   string `json:"hostKeyFingerprint" gorm:"size:128;comment:固定主机密钥指纹"`
+	ControlBy
+	ModelTime
+}
+
+func (SysDevice) TableName() string {
+	return "sys_device"
+}
@@ -0,0 +1,98 @@
+package version_local
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"gorm.io/gorm"
+
+	devicemodels "opt-switch/app/device/models"
+	"opt-switch/cmd/migrate/migration"
+	"opt-switch/cmd/migrate/migration/models"
+	common "opt-switch/common/models"
+	ext "opt-switch/config"
+	"opt-switch/pkg/device"
+)
+
+func init() {
+	_, fileName, _, _ := runtime.Caller(0)
+	migration.Migrate.SetVersion(migration.GetFilename(fileName), _1792246821371SysDevice)
+}
+
+// _1792246821371SysDevice creates the device inventory and seeds it with the
+// device from the settings file as device #1
+func _1792246821371SysDevice(db *gorm.DB, version string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Migrator().AutoMigrate(
+			new(models.SysDevice),
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := seedDevice(tx); err != nil {
+			return err
+		}
+
+		return tx.Create(&common.Migration{
+			Version: version,
+		}).Error
+	})
+}
+
+// seedDevice stores the settings file device, remote or local, as device #1.
+// The record is created through the inventory model so that its credentials
+// are encrypted like those entered through the API.
+func seedDevice(tx *gorm.DB) error {
+	cfg := device.ConfigFromSettings(ext.ExtConfig.Device)
+	if !device.HasDevice(cfg) {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&models.SysDevice{}).Where("device_id = ?", 1).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	conn := cfg.Connection
+	privateKey := conn.PrivateKey
+	if conn.PrivateKeyFile != "" {
+		// the inventory stores the key itself
+		key, err := os.ReadFile(conn.PrivateKeyFile)
+		if err != nil {
+			return fmt.Errorf("read private key of the settings file device: %w", err)
+		}
+		privateKey = string(key)
+	}
+	err := tx.Create(&devicemodels.SysDevice{
+		DeviceId:             device.DefaultDeviceID,
+		Name:                 "default",
+		Protocol:             conn.Protocol,
+		Vendor:               conn.Vendor,
+		Host:                 conn.Host,
+		Port:                 conn.Port,
+		Username:             conn.Username,
+		Password:             conn.Password,
+		Timeout:              conn.Timeout,
+		Status:               devicemodels.DeviceStatusEnabled,
+		Remark:               "Imported from settings file",
+		EnablePassword:       conn.EnablePassword,
+		PrivateKey:           privateKey,
+		PrivateKeyPassphrase: conn.PrivateKeyPassphrase,
+		HostKeyPolicy:        conn.HostKeyPolicy,
+		HostKeyFingerprint:   conn.HostKeyFingerprint,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	// The explicit id leaves the postgres sequence behind, the next device
+	// would be created with id 1 again
+	if tx.Dialector.Name() == "postgres" {
+		return tx.Exec("SELECT setval(pg_get_serial_sequence('sys_device', 'device_id'), (SELECT MAX(device_id) FROM sys_device))").Error
+	}
+	return nil
+}
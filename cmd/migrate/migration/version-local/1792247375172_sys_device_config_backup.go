@@ -0,0 +1,53 @@
+package version_local
+
+import (
+	"runtime"
+
+	"gorm.io/gorm"
+
+	"opt-switch/cmd/migrate/migration"
+	"opt-switch/cmd/migrate/migration/models"
+	common "opt-switch/common/models"
+)
+
+func init() {
+	_, fileName, _, _ := runtime.Caller(0)
+	migration.Migrate.SetVersion(migration.GetFilename(fileName), _1792247375172SysDeviceConfigBackup)
+}
+
+// _1792247375172SysDeviceConfigBackup creates the configuration backup table
+// and schedules a nightly backup of every managed device
+func _1792247375172SysDeviceConfigBackup(db *gorm.DB, version string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Migrator().AutoMigrate(
+			new(models.SysDeviceConfigBackup),
+		)
+		if err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.SysJob{}).Where("invoke_target = ?", "DeviceConfigBackup").Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			err = tx.Create(&models.SysJob{
+				JobName:        "设备配置备份",
+				JobGroup:       "SYSTEM",
+				JobType:        2,
+				CronExpression: "0 0 2 * * *",
+				InvokeTarget:   "DeviceConfigBackup",
+				MisfirePolicy:  1,
+				Concurrent:     1,
+				Status:         2,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&common.Migration{
+			Version: version,
+		}).Error
+	})
+}
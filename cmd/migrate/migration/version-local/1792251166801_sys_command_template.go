@@ -0,0 +1,49 @@
+package version_local
+
+import (
+	"runtime"
+
+	"gorm.io/gorm"
+
+	"opt-switch/cmd/migrate/migration"
+	"opt-switch/cmd/migrate/migration/models"
+	common "opt-switch/common/models"
+)
+
+func init() {
+	_, fileName, _, _ := runtime.Caller(0)
+	migration.Migrate.SetVersion(migration.GetFilename(fileName), _1792251166801SysCommandTemplate)
+}
+
+// _1792251166801SysCommandTemplate creates the command template table with an
+// example template
+func _1792251166801SysCommandTemplate(db *gorm.DB, version string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Migrator().AutoMigrate(
+			new(models.SysCommandTemplate),
+		)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Create(&models.SysCommandTemplate{
+			Name:        "设置端口VLAN",
+			Description: "将接入端口划入指定VLAN",
+			Body: "configure terminal\n" +
+				"interface {{.port}}\n" +
+				"switchport mode access\n" +
+				"switchport access vlan {{.vlan}}\n" +
+				"end",
+			Params: `[{"name":"port","type":"interface","label":"端口","required":true},` +
+				`{"name":"vlan","type":"int","label":"VLAN","required":true,"min":1,"max":4094}]`,
+			Status: 2,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&common.Migration{
+			Version: version,
+		}).Error
+	})
+}
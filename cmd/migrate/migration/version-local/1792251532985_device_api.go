@@ -0,0 +1,223 @@
+package version_local
+
+import (
+	"runtime"
+	"strconv"
+
+	"gorm.io/gorm"
+
+	"opt-switch/cmd/migrate/migration"
+	"opt-switch/cmd/migrate/migration/models"
+	common "opt-switch/common/models"
+)
+
+func init() {
+	_, fileName, _, _ := runtime.Caller(0)
+	migration.Migrate.SetVersion(migration.GetFilename(fileName), _1792251532985DeviceApi)
+}
+
+// deviceApi is a device route registered in sys_api
+type deviceApi struct {
+	handle string
+	title  string
+	path   string
+	action string
+}
+
+// deviceMenu is a menu or button of the device management menu
+type deviceMenu struct {
+	name       string
+	title      string
+	icon       string
+	path       string
+	menuType   string
+	permission string
+	component  string
+	apis       []deviceApi
+	children   []deviceMenu
+}
+
+const deviceApiPkg = "opt-switch/app/device/apis."
+
+var deviceMenus = deviceMenu{
+	name:      "Device",
+	title:     "设备管理",
+	icon:      "network",
+	path:      "/device",
+	menuType:  "M",
+	component: "Layout",
+	children: []deviceMenu{
+		{
+			name: "SysDeviceManage", title: "设备列表", icon: "list", path: "/device/sys-device", menuType: "C",
+			permission: "device:sysDevice:list", component: "/device/sys-device/index",
+			apis: []deviceApi{
+				{deviceApiPkg + "SysDevice.GetPage-fm", "设备列表", "/api/v1/device/inventory", "GET"},
+				{deviceApiPkg + "SysDevice.Get-fm", "设备通过id获取", "/api/v1/device/inventory/:id", "GET"},
+				{deviceApiPkg + "(*CommandAPI).GetStatus-fm", "设备连接状态", "/api/v1/device/status", "GET"},
+			},
+			children: []deviceMenu{
+				{title: "新增设备", menuType: "F", permission: "device:sysDevice:add", apis: []deviceApi{
+					{deviceApiPkg + "SysDevice.Insert-fm", "设备创建", "/api/v1/device/inventory", "POST"},
+				}},
+				{title: "修改设备", menuType: "F", permission: "device:sysDevice:edit", apis: []deviceApi{
+					{deviceApiPkg + "SysDevice.Update-fm", "设备编辑", "/api/v1/device/inventory/:id", "PUT"},
+				}},
+				{title: "删除设备", menuType: "F", permission: "device:sysDevice:remove", apis: []deviceApi{
+					{deviceApiPkg + "SysDevice.Delete-fm", "设备删除", "/api/v1/device/inventory", "DELETE"},
+				}},
+			},
+		},
+		{
+			name: "DeviceCommand", title: "命令执行", icon: "code", path: "/device/command", menuType: "C",
+			permission: "device:command:list", component: "/device/command/index",
+			apis: []deviceApi{
+				{deviceApiPkg + "(*CommandAPI).GetHistory-fm", "命令执行历史", "/api/v1/device/command/history", "GET"},
+			},
+			children: []deviceMenu{
+				{title: "执行命令", menuType: "F", permission: "device:command:exec", apis: []deviceApi{
+					{deviceApiPkg + "(*CommandAPI).ExecuteCommand-fm", "执行单条命令", "/api/v1/device/command/execute", "POST"},
+					{deviceApiPkg + "(*CommandAPI).ExecuteBatch-fm", "批量执行命令", "/api/v1/device/command/batch", "POST"},
+				}},
+				{title: "交互终端", menuType: "F", permission: "device:terminal:connect", apis: []deviceApi{
+					{deviceApiPkg + "(*TerminalAPI).Connect-fm", "设备交互终端", "/ws/device/terminal", "GET"},
+				}},
+			},
+		},
+		{
+			name: "DeviceNetconf", title: "NETCONF", icon: "tree", path: "/device/netconf", menuType: "C",
+			permission: "device:netconf:list", component: "/device/netconf/index",
+			apis: []deviceApi{
+				{deviceApiPkg + "(*NetconfAPI).GetCapabilities-fm", "NETCONF能力列表", "/api/v1/device/netconf/capabilities", "GET"},
+				{deviceApiPkg + "(*NetconfAPI).Get-fm", "NETCONF查询状态", "/api/v1/device/netconf/get", "POST"},
+				{deviceApiPkg + "(*NetconfAPI).GetConfig-fm", "NETCONF查询配置", "/api/v1/device/netconf/get-config", "POST"},
+			},
+			children: []deviceMenu{
+				{title: "修改配置", menuType: "F", permission: "device:netconf:edit", apis: []deviceApi{
+					{deviceApiPkg + "(*NetconfAPI).EditConfig-fm", "NETCONF修改配置", "/api/v1/device/netconf/edit-config", "POST"},
+					{deviceApiPkg + "(*NetconfAPI).Commit-fm", "NETCONF提交配置", "/api/v1/device/netconf/commit", "POST"},
+				}},
+			},
+		},
+		{
+			name: "DeviceConfigBackup", title: "配置备份", icon: "documentation", path: "/device/config-backup", menuType: "C",
+			permission: "device:configBackup:list", component: "/device/config-backup/index",
+			apis: []deviceApi{
+				{deviceApiPkg + "ConfigBackup.GetPage-fm", "配置备份列表", "/api/v1/device/config/backups", "GET"},
+				{deviceApiPkg + "ConfigBackup.Get-fm", "配置备份通过id获取", "/api/v1/device/config/backups/:id", "GET"},
+				{deviceApiPkg + "ConfigBackup.Diff-fm", "配置备份对比", "/api/v1/device/config/backups/diff", "GET"},
+			},
+			children: []deviceMenu{
+				{title: "立即备份", menuType: "F", permission: "device:configBackup:add", apis: []deviceApi{
+					{deviceApiPkg + "ConfigBackup.Capture-fm", "立即备份配置", "/api/v1/device/config/backups", "POST"},
+				}},
+				{title: "恢复配置", menuType: "F", permission: "device:configBackup:restore", apis: []deviceApi{
+					{deviceApiPkg + "ConfigBackup.Restore-fm", "恢复配置", "/api/v1/device/config/backups/:id/restore", "POST"},
+				}},
+			},
+		},
+		{
+			name: "DeviceCommandTemplate", title: "命令模板", icon: "form", path: "/device/command-template", menuType: "C",
+			permission: "device:commandTemplate:list", component: "/device/command-template/index",
+			apis: []deviceApi{
+				{deviceApiPkg + "SysCommandTemplate.GetPage-fm", "命令模板列表", "/api/v1/device/command/templates", "GET"},
+				{deviceApiPkg + "SysCommandTemplate.Get-fm", "命令模板通过id获取", "/api/v1/device/command/templates/:id", "GET"},
+			},
+			children: []deviceMenu{
+				{title: "新增模板", menuType: "F", permission: "device:commandTemplate:add", apis: []deviceApi{
+					{deviceApiPkg + "SysCommandTemplate.Insert-fm", "命令模板创建", "/api/v1/device/command/templates", "POST"},
+				}},
+				{title: "修改模板", menuType: "F", permission: "device:commandTemplate:edit", apis: []deviceApi{
+					{deviceApiPkg + "SysCommandTemplate.Update-fm", "命令模板编辑", "/api/v1/device/command/templates/:id", "PUT"},
+				}},
+				{title: "删除模板", menuType: "F", permission: "device:commandTemplate:remove", apis: []deviceApi{
+					{deviceApiPkg + "SysCommandTemplate.Delete-fm", "命令模板删除", "/api/v1/device/command/templates", "DELETE"},
+				}},
+				{title: "执行模板", menuType: "F", permission: "device:commandTemplate:run", apis: []deviceApi{
+					{deviceApiPkg + "SysCommandTemplate.Run-fm", "执行命令模板", "/api/v1/device/command/template/:id/run", "POST"},
+				}},
+			},
+		},
+		{
+			name: "DeviceCommandPolicy", title: "命令策略", icon: "lock", path: "/device/command-policy", menuType: "C",
+			permission: "device:commandPolicy:list", component: "/device/command-policy/index",
+			apis: []deviceApi{
+				{deviceApiPkg + "SysCommandPolicy.GetPage-fm", "命令策略列表", "/api/v1/device/command/policies", "GET"},
+				{deviceApiPkg + "SysCommandPolicy.Get-fm", "命令策略通过id获取", "/api/v1/device/command/policies/:id", "GET"},
+			},
+			children: []deviceMenu{
+				{title: "新增策略", menuType: "F", permission: "device:commandPolicy:add", apis: []deviceApi{
+					{deviceApiPkg + "SysCommandPolicy.Insert-fm", "命令策略创建", "/api/v1/device/command/policies", "POST"},
+				}},
+				{title: "修改策略", menuType: "F", permission: "device:commandPolicy:edit", apis: []deviceApi{
+					{deviceApiPkg + "SysCommandPolicy.Update-fm", "命令策略编辑", "/api/v1/device/command/policies/:id", "PUT"},
+				}},
+				{title: "删除策略", menuType: "F", permission: "device:commandPolicy:remove", apis: []deviceApi{
+					{deviceApiPkg + "SysCommandPolicy.Delete-fm", "命令策略删除", "/api/v1/device/command/policies", "DELETE"},
+				}},
+			},
+		},
+	},
+}
+
+// _1792251532985DeviceApi registers the device routes as sys_api entries under
+// a device management menu, so that they can be granted in role permission
+// assignment
+func _1792251532985DeviceApi(db *gorm.DB, version string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := createDeviceMenu(tx, &deviceMenus, 0, "/0", 20); err != nil {
+			return err
+		}
+
+		return tx.Create(&common.Migration{
+			Version: version,
+		}).Error
+	})
+}
+
+func createDeviceMenu(tx *gorm.DB, m *deviceMenu, parentId int, parentPaths string, sort int) error {
+	apis := make([]models.SysApi, 0, len(m.apis))
+	for _, a := range m.apis {
+		api := models.SysApi{}
+		err := tx.Where(models.SysApi{Path: a.path, Action: a.action}).
+			Attrs(models.SysApi{Handle: a.handle, Title: a.title, Type: "BUS"}).
+			FirstOrCreate(&api).Error
+		if err != nil {
+			return err
+		}
+		apis = append(apis, api)
+	}
+
+	menu := models.SysMenu{
+		MenuName:   m.name,
+		Title:      m.title,
+		Icon:       m.icon,
+		Path:       m.path,
+		MenuType:   m.menuType,
+		Action:     "无",
+		Permission: m.permission,
+		ParentId:   parentId,
+		Component:  m.component,
+		Sort:       sort,
+		Visible:    "0",
+		IsFrame:    "1",
+		SysApi:     apis,
+	}
+	if m.menuType == "F" {
+		menu.Icon = "app-group-fill"
+		menu.Action = ""
+	}
+	if err := tx.Create(&menu).Error; err != nil {
+		return err
+	}
+	menu.Paths = parentPaths + "/" + strconv.Itoa(menu.MenuId)
+	if err := tx.Model(&menu).Update("paths", menu.Paths).Error; err != nil {
+		return err
+	}
+
+	for i := range m.children {
+		if err := createDeviceMenu(tx, &m.children[i], menu.MenuId, menu.Paths, (i+1)*10); err != nil {
+			return err
+		}
+	}
+	return nil
+}
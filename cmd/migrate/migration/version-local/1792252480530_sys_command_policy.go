@@ -0,0 +1,53 @@
+package version_local
+
+import (
+	"runtime"
+
+	"gorm.io/gorm"
+
+	"opt-switch/cmd/migrate/migration"
+	"opt-switch/cmd/migrate/migration/models"
+	common "opt-switch/common/models"
+)
+
+func init() {
+	_, fileName, _, _ := runtime.Caller(0)
+	migration.Migrate.SetVersion(migration.GetFilename(fileName), _1792252480530SysCommandPolicy)
+}
+
+// _1792252480530SysCommandPolicy creates the command policy table. Reloading
+// and erasing the device require confirmation for every role by default.
+func _1792252480530SysCommandPolicy(db *gorm.DB, version string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Migrator().AutoMigrate(
+			new(models.SysCommandPolicy),
+		)
+		if err != nil {
+			return err
+		}
+
+		list := []models.SysCommandPolicy{
+			{
+				RoleKey: "*",
+				Action:  "confirm",
+				Pattern: `(?i)^rel(o(a(d)?)?)?(\s|$)`,
+				Status:  2,
+				Remark:  "重启设备",
+			},
+			{
+				RoleKey: "*",
+				Action:  "confirm",
+				Pattern: `(?i)^(erase|format|delete|wr(ite)?\s+er(ase)?)(\s|$)`,
+				Status:  2,
+				Remark:  "擦除或删除配置、文件",
+			},
+		}
+		if err := tx.Create(&list).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&common.Migration{
+			Version: version,
+		}).Error
+	})
+}
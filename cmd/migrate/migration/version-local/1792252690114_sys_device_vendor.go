@@ -0,0 +1,32 @@
+package version_local
+
+import (
+	"runtime"
+
+	"gorm.io/gorm"
+
+	"opt-switch/cmd/migrate/migration"
+	"opt-switch/cmd/migrate/migration/models"
+	common "opt-switch/common/models"
+)
+
+func init() {
+	_, fileName, _, _ := runtime.Caller(0)
+	migration.Migrate.SetVersion(migration.GetFilename(fileName), _1792252690114SysDeviceVendor)
+}
+
+// _1792252690114SysDeviceVendor adds the vendor column used to pick output parsers
+func _1792252690114SysDeviceVendor(db *gorm.DB, version string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Migrator().AutoMigrate(
+			new(models.SysDevice),
+		)
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&common.Migration{
+			Version: version,
+		}).Error
+	})
+}
@@ -0,0 +1,59 @@
+package version_local
+
+import (
+	"runtime"
+
+	"gorm.io/gorm"
+
+	"opt-switch/cmd/migrate/migration"
+	"opt-switch/cmd/migrate/migration/models"
+	common "opt-switch/common/models"
+)
+
+func init() {
+	_, fileName, _, _ := runtime.Caller(0)
+	migration.Migrate.SetVersion(migration.GetFilename(fileName), _1792252861407DeviceCommandJobApi)
+}
+
+// _1792252861407DeviceCommandJobApi grants the asynchronous command job routes with
+// the command execution button
+func _1792252861407DeviceCommandJobApi(db *gorm.DB, version string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := appendDeviceApis(tx, "device:command:exec", []deviceApi{
+			{deviceApiPkg + "(*CommandAPI).SubmitJob-fm", "提交异步命令任务", "/api/v1/device/command/jobs", "POST"},
+			{deviceApiPkg + "(*CommandAPI).GetJob-fm", "查询异步命令任务", "/api/v1/device/command/jobs/:id", "GET"},
+			{deviceApiPkg + "(*CommandAPI).CancelJob-fm", "取消异步命令任务", "/api/v1/device/command/jobs/:id/cancel", "POST"},
+			{deviceApiPkg + "(*CommandAPI).JobEvents-fm", "订阅异步命令任务", "/api/v1/device/command/jobs/:id/events", "GET"},
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&common.Migration{
+			Version: version,
+		}).Error
+	})
+}
+
+// appendDeviceApis registers routes in sys_api and links them to the menu or
+// button with the given permission. Roles already holding the permission
+// pick the routes up the next time the role is saved.
+func appendDeviceApis(tx *gorm.DB, permission string, apis []deviceApi) error {
+	var menu models.SysMenu
+	if err := tx.Where("permission = ?", permission).First(&menu).Error; err != nil {
+		return err
+	}
+
+	rows := make([]models.SysApi, 0, len(apis))
+	for _, a := range apis {
+		api := models.SysApi{}
+		err := tx.Where(models.SysApi{Path: a.path, Action: a.action}).
+			Attrs(models.SysApi{Handle: a.handle, Title: a.title, Type: "BUS"}).
+			FirstOrCreate(&api).Error
+		if err != nil {
+			return err
+		}
+		rows = append(rows, api)
+	}
+	return tx.Model(&menu).Association("SysApi").Append(rows)
+}
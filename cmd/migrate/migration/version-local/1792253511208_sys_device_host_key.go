@@ -0,0 +1,47 @@
+package version_local
+
+import (
+	"runtime"
+
+	"gorm.io/gorm"
+
+	"opt-switch/cmd/migrate/migration"
+	"opt-switch/cmd/migrate/migration/models"
+	common "opt-switch/common/models"
+)
+
+func init() {
+	_, fileName, _, _ := runtime.Caller(0)
+	migration.Migrate.SetVersion(migration.GetFilename(fileName), _1792253511208SysDeviceHostKey)
+}
+
+// _1792253511208SysDeviceHostKey adds the private key and host key columns and
+// grants the host key routes with the device list and edit buttons
+func _1792253511208SysDeviceHostKey(db *gorm.DB, version string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Migrator().AutoMigrate(
+			new(models.SysDevice),
+		)
+		if err != nil {
+			return err
+		}
+
+		err = appendDeviceApis(tx, "device:sysDevice:list", []deviceApi{
+			{deviceApiPkg + "(*HostKeyAPI).Get-fm", "查看设备主机密钥", "/api/v1/device/hostkey", "GET"},
+		})
+		if err != nil {
+			return err
+		}
+		err = appendDeviceApis(tx, "device:sysDevice:edit", []deviceApi{
+			{deviceApiPkg + "(*HostKeyAPI).Accept-fm", "接受设备主机密钥", "/api/v1/device/hostkey/accept", "POST"},
+			{deviceApiPkg + "(*HostKeyAPI).Forget-fm", "删除设备主机密钥", "/api/v1/device/hostkey", "DELETE"},
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&common.Migration{
+			Version: version,
+		}).Error
+	})
+}
@@ -0,0 +1,38 @@
+package version_local
+
+import (
+	"runtime"
+
+	"gorm.io/gorm"
+
+	"opt-switch/cmd/migrate/migration"
+	common "opt-switch/common/models"
+)
+
+func init() {
+	_, fileName, _, _ := runtime.Caller(0)
+	migration.Migrate.SetVersion(migration.GetFilename(fileName), _1792253745301DeviceConfigReloadApi)
+}
+
+// _1792253745301DeviceConfigReloadApi grants the configuration reload routes
+// with the device list and edit buttons
+func _1792253745301DeviceConfigReloadApi(db *gorm.DB, version string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := appendDeviceApis(tx, "device:sysDevice:list", []deviceApi{
+			{deviceApiPkg + "(*DeviceConfigAPI).LastReload-fm", "查看设备配置热加载结果", "/api/v1/device/config/reload", "GET"},
+		})
+		if err != nil {
+			return err
+		}
+		err = appendDeviceApis(tx, "device:sysDevice:edit", []deviceApi{
+			{deviceApiPkg + "(*DeviceConfigAPI).Reload-fm", "热加载设备配置", "/api/v1/device/config", "PUT"},
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&common.Migration{
+			Version: version,
+		}).Error
+	})
+}
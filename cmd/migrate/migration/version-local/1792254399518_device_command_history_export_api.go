@@ -0,0 +1,32 @@
+package version_local
+
+import (
+	"runtime"
+
+	"gorm.io/gorm"
+
+	"opt-switch/cmd/migrate/migration"
+	common "opt-switch/common/models"
+)
+
+func init() {
+	_, fileName, _, _ := runtime.Caller(0)
+	migration.Migrate.SetVersion(migration.GetFilename(fileName), _1792254399518DeviceCommandHistoryExportApi)
+}
+
+// _1792254399518DeviceCommandHistoryExportApi grants the history export
+// with the command history menu
+func _1792254399518DeviceCommandHistoryExportApi(db *gorm.DB, version string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := appendDeviceApis(tx, "device:command:list", []deviceApi{
+			{deviceApiPkg + "(*CommandAPI).ExportHistory-fm", "导出命令执行历史", "/api/v1/device/command/history/export", "GET"},
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&common.Migration{
+			Version: version,
+		}).Error
+	})
+}
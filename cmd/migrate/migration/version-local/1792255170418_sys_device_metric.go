@@ -0,0 +1,40 @@
+package version_local
+
+import (
+	"runtime"
+
+	"gorm.io/gorm"
+
+	"opt-switch/cmd/migrate/migration"
+	"opt-switch/cmd/migrate/migration/models"
+	common "opt-switch/common/models"
+)
+
+func init() {
+	_, fileName, _, _ := runtime.Caller(0)
+	migration.Migrate.SetVersion(migration.GetFilename(fileName), _1792255170418SysDeviceMetric)
+}
+
+// _1792255170418SysDeviceMetric creates the switch telemetry table and
+// grants the telemetry charts with the device list
+func _1792255170418SysDeviceMetric(db *gorm.DB, version string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Migrator().AutoMigrate(
+			new(models.SysDeviceMetric),
+		)
+		if err != nil {
+			return err
+		}
+
+		err = appendDeviceApis(tx, "device:sysDevice:list", []deviceApi{
+			{deviceApiPkg + "(*CommandAPI).GetMetrics-fm", "设备遥测指标", "/api/v1/device/metrics", "GET"},
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&common.Migration{
+			Version: version,
+		}).Error
+	})
+}
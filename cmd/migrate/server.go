@@ -18,6 +18,7 @@ import (
 	_ "opt-switch/cmd/migrate/migration/version-local"
 	"opt-switch/common/database"
 	"opt-switch/common/models"
+	ext "opt-switch/config"
 )
 
 var (
@@ -47,6 +48,8 @@ func run() {
 
 	if !generate {
 		fmt.Println(`start init`)
+		// 注入配置扩展项
+		config.ExtendConfig = &ext.ExtConfig
 		//1. 读取配置
 		config.Setup(
 			file.NewSource(file.WithPath(configYml)),
@@ -90,6 +93,12 @@ func migrateModel() error {
 func initDB() {
 	//3. 初始化数据库链接
 	database.Setup()
+	// 设备清单迁移以 settings.device 中的设备作为 1 号设备，该节需单独读取
+	if deviceConfig, found, err := ext.LoadDeviceConfig(configYml); err != nil {
+		fmt.Printf("read device settings error, %s\n", err.Error())
+	} else if found {
+		ext.ExtConfig.Device = deviceConfig
+	}
 	//4. 数据库迁移
 	fmt.Println("数据库迁移开始")
 	_ = migrateModel()
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	httpMetricsOnce  sync.Once
+	httpRequests     *prometheus.CounterVec
+	httpRequestsTime *prometheus.HistogramVec
+)
+
+// Metrics 统计 HTTP 请求数与耗时，按路由模板而非实际路径分组，未匹配的请求归入 unmatched
+func Metrics() gin.HandlerFunc {
+	httpMetricsOnce.Do(func() {
+		httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests by method, route and status.",
+		}, []string{"method", "route", "status"})
+		httpRequestsTime = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by method and route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"})
+		prometheus.MustRegister(httpRequests, httpRequestsTime)
+	})
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpRequestsTime.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
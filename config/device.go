@@ -0,0 +1,30 @@
+package config
+
+import (
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadDeviceConfig 读取配置文件中的 settings.device。
+// 该节不在 settings.extend 下，框架不会加载它，启动和热加载都经由此处读取；
+// found 表示配置文件中是否有该节
+func LoadDeviceConfig(path string) (cfg DeviceConfig, found bool, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, false, err
+	}
+
+	var file struct {
+		Settings struct {
+			Device *DeviceConfig `yaml:"device"`
+		} `yaml:"settings"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return cfg, false, err
+	}
+	if file.Settings.Device == nil {
+		return cfg, false, nil
+	}
+	return *file.Settings.Device, true, nil
+}
@@ -62,12 +62,28 @@ type MiddlewareConfig struct {
 
 // DeviceConnectionConfig 设备连接配置
 type DeviceConnectionConfig struct {
-	Host     string `yaml:"host" json:"host"`
-	Port     int    `yaml:"port" json:"port"`
-	Protocol string `yaml:"protocol" json:"protocol"`
-	Username string `yaml:"username" json:"username"`
-	Password string `yaml:"password" json:"password"`
-	Timeout  int    `yaml:"timeout" json:"timeout"`
+	Host           string `yaml:"host" json:"host"`
+	Port           int    `yaml:"port" json:"port"`
+	Protocol       string `yaml:"protocol" json:"protocol"`
+	Vendor         string `yaml:"vendor" json:"vendor"`
+	Username       string `yaml:"username" json:"username"`
+	Password       string `yaml:"password" json:"password"`
+	EnablePassword string `yaml:"enable_password" json:"enable_password"`
+	Timeout        int    `yaml:"timeout" json:"timeout"`
+
+	// 本机 CLI（protocol: local）的可执行文件路径和参数，无需地址与密码
+	CLIPath string   `yaml:"cli_path" json:"cli_path"`
+	CLIArgs []string `yaml:"cli_args" json:"cli_args"`
+
+	// SSH/NETCONF 私钥认证：私钥文件或内联 PEM（可为 encrypted:），加密私钥的口令
+	PrivateKeyFile       string `yaml:"private_key_file" json:"private_key_file"`
+	PrivateKey           string `yaml:"private_key" json:"private_key"`
+	PrivateKeyPassphrase string `yaml:"private_key_passphrase" json:"private_key_passphrase"`
+	// 主机密钥校验：tofu（默认，首次连接时信任）、strict、insecure；
+	// host_key_fingerprint 固定 SHA256 指纹，known_hosts_file 默认 config/known_hosts
+	HostKeyPolicy      string `yaml:"host_key_policy" json:"host_key_policy"`
+	HostKeyFingerprint string `yaml:"host_key_fingerprint" json:"host_key_fingerprint"`
+	KnownHostsFile     string `yaml:"known_hosts_file" json:"known_hosts_file"`
 }
 
 // DevicePoolConfig 设备连接池配置
@@ -78,6 +94,8 @@ type DevicePoolConfig struct {
 	CommandTimeout int `yaml:"command_timeout" json:"command_timeout"`
 	QueueTimeout   int `yaml:"queue_timeout" json:"queue_timeout"`
 	MaxQueueSize   int `yaml:"max_queue_size" json:"max_queue_size"`
+
+	KeepaliveInterval int `yaml:"keepalive_interval" json:"keepalive_interval"` // 空闲连接探活间隔（秒）
 }
 
 // DeviceLogConfig 设备日志配置
@@ -90,6 +108,49 @@ type DeviceLogConfig struct {
 	Compress      bool   `yaml:"compress" json:"compress"`
 	IncludeOutput bool   `yaml:"include_output" json:"include_output"`
 	MaxOutputSize int    `yaml:"max_output_size" json:"max_output_size"`
+
+	// 将每条命令记录以 RFC 5424 格式转发到远程 syslog
+	Syslog DeviceSyslogConfig `yaml:"syslog" json:"syslog"`
+	// 防篡改：每条记录带上一条记录的哈希和 HMAC，形成哈希链
+	Integrity DeviceIntegrityConfig `yaml:"integrity" json:"integrity"`
+}
+
+// DeviceIntegrityConfig 命令日志哈希链
+type DeviceIntegrityConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// HMAC 密钥，可为 encrypted: 密文
+	Key string `yaml:"key" json:"key"`
+}
+
+// DeviceSyslogConfig 命令记录的 syslog 转发
+type DeviceSyslogConfig struct {
+	// udp、tcp 或 tls，为空时不转发
+	Network string `yaml:"network" json:"network"`
+	// 采集端地址 host:port
+	Address string `yaml:"address" json:"address"`
+	// 设施名，默认 local0
+	Facility string `yaml:"facility" json:"facility"`
+	// APP-NAME，默认 opt-switch
+	AppName string `yaml:"app_name" json:"app_name"`
+	// tls：校验采集端证书的 CA 文件（为空时使用系统根证书），或跳过校验
+	CAFile             string `yaml:"ca_file" json:"ca_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" json:"insecure_skip_verify"`
+}
+
+// DeviceTerminalConfig 交互式终端配置
+type DeviceTerminalConfig struct {
+	IdleTimeout        int `yaml:"idle_timeout" json:"idle_timeout"`
+	MaxSessionsPerUser int `yaml:"max_sessions_per_user" json:"max_sessions_per_user"`
+	// 允许打开终端的其他浏览器来源（如 https://noc.example.com），与服务同源的请求始终允许
+	AllowedOrigins []string `yaml:"allowed_origins" json:"allowed_origins"`
+}
+
+// DeviceBackupConfig 设备配置备份
+type DeviceBackupConfig struct {
+	Command        string   `yaml:"command" json:"command"`
+	IgnorePatterns []string `yaml:"ignore_patterns" json:"ignore_patterns"`
+	EnterConfig    string   `yaml:"enter_config" json:"enter_config"`
+	ExitConfig     string   `yaml:"exit_config" json:"exit_config"`
 }
 
 // DeviceConfig 设备配置
@@ -97,4 +158,61 @@ type DeviceConfig struct {
 	Connection DeviceConnectionConfig `yaml:"connection" json:"connection"`
 	Pool       DevicePoolConfig       `yaml:"pool" json:"pool"`
 	Log        DeviceLogConfig        `yaml:"log" json:"log"`
+	Terminal   DeviceTerminalConfig   `yaml:"terminal" json:"terminal"`
+	Backup     DeviceBackupConfig     `yaml:"backup" json:"backup"`
+	Jobs       DeviceJobConfig        `yaml:"jobs" json:"jobs"`
+	Reload     DeviceReloadConfig     `yaml:"reload" json:"reload"`
+	Telemetry  DeviceTelemetryConfig  `yaml:"telemetry" json:"telemetry"`
+	Profiles   []DeviceProfileConfig  `yaml:"profiles" json:"profiles"`
+}
+
+// DeviceReloadConfig 设备配置热加载
+type DeviceReloadConfig struct {
+	// 检查配置文件变化的间隔（秒，0 = 不监听）
+	WatchInterval int `yaml:"watch_interval" json:"watch_interval"`
+	// 重建连接池时等待旧连接池中排队命令、终端结束的最长时间（秒）
+	DrainTimeout int `yaml:"drain_timeout" json:"drain_timeout"`
+}
+
+// DeviceTelemetryConfig 交换机遥测采集（接口计数、CPU、内存、温度、电源/风扇）
+type DeviceTelemetryConfig struct {
+	// 是否启用采集（需要数据库迁移后的 sys_device_metric 表）
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// 采集间隔（秒，默认 60）
+	Interval int `yaml:"interval" json:"interval"`
+	// 采集命令，需有对应的输出解析器（默认 show interfaces/processes cpu/processes memory/environment）
+	Commands  []string                 `yaml:"commands" json:"commands"`
+	Retention DeviceTelemetryRetention `yaml:"retention" json:"retention"`
+}
+
+// DeviceTelemetryRetention 遥测数据保留时长
+type DeviceTelemetryRetention struct {
+	// 原始采样保留小时数（默认 24）
+	Raw int `yaml:"raw" json:"raw"`
+	// 5 分钟聚合保留天数（默认 7）
+	FiveMinute int `yaml:"five_minute" json:"five_minute"`
+	// 1 小时聚合保留天数（默认 90）
+	Hourly int `yaml:"hourly" json:"hourly"`
+}
+
+// DeviceJobConfig 异步命令任务配置
+type DeviceJobConfig struct {
+	ResultTTL int `yaml:"result_ttl" json:"result_ttl"`
+	MaxJobs   int `yaml:"max_jobs" json:"max_jobs"`
+}
+
+// DeviceProfileConfig 自定义设备配置文件（提示符、分页、提权、错误识别）
+type DeviceProfileConfig struct {
+	Name             string   `yaml:"name" json:"name"`
+	Base             string   `yaml:"base" json:"base"`
+	Prompt           string   `yaml:"prompt" json:"prompt"`
+	PrivilegedPrompt string   `yaml:"privileged_prompt" json:"privileged_prompt"`
+	UsernamePrompt   string   `yaml:"username_prompt" json:"username_prompt"`
+	PasswordPrompt   string   `yaml:"password_prompt" json:"password_prompt"`
+	MorePrompt       string   `yaml:"more_prompt" json:"more_prompt"`
+	EnableCommand    string   `yaml:"enable_command" json:"enable_command"`
+	DisablePaging    []string `yaml:"disable_paging" json:"disable_paging"`
+	ErrorPatterns    []string `yaml:"error_patterns" json:"error_patterns"`
+	LineEnding       string   `yaml:"line_ending" json:"line_ending"`
+	Shell            bool     `yaml:"shell" json:"shell"`
 }
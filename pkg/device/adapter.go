@@ -1,6 +1,11 @@
 package device
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
 
 // ProtocolType represents the protocol type
 type ProtocolType string
@@ -14,11 +19,31 @@ const (
 // ConnectionConfig holds the connection configuration
 type ConnectionConfig struct {
 	Protocol string
+	Vendor   string // selects vendor specific output parsers, generic ones when empty
 	Host     string
 	Port     int
 	Username string
 	Password string
-	Timeout  int // seconds
+	// EnablePassword is sent when the device profile enters privileged mode,
+	// the login password is used when empty
+	EnablePassword string
+	Timeout        int // seconds
+	// CLIPath and CLIArgs start the switch CLI for the local protocol
+	CLIPath string
+	CLIArgs []string
+
+	// PrivateKeyFile or PrivateKey (inline PEM) enable public key
+	// authentication for SSH and NETCONF, PrivateKeyPassphrase decrypts an
+	// encrypted key
+	PrivateKeyFile       string
+	PrivateKey           string
+	PrivateKeyPassphrase string
+	// HostKeyPolicy is tofu (default), strict or insecure. HostKeyFingerprint
+	// pins the SHA256 fingerprint of the host key instead of the known_hosts
+	// file.
+	HostKeyPolicy      string
+	HostKeyFingerprint string
+	KnownHostsFile     string // default config/known_hosts
 }
 
 // DeviceConfig holds the device configuration from config file
@@ -26,6 +51,11 @@ type DeviceConfig struct {
 	Connection ConnectionConfig `yaml:"connection" mapstructure:"connection"`
 	Pool       PoolConfig       `yaml:"pool" mapstructure:"pool"`
 	Log        LogConfig        `yaml:"log" mapstructure:"log"`
+	Terminal   TerminalConfig   `yaml:"terminal" mapstructure:"terminal"`
+	Backup     BackupConfig     `yaml:"backup" mapstructure:"backup"`
+	Jobs       JobConfig        `yaml:"jobs" mapstructure:"jobs"`
+	Reload     ReloadConfig     `yaml:"reload" mapstructure:"reload"`
+	Telemetry  TelemetryConfig  `yaml:"telemetry" mapstructure:"telemetry"`
 }
 
 // PoolConfig holds the connection pool configuration
@@ -36,6 +66,7 @@ type PoolConfig struct {
 	CommandTimeout int  `yaml:"command_timeout" mapstructure:"command_timeout"` // seconds
 	QueueTimeout   int  `yaml:"queue_timeout" mapstructure:"queue_timeout"`   // seconds
 	MaxQueueSize   int  `yaml:"max_queue_size" mapstructure:"max_queue_size"`
+	KeepaliveInterval int `yaml:"keepalive_interval" mapstructure:"keepalive_interval"` // seconds between probes of idle connections
 }
 
 // LogConfig holds the logging configuration
@@ -48,6 +79,17 @@ type LogConfig struct {
 	Compress      bool   `yaml:"compress" mapstructure:"compress"`
 	IncludeOutput bool   `yaml:"include_output" mapstructure:"include_output"`
 	MaxOutputSize int    `yaml:"max_output_size" mapstructure:"max_output_size"` // bytes
+
+	Syslog    SyslogConfig    `yaml:"syslog" mapstructure:"syslog"`       // forward every entry to a remote collector
+	Integrity IntegrityConfig `yaml:"integrity" mapstructure:"integrity"` // hash chain the entries
+}
+
+// BackupConfig holds the configuration backup settings
+type BackupConfig struct {
+	Command        string   `yaml:"command" mapstructure:"command"`                 // command printing the running configuration
+	IgnorePatterns []string `yaml:"ignore_patterns" mapstructure:"ignore_patterns"` // regexps of volatile lines left out of the snapshot hash
+	EnterConfig    string   `yaml:"enter_config" mapstructure:"enter_config"`       // command entering configuration mode for a restore
+	ExitConfig     string   `yaml:"exit_config" mapstructure:"exit_config"`         // command leaving configuration mode
 }
 
 // CommandResult represents the result of a command execution
@@ -55,7 +97,7 @@ type CommandResult struct {
 	Command   string        `json:"command"`
 	Output    string        `json:"output,omitempty"`
 	Error     string        `json:"error,omitempty"`
-	Duration  int64         `json:"duration_ms"`
+	Duration  int64         `json:"durationMs"`
 	Success   bool          `json:"success"`
 	Timestamp int64         `json:"timestamp"`
 }
@@ -77,3 +119,104 @@ type ProtocolAdapter interface {
 	// ProtocolType returns the protocol type
 	ProtocolType() ProtocolType
 }
+
+// KeepaliveAdapter is implemented by adapters that can probe an idle
+// connection without running a command. Keepalive fails when the device no
+// longer answers.
+type KeepaliveAdapter interface {
+	Keepalive(ctx context.Context) error
+}
+
+// AdapterFactory creates an unconnected adapter. The pool calls it once per
+// connection, so adapters never share a client or socket.
+type AdapterFactory func() ProtocolAdapter
+
+// adapterFactories holds the adapter factory per protocol, see RegisterAdapter
+var adapterFactories = struct {
+	sync.RWMutex
+	m map[ProtocolType]AdapterFactory
+}{m: map[ProtocolType]AdapterFactory{
+	ProtocolSSH:     NewSSHAdapterFunc,
+	ProtocolTelnet:  NewTelnetAdapterFunc,
+	ProtocolNETCONF: NewNETCONFAdapterFunc,
+	ProtocolLocal:   NewLocalAdapterFunc,
+}}
+
+// RegisterAdapter registers the adapter factory for protocol, replacing the
+// built-in one if any. Pools created afterwards use it. Transports living in
+// other packages register themselves this way, typically from an init
+// function; their adapters describe themselves by implementing
+// CapabilityReporter.
+func RegisterAdapter(protocol ProtocolType, factory AdapterFactory) error {
+	if protocol == "" {
+		return NewInvalidConfigError("adapter protocol is empty")
+	}
+	if factory == nil {
+		return NewInvalidConfigError(fmt.Sprintf("adapter %q: nil factory", protocol))
+	}
+	adapterFactories.Lock()
+	defer adapterFactories.Unlock()
+	adapterFactories.m[protocol] = factory
+	return nil
+}
+
+// LookupAdapter returns the adapter factory for protocol
+func LookupAdapter(protocol ProtocolType) (AdapterFactory, bool) {
+	adapterFactories.RLock()
+	defer adapterFactories.RUnlock()
+	factory, ok := adapterFactories.m[protocol]
+	return factory, ok
+}
+
+// AdapterCapabilities describes what the adapters of a protocol support
+type AdapterCapabilities struct {
+	// ConfigSession is set when the commands of a task share one session, so
+	// that configuration mode or locks carry over between them
+	ConfigSession bool `json:"configSession"`
+	// Streaming is set when the adapter can open an interactive terminal
+	Streaming bool `json:"streaming"`
+	// StructuredData is set when the device answers with structured data
+	// rather than CLI text
+	StructuredData bool `json:"structuredData"`
+	// Keepalive is set when idle connections can be probed
+	Keepalive bool `json:"keepalive"`
+}
+
+// CapabilityReporter is implemented by adapters that declare their
+// capabilities. Streaming and Keepalive are otherwise derived from the
+// optional interfaces the adapter implements.
+type CapabilityReporter interface {
+	AdapterCapabilities() AdapterCapabilities
+}
+
+// ProtocolInfo describes a registered protocol
+type ProtocolInfo struct {
+	Protocol     ProtocolType        `json:"protocol"`
+	Capabilities AdapterCapabilities `json:"capabilities"`
+}
+
+// Protocols lists the registered protocols by name with the capabilities of
+// their adapters
+func Protocols() []ProtocolInfo {
+	adapterFactories.RLock()
+	list := make([]ProtocolInfo, 0, len(adapterFactories.m))
+	for protocol, factory := range adapterFactories.m {
+		list = append(list, ProtocolInfo{Protocol: protocol, Capabilities: capabilitiesOf(factory())})
+	}
+	adapterFactories.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Protocol < list[j].Protocol })
+	return list
+}
+
+// capabilitiesOf returns the capabilities of an unconnected adapter
+func capabilitiesOf(a ProtocolAdapter) AdapterCapabilities {
+	var caps AdapterCapabilities
+	if r, ok := a.(CapabilityReporter); ok {
+		caps = r.AdapterCapabilities()
+	} else {
+		_, caps.Streaming = a.(TerminalOpener)
+	}
+	_, caps.Keepalive = a.(KeepaliveAdapter)
+	return caps
+}
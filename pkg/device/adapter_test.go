@@ -0,0 +1,71 @@
+package device_test
+
+import (
+	"context"
+	"testing"
+
+	"opt-switch/pkg/device"
+)
+
+// loopbackAdapter stands in for a transport registered from another package
+type loopbackAdapter struct{ connected bool }
+
+func (a *loopbackAdapter) Connect(ctx context.Context, config *device.ConnectionConfig) error {
+	a.connected = true
+	return nil
+}
+
+func (a *loopbackAdapter) Disconnect(ctx context.Context) error {
+	a.connected = false
+	return nil
+}
+
+func (a *loopbackAdapter) ExecuteCommand(ctx context.Context, cmd string) (*device.CommandResult, error) {
+	return &device.CommandResult{Command: cmd, Output: cmd, Success: true}, nil
+}
+
+func (a *loopbackAdapter) IsConnected() bool                 { return a.connected }
+func (a *loopbackAdapter) ProtocolType() device.ProtocolType { return "loopback" }
+
+func (a *loopbackAdapter) AdapterCapabilities() device.AdapterCapabilities {
+	return device.AdapterCapabilities{ConfigSession: true}
+}
+
+func TestRegisterAdapter(t *testing.T) {
+	if err := device.RegisterAdapter("", func() device.ProtocolAdapter { return &loopbackAdapter{} }); err == nil {
+		t.Error("empty protocol accepted")
+	}
+	if err := device.RegisterAdapter("loopback", nil); err == nil {
+		t.Error("nil factory accepted")
+	}
+	if _, err := device.NewConnectionPool(&device.DeviceConfig{Connection: device.ConnectionConfig{Protocol: "pigeon"}}); err == nil {
+		t.Fatal("pool created for an unregistered protocol")
+	}
+
+	err := device.RegisterAdapter("loopback", func() device.ProtocolAdapter { return &loopbackAdapter{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &device.DeviceConfig{Connection: device.ConnectionConfig{Protocol: "loopback"}}
+	cfg.Pool.MaxConnections = 1
+	cfg.Pool.MaxQueueSize = 1
+	if _, err := device.NewConnectionPool(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	caps := map[device.ProtocolType]device.AdapterCapabilities{}
+	for _, p := range device.Protocols() {
+		caps[p.Protocol] = p.Capabilities
+	}
+	want := map[device.ProtocolType]device.AdapterCapabilities{
+		"loopback":             {ConfigSession: true},
+		device.ProtocolSSH:     {Streaming: true, Keepalive: true},
+		device.ProtocolTelnet:  {ConfigSession: true, Streaming: true, Keepalive: true},
+		device.ProtocolNETCONF: {ConfigSession: true, StructuredData: true, Keepalive: true},
+	}
+	for protocol, w := range want {
+		if got, ok := caps[protocol]; !ok || got != w {
+			t.Errorf("%s capabilities = %+v, want %+v", protocol, got, w)
+		}
+	}
+}
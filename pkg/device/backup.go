@@ -0,0 +1,121 @@
+package device
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// NormalizeConfig normalizes the output of the backup command so that
+// snapshots taken over different protocols compare equal: line endings are
+// unified, trailing whitespace and leading/trailing blank lines are removed.
+func NormalizeConfig(output string) string {
+	output = strings.ReplaceAll(output, "\r\n", "\n")
+	output = strings.ReplaceAll(output, "\r", "\n")
+
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// ConfigHash returns the hex encoded SHA-256 of a normalized configuration.
+// Lines matching one of the ignore patterns (timestamps, byte counts) are left
+// out so that they do not make otherwise identical snapshots differ.
+func ConfigHash(config string, ignore []string) (string, error) {
+	patterns, err := compilePatterns(ignore)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	for _, line := range strings.Split(config, "\n") {
+		if matchAny(patterns, line) {
+			continue
+		}
+		h.Write([]byte(line))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// UnifiedDiff returns a unified diff from a to b with n lines of context and
+// the number of added and removed lines
+func UnifiedDiff(a, b, fromName, toName string, n int) (diff string, added, removed int) {
+	al, bl := splitConfigLines(a), splitConfigLines(b)
+	m := difflib.NewMatcherWithJunk(al, bl, false, nil)
+
+	var sb strings.Builder
+	for _, group := range m.GetGroupedOpCodes(n) {
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		first, last := group[0], group[len(group)-1]
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(first.I1, last.I2), hunkRange(first.J1, last.J2))
+		for _, op := range group {
+			switch op.Tag {
+			case 'e':
+				for _, line := range al[op.I1:op.I2] {
+					sb.WriteString(" " + line + "\n")
+				}
+			case 'r', 'd':
+				for _, line := range al[op.I1:op.I2] {
+					sb.WriteString("-" + line + "\n")
+				}
+				removed += op.I2 - op.I1
+			}
+			if op.Tag == 'r' || op.Tag == 'i' {
+				for _, line := range bl[op.J1:op.J2] {
+					sb.WriteString("+" + line + "\n")
+				}
+				added += op.J2 - op.J1
+			}
+		}
+	}
+	return sb.String(), added, removed
+}
+
+// hunkRange formats a unified diff range for lines [start, stop)
+func hunkRange(start, stop int) string {
+	length := stop - start
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+func splitConfigLines(config string) []string {
+	if config == "" {
+		return nil
+	}
+	return strings.Split(config, "\n")
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, NewInvalidConfigError(fmt.Sprintf("invalid backup ignore pattern %q: %v", p, err))
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+func matchAny(patterns []*regexp.Regexp, line string) bool {
+	for _, re := range patterns {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
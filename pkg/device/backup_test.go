@@ -0,0 +1,61 @@
+package device
+
+import (
+	"testing"
+)
+
+func TestNormalizeConfig(t *testing.T) {
+	got := NormalizeConfig("\r\nhostname sw1  \r\n!\r\ninterface Gi0/1\t\r\n\r\n")
+	want := "hostname sw1\n!\ninterface Gi0/1"
+	if got != want {
+		t.Errorf("NormalizeConfig = %q, want %q", got, want)
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	ignore := []string{`^! Last configuration change`}
+	a := "! Last configuration change at 10:00\nhostname sw1"
+	b := "! Last configuration change at 11:00\nhostname sw1"
+	c := "! Last configuration change at 11:00\nhostname sw2"
+
+	ha, err := ConfigHash(a, ignore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hb, _ := ConfigHash(b, ignore)
+	hc, _ := ConfigHash(c, ignore)
+	if ha != hb {
+		t.Error("ignored lines must not change the hash")
+	}
+	if ha == hc {
+		t.Error("configuration changes must change the hash")
+	}
+
+	if _, err := ConfigHash(a, []string{"("}); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "hostname sw1\n!\nvlan 10\n!\nvlan 20\n!\nend"
+	b := "hostname sw1\n!\nvlan 10\n name users\n!\nend"
+
+	diff, added, removed := UnifiedDiff(a, b, "a", "b", 1)
+	want := "--- a\n+++ b\n" +
+		"@@ -3,4 +3,3 @@\n" +
+		" vlan 10\n" +
+		"-!\n" +
+		"-vlan 20\n" +
+		"+ name users\n" +
+		" !\n"
+	if diff != want {
+		t.Errorf("diff =\n%s\nwant\n%s", diff, want)
+	}
+	if added != 1 || removed != 2 {
+		t.Errorf("added, removed = %d, %d, want 1, 2", added, removed)
+	}
+
+	if diff, _, _ := UnifiedDiff(a, a, "a", "b", 3); diff != "" {
+		t.Errorf("identical configurations produced %q", diff)
+	}
+}
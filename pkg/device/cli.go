@@ -0,0 +1,280 @@
+package device
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ansiEscape matches the terminal control sequences some devices send, e.g.
+// to erase a pager prompt
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// cliSession drives the CLI of a device over a byte stream, as described by
+// a device profile. It is used by Telnet connections and SSH shells.
+type cliSession struct {
+	w          io.Writer
+	profile    *DeviceProfile
+	lineEnding string
+	timeout    time.Duration // used when the context has no deadline
+
+	chunks  chan []byte
+	done    chan struct{}
+	once    sync.Once
+	readErr error // set before chunks is closed
+	buf     bytes.Buffer
+	prompt  string // the line matched by the last expect
+}
+
+// newCLISession starts reading r in the background
+func newCLISession(r io.Reader, w io.Writer, profile *DeviceProfile, lineEnding string, timeout time.Duration) *cliSession {
+	s := &cliSession{
+		w:          w,
+		profile:    profile,
+		lineEnding: profile.lineEnding(lineEnding),
+		timeout:    timeout,
+		chunks:     make(chan []byte, 64),
+		done:       make(chan struct{}),
+	}
+	go s.read(r)
+	return s
+}
+
+func (s *cliSession) read(r io.Reader) {
+	defer close(s.chunks)
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			chunk := make([]byte, n)
+			copy(chunk, buf[:n])
+			select {
+			case s.chunks <- chunk:
+			case <-s.done:
+				return
+			}
+		}
+		if err != nil {
+			s.readErr = err
+			return
+		}
+	}
+}
+
+// close stops the background reader; closing the underlying stream is up to
+// the adapter
+func (s *cliSession) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// Read hands the raw stream to an interactive terminal, starting with the
+// output that was read but not consumed yet
+func (s *cliSession) Read(p []byte) (int, error) {
+	if s.buf.Len() > 0 {
+		return s.buf.Read(p)
+	}
+	chunk, ok := <-s.chunks
+	if !ok {
+		if s.readErr != nil {
+			return 0, s.readErr
+		}
+		return 0, io.EOF
+	}
+	n := copy(p, chunk)
+	s.buf.Write(chunk[n:])
+	return n, nil
+}
+
+// send writes a line to the device
+func (s *cliSession) send(line string) error {
+	_, err := io.WriteString(s.w, line+s.lineEnding)
+	return err
+}
+
+// expect reads until the line the cursor is on matches one of patterns and
+// returns the index of the pattern and the output read so far. nil patterns
+// never match.
+func (s *cliSession) expect(ctx context.Context, patterns ...*regexp.Regexp) (int, string, error) {
+	// a context deadline is reported as the context error
+	var timeout <-chan time.Time
+	if _, ok := ctx.Deadline(); !ok {
+		timer := time.NewTimer(s.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		line := currentLine(s.buf.Bytes())
+		for i, re := range patterns {
+			if re != nil && re.MatchString(line) {
+				s.prompt = line
+				out := s.buf.String()
+				s.buf.Reset()
+				return i, out, nil
+			}
+		}
+
+		select {
+		case chunk, ok := <-s.chunks:
+			if !ok {
+				err := s.readErr
+				if err == nil || err == io.EOF {
+					err = fmt.Errorf("connection closed by the device")
+				}
+				return -1, s.buf.String(), err
+			}
+			s.buf.Write(chunk)
+		case <-ctx.Done():
+			return -1, s.buf.String(), ctx.Err()
+		case <-timeout:
+			return -1, s.buf.String(), fmt.Errorf("timeout waiting for the device prompt")
+		}
+	}
+}
+
+// login answers the username and password prompts, if the device asks for
+// them, and waits for the CLI prompt
+func (s *cliSession) login(ctx context.Context, username, password string) error {
+	p := s.profile
+	asked := make(map[int]bool)
+	for {
+		i, _, err := s.expect(ctx, p.prompt, p.username, p.password)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			return nil
+		}
+		// being asked again means the credentials were rejected
+		if asked[i] {
+			return fmt.Errorf("login rejected by the device")
+		}
+		asked[i] = true
+		if i == 1 {
+			err = s.send(username)
+		} else {
+			err = s.send(password)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// prepare enters privileged mode and disables paging. It expects the session
+// to be at the prompt.
+func (s *cliSession) prepare(ctx context.Context, enablePassword string) error {
+	p := s.profile
+	if p.EnableCommand != "" && p.privileged != nil && !p.privileged.MatchString(s.prompt) {
+		if err := s.send(p.EnableCommand); err != nil {
+			return err
+		}
+		i, _, err := s.expect(ctx, p.password, p.prompt)
+		if err != nil {
+			return fmt.Errorf("enable: %v", err)
+		}
+		if i == 0 {
+			if err := s.send(enablePassword); err != nil {
+				return err
+			}
+			if _, _, err := s.expect(ctx, p.prompt); err != nil {
+				return fmt.Errorf("enable: %v", err)
+			}
+		}
+		if !p.privileged.MatchString(s.prompt) {
+			return fmt.Errorf("enable: still at unprivileged prompt %q", s.prompt)
+		}
+	}
+
+	for _, cmd := range p.DisablePaging {
+		out, err := s.run(ctx, cmd)
+		if err != nil {
+			return fmt.Errorf("%s: %v", cmd, err)
+		}
+		if err := p.CheckOutput(out); err != nil {
+			return fmt.Errorf("%s: %v", cmd, err)
+		}
+	}
+	return nil
+}
+
+// run sends a command and returns its output without the echoed command and
+// the trailing prompt. Pager prompts are answered with a space.
+func (s *cliSession) run(ctx context.Context, cmd string) (string, error) {
+	if err := s.send(cmd); err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	for {
+		i, chunk, err := s.expect(ctx, s.profile.prompt, s.profile.more)
+		if err != nil {
+			out.WriteString(chunk)
+			return cleanOutput(out.String(), cmd), err
+		}
+		if i == 0 {
+			out.WriteString(chunk)
+			return cleanOutput(out.String(), cmd), nil
+		}
+		// drop the pager prompt and ask for the next page
+		if n := strings.LastIndexByte(chunk, '\n'); n >= 0 {
+			out.WriteString(chunk[:n+1])
+		}
+		if _, err := io.WriteString(s.w, " "); err != nil {
+			return cleanOutput(out.String(), cmd), err
+		}
+	}
+}
+
+// interrupt aborts the running command with Ctrl-C and waits for the prompt,
+// so that the session can be reused
+func (s *cliSession) interrupt() error {
+	if _, err := io.WriteString(s.w, "\x03"); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	_, _, err := s.expect(ctx, s.profile.prompt)
+	return err
+}
+
+// currentLine returns the line the cursor is on without control sequences
+func currentLine(buf []byte) string {
+	if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+		buf = buf[i+1:]
+	}
+	line := ansiEscape.ReplaceAllString(string(buf), "")
+	if i := strings.LastIndexByte(line, '\r'); i >= 0 && strings.TrimSpace(line[i+1:]) != "" {
+		line = line[i+1:]
+	}
+	return strings.Trim(line, "\r")
+}
+
+// cleanOutput normalizes line endings and removes the echoed command and the
+// prompt line from the output of cmd
+func cleanOutput(out, cmd string) string {
+	out = ansiEscape.ReplaceAllString(out, "")
+	out = strings.ReplaceAll(out, "\r\n", "\n")
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		// a carriage return without line feed moves back to the line start
+		line = strings.TrimRight(line, "\r")
+		lines[i] = line
+		if j := strings.LastIndexByte(line, '\r'); j >= 0 {
+			lines[i] = line[j+1:]
+		}
+	}
+
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) != "" && strings.HasSuffix(strings.TrimSpace(lines[0]), strings.TrimSpace(cmd)) {
+		lines = lines[1:]
+	}
+	if len(lines) > 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n ")
+}
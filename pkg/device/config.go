@@ -1,35 +1,23 @@
 package device
 
-import (
-	"crypto/aes"
-	"crypto/cipher"
-	"encoding/base64"
-	"fmt"
-	"os"
-	"strings"
-	"time"
-
-	"golang.org/x/crypto/ssh"
-)
+// defaultLogFile is the execution log when log.file is not set
+const defaultLogFile = "logs/command.log"
 
 // ConfigManager manages device configuration
 type ConfigManager struct {
-	config      *DeviceConfig
-	encryptionKey []byte
+	config *DeviceConfig
 }
 
 // NewConfigManager creates a new config manager
 func NewConfigManager(config *DeviceConfig) *ConfigManager {
-	// Load encryption key from environment
-	key := []byte(os.Getenv("DEVICE_ENCRYPTION_KEY"))
-
 	return &ConfigManager{
-		config:      config,
-		encryptionKey: key,
+		config: config,
 	}
 }
 
-// LoadConfig loads and validates the device configuration
+// LoadConfig loads and validates the device configuration. Encrypted
+// credentials are checked to decrypt but stay encrypted in the
+// configuration; the adapters decrypt them when they connect.
 func (m *ConfigManager) LoadConfig() (*DeviceConfig, error) {
 	if m.config == nil {
 		return nil, NewInvalidConfigError("device config is nil")
@@ -40,13 +28,8 @@ func (m *ConfigManager) LoadConfig() (*DeviceConfig, error) {
 		return nil, err
 	}
 
-	// Decrypt password if needed
-	if strings.HasPrefix(m.config.Connection.Password, "encrypted:") {
-		decrypted, err := m.decryptPassword(m.config.Connection.Password)
-		if err != nil {
-			return nil, NewInvalidConfigError(fmt.Sprintf("failed to decrypt password: %v", err))
-		}
-		m.config.Connection.Password = decrypted
+	if _, err := m.config.Connection.credentials(); err != nil {
+		return nil, err
 	}
 
 	return m.config, nil
@@ -54,6 +37,15 @@ func (m *ConfigManager) LoadConfig() (*DeviceConfig, error) {
 
 // validateConfig validates the device configuration
 func (m *ConfigManager) validateConfig(config *DeviceConfig) error {
+	// The local CLI needs neither an address nor credentials
+	if ProtocolType(config.Connection.Protocol) == ProtocolLocal {
+		if config.Connection.CLIPath == "" {
+			return NewInvalidConfigError("connection.cli_path is required for the local protocol")
+		}
+		applyDefaults(config)
+		return nil
+	}
+
 	// Validate connection config
 	if config.Connection.Host == "" {
 		return NewInvalidConfigError("connection.host is required")
@@ -67,14 +59,24 @@ func (m *ConfigManager) validateConfig(config *DeviceConfig) error {
 	if config.Connection.Username == "" {
 		return NewInvalidConfigError("connection.username is required")
 	}
-	if config.Connection.Password == "" {
+	// SSH and NETCONF can authenticate with a private key instead
+	hasKey := config.Connection.PrivateKey != "" || config.Connection.PrivateKeyFile != ""
+	if config.Connection.Password == "" && (!hasKey || ProtocolType(config.Connection.Protocol) == ProtocolTelnet) {
 		return NewInvalidConfigError("connection.password is required")
 	}
+
+	applyDefaults(config)
+
+	return nil
+}
+
+// applyDefaults fills in defaults for the optional device settings
+func applyDefaults(config *DeviceConfig) {
 	if config.Connection.Timeout <= 0 {
 		config.Connection.Timeout = 30 // Default 30 seconds
 	}
 
-	// Validate pool config
+	// Pool defaults
 	if config.Pool.MaxConnections <= 0 {
 		config.Pool.MaxConnections = 3 // Default
 	}
@@ -87,6 +89,9 @@ func (m *ConfigManager) validateConfig(config *DeviceConfig) error {
 	if config.Pool.IdleTimeout <= 0 {
 		config.Pool.IdleTimeout = 300 // Default 5 minutes
 	}
+	if config.Pool.KeepaliveInterval <= 0 {
+		config.Pool.KeepaliveInterval = 30 // Default 30 seconds
+	}
 	if config.Pool.CommandTimeout <= 0 {
 		config.Pool.CommandTimeout = 30 // Default 30 seconds
 	}
@@ -97,9 +102,9 @@ func (m *ConfigManager) validateConfig(config *DeviceConfig) error {
 		config.Pool.MaxQueueSize = 100 // Default
 	}
 
-	// Validate log config
+	// Log defaults
 	if config.Log.File == "" {
-		config.Log.File = "logs/command.log" // Default
+		config.Log.File = defaultLogFile
 	}
 	if config.Log.MaxSize <= 0 {
 		config.Log.MaxSize = 100 // Default 100MB
@@ -114,68 +119,34 @@ func (m *ConfigManager) validateConfig(config *DeviceConfig) error {
 		config.Log.MaxOutputSize = 10240 // Default 10KB
 	}
 
-	return nil
-}
-
-// decryptPassword decrypts an encrypted password
-func (m *ConfigManager) decryptPassword(encrypted string) (string, error) {
-	if len(m.encryptionKey) == 0 {
-		return "", fmt.Errorf("encryption key not set (DEVICE_ENCRYPTION_KEY environment variable)")
+	// Terminal defaults
+	if config.Terminal.IdleTimeout <= 0 {
+		config.Terminal.IdleTimeout = 600 // Default 10 minutes
 	}
-
-	// Remove "encrypted:" prefix
-	encrypted = strings.TrimPrefix(encrypted, "encrypted:")
-
-	// Decode base64
-	ciphertext, err := base64.StdEncoding.DecodeString(encrypted)
-	if err != nil {
-		return "", fmt.Errorf("failed to decode base64: %w", err)
+	if config.Terminal.MaxSessionsPerUser <= 0 {
+		config.Terminal.MaxSessionsPerUser = 2 // Default
 	}
 
-	// Create cipher
-	block, err := aes.NewCipher(m.encryptionKey)
-	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
+	// Backup defaults
+	if config.Backup.Command == "" {
+		config.Backup.Command = "show running-config" // Default
 	}
-
-	// Check ciphertext length
-	if len(ciphertext) < aes.BlockSize {
-		return "", fmt.Errorf("ciphertext too short")
+	if config.Backup.EnterConfig == "" {
+		config.Backup.EnterConfig = "configure terminal" // Default
+	}
+	if config.Backup.ExitConfig == "" {
+		config.Backup.ExitConfig = "end" // Default
 	}
-
-	// Extract IV and actual ciphertext
-	iv := ciphertext[:aes.BlockSize]
-	ciphertext = ciphertext[aes.BlockSize:]
-
-	// Decrypt
-	stream := cipher.NewCFBDecrypter(block, iv)
-	stream.XORKeyStream(ciphertext, ciphertext)
-
-	return string(ciphertext), nil
 }
 
-// EncryptPassword encrypts a password (utility function for generating encrypted passwords)
+// EncryptPassword encrypts a password with key as key 1, the key
+// DEVICE_ENCRYPTION_KEY is known by
 func EncryptPassword(password string, key []byte) (string, error) {
-	block, err := aes.NewCipher(key)
+	v, err := NewVault(legacyKeyID, map[string][]byte{legacyKeyID: key})
 	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
+		return "", err
 	}
-
-	// Create IV
-	iv := make([]byte, aes.BlockSize)
-	// In production, use crypto/rand for IV generation
-	// For simplicity here, we use a fixed IV (NOT SECURE for production)
-
-	// Encrypt
-	ciphertext := make([]byte, len(password))
-	stream := cipher.NewCFBEncrypter(block, iv)
-	stream.XORKeyStream(ciphertext, []byte(password))
-
-	// Combine IV and ciphertext
-	result := append(iv, ciphertext...)
-
-	// Encode to base64 with prefix
-	return "encrypted:" + base64.StdEncoding.EncodeToString(result), nil
+	return v.Encrypt(password)
 }
 
 // GetConfig returns the current configuration
@@ -196,20 +167,15 @@ func (m *ConfigManager) UpdateConfig(newConfig *DeviceConfig) error {
 // ValidateSSHConnection validates the SSH connection configuration
 func (m *ConfigManager) ValidateSSHConnection() error {
 	config := m.config.Connection
+	config.Timeout = 5 // seconds
 
-	sshConfig := &ssh.ClientConfig{
-		User: config.Username,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(config.Password),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:        5 * time.Second,
+	creds, err := config.credentials()
+	if err != nil {
+		return err
 	}
-
-	address := fmt.Sprintf("%s:%d", config.Host, config.Port)
-	client, err := ssh.Dial("tcp", address, sshConfig)
+	client, err := dialSSH(&config, creds)
 	if err != nil {
-		return NewConnectionError(err)
+		return err
 	}
 	defer client.Close()
 
@@ -0,0 +1,104 @@
+package device
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Sinks that drop execution log entries rather than slowing commands down
+const (
+	SinkSyslog  = "syslog"
+	SinkHistory = "history"
+)
+
+// dropReportInterval is the shortest time between two reports of a sink
+const dropReportInterval = time.Minute
+
+// dropCounter counts the execution log entries a sink dropped. Drops are
+// reported through the device layer logger at most once per
+// dropReportInterval, with the number dropped since the previous report, so
+// that an unreachable collector does not flood the log.
+type dropCounter struct {
+	sink  string
+	total atomic.Uint64
+
+	mu       sync.Mutex
+	pending  uint64
+	reason   error
+	reported time.Time
+}
+
+var (
+	syslogDrops  = &dropCounter{sink: SinkSyslog}
+	historyDrops = &dropCounter{sink: SinkHistory}
+)
+
+// serviceLogger is the logger passed to Initialize
+var serviceLogger atomic.Pointer[zap.Logger]
+
+// getServiceLogger returns the logger passed to Initialize, a no-op logger
+// before
+func getServiceLogger() *zap.Logger {
+	if logger := serviceLogger.Load(); logger != nil {
+		return logger
+	}
+	return zap.NewNop()
+}
+
+// DroppedLogEntries returns the execution log entries dropped since startup
+// by sink
+func DroppedLogEntries() map[string]uint64 {
+	return map[string]uint64{
+		SinkSyslog:  syslogDrops.total.Load(),
+		SinkHistory: historyDrops.total.Load(),
+	}
+}
+
+// add counts n dropped entries and reports them when the last report is
+// long enough ago
+func (d *dropCounter) add(n int, reason error) {
+	d.total.Add(uint64(n))
+
+	d.mu.Lock()
+	d.pending += uint64(n)
+	d.reason = reason
+	if time.Since(d.reported) < dropReportInterval {
+		d.mu.Unlock()
+		return
+	}
+	d.reported = time.Now()
+	pending, reason := d.take()
+	d.mu.Unlock()
+	d.report(pending, reason)
+}
+
+// flush reports the drops that were not reported yet
+func (d *dropCounter) flush() {
+	d.mu.Lock()
+	pending, reason := d.take()
+	d.mu.Unlock()
+	d.report(pending, reason)
+}
+
+// take returns and resets the drops since the last report. d.mu must be
+// held.
+func (d *dropCounter) take() (uint64, error) {
+	pending, reason := d.pending, d.reason
+	d.pending, d.reason = 0, nil
+	return pending, reason
+}
+
+func (d *dropCounter) report(pending uint64, reason error) {
+	if pending == 0 {
+		return
+	}
+	getServiceLogger().Warn("Command log entries dropped",
+		zap.String("sink", d.sink),
+		zap.Uint64("dropped", pending),
+		zap.Uint64("dropped_total", d.total.Load()),
+		zap.Error(reason),
+	)
+}
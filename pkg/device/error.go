@@ -10,33 +10,53 @@ const (
 	ErrConnectionFailed ErrorCode = 1001
 	ErrAuthFailed       ErrorCode = 1002
 	ErrConnectionClosed ErrorCode = 1003
+	ErrHostKeyMismatch  ErrorCode = 1004
 
 	// Queue errors 1100-1199
 	ErrQueueFull    ErrorCode = 1101
 	ErrQueueTimeout ErrorCode = 1102
+	ErrSessionLimit ErrorCode = 1103
 
 	// Execution errors 1200-1299
-	ErrCommandFailed  ErrorCode = 1201
-	ErrCommandTimeout ErrorCode = 1202
-	ErrOutputTooLarge ErrorCode = 1203
+	ErrCommandFailed   ErrorCode = 1201
+	ErrCommandTimeout  ErrorCode = 1202
+	ErrOutputTooLarge  ErrorCode = 1203
+	ErrNotSupported    ErrorCode = 1204
+	ErrInvalidParam    ErrorCode = 1205
+	ErrCommandDenied   ErrorCode = 1206
+	ErrConfirmRequired ErrorCode = 1207
+	ErrParseFailed     ErrorCode = 1208
 
 	// Config errors 1300-1399
-	ErrInvalidConfig        ErrorCode = 1301
-	ErrDeviceNotConfigured  ErrorCode = 1302
+	ErrInvalidConfig       ErrorCode = 1301
+	ErrDeviceNotConfigured ErrorCode = 1302
+	ErrDeviceNotFound      ErrorCode = 1303
+	ErrInvalidTemplate     ErrorCode = 1304
+	ErrJobNotFound         ErrorCode = 1305
 )
 
 // Error messages mapping
 var errorMessages = map[ErrorCode]string{
-	ErrConnectionFailed:   "Failed to connect to device",
-	ErrAuthFailed:         "Authentication failed",
-	ErrConnectionClosed:   "Connection closed",
-	ErrQueueFull:          "Command queue is full, please try again later",
-	ErrQueueTimeout:       "Queue wait timeout",
-	ErrCommandFailed:      "Command execution failed",
-	ErrCommandTimeout:     "Command execution timeout",
-	ErrOutputTooLarge:     "Command output too large, truncated",
-	ErrInvalidConfig:      "Invalid device configuration",
+	ErrConnectionFailed:    "Failed to connect to device",
+	ErrAuthFailed:          "Authentication failed",
+	ErrConnectionClosed:    "Connection closed",
+	ErrHostKeyMismatch:     "Device host key not trusted",
+	ErrQueueFull:           "Command queue is full, please try again later",
+	ErrQueueTimeout:        "Queue wait timeout",
+	ErrSessionLimit:        "Too many terminal sessions",
+	ErrCommandFailed:       "Command execution failed",
+	ErrCommandTimeout:      "Command execution timeout",
+	ErrOutputTooLarge:      "Command output too large, truncated",
+	ErrNotSupported:        "Operation not supported by the device protocol",
+	ErrInvalidParam:        "Invalid template parameter",
+	ErrCommandDenied:       "Command denied by policy",
+	ErrConfirmRequired:     "Command requires confirmation",
+	ErrParseFailed:         "Failed to parse command output",
+	ErrInvalidConfig:       "Invalid device configuration",
 	ErrDeviceNotConfigured: "Device not configured",
+	ErrDeviceNotFound:      "Device not found",
+	ErrInvalidTemplate:     "Invalid command template",
+	ErrJobNotFound:         "Command job not found",
 }
 
 // DeviceError represents a device operation error
@@ -78,6 +98,14 @@ func NewAuthError(cause error) *DeviceError {
 	}
 }
 
+// NewHostKeyError creates a new host key verification error
+func NewHostKeyError(message string) *DeviceError {
+	return &DeviceError{
+		Code:    ErrHostKeyMismatch,
+		Message: message,
+	}
+}
+
 // NewQueueTimeoutError creates a new queue timeout error
 func NewQueueTimeoutError() *DeviceError {
 	return &DeviceError{
@@ -92,6 +120,14 @@ func NewQueueFullError() *DeviceError {
 	}
 }
 
+// NewSessionLimitError creates a new terminal session limit error
+func NewSessionLimitError(limit int) *DeviceError {
+	return &DeviceError{
+		Code:    ErrSessionLimit,
+		Message: fmt.Sprintf("at most %d concurrent sessions per user", limit),
+	}
+}
+
 // NewCommandTimeoutError creates a new command timeout error
 func NewCommandTimeoutError() *DeviceError {
 	return &DeviceError{
@@ -107,6 +143,44 @@ func NewCommandFailedError(cause error) *DeviceError {
 	}
 }
 
+// NewNotSupportedError creates a new operation not supported error
+func NewNotSupportedError(message string) *DeviceError {
+	return &DeviceError{
+		Code:    ErrNotSupported,
+		Message: message,
+	}
+}
+
+// NewInvalidParamError creates a new invalid template parameter error
+func NewInvalidParamError(message string) *DeviceError {
+	return &DeviceError{
+		Code:    ErrInvalidParam,
+		Message: message,
+	}
+}
+
+// NewCommandDeniedError creates a new command denied error. rule is nil when
+// the command was denied for matching none of the allow rules.
+func NewCommandDeniedError(command string, rule *PolicyRule) *DeviceError {
+	msg := fmt.Sprintf("%q is not allowed for this role", command)
+	if rule != nil {
+		msg = fmt.Sprintf("%q matches deny rule %d", command, rule.ID)
+	}
+	return &DeviceError{
+		Code:    ErrCommandDenied,
+		Message: msg,
+	}
+}
+
+// NewParseFailedError creates a new output parse error
+func NewParseFailedError(command string, cause error) *DeviceError {
+	return &DeviceError{
+		Code:    ErrParseFailed,
+		Message: fmt.Sprintf("%q: %v", command, cause),
+		Cause:   cause,
+	}
+}
+
 // NewInvalidConfigError creates a new invalid config error
 func NewInvalidConfigError(message string) *DeviceError {
 	return &DeviceError{
@@ -115,6 +189,37 @@ func NewInvalidConfigError(message string) *DeviceError {
 	}
 }
 
+// NewDeviceNotConfiguredError creates a new device not configured error
+func NewDeviceNotConfiguredError() *DeviceError {
+	return &DeviceError{
+		Code: ErrDeviceNotConfigured,
+	}
+}
+
+// NewDeviceNotFoundError creates a new device not found error
+func NewDeviceNotFoundError(id int) *DeviceError {
+	return &DeviceError{
+		Code:    ErrDeviceNotFound,
+		Message: fmt.Sprintf("device %d is not registered or disabled", id),
+	}
+}
+
+// NewInvalidTemplateError creates a new invalid command template error
+func NewInvalidTemplateError(message string) *DeviceError {
+	return &DeviceError{
+		Code:    ErrInvalidTemplate,
+		Message: message,
+	}
+}
+
+// NewJobNotFoundError creates a new command job not found error
+func NewJobNotFoundError(id string) *DeviceError {
+	return &DeviceError{
+		Code:    ErrJobNotFound,
+		Message: fmt.Sprintf("job %s does not exist or has expired", id),
+	}
+}
+
 // NewConnectionClosed creates a new connection closed error
 func NewConnectionClosed() *DeviceError {
 	return &DeviceError{
@@ -0,0 +1,104 @@
+package device
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// History export formats
+const (
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson" // one JSON entry per line
+)
+
+// historyColumns is the header of the CSV export
+var historyColumns = []string{
+	"timestamp", "device_id", "user_id", "username", "client_ip", "session_id",
+	"command", "success", "error", "policy", "duration_ms", "output_size", "output",
+}
+
+// HistoryEncoder writes command history entries in an export format
+type HistoryEncoder interface {
+	Encode(entry *ExecutionLog) error
+	// Flush writes the buffered entries
+	Flush() error
+}
+
+// NewHistoryEncoder returns an encoder writing format to w
+func NewHistoryEncoder(format string, w io.Writer) (HistoryEncoder, error) {
+	switch format {
+	case ExportCSV:
+		return &csvEncoder{w: csv.NewWriter(w)}, nil
+	case ExportNDJSON:
+		return &ndjsonEncoder{enc: json.NewEncoder(w)}, nil
+	}
+	return nil, NewInvalidParamError(fmt.Sprintf("unsupported export format %q, use csv or ndjson", format))
+}
+
+// ExportContentType returns the media type of an export format
+func ExportContentType(format string) string {
+	if format == ExportCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// csvEncoder writes a header line, then a line per entry with the time in
+// RFC 3339
+type csvEncoder struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (e *csvEncoder) Encode(entry *ExecutionLog) error {
+	if !e.header {
+		if err := e.w.Write(historyColumns); err != nil {
+			return err
+		}
+		e.header = true
+	}
+	return e.w.Write([]string{
+		time.Unix(entry.Timestamp, 0).UTC().Format(time.RFC3339),
+		strconv.Itoa(entry.DeviceID),
+		entry.UserID,
+		entry.Username,
+		entry.ClientIP,
+		entry.SessionID,
+		entry.Command,
+		strconv.FormatBool(entry.Success),
+		entry.Error,
+		entry.Policy,
+		strconv.FormatInt(entry.Duration, 10),
+		strconv.Itoa(entry.OutputSize),
+		entry.Output,
+	})
+}
+
+// Flush writes the header even when nothing matched
+func (e *csvEncoder) Flush() error {
+	if !e.header {
+		if err := e.w.Write(historyColumns); err != nil {
+			return err
+		}
+		e.header = true
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// ndjsonEncoder writes an entry as JSON per line, the time in unix seconds
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) Encode(entry *ExecutionLog) error {
+	return e.enc.Encode(entry)
+}
+
+func (e *ndjsonEncoder) Flush() error {
+	return nil
+}
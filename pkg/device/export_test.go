@@ -0,0 +1,266 @@
+package device
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportHistory(t *testing.T) {
+	config := &LogConfig{Enabled: true, File: filepath.Join(t.TempDir(), "command.log"), IncludeOutput: true}
+	base := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	writeBackup(t, config.File, base.Add(time.Hour),
+		ExecutionLog{Timestamp: base.Unix(), Username: "alice", Command: "show version", Success: true})
+	execLogger, err := NewExecutionLogger(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer execLogger.Close()
+	_ = execLogger.Log(&ExecutionLog{Timestamp: base.Add(2 * time.Hour).Unix(), Username: "bob", Command: `echo "a,b"`, Output: "a,b\nc"})
+	_ = execLogger.Log(&ExecutionLog{Timestamp: base.Add(3 * time.Hour).Unix(), Username: "bob", Command: "show clock", Success: true})
+
+	var buf bytes.Buffer
+	enc, err := NewHistoryEncoder(ExportCSV, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = execLogger.ScanHistory(&HistoryQuery{Until: base.Add(2 * time.Hour)}, func(entry ExecutionLog) error {
+		return enc.Encode(&entry)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// oldest first, across the backup, quoted where needed
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0][0] != "timestamp" {
+		t.Fatalf("records = %q", records)
+	}
+	if records[1][0] != "2026-09-01T00:00:00Z" || records[1][6] != "show version" {
+		t.Errorf("first record = %q", records[1])
+	}
+	if records[2][6] != `echo "a,b"` || records[2][12] != "a,b\nc" {
+		t.Errorf("second record = %q", records[2])
+	}
+
+	buf.Reset()
+	enc, _ = NewHistoryEncoder(ExportNDJSON, &buf)
+	err = execLogger.ScanHistory(&HistoryQuery{Username: "bob"}, func(entry ExecutionLog) error {
+		return enc.Encode(&entry)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("ndjson = %q", buf.String())
+	}
+	var entry ExecutionLog
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil || entry.Command != "show clock" {
+		t.Errorf("last line = %q, %v", lines[1], err)
+	}
+
+	if _, err := NewHistoryEncoder("xml", &buf); err == nil {
+		t.Error("accepted an unsupported format")
+	}
+	// an empty CSV export still has its header
+	buf.Reset()
+	enc, _ = NewHistoryEncoder(ExportCSV, &buf)
+	_ = enc.Flush()
+	if !strings.HasPrefix(buf.String(), "timestamp,") {
+		t.Errorf("empty export = %q", buf.String())
+	}
+}
+
+// syslogLogger returns an execution logger forwarding to a collector
+func syslogLogger(t *testing.T, syslog SyslogConfig) *ExecutionLogger {
+	t.Helper()
+	execLogger, err := NewExecutionLogger(&LogConfig{
+		Enabled: true,
+		File:    filepath.Join(t.TempDir(), "command.log"),
+		Syslog:  syslog,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return execLogger
+}
+
+// checkSyslogMessage checks an RFC 5424 message of a forwarded entry
+func checkSyslogMessage(t *testing.T, msg, command string, pri int) {
+	t.Helper()
+	fields := strings.SplitN(msg, " ", 8)
+	if len(fields) != 8 {
+		t.Fatalf("message = %q", msg)
+	}
+	if want := "<" + strconv.Itoa(pri) + ">1"; fields[0] != want {
+		t.Errorf("header = %q, want %q", fields[0], want)
+	}
+	if fields[2] == "" || fields[3] != "switchd" || fields[5] != "command_execution" || fields[6] != "-" {
+		t.Errorf("message = %q", msg)
+	}
+	var entry ExecutionLog
+	if err := json.Unmarshal([]byte(fields[7]), &entry); err != nil || entry.Command != command {
+		t.Errorf("MSG = %q, %v", fields[7], err)
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	execLogger := syslogLogger(t, SyslogConfig{Network: "udp", Address: conn.LocalAddr().String(), AppName: "switchd", Facility: "auth"})
+	_ = execLogger.Log(&ExecutionLog{Timestamp: time.Now().Unix(), Command: "reload", Success: false})
+	_ = execLogger.Close()
+
+	buf := make([]byte, 64*1024)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// auth (4) * 8 + warning (4) for a failed command
+	checkSyslogMessage(t, string(buf[:n]), "reload", 36)
+}
+
+// readFramed reads octet counted messages from a stream collector
+func readFramed(t *testing.T, ln net.Listener, count int) []string {
+	t.Helper()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	r := bufio.NewReader(conn)
+	var msgs []string
+	for len(msgs) < count {
+		length, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(length))
+		if err != nil {
+			t.Fatalf("frame length %q", length)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, string(msg))
+	}
+	return msgs
+}
+
+func TestSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	execLogger := syslogLogger(t, SyslogConfig{Network: "tcp", Address: ln.Addr().String(), AppName: "switchd"})
+	defer execLogger.Close()
+	_ = execLogger.Log(&ExecutionLog{Timestamp: time.Now().Unix(), Command: "show version", Success: true})
+	_ = execLogger.Log(&ExecutionLog{Timestamp: time.Now().Unix(), Command: "show\nclock", Success: true})
+
+	msgs := readFramed(t, ln, 2)
+	// local0 (16) * 8 + info (6)
+	checkSyslogMessage(t, msgs[0], "show version", 134)
+	checkSyslogMessage(t, msgs[1], "show\nclock", 134)
+}
+
+func TestSyslogTLS(t *testing.T) {
+	cert, caFile := testCertificate(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	execLogger := syslogLogger(t, SyslogConfig{Network: "tls", Address: ln.Addr().String(), AppName: "switchd", CAFile: caFile})
+	defer execLogger.Close()
+	_ = execLogger.Log(&ExecutionLog{Timestamp: time.Now().Unix(), Command: "show version", Success: true})
+
+	msgs := readFramed(t, ln, 1)
+	checkSyslogMessage(t, msgs[0], "show version", 134)
+}
+
+func TestSyslogConfigInvalid(t *testing.T) {
+	for _, syslog := range []SyslogConfig{
+		{Network: "http", Address: "127.0.0.1:514"},
+		{Network: "udp", Address: "collector"},
+		{Network: "udp", Address: "127.0.0.1:514", Facility: "local9"},
+		{Network: "tls", Address: "127.0.0.1:6514", CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+	} {
+		if _, err := NewExecutionLogger(&LogConfig{Enabled: true, File: filepath.Join(t.TempDir(), "c.log"), Syslog: syslog}); err == nil {
+			t.Errorf("accepted %+v", syslog)
+		}
+	}
+}
+
+// testCertificate returns a self-signed certificate for 127.0.0.1 and a file
+// holding it as CA
+func testCertificate(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "collector"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return cert, caFile
+}
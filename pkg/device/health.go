@@ -0,0 +1,221 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maintainInterval    = time.Second     // how often the maintainer looks at the idle connections
+	reconnectBackoffMin = 2 * time.Second // wait after the first failed reconnect, doubled per failure
+	reconnectBackoffMax = 5 * time.Minute
+)
+
+// ConnectionHealth describes a pooled connection in the pool status
+type ConnectionHealth struct {
+	ID        string `json:"id"`
+	Connected bool   `json:"connected"`
+	InUse     bool   `json:"inUse"`
+	Age       int64  `json:"ageSeconds"` // seconds since the connection was established
+	LastUsed  int64  `json:"lastUsed"`   // unix time
+	LastCheck int64  `json:"lastCheck,omitempty"`
+	Failures  int    `json:"failures"` // consecutive failed keepalives and reconnects
+	LastError string `json:"lastError,omitempty"`
+	RetryAt   int64  `json:"retryAt,omitempty"` // unix time of the next reconnect attempt
+}
+
+// connectionHealth is the outcome of the recent probes and reconnects of a
+// connection, and the adapter state its last holder saw
+type connectionHealth struct {
+	mu          sync.Mutex
+	failures    int
+	lastError   string
+	lastCheck   time.Time
+	retryAt     time.Time
+	connected   bool
+	established time.Time
+}
+
+// snapshot copies the state of the adapter of conn. The caller must hold
+// conn.
+func (h *connectionHealth) snapshot(conn *Connection) {
+	connected := conn.Adapter.IsConnected()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.connected = connected
+	h.established = conn.CreatedAt
+}
+
+// record notes the outcome of a probe or reconnect at now
+func (h *connectionHealth) record(err error, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastCheck = now
+	if err == nil {
+		h.failures = 0
+		h.lastError = ""
+		h.retryAt = time.Time{}
+		return
+	}
+	h.failures++
+	h.lastError = err.Error()
+	h.retryAt = now.Add(reconnectBackoff(h.failures))
+}
+
+// reconnectBackoff returns the wait before the next reconnect after n
+// consecutive failures
+func reconnectBackoff(n int) time.Duration {
+	d := reconnectBackoffMin
+	for i := 1; i < n && d < reconnectBackoffMax; i++ {
+		d *= 2
+	}
+	if d > reconnectBackoffMax {
+		d = reconnectBackoffMax
+	}
+	return d
+}
+
+// checkConnection verifies a checked out connection. Connections idle for
+// longer than the keepalive interval are probed when the adapter supports
+// it; a failed probe disconnects them.
+func (p *ConnectionPool) checkConnection(ctx context.Context, conn *Connection) error {
+	if !conn.Adapter.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	ka, ok := conn.Adapter.(KeepaliveAdapter)
+	if !ok {
+		return nil
+	}
+
+	conn.health.mu.Lock()
+	lastActive := conn.health.lastCheck
+	conn.health.mu.Unlock()
+	if lastUsed := conn.LastUsed(); lastUsed.After(lastActive) {
+		lastActive = lastUsed
+	}
+	if time.Since(lastActive) < time.Duration(p.config.Pool.KeepaliveInterval)*time.Second {
+		return nil
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, time.Duration(p.config.Connection.Timeout)*time.Second)
+	defer cancel()
+	err := ka.Keepalive(probeCtx)
+	conn.health.record(err, time.Now())
+	if err != nil {
+		_ = conn.Adapter.Disconnect(context.Background())
+	}
+	return err
+}
+
+// maintain probes the idle connections, closes those idle for longer than the
+// idle timeout down to the minimum and reconnects dead ones until the pool
+// stops
+func (p *ConnectionPool) maintain(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(maintainInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.maintainOnce(ctx, now)
+		}
+	}
+}
+
+// maintainOnce runs one maintenance pass over the connections that are not
+// in use. The pass holds a connection slot like a worker, so that a worker
+// always finds a connection it can take; it is skipped while the pool is busy.
+func (p *ConnectionPool) maintainOnce(ctx context.Context, now time.Time) {
+	if !p.gate.TryAcquire(1) {
+		return
+	}
+	defer p.gate.Release(1)
+	select {
+	case p.semaphore <- struct{}{}:
+		defer func() { <-p.semaphore }()
+	default:
+		return
+	}
+
+	p.mu.RLock()
+	conns := make([]*Connection, 0, len(p.connections))
+	for _, conn := range p.connections {
+		conns = append(conns, conn)
+	}
+	cfg := p.config.Pool
+	p.mu.RUnlock()
+
+	idleTimeout := time.Duration(cfg.IdleTimeout) * time.Second
+	count := len(conns)
+	for _, conn := range conns {
+		if !atomic.CompareAndSwapInt32(&conn.InUse, 0, 1) {
+			continue
+		}
+
+		if count > cfg.MinConnections && now.Sub(conn.LastUsed()) > idleTimeout {
+			_ = conn.Adapter.Disconnect(context.Background())
+			p.removeConnection(conn)
+			count--
+			continue
+		}
+
+		if conn.Adapter.IsConnected() {
+			_ = p.checkConnection(ctx, conn)
+		} else {
+			conn.health.mu.Lock()
+			due := !now.Before(conn.health.retryAt)
+			conn.health.mu.Unlock()
+			if due {
+				if err := p.recreateConnection(ctx, conn); err != nil {
+					fmt.Printf("Failed to recreate connection %s: %v\n", conn.ID, err)
+				}
+			}
+		}
+		conn.release()
+	}
+}
+
+// removeConnection drops a checked out connection from the pool
+func (p *ConnectionPool) removeConnection(conn *Connection) {
+	p.mu.Lock()
+	delete(p.connections, conn.ID)
+	p.mu.Unlock()
+}
+
+// connectionHealth describes the pooled connections, oldest first, from the
+// snapshots their holders took. p.mu must be held.
+func (p *ConnectionPool) connectionHealth() []ConnectionHealth {
+	now := time.Now()
+	list := make([]ConnectionHealth, 0, len(p.connections))
+	for _, conn := range p.connections {
+		conn.health.mu.Lock()
+		h := ConnectionHealth{
+			ID:        conn.ID,
+			Connected: conn.health.connected,
+			InUse:     atomic.LoadInt32(&conn.InUse) == 1,
+			Age:       int64(now.Sub(conn.health.established).Seconds()),
+			LastUsed:  conn.LastUsed().Unix(),
+			Failures:  conn.health.failures,
+			LastError: conn.health.lastError,
+		}
+		if !conn.health.lastCheck.IsZero() {
+			h.LastCheck = conn.health.lastCheck.Unix()
+		}
+		if !conn.health.retryAt.IsZero() {
+			h.RetryAt = conn.health.retryAt.Unix()
+		}
+		conn.health.mu.Unlock()
+		list = append(list, h)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
@@ -0,0 +1,243 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// healthTestAdapter is a connection whose keepalives and reconnects fail on
+// demand. With hold set they report on blocked and wait until hold closes.
+type healthTestAdapter struct {
+	mu          sync.Mutex
+	connected   bool
+	probes      int
+	failProbe   bool
+	failConnect bool
+	hold        chan struct{}
+	blocked     chan<- struct{}
+}
+
+// wait blocks while the adapter is held
+func (a *healthTestAdapter) wait() {
+	a.mu.Lock()
+	hold, blocked := a.hold, a.blocked
+	a.mu.Unlock()
+	if hold != nil {
+		blocked <- struct{}{}
+		<-hold
+	}
+}
+
+func (a *healthTestAdapter) Connect(ctx context.Context, config *ConnectionConfig) error {
+	a.wait()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.failConnect {
+		return errors.New("unreachable")
+	}
+	a.connected = true
+	return nil
+}
+
+func (a *healthTestAdapter) Disconnect(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.connected = false
+	return nil
+}
+
+func (a *healthTestAdapter) IsConnected() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.connected
+}
+
+func (a *healthTestAdapter) Keepalive(ctx context.Context) error {
+	a.wait()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.probes++
+	if a.failProbe {
+		return errors.New("no answer")
+	}
+	return nil
+}
+
+func (a *healthTestAdapter) ProtocolType() ProtocolType { return ProtocolSSH }
+
+func (a *healthTestAdapter) ExecuteCommand(ctx context.Context, cmd string) (*CommandResult, error) {
+	return &CommandResult{Command: cmd, Success: true}, nil
+}
+
+func (a *healthTestAdapter) set(fn func(a *healthTestAdapter)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	fn(a)
+}
+
+// newHealthTestPool returns a pool with n connections that are not started,
+// so that the test drives the maintenance passes
+func newHealthTestPool(t *testing.T, n int) (*ConnectionPool, []*healthTestAdapter) {
+	cfg := &DeviceConfig{Connection: ConnectionConfig{Protocol: string(ProtocolSSH)}}
+	applyDefaults(cfg)
+	cfg.Pool.MinConnections = 1
+	pool, err := NewConnectionPool(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var adapters []*healthTestAdapter
+	pool.newAdapter = func() ProtocolAdapter {
+		a := &healthTestAdapter{}
+		adapters = append(adapters, a)
+		return a
+	}
+	var conns []*Connection
+	for i := 0; i < n; i++ {
+		conn, err := pool.getConnection(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		pool.releaseConnection(conn)
+	}
+	return pool, adapters
+}
+
+func TestMaintainKeepalive(t *testing.T) {
+	pool, adapters := newHealthTestPool(t, 1)
+	a := adapters[0]
+	now := time.Now()
+
+	// recently used connections are not probed
+	pool.maintainOnce(context.Background(), now)
+	if a.probes != 0 {
+		t.Fatalf("probes = %d, want 0", a.probes)
+	}
+
+	keepalive := time.Duration(pool.config.Pool.KeepaliveInterval) * time.Second
+	for _, conn := range pool.connections {
+		conn.touch(now.Add(-keepalive))
+	}
+	a.set(func(a *healthTestAdapter) { a.failProbe = true; a.failConnect = true })
+	pool.maintainOnce(context.Background(), now)
+	if a.probes != 1 || a.IsConnected() {
+		t.Fatalf("probes = %d, connected = %v after a failed keepalive", a.probes, a.IsConnected())
+	}
+
+	// the reconnect waits for the backoff
+	h := pool.connectionHealth()[0]
+	if h.Failures != 1 || h.LastError == "" || h.RetryAt == 0 {
+		t.Fatalf("health = %+v", h)
+	}
+	a.set(func(a *healthTestAdapter) { a.failConnect = false })
+	pool.maintainOnce(context.Background(), now)
+	if a.IsConnected() {
+		t.Fatal("reconnected before the backoff")
+	}
+	pool.maintainOnce(context.Background(), now.Add(reconnectBackoffMin+time.Second))
+	if !a.IsConnected() {
+		t.Fatal("not reconnected after the backoff")
+	}
+	if h := pool.connectionHealth()[0]; h.Failures != 0 || h.LastError != "" {
+		t.Errorf("health after reconnect = %+v", h)
+	}
+}
+
+func TestMaintainIdleTimeout(t *testing.T) {
+	pool, adapters := newHealthTestPool(t, 3)
+	idle := time.Duration(pool.config.Pool.IdleTimeout) * time.Second
+
+	pool.maintainOnce(context.Background(), time.Now().Add(idle+time.Second))
+	if n := len(pool.connections); n != pool.config.Pool.MinConnections {
+		t.Fatalf("connections = %d, want %d", n, pool.config.Pool.MinConnections)
+	}
+	var open int
+	for _, a := range adapters {
+		if a.IsConnected() {
+			open++
+		}
+	}
+	if open != 1 {
+		t.Errorf("open adapters = %d, want 1", open)
+	}
+}
+
+func TestGetConnectionReconnectFailure(t *testing.T) {
+	pool, adapters := newHealthTestPool(t, 1)
+	adapters[0].set(func(a *healthTestAdapter) { a.connected = false; a.failConnect = true })
+
+	if _, err := pool.getConnection(context.Background()); err == nil {
+		t.Fatal("dead connection handed out")
+	}
+	for _, conn := range pool.connections {
+		if conn.InUse != 0 {
+			t.Error("failed connection left checked out")
+		}
+	}
+}
+
+func TestGetConnectionOutsideLock(t *testing.T) {
+	pool, adapters := newHealthTestPool(t, 1)
+	pool.config.Pool.MaxConnections = 2
+	pool.config.Pool.KeepaliveInterval = 0
+
+	hold := make(chan struct{})
+	blocked := make(chan struct{}, 2)
+	held := func(a *healthTestAdapter) { a.hold, a.blocked = hold, blocked }
+	adapters[0].set(held)
+	newAdapter := pool.newAdapter
+	pool.newAdapter = func() ProtocolAdapter {
+		a := newAdapter().(*healthTestAdapter)
+		a.set(held)
+		return a
+	}
+
+	// one caller probes the idle connection while the other dials a new one
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := pool.getConnection(context.Background())
+			results <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-blocked:
+		case <-time.After(5 * time.Second):
+			close(hold)
+			t.Fatal("a probe or dial blocks the other callers")
+		}
+	}
+
+	// the connection being dialed counts against the limit
+	if _, err := pool.getConnection(context.Background()); !isDeviceError(err, ErrQueueFull) {
+		t.Errorf("third connection error = %v, want queue full", err)
+	}
+
+	close(hold)
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(pool.connections); n != 2 {
+		t.Errorf("connections = %d, want 2", n)
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	if d := reconnectBackoff(1); d != reconnectBackoffMin {
+		t.Errorf("backoff(1) = %v", d)
+	}
+	if d := reconnectBackoff(3); d != 4*reconnectBackoffMin {
+		t.Errorf("backoff(3) = %v", d)
+	}
+	if d := reconnectBackoff(100); d != reconnectBackoffMax {
+		t.Errorf("backoff(100) = %v", d)
+	}
+}
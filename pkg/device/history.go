@@ -0,0 +1,383 @@
+package device
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HistoryQuery selects entries of the command history. Zero fields do not
+// filter.
+type HistoryQuery struct {
+	DeviceID     int
+	UserID       string
+	Username     string
+	Command      string // substring of the command
+	CommandRegex string // regular expression matched against the command
+	Success      *bool
+	Since        time.Time // inclusive
+	Until        time.Time // inclusive
+	ClientIP     string
+	SessionID    string
+	Limit        int
+	Offset       int
+
+	commandRegex *regexp.Regexp
+}
+
+// Compile checks the query and compiles its regular expression
+func (q *HistoryQuery) Compile() error {
+	if q.Limit <= 0 {
+		q.Limit = 100
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	q.commandRegex = nil
+	if q.CommandRegex != "" {
+		re, err := regexp.Compile(q.CommandRegex)
+		if err != nil {
+			return NewInvalidParamError(fmt.Sprintf("invalid command regex: %v", err))
+		}
+		q.commandRegex = re
+	}
+	return nil
+}
+
+// Match reports whether entry passes the filters of the compiled query
+func (q *HistoryQuery) Match(entry *ExecutionLog) bool {
+	switch {
+	case q.DeviceID != 0 && entry.DeviceID != q.DeviceID,
+		q.UserID != "" && entry.UserID != q.UserID,
+		q.Username != "" && entry.Username != q.Username,
+		q.ClientIP != "" && entry.ClientIP != q.ClientIP,
+		q.SessionID != "" && entry.SessionID != q.SessionID,
+		q.Success != nil && entry.Success != *q.Success,
+		!q.Since.IsZero() && entry.Timestamp < q.Since.Unix(),
+		!q.Until.IsZero() && entry.Timestamp > q.Until.Unix(),
+		q.Command != "" && !strings.Contains(entry.Command, q.Command),
+		q.commandRegex != nil && !q.commandRegex.MatchString(entry.Command):
+		return false
+	}
+	return true
+}
+
+// MatchCommand applies only the regular expression of the compiled query,
+// for stores filtering the other fields themselves
+func (q *HistoryQuery) MatchCommand(command string) bool {
+	return q.commandRegex == nil || q.commandRegex.MatchString(command)
+}
+
+// HistoryStore keeps the command history in a queryable form, e.g. a
+// database table. Entries are appended in batches in the background; Query
+// returns a page of the matching entries, newest first, and their total;
+// Scan calls fn for every matching entry, oldest first, regardless of the
+// page.
+type HistoryStore interface {
+	Append(entries []ExecutionLog) error
+	Query(q *HistoryQuery) ([]ExecutionLog, int64, error)
+	Scan(q *HistoryQuery, fn func(ExecutionLog) error) error
+}
+
+const (
+	historyBuffer   = 1024 // entries waiting for the store
+	historyBatch    = 100
+	historyInterval = time.Second
+)
+
+// history is the installed history store and its writer
+var history struct {
+	sync.RWMutex
+	store   HistoryStore
+	entries chan ExecutionLog
+	done    chan struct{}
+}
+
+// SetHistoryStore installs the store the execution log entries are copied
+// to and history queries are answered from. Entries still queued for the
+// previous store are written first. nil queries the log files again.
+func SetHistoryStore(store HistoryStore) {
+	history.Lock()
+	defer history.Unlock()
+
+	if history.entries != nil {
+		close(history.entries)
+		<-history.done
+		history.entries = nil
+	}
+	history.store = store
+	if store == nil {
+		return
+	}
+	history.entries = make(chan ExecutionLog, historyBuffer)
+	history.done = make(chan struct{})
+	go writeHistory(store, history.entries, history.done)
+}
+
+// GetHistoryStore returns the installed history store, nil for none
+func GetHistoryStore() HistoryStore {
+	history.RLock()
+	defer history.RUnlock()
+	return history.store
+}
+
+// errHistoryBusy is the reason of entries dropped while the queue is full
+var errHistoryBusy = errors.New("history store busy")
+
+// recordHistory queues an entry for the history store. Entries are dropped
+// rather than slowing commands down when the store falls behind; drops are
+// counted in historyDrops.
+func recordHistory(entry ExecutionLog) {
+	history.RLock()
+	defer history.RUnlock()
+	if history.entries == nil {
+		return
+	}
+	select {
+	case history.entries <- entry:
+	default:
+		historyDrops.add(1, errHistoryBusy)
+	}
+}
+
+// writeHistory appends the queued entries in batches until entries is closed
+func writeHistory(store HistoryStore, entries <-chan ExecutionLog, done chan<- struct{}) {
+	defer close(done)
+	defer historyDrops.flush()
+
+	ticker := time.NewTicker(historyInterval)
+	defer ticker.Stop()
+	batch := make([]ExecutionLog, 0, historyBatch)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := store.Append(batch); err != nil {
+			historyDrops.add(len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case entry, ok := <-entries:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) == historyBatch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// historyLine is a line of the execution log file. The entry timestamp is
+// written as RFC 3339.
+type historyLine struct {
+	Msg  string `json:"msg"`
+	Data struct {
+		ExecutionLog
+		Timestamp json.RawMessage `json:"timestamp"`
+	} `json:"data"`
+}
+
+// parseHistoryLine decodes an execution log line, reporting false for lines
+// that are not command entries
+func parseHistoryLine(line []byte) (ExecutionLog, bool) {
+	var l historyLine
+	if err := json.Unmarshal(line, &l); err != nil || l.Msg != "command_execution" {
+		return ExecutionLog{}, false
+	}
+	entry := l.Data.ExecutionLog
+	var ts string
+	if err := json.Unmarshal(l.Data.Timestamp, &ts); err == nil {
+		if t, err := time.Parse(time.RFC3339, ts); err == nil {
+			entry.Timestamp = t.Unix()
+		}
+	} else {
+		_ = json.Unmarshal(l.Data.Timestamp, &entry.Timestamp)
+	}
+	return entry, true
+}
+
+// historyFile is the current log file or one of its rotated backups
+type historyFile struct {
+	path    string
+	rotated time.Time // when the backup was rotated out, zero for the current file
+}
+
+// backupTimeFormat is the timestamp lumberjack puts in backup names
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// historyFiles lists the log file and its rotated, possibly compressed,
+// backups, oldest first
+func historyFiles(file string) ([]historyFile, error) {
+	dir := filepath.Dir(file)
+	ext := filepath.Ext(file)
+	prefix := strings.TrimSuffix(filepath.Base(file), ext) + "-"
+
+	names, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var files []historyFile
+	for _, e := range names {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		stamp = strings.TrimPrefix(stamp, prefix)
+		rotated, err := time.ParseInLocation(backupTimeFormat, stamp, time.UTC)
+		if err != nil {
+			continue
+		}
+		files = append(files, historyFile{path: filepath.Join(dir, name), rotated: rotated})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].rotated.Before(files[j].rotated) })
+
+	if _, err := os.Stat(file); err == nil {
+		files = append(files, historyFile{path: file})
+	}
+	return files, nil
+}
+
+// readLogLines calls fn for every line of a log file, decompressing rotated
+// .gz backups, with the line number
+func readLogLines(path string, fn func(line []byte, number int) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	reader := bufio.NewReader(r)
+	for number := 1; ; number++ {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			if err := fn(line, number); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+}
+
+// readHistoryFile calls fn for the entries of a log file in the order they
+// were written
+func readHistoryFile(path string, fn func(ExecutionLog) error) error {
+	return readLogLines(path, func(line []byte, _ int) error {
+		if entry, ok := parseHistoryLine(line); ok {
+			return fn(entry)
+		}
+		return nil
+	})
+}
+
+// ReadHistory calls fn for every entry of the execution log, including the
+// rotated backups, oldest first. It is used to import the log into a
+// history store.
+func ReadHistory(config *LogConfig, fn func(ExecutionLog) error) error {
+	files, err := historyFiles(config.File)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := readHistoryFile(file.path, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanHistoryFiles calls fn for the entries of the log files matching q,
+// oldest first. Backups rotated out before q.Since are skipped.
+func scanHistoryFiles(config *LogConfig, q *HistoryQuery, fn func(ExecutionLog) error) error {
+	files, err := historyFiles(config.File)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if !q.Since.IsZero() && !file.rotated.IsZero() && file.rotated.Before(q.Since) {
+			continue
+		}
+		err := readHistoryFile(file.path, func(entry ExecutionLog) error {
+			if !q.Match(&entry) {
+				return nil
+			}
+			return fn(entry)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryHistoryFiles answers q from the log files, newest first. Backups
+// rotated out before q.Since are skipped.
+func queryHistoryFiles(config *LogConfig, q *HistoryQuery) ([]ExecutionLog, int64, error) {
+	files, err := historyFiles(config.File)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	page := []ExecutionLog{}
+	var total int64
+	for i := len(files) - 1; i >= 0; i-- {
+		file := files[i]
+		if !q.Since.IsZero() && !file.rotated.IsZero() && file.rotated.Before(q.Since) {
+			break // older backups only hold older entries
+		}
+		var matches []ExecutionLog
+		err := readHistoryFile(file.path, func(entry ExecutionLog) error {
+			if q.Match(&entry) {
+				matches = append(matches, entry)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		for j := len(matches) - 1; j >= 0; j-- {
+			if total >= int64(q.Offset) && len(page) < q.Limit {
+				page = append(page, matches[j])
+			}
+			total++
+		}
+	}
+	return page, total, nil
+}
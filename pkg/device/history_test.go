@@ -0,0 +1,262 @@
+package device
+
+import (
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// writeBackup writes entries as a compressed backup rotated out at rotated,
+// named the way lumberjack names it
+func writeBackup(t *testing.T, file string, rotated time.Time, entries ...ExecutionLog) {
+	t.Helper()
+	dir := t.TempDir()
+	backup, err := NewExecutionLogger(&LogConfig{Enabled: true, File: filepath.Join(dir, "backup.log")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range entries {
+		_ = backup.Log(&entries[i])
+	}
+	_ = backup.Close()
+	data, err := os.ReadFile(filepath.Join(dir, "backup.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := "command-" + rotated.UTC().Format(backupTimeFormat) + ".log.gz"
+	f, err := os.Create(filepath.Join(filepath.Dir(file), name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetHistoryAcrossBackups(t *testing.T) {
+	config := &LogConfig{
+		Enabled:       true,
+		File:          filepath.Join(t.TempDir(), "command.log"),
+		IncludeOutput: true,
+	}
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	writeBackup(t, config.File, base.Add(time.Hour),
+		ExecutionLog{Timestamp: base.Unix(), Username: "alice", Command: "show version", Success: true},
+		ExecutionLog{Timestamp: base.Add(time.Minute).Unix(), Username: "bob", Command: "reload", ClientIP: "10.0.0.2"},
+	)
+
+	execLogger, err := NewExecutionLogger(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer execLogger.Close()
+	for i, cmd := range []string{"show interface", "show vlan", "configure terminal"} {
+		_ = execLogger.Log(&ExecutionLog{
+			Timestamp: base.Add(2*time.Hour + time.Duration(i)*time.Minute).Unix(),
+			DeviceID:  2,
+			Username:  "alice",
+			Command:   cmd,
+			Output:    "output of " + cmd,
+			Success:   i != 2,
+			ClientIP:  "10.0.0.1",
+		})
+	}
+
+	logs, total, err := execLogger.GetHistory(&HistoryQuery{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 5 || len(logs) != 2 {
+		t.Fatalf("total = %d, page = %d, want 5 and 2", total, len(logs))
+	}
+	if logs[0].Command != "configure terminal" || logs[1].Command != "show vlan" {
+		t.Errorf("page = %+v, want newest first", logs)
+	}
+	if logs[1].Output != "output of show vlan" {
+		t.Errorf("output = %q, want the recorded output", logs[1].Output)
+	}
+
+	// the last page reaches into the compressed backup
+	logs, _, _ = execLogger.GetHistory(&HistoryQuery{Limit: 2, Offset: 4})
+	if len(logs) != 1 || logs[0].Command != "show version" || logs[0].Timestamp != base.Unix() {
+		t.Errorf("last page = %+v", logs)
+	}
+
+	success := true
+	tests := []struct {
+		name  string
+		query HistoryQuery
+		want  int64
+	}{
+		{"user", HistoryQuery{Username: "alice"}, 4},
+		{"substring", HistoryQuery{Command: "show"}, 3},
+		{"regex", HistoryQuery{CommandRegex: "^(reload|configure)"}, 2},
+		{"success", HistoryQuery{Success: &success}, 3},
+		{"client ip", HistoryQuery{ClientIP: "10.0.0.2"}, 1},
+		{"device", HistoryQuery{DeviceID: 2}, 3},
+		{"since", HistoryQuery{Since: base.Add(2*time.Hour + time.Minute)}, 2},
+		{"until", HistoryQuery{Until: base.Add(time.Minute)}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs, total, err := execLogger.GetHistory(&tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != tt.want || int64(len(logs)) != tt.want {
+				t.Errorf("total = %d, page = %d, want %d", total, len(logs), tt.want)
+			}
+		})
+	}
+
+	_, _, err = execLogger.GetHistory(&HistoryQuery{CommandRegex: "("})
+	var deviceErr *DeviceError
+	if !errors.As(err, &deviceErr) || deviceErr.Code != ErrInvalidParam {
+		t.Errorf("err = %v, want an invalid parameter error", err)
+	}
+}
+
+// memoryHistory is a history store in memory
+type memoryHistory struct {
+	mu      sync.Mutex
+	entries []ExecutionLog
+}
+
+func (m *memoryHistory) Append(entries []ExecutionLog) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, entries...)
+	return nil
+}
+
+func (m *memoryHistory) Query(q *HistoryQuery) ([]ExecutionLog, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var logs []ExecutionLog
+	for _, entry := range m.entries {
+		if q.Match(&entry) {
+			logs = append(logs, entry)
+		}
+	}
+	return logs, int64(len(logs)), nil
+}
+
+func (m *memoryHistory) Scan(q *HistoryQuery, fn func(ExecutionLog) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, entry := range m.entries {
+		if q.Match(&entry) {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TestHistoryStore(t *testing.T) {
+	store := &memoryHistory{}
+	SetHistoryStore(store)
+	t.Cleanup(func() { SetHistoryStore(nil) })
+
+	execLogger, err := NewExecutionLogger(&LogConfig{
+		Enabled:       true,
+		File:          filepath.Join(t.TempDir(), "command.log"),
+		MaxOutputSize: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer execLogger.Close()
+	_ = execLogger.Log(&ExecutionLog{Timestamp: time.Now().Unix(), Command: "show version", Output: "version 1.0"})
+	_ = execLogger.Log(&ExecutionLog{Timestamp: time.Now().Unix(), Command: "show clock", Success: true})
+
+	// queued entries are written before the store is replaced
+	SetHistoryStore(nil)
+	if len(store.entries) != 2 {
+		t.Fatalf("store got %d entries, want 2", len(store.entries))
+	}
+	if store.entries[0].Output != "" {
+		t.Errorf("output = %q, want none without log.include_output", store.entries[0].Output)
+	}
+
+	SetHistoryStore(store)
+	success := true
+	logs, total, err := execLogger.GetHistory(&HistoryQuery{Success: &success})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || logs[0].Command != "show clock" {
+		t.Errorf("store query = %+v, %d", logs, total)
+	}
+}
+
+// failingHistory is a history store whose writes fail
+type failingHistory struct{ memoryHistory }
+
+func (*failingHistory) Append(entries []ExecutionLog) error { return errors.New("disk full") }
+
+// observeServiceLogger captures the warnings of the device layer logger
+func observeServiceLogger(t *testing.T) *observer.ObservedLogs {
+	core, logs := observer.New(zap.WarnLevel)
+	prev := serviceLogger.Swap(zap.New(core))
+	t.Cleanup(func() { serviceLogger.Store(prev) })
+	return logs
+}
+
+func TestHistoryStoreDrops(t *testing.T) {
+	logs := observeServiceLogger(t)
+	before := DroppedLogEntries()[SinkHistory]
+
+	SetHistoryStore(&failingHistory{})
+	t.Cleanup(func() { SetHistoryStore(nil) })
+	for i := 0; i < 3; i++ {
+		recordHistory(ExecutionLog{Timestamp: time.Now().Unix(), Command: "show clock"})
+	}
+	SetHistoryStore(nil)
+
+	if n := DroppedLogEntries()[SinkHistory] - before; n != 3 {
+		t.Errorf("dropped entries = %d, want 3", n)
+	}
+	// the failed batch is reported once, not per entry
+	reported := logs.FilterMessage("Command log entries dropped").All()
+	if len(reported) != 1 || reported[0].ContextMap()["dropped"] != uint64(3) {
+		t.Errorf("reports = %+v", reported)
+	}
+}
+
+func TestDropCounterRateLimit(t *testing.T) {
+	logs := observeServiceLogger(t)
+	d := &dropCounter{sink: SinkSyslog}
+	reason := errors.New("collector unreachable")
+
+	d.add(1, reason)
+	d.add(2, reason)
+	d.add(3, reason)
+	if n := logs.Len(); n != 1 {
+		t.Fatalf("reports within the interval = %d, want 1", n)
+	}
+	d.flush()
+	d.flush()
+
+	reported := logs.All()
+	if len(reported) != 2 || reported[1].ContextMap()["dropped"] != uint64(5) {
+		t.Errorf("reports = %+v", reported)
+	}
+	if d.total.Load() != 6 {
+		t.Errorf("total = %d, want 6", d.total.Load())
+	}
+}
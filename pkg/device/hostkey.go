@@ -0,0 +1,364 @@
+package device
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Host key policies
+const (
+	// HostKeyTOFU trusts and stores the key of a host seen for the first time
+	// and rejects a different key afterwards
+	HostKeyTOFU = "tofu"
+	// HostKeyStrict only accepts hosts whose key is in the known_hosts file
+	HostKeyStrict = "strict"
+	// HostKeyInsecure accepts any host key
+	HostKeyInsecure = "insecure"
+)
+
+// HostKeyInfo describes the stored and the last rejected host key of an
+// address
+type HostKeyInfo struct {
+	Address      string   `json:"address"`
+	Policy       string   `json:"policy"`
+	Pinned       bool     `json:"pinned"`       // the fingerprint is pinned by the device configuration
+	Fingerprints []string `json:"fingerprints"` // SHA256 fingerprints of the stored keys
+	// Pending is the fingerprint of the last key the host presented that did
+	// not match, it can be accepted to rotate the stored key
+	Pending       string `json:"pending,omitempty"`
+	PendingType   string `json:"pendingType,omitempty"`
+	PendingSeenAt int64  `json:"pendingSeenAt,omitempty"`
+}
+
+// knownHostsLine is a line of a known_hosts file. Lines that are not plain
+// host keys (comments, markers, hashed hosts) keep key nil and are written
+// back unchanged.
+type knownHostsLine struct {
+	text  string
+	hosts []string
+	key   ssh.PublicKey
+}
+
+// pendingHostKey is a key rejected because it did not match the stored one
+type pendingHostKey struct {
+	key  ssh.PublicKey
+	seen time.Time
+}
+
+// HostKeyStore keeps the SSH host keys of the devices in a known_hosts file
+type HostKeyStore struct {
+	path    string
+	mu      sync.Mutex
+	pending map[string]pendingHostKey
+}
+
+var hostKeyStores = struct {
+	sync.Mutex
+	byPath map[string]*HostKeyStore
+}{byPath: make(map[string]*HostKeyStore)}
+
+// GetHostKeyStore returns the store of the known_hosts file at path, shared
+// by all connections using the file
+func GetHostKeyStore(path string) *HostKeyStore {
+	path = filepath.Clean(path)
+	hostKeyStores.Lock()
+	defer hostKeyStores.Unlock()
+	s, ok := hostKeyStores.byPath[path]
+	if !ok {
+		s = &HostKeyStore{path: path, pending: make(map[string]pendingHostKey)}
+		hostKeyStores.byPath[path] = s
+	}
+	return s
+}
+
+// load reads the known_hosts file, a missing file has no lines. s.mu must be
+// held.
+func (s *HostKeyStore) load() ([]knownHostsLine, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []knownHostsLine
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := knownHostsLine{text: scanner.Text()}
+		marker, hosts, key, _, _, err := ssh.ParseKnownHosts([]byte(line.text))
+		if err == nil && marker == "" && !hashedHosts(hosts) {
+			line.hosts = hosts
+			line.key = key
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// save replaces the known_hosts file. s.mu must be held.
+func (s *HostKeyStore) save(lines []knownHostsLine) error {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line.text)
+		buf.WriteByte('\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func hashedHosts(hosts []string) bool {
+	for _, h := range hosts {
+		if strings.HasPrefix(h, "|") {
+			return true
+		}
+	}
+	return false
+}
+
+// keysFor returns the stored keys of address. s.mu must be held.
+func keysFor(lines []knownHostsLine, address string) []ssh.PublicKey {
+	host := knownhosts.Normalize(address)
+	var keys []ssh.PublicKey
+	for _, line := range lines {
+		if line.key == nil {
+			continue
+		}
+		for _, h := range line.hosts {
+			if h == host {
+				keys = append(keys, line.key)
+				break
+			}
+		}
+	}
+	return keys
+}
+
+// KeyAlgorithms returns the host key algorithms of the keys stored for
+// address, so that the server is asked for a key that can be verified. It
+// returns nil when no key is stored.
+func (s *HostKeyStore) KeyAlgorithms(address string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lines, err := s.load()
+	if err != nil {
+		return nil
+	}
+	var algos []string
+	for _, key := range keysFor(lines, address) {
+		if key.Type() == ssh.KeyAlgoRSA {
+			algos = append(algos, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+		}
+		algos = append(algos, key.Type())
+	}
+	return algos
+}
+
+// Callback returns the host key callback of policy. A key that does not
+// match the stored one is kept as pending so that it can be reviewed and
+// accepted.
+func (s *HostKeyStore) Callback(policy string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		lines, err := s.load()
+		if err != nil {
+			return fmt.Errorf("read %s: %v", s.path, err)
+		}
+		address := hostname
+		stored := keysFor(lines, address)
+		for _, k := range stored {
+			if bytes.Equal(k.Marshal(), key.Marshal()) {
+				return nil
+			}
+		}
+
+		if len(stored) > 0 || policy == HostKeyStrict {
+			s.pending[knownhosts.Normalize(address)] = pendingHostKey{key: key, seen: time.Now()}
+			if len(stored) > 0 {
+				return NewHostKeyError(fmt.Sprintf("host key of %s changed, presented %s", address, ssh.FingerprintSHA256(key)))
+			}
+			return NewHostKeyError(fmt.Sprintf("host key of %s is unknown, presented %s", address, ssh.FingerprintSHA256(key)))
+		}
+
+		// trust on first use
+		lines = append(lines, knownHostsLine{
+			text:  knownhosts.Line([]string{address}, key),
+			hosts: []string{knownhosts.Normalize(address)},
+			key:   key,
+		})
+		return s.save(lines)
+	}
+}
+
+// reject records key as the pending key of address
+func (s *HostKeyStore) reject(address string, key ssh.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[knownhosts.Normalize(address)] = pendingHostKey{key: key, seen: time.Now()}
+}
+
+// Info describes the host keys of address
+func (s *HostKeyStore) Info(address string) (*HostKeyInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lines, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &HostKeyInfo{Address: address, Fingerprints: []string{}}
+	for _, key := range keysFor(lines, address) {
+		info.Fingerprints = append(info.Fingerprints, ssh.FingerprintSHA256(key))
+	}
+	if p, ok := s.pending[knownhosts.Normalize(address)]; ok {
+		info.Pending = ssh.FingerprintSHA256(p.key)
+		info.PendingType = p.key.Type()
+		info.PendingSeenAt = p.seen.Unix()
+	}
+	return info, nil
+}
+
+// Accept replaces the stored keys of address by the pending key, which must
+// have the given fingerprint
+func (s *HostKeyStore) Accept(address, fingerprint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	host := knownhosts.Normalize(address)
+	p, ok := s.pending[host]
+	if !ok {
+		return NewInvalidParamError(fmt.Sprintf("no pending host key for %s", address))
+	}
+	if ssh.FingerprintSHA256(p.key) != fingerprint {
+		return NewInvalidParamError(fmt.Sprintf("pending host key of %s is %s, not %s", address, ssh.FingerprintSHA256(p.key), fingerprint))
+	}
+
+	lines, err := s.load()
+	if err != nil {
+		return err
+	}
+	lines = withoutHost(lines, host)
+	lines = append(lines, knownHostsLine{
+		text:  knownhosts.Line([]string{address}, p.key),
+		hosts: []string{host},
+		key:   p.key,
+	})
+	if err := s.save(lines); err != nil {
+		return err
+	}
+	delete(s.pending, host)
+	return nil
+}
+
+// Forget removes the stored and pending keys of address. With the tofu
+// policy the next connection stores the key the host presents then.
+func (s *HostKeyStore) Forget(address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	host := knownhosts.Normalize(address)
+	lines, err := s.load()
+	if err != nil {
+		return err
+	}
+	delete(s.pending, host)
+	return s.save(withoutHost(lines, host))
+}
+
+// withoutHost removes host from the lines, dropping the lines left without
+// a host
+func withoutHost(lines []knownHostsLine, host string) []knownHostsLine {
+	kept := lines[:0:0]
+	for _, line := range lines {
+		if line.key == nil {
+			kept = append(kept, line)
+			continue
+		}
+		var hosts []string
+		for _, h := range line.hosts {
+			if h != host {
+				hosts = append(hosts, h)
+			}
+		}
+		switch {
+		case len(hosts) == len(line.hosts):
+			kept = append(kept, line)
+		case len(hosts) > 0:
+			kept = append(kept, knownHostsLine{text: knownhosts.Line(hosts, line.key), hosts: hosts, key: line.key})
+		}
+	}
+	return kept
+}
+
+// hostKeyConfig returns the connection configuration of a pool whose
+// protocol runs over SSH
+func (p *ConnectionPool) hostKeyConfig() (*ConnectionConfig, error) {
+	conn := &p.Config().Connection
+	switch ProtocolType(conn.Protocol) {
+	case ProtocolSSH, ProtocolNETCONF:
+		return conn, nil
+	}
+	return nil, NewNotSupportedError(fmt.Sprintf("protocol %s has no host key", conn.Protocol))
+}
+
+// HostKey describes the stored and the pending host key of the device
+func (p *ConnectionPool) HostKey() (*HostKeyInfo, error) {
+	conn, err := p.hostKeyConfig()
+	if err != nil {
+		return nil, err
+	}
+	info, err := GetHostKeyStore(conn.knownHostsFile()).Info(conn.address())
+	if err != nil {
+		return nil, err
+	}
+	info.Policy = conn.hostKeyPolicy()
+	if conn.HostKeyFingerprint != "" {
+		info.Pinned = true
+		info.Fingerprints = []string{conn.HostKeyFingerprint}
+	}
+	return info, nil
+}
+
+// AcceptHostKey trusts the pending host key of the device, replacing the
+// stored one. fingerprint must match the pending key.
+func (p *ConnectionPool) AcceptHostKey(fingerprint string) error {
+	conn, err := p.hostKeyConfig()
+	if err != nil {
+		return err
+	}
+	if conn.HostKeyFingerprint != "" {
+		return NewNotSupportedError("the host key is pinned by the device configuration")
+	}
+	return GetHostKeyStore(conn.knownHostsFile()).Accept(conn.address(), fingerprint)
+}
+
+// ForgetHostKey removes the stored host key of the device
+func (p *ConnectionPool) ForgetHostKey() error {
+	conn, err := p.hostKeyConfig()
+	if err != nil {
+		return err
+	}
+	if conn.HostKeyFingerprint != "" {
+		return NewNotSupportedError("the host key is pinned by the device configuration")
+	}
+	return GetHostKeyStore(conn.knownHostsFile()).Forget(conn.address())
+}
@@ -0,0 +1,306 @@
+package device
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshTestServer is an in-process SSH server that accepts the user admin with
+// the password secret over keyboard-interactive, or with clientKey
+type sshTestServer struct {
+	config    *ConnectionConfig
+	clientKey ed25519.PrivateKey
+
+	mu      sync.Mutex
+	hostKey ssh.Signer
+}
+
+// rotateHostKey replaces the host key of the server and returns the new one
+func (s *sshTestServer) rotateHostKey(t *testing.T) ssh.Signer {
+	key, _ := newTestSigner(t)
+	s.mu.Lock()
+	s.hostKey = key
+	s.mu.Unlock()
+	return key
+}
+
+// hostKeySigner signs with the current host key of the server
+type hostKeySigner struct{ srv *sshTestServer }
+
+func (s hostKeySigner) current() ssh.Signer {
+	s.srv.mu.Lock()
+	defer s.srv.mu.Unlock()
+	return s.srv.hostKey
+}
+
+func (s hostKeySigner) PublicKey() ssh.PublicKey { return s.current().PublicKey() }
+
+func (s hostKeySigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.current().Sign(rand, data)
+}
+
+func newTestSigner(t *testing.T) (ssh.Signer, ed25519.PrivateKey) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, key
+}
+
+func startSSHTestServer(t *testing.T) *sshTestServer {
+	t.Helper()
+
+	hostKey, _ := newTestSigner(t)
+	clientSigner, clientKey := newTestSigner(t)
+	srv := &sshTestServer{hostKey: hostKey, clientKey: clientKey}
+
+	serverConfig := &ssh.ServerConfig{
+		KeyboardInteractiveCallback: func(c ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client("", "", []string{"Password: "}, []bool{false})
+			if err != nil {
+				return nil, err
+			}
+			if c.User() == "admin" && len(answers) == 1 && answers[0] == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if c.User() == "admin" && bytes.Equal(key.Marshal(), clientSigner.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	// the host key is read on every handshake so that tests can rotate it
+	serverConfig.AddHostKey(hostKeySigner{srv})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				sconn, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				defer sconn.Close()
+				go ssh.DiscardRequests(reqs)
+				for ch := range chans {
+					ch.Reject(ssh.Prohibited, "no channels")
+				}
+			}()
+		}
+	}()
+
+	srv.config = &ConnectionConfig{
+		Protocol:       string(ProtocolSSH),
+		Host:           "127.0.0.1",
+		Port:           ln.Addr().(*net.TCPAddr).Port,
+		Username:       "admin",
+		Password:       "secret",
+		Timeout:        5,
+		KnownHostsFile: filepath.Join(t.TempDir(), "known_hosts"),
+	}
+	return srv
+}
+
+func dialTest(t *testing.T, config *ConnectionConfig) error {
+	t.Helper()
+	creds, err := config.credentials()
+	if err != nil {
+		return err
+	}
+	client, err := dialSSH(config, creds)
+	if err == nil {
+		client.Close()
+	}
+	return err
+}
+
+func errorCode(err error) ErrorCode {
+	var deviceErr *DeviceError
+	if errors.As(err, &deviceErr) {
+		return deviceErr.Code
+	}
+	return 0
+}
+
+func TestHostKeyTrustOnFirstUse(t *testing.T) {
+	srv := startSSHTestServer(t)
+	store := GetHostKeyStore(srv.config.KnownHostsFile)
+	address := srv.config.address()
+	oldFingerprint := ssh.FingerprintSHA256(hostKeySigner{srv}.PublicKey())
+
+	if err := dialTest(t, srv.config); err != nil {
+		t.Fatalf("first connection: %v", err)
+	}
+	info, err := store.Info(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Fingerprints) != 1 || info.Fingerprints[0] != oldFingerprint {
+		t.Fatalf("stored fingerprints = %v, want [%s]", info.Fingerprints, oldFingerprint)
+	}
+	if err := dialTest(t, srv.config); err != nil {
+		t.Fatalf("second connection: %v", err)
+	}
+
+	// the device presents a new key
+	newFingerprint := ssh.FingerprintSHA256(srv.rotateHostKey(t).PublicKey())
+	if err := dialTest(t, srv.config); errorCode(err) != ErrHostKeyMismatch {
+		t.Fatalf("connection with changed key: error = %v, want host key mismatch", err)
+	}
+	info, _ = store.Info(address)
+	if info.Pending != newFingerprint {
+		t.Fatalf("pending = %q, want %q", info.Pending, newFingerprint)
+	}
+
+	if err := store.Accept(address, oldFingerprint); err == nil {
+		t.Fatal("accepted a fingerprint that is not pending")
+	}
+	if err := store.Accept(address, newFingerprint); err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	info, _ = store.Info(address)
+	if len(info.Fingerprints) != 1 || info.Fingerprints[0] != newFingerprint || info.Pending != "" {
+		t.Fatalf("after accept: %+v", info)
+	}
+	if err := dialTest(t, srv.config); err != nil {
+		t.Fatalf("connection after accept: %v", err)
+	}
+}
+
+func TestHostKeyStrict(t *testing.T) {
+	srv := startSSHTestServer(t)
+	srv.config.HostKeyPolicy = HostKeyStrict
+	if err := dialTest(t, srv.config); errorCode(err) != ErrHostKeyMismatch {
+		t.Fatalf("unknown host: error = %v, want host key mismatch", err)
+	}
+
+	store := GetHostKeyStore(srv.config.KnownHostsFile)
+	info, _ := store.Info(srv.config.address())
+	if err := store.Accept(srv.config.address(), info.Pending); err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	if err := dialTest(t, srv.config); err != nil {
+		t.Fatalf("connection after accept: %v", err)
+	}
+}
+
+func TestHostKeyPinned(t *testing.T) {
+	srv := startSSHTestServer(t)
+	fingerprint := ssh.FingerprintSHA256(hostKeySigner{srv}.PublicKey())
+
+	srv.config.HostKeyFingerprint = strings.TrimPrefix(fingerprint, "SHA256:")
+	if err := dialTest(t, srv.config); err != nil {
+		t.Fatalf("pinned key: %v", err)
+	}
+
+	srv.rotateHostKey(t)
+	if err := dialTest(t, srv.config); errorCode(err) != ErrHostKeyMismatch {
+		t.Fatalf("changed pinned key: error = %v, want host key mismatch", err)
+	}
+	if _, err := os.Stat(srv.config.KnownHostsFile); !os.IsNotExist(err) {
+		t.Errorf("pinned key wrote the known_hosts file: %v", err)
+	}
+}
+
+func TestHostKeyForgetKeepsOtherLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	key, _ := newTestSigner(t)
+	header := "# managed by hand\n|1|c2FsdA==|aGFzaA== ssh-ed25519 AAAA\n"
+	content := header + "10.0.0.1,[10.0.0.2]:2222 " + string(ssh.MarshalAuthorizedKey(key.PublicKey()))
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store := GetHostKeyStore(path)
+	if err := store.Forget("10.0.0.2:2222"); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := store.Info("10.0.0.1:22")
+	if len(info.Fingerprints) != 1 || info.Fingerprints[0] != ssh.FingerprintSHA256(key.PublicKey()) {
+		t.Errorf("10.0.0.1 fingerprints = %v", info.Fingerprints)
+	}
+	info, _ = store.Info("10.0.0.2:2222")
+	if len(info.Fingerprints) != 0 {
+		t.Errorf("10.0.0.2 fingerprints = %v, want none", info.Fingerprints)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(data), header) {
+		t.Errorf("unparsed lines dropped:\n%s", data)
+	}
+}
+
+func TestSSHAuthentication(t *testing.T) {
+	srv := startSSHTestServer(t)
+	srv.config.HostKeyPolicy = HostKeyInsecure
+
+	// keyboard-interactive answered with the password
+	if err := dialTest(t, srv.config); err != nil {
+		t.Fatalf("keyboard-interactive: %v", err)
+	}
+
+	srv.config.Password = "wrong"
+	if err := dialTest(t, srv.config); errorCode(err) != ErrAuthFailed {
+		t.Fatalf("wrong password: error = %v, want authentication failure", err)
+	}
+
+	// encrypted inline private key
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(srv.clientKey, "", []byte("phrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.config.Password = ""
+	srv.config.PrivateKey = string(pem.EncodeToMemory(block))
+	if err := dialTest(t, srv.config); errorCode(err) != ErrInvalidConfig {
+		t.Fatalf("missing passphrase: error = %v, want invalid config", err)
+	}
+	srv.config.PrivateKeyPassphrase = "phrase"
+	if err := dialTest(t, srv.config); err != nil {
+		t.Fatalf("private key: %v", err)
+	}
+
+	// private key file
+	block, err = ssh.MarshalPrivateKey(srv.clientKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	srv.config.PrivateKey = ""
+	srv.config.PrivateKeyPassphrase = ""
+	srv.config.PrivateKeyFile = keyFile
+	if err := dialTest(t, srv.config); err != nil {
+		t.Fatalf("private key file: %v", err)
+	}
+}
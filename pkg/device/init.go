@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"go.uber.org/zap"
 
@@ -11,79 +12,59 @@ import (
 )
 
 var (
-	globalPool     *ConnectionPool
-	globalLogger   *ExecutionLogger
-	globalConfig   *DeviceConfig
-	configManager  *ConfigManager
-	once           sync.Once
+	globalRegistry  *Registry
+	globalLogger    atomic.Pointer[ExecutionLogger]
+	globalConfig    atomic.Pointer[DeviceConfig]
+	globalJobs      *JobManager
+	globalTelemetry *TelemetryCollector
+	configManager   atomic.Pointer[ConfigManager]
+	commandPolicy   atomic.Pointer[CommandPolicy]
+	once            sync.Once
 )
 
 // Initialize initializes the device interaction layer
 func Initialize(logger *zap.Logger) error {
 	var initErr error
 	once.Do(func() {
+		serviceLogger.Store(logger)
+
 		// Load device configuration from config.ExtConfig
 		extConfig := config.ExtConfig
+		cfg := ConfigFromSettings(extConfig.Device)
 
-		// Convert config.ExtConfig.Device to device.DeviceConfig
-		cfg := &DeviceConfig{
-			Connection: ConnectionConfig{
-				Protocol: extConfig.Device.Connection.Protocol,
-				Host:     extConfig.Device.Connection.Host,
-				Port:     extConfig.Device.Connection.Port,
-				Username: extConfig.Device.Connection.Username,
-				Password: extConfig.Device.Connection.Password,
-				Timeout:  extConfig.Device.Connection.Timeout,
-			},
-			Pool: PoolConfig{
-				MaxConnections: extConfig.Device.Pool.MaxConnections,
-				MinConnections: extConfig.Device.Pool.MinConnections,
-				IdleTimeout:    extConfig.Device.Pool.IdleTimeout,
-				CommandTimeout: extConfig.Device.Pool.CommandTimeout,
-				QueueTimeout:   extConfig.Device.Pool.QueueTimeout,
-				MaxQueueSize:   extConfig.Device.Pool.MaxQueueSize,
-			},
-			Log: LogConfig{
-				Enabled:       extConfig.Device.Log.Enabled,
-				File:          extConfig.Device.Log.File,
-				MaxSize:       extConfig.Device.Log.MaxSize,
-				MaxBackups:    extConfig.Device.Log.MaxBackups,
-				MaxAge:        extConfig.Device.Log.MaxAge,
-				Compress:      extConfig.Device.Log.Compress,
-				IncludeOutput: extConfig.Device.Log.IncludeOutput,
-				MaxOutputSize: extConfig.Device.Log.MaxOutputSize,
-			},
-		}
-
-		globalConfig = cfg
-		configManager = NewConfigManager(cfg)
-
-		// Validate and load config
-		if _, err := configManager.LoadConfig(); err != nil {
-			initErr = fmt.Errorf("failed to validate device config: %w", err)
+		// Custom profiles are registered before any device connects, in
+		// order, so that they can build on each other
+		if err := registerProfiles(extConfig.Device.Profiles); err != nil {
+			initErr = err
 			return
 		}
 
+		// Pool and log settings are shared by every managed device, so they
+		// are defaulted even when the settings file has no device of its own
+		applyDefaults(cfg)
+		globalConfig.Store(cfg)
+		configManager.Store(NewConfigManager(cfg))
+
 		// Create execution logger
 		execLogger, err := NewExecutionLogger(&cfg.Log)
 		if err != nil {
 			initErr = fmt.Errorf("failed to create execution logger: %w", err)
 			return
 		}
-		globalLogger = execLogger
+		globalLogger.Store(execLogger)
 
-		// Create connection pool
-		pool, err := NewConnectionPool(cfg)
-		if err != nil {
-			initErr = fmt.Errorf("failed to create connection pool: %w", err)
+		globalRegistry = NewRegistry()
+		globalJobs = NewJobManager(cfg.Jobs)
+		globalTelemetry = NewTelemetryCollector(cfg.Telemetry)
+
+		if !HasDevice(cfg) {
+			logger.Info("No device in settings file, waiting for device inventory")
 			return
 		}
-		globalPool = pool
 
-		// Start the pool
-		ctx := context.Background()
-		if err := pool.Start(ctx); err != nil {
-			initErr = fmt.Errorf("failed to start connection pool: %w", err)
+		// The settings file device is device #1 until the inventory says otherwise
+		if err := globalRegistry.Register(context.Background(), DefaultDeviceID, cfg); err != nil {
+			initErr = fmt.Errorf("failed to register default device: %w", err)
 			return
 		}
 
@@ -97,37 +78,233 @@ func Initialize(logger *zap.Logger) error {
 	return initErr
 }
 
-// GetPool returns the global connection pool
+// ConfigFromSettings converts the device block of the settings file
+func ConfigFromSettings(s config.DeviceConfig) *DeviceConfig {
+	return &DeviceConfig{
+		Connection: ConnectionConfig{
+			Protocol:       s.Connection.Protocol,
+			Vendor:         s.Connection.Vendor,
+			Host:           s.Connection.Host,
+			Port:           s.Connection.Port,
+			Username:       s.Connection.Username,
+			Password:       s.Connection.Password,
+			EnablePassword: s.Connection.EnablePassword,
+			Timeout:        s.Connection.Timeout,
+			CLIPath:        s.Connection.CLIPath,
+			CLIArgs:        s.Connection.CLIArgs,
+
+			PrivateKeyFile:       s.Connection.PrivateKeyFile,
+			PrivateKey:           s.Connection.PrivateKey,
+			PrivateKeyPassphrase: s.Connection.PrivateKeyPassphrase,
+			HostKeyPolicy:        s.Connection.HostKeyPolicy,
+			HostKeyFingerprint:   s.Connection.HostKeyFingerprint,
+			KnownHostsFile:       s.Connection.KnownHostsFile,
+		},
+		Pool: PoolConfig{
+			MaxConnections: s.Pool.MaxConnections,
+			MinConnections: s.Pool.MinConnections,
+			IdleTimeout:    s.Pool.IdleTimeout,
+			CommandTimeout: s.Pool.CommandTimeout,
+			QueueTimeout:   s.Pool.QueueTimeout,
+			MaxQueueSize:   s.Pool.MaxQueueSize,
+
+			KeepaliveInterval: s.Pool.KeepaliveInterval,
+		},
+		Log: LogConfig{
+			Enabled:       s.Log.Enabled,
+			File:          s.Log.File,
+			MaxSize:       s.Log.MaxSize,
+			MaxBackups:    s.Log.MaxBackups,
+			MaxAge:        s.Log.MaxAge,
+			Compress:      s.Log.Compress,
+			IncludeOutput: s.Log.IncludeOutput,
+			MaxOutputSize: s.Log.MaxOutputSize,
+
+			Syslog: SyslogConfig{
+				Network:            s.Log.Syslog.Network,
+				Address:            s.Log.Syslog.Address,
+				Facility:           s.Log.Syslog.Facility,
+				AppName:            s.Log.Syslog.AppName,
+				CAFile:             s.Log.Syslog.CAFile,
+				InsecureSkipVerify: s.Log.Syslog.InsecureSkipVerify,
+			},
+			Integrity: IntegrityConfig{
+				Enabled: s.Log.Integrity.Enabled,
+				Key:     s.Log.Integrity.Key,
+			},
+		},
+		Terminal: TerminalConfig{
+			IdleTimeout:        s.Terminal.IdleTimeout,
+			MaxSessionsPerUser: s.Terminal.MaxSessionsPerUser,
+			AllowedOrigins:     s.Terminal.AllowedOrigins,
+		},
+		Backup: BackupConfig{
+			Command:        s.Backup.Command,
+			IgnorePatterns: s.Backup.IgnorePatterns,
+			EnterConfig:    s.Backup.EnterConfig,
+			ExitConfig:     s.Backup.ExitConfig,
+		},
+		Jobs: JobConfig{
+			ResultTTL: s.Jobs.ResultTTL,
+			MaxJobs:   s.Jobs.MaxJobs,
+		},
+		Reload: ReloadConfig{
+			WatchInterval: s.Reload.WatchInterval,
+			DrainTimeout:  s.Reload.DrainTimeout,
+		},
+		Telemetry: TelemetryConfig{
+			Enabled:  s.Telemetry.Enabled,
+			Interval: s.Telemetry.Interval,
+			Commands: s.Telemetry.Commands,
+			Retention: TelemetryRetention{
+				Raw:        s.Telemetry.Retention.Raw,
+				FiveMinute: s.Telemetry.Retention.FiveMinute,
+				Hourly:     s.Telemetry.Retention.Hourly,
+			},
+		},
+	}
+}
+
+// registerProfiles registers the custom profiles of the settings file
+func registerProfiles(list []config.DeviceProfileConfig) error {
+	for _, p := range list {
+		err := RegisterProfile(DeviceProfile{
+			Name:             p.Name,
+			Base:             p.Base,
+			Prompt:           p.Prompt,
+			PrivilegedPrompt: p.PrivilegedPrompt,
+			UsernamePrompt:   p.UsernamePrompt,
+			PasswordPrompt:   p.PasswordPrompt,
+			MorePrompt:       p.MorePrompt,
+			EnableCommand:    p.EnableCommand,
+			DisablePaging:    p.DisablePaging,
+			ErrorPatterns:    p.ErrorPatterns,
+			LineEnding:       p.LineEnding,
+			Shell:            p.Shell,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasDevice reports whether cfg describes a device of its own
+func HasDevice(cfg *DeviceConfig) bool {
+	return cfg.Connection.Host != "" || ProtocolType(cfg.Connection.Protocol) == ProtocolLocal
+}
+
+// GetPool returns the connection pool of the default device, or nil if it is not registered
 func GetPool() *ConnectionPool {
-	return globalPool
+	if globalRegistry == nil {
+		return nil
+	}
+	pool, err := globalRegistry.Get(DefaultDeviceID)
+	if err != nil {
+		return nil
+	}
+	return pool
+}
+
+// GetDevicePool returns the connection pool of a device. id 0 selects the default device.
+func GetDevicePool(id int) (*ConnectionPool, error) {
+	if globalRegistry == nil {
+		return nil, NewDeviceNotConfiguredError()
+	}
+	return globalRegistry.Get(id)
+}
+
+// GetRegistry returns the global device registry
+func GetRegistry() *Registry {
+	return globalRegistry
+}
+
+// RegisterDevice starts (or restarts) the pool of a device. Pool, log,
+// terminal and backup settings are shared with the settings file configuration.
+func RegisterDevice(id int, conn ConnectionConfig) error {
+	if globalRegistry == nil {
+		return NewDeviceNotConfiguredError()
+	}
+	return globalRegistry.Register(context.Background(), id, withShared(conn, GetConfig()))
+}
+
+// withShared returns the configuration of a device connecting with conn and
+// sharing the other settings of shared. The inventory does not store the
+// local CLI command or the known hosts file, so conn falls back to those of
+// shared.
+func withShared(conn ConnectionConfig, shared *DeviceConfig) *DeviceConfig {
+	if conn.CLIPath == "" {
+		conn.CLIPath, conn.CLIArgs = shared.Connection.CLIPath, shared.Connection.CLIArgs
+	}
+	if conn.KnownHostsFile == "" {
+		conn.KnownHostsFile = shared.Connection.KnownHostsFile
+	}
+	return &DeviceConfig{
+		Connection: conn,
+		Pool:       shared.Pool,
+		Log:        shared.Log,
+		Terminal:   shared.Terminal,
+		Backup:     shared.Backup,
+		Jobs:       shared.Jobs,
+		Reload:     shared.Reload,
+		Telemetry:  shared.Telemetry,
+	}
+}
+
+// UnregisterDevice stops the pool of a device and removes it from the registry
+func UnregisterDevice(id int) error {
+	if globalRegistry == nil {
+		return nil
+	}
+	return globalRegistry.Unregister(id)
 }
 
 // GetLogger returns the global execution logger
 func GetLogger() *ExecutionLogger {
-	return globalLogger
+	return globalLogger.Load()
 }
 
 // GetConfig returns the global device configuration
 func GetConfig() *DeviceConfig {
-	return globalConfig
+	return globalConfig.Load()
 }
 
 // GetConfigManager returns the global config manager
 func GetConfigManager() *ConfigManager {
-	return configManager
+	return configManager.Load()
+}
+
+// GetJobManager returns the manager of asynchronous command jobs
+func GetJobManager() *JobManager {
+	return globalJobs
+}
+
+// GetTelemetryCollector returns the switch telemetry collector
+func GetTelemetryCollector() *TelemetryCollector {
+	return globalTelemetry
 }
 
 // Shutdown shuts down the device interaction layer
 func Shutdown(logger *zap.Logger) error {
-	if globalPool != nil {
-		if err := globalPool.Stop(); err != nil {
-			logger.Error("Failed to stop connection pool", zap.Error(err))
+	if globalJobs != nil {
+		globalJobs.Stop()
+	}
+	if globalTelemetry != nil {
+		globalTelemetry.Stop()
+	}
+
+	if globalRegistry != nil {
+		if err := globalRegistry.StopAll(); err != nil {
+			logger.Error("Failed to stop connection pools", zap.Error(err))
 			return err
 		}
 	}
 
-	if globalLogger != nil {
-		if err := globalLogger.Close(); err != nil {
+	// Write the entries still queued for the history store
+	SetHistoryStore(nil)
+
+	if execLogger := GetLogger(); execLogger != nil {
+		if err := execLogger.Close(); err != nil {
 			logger.Error("Failed to close execution logger", zap.Error(err))
 			return err
 		}
@@ -139,5 +316,16 @@ func Shutdown(logger *zap.Logger) error {
 
 // IsInitialized returns whether the device layer is initialized
 func IsInitialized() bool {
-	return globalPool != nil
+	return globalRegistry != nil
+}
+
+// SetCommandPolicy replaces the command policy evaluated before commands are
+// queued. A nil policy allows every command.
+func SetCommandPolicy(p *CommandPolicy) {
+	commandPolicy.Store(p)
+}
+
+// GetCommandPolicy returns the current command policy
+func GetCommandPolicy() *CommandPolicy {
+	return commandPolicy.Load()
 }
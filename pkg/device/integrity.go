@@ -0,0 +1,361 @@
+package device
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// IntegrityConfig holds the tamper evidence settings of the execution log
+type IntegrityConfig struct {
+	Enabled bool   `yaml:"enabled" mapstructure:"enabled"`
+	Key     string `yaml:"key" mapstructure:"key"` // HMAC key, may be encrypted:
+}
+
+// Chain fields added to every entry of an integrity protected log
+const (
+	chainSeq      = "seq"       // 1 for the first protected entry
+	chainPrevHash = "prev_hash" // hash of the previous entry, empty for the first
+	chainHash     = "hash"      // SHA-256 of the entry without hash and hmac
+	chainHMAC     = "hmac"      // HMAC-SHA256 of hash with log.integrity.key
+)
+
+// chainState is the head of the hash chain of a log file. It is shared by
+// the loggers writing the file, so that a logger replaced by a reload and
+// its successor continue one chain.
+type chainState struct {
+	mu     sync.Mutex
+	loaded bool
+	seq    uint64
+	hash   string
+}
+
+var chains struct {
+	sync.Mutex
+	m map[string]*chainState
+}
+
+// getChain returns the chain of a log file
+func getChain(file string) *chainState {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	chains.Lock()
+	defer chains.Unlock()
+	if chains.m == nil {
+		chains.m = make(map[string]*chainState)
+	}
+	c := chains.m[file]
+	if c == nil {
+		c = &chainState{}
+		chains.m[file] = c
+	}
+	return c
+}
+
+// integrityKey returns the HMAC key of the log, nil when the log is not
+// protected
+func integrityKey(config *IntegrityConfig) ([]byte, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	return decryptIntegrityKey(config.Key)
+}
+
+// decryptIntegrityKey decrypts a configured HMAC key
+func decryptIntegrityKey(key string) ([]byte, error) {
+	if key == "" {
+		return nil, NewInvalidConfigError("log.integrity.key is required")
+	}
+	if !IsEncrypted(key) {
+		return []byte(key), nil
+	}
+	vault, err := GetVault()
+	if err != nil {
+		return nil, NewInvalidConfigError(err.Error())
+	}
+	plain, err := vault.Decrypt(key)
+	if err != nil {
+		return nil, NewInvalidConfigError(fmt.Sprintf("failed to decrypt log.integrity.key: %v", err))
+	}
+	return []byte(plain), nil
+}
+
+// load resumes the chain from the newest protected entry of the log file or
+// its backups
+func (c *chainState) load(file string) error {
+	if c.loaded {
+		return nil
+	}
+	files, err := historyFiles(file)
+	if err != nil {
+		return err
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		data, found, err := lastChainEntry(files[i].path)
+		if err != nil {
+			return err
+		}
+		if found {
+			c.seq, _ = chainNumber(data[chainSeq])
+			c.hash, _ = data[chainHash].(string)
+			break
+		}
+	}
+	c.loaded = true
+	return nil
+}
+
+// link adds the chain fields to an entry and advances the chain. The caller
+// holds c.mu until the entry is written.
+func (c *chainState) link(entry map[string]interface{}, key []byte) {
+	entry[chainSeq] = c.seq + 1
+	entry[chainPrevHash] = c.hash
+	hash := chainEntryHash(entry)
+	entry[chainHash] = hash
+	entry[chainHMAC] = chainEntryHMAC(hash, key)
+	c.seq++
+	c.hash = hash
+}
+
+// chainEntryHash returns the hash of an entry. encoding/json sorts the keys,
+// so the entry read back from the log hashes the same.
+func chainEntryHash(entry map[string]interface{}) string {
+	fields := make(map[string]interface{}, len(entry))
+	for k, v := range entry {
+		if k != chainHash && k != chainHMAC {
+			fields[k] = v
+		}
+	}
+	data, _ := json.Marshal(fields)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// chainEntryHMAC returns the HMAC of an entry hash
+func chainEntryHMAC(hash string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(hash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// chainNumber reads the sequence number of a decoded entry
+func chainNumber(v interface{}) (uint64, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(n.String(), 10, 64)
+	return seq, err == nil
+}
+
+// parseChainLine decodes the entry of an execution log line keeping the
+// numbers as written. ok is false for lines of other messages.
+func parseChainLine(line []byte) (entry map[string]interface{}, ok bool, err error) {
+	var l struct {
+		Msg  string          `json:"msg"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(line, &l); err != nil {
+		return nil, false, err
+	}
+	if l.Msg != "command_execution" {
+		return nil, false, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(l.Data))
+	dec.UseNumber()
+	if err := dec.Decode(&entry); err != nil {
+		return nil, false, err
+	}
+	return entry, true, nil
+}
+
+// lastChainEntry returns the last protected entry of a log file. Plain files
+// are read from the end.
+func lastChainEntry(path string) (map[string]interface{}, bool, error) {
+	if strings.HasSuffix(path, ".gz") {
+		var last map[string]interface{}
+		err := readLogLines(path, func(line []byte, _ int) error {
+			if entry, ok, _ := parseChainLine(line); ok && entry[chainHash] != nil {
+				last = entry
+			}
+			return nil
+		})
+		return last, last != nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	for window := int64(64 * 1024); ; window *= 4 {
+		offset := info.Size() - window
+		if offset < 0 {
+			offset = 0
+		}
+		buf := make([]byte, info.Size()-offset)
+		if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+			return nil, false, err
+		}
+		lines := bytes.Split(buf, []byte("\n"))
+		if offset > 0 {
+			lines = lines[1:] // partial first line
+		}
+		for i := len(lines) - 1; i >= 0; i-- {
+			if entry, ok, _ := parseChainLine(lines[i]); ok && entry[chainHash] != nil {
+				return entry, true, nil
+			}
+		}
+		if offset == 0 {
+			return nil, false, nil
+		}
+	}
+}
+
+// ChainBreak is the first entry that does not continue the hash chain
+type ChainBreak struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Seq    uint64 `json:"seq,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// ChainVerification is the result of checking the hash chain of the
+// execution log
+type ChainVerification struct {
+	Valid     bool        `json:"valid"`
+	Files     []string    `json:"files"`     // oldest first
+	Entries   int64       `json:"entries"`   // protected entries checked
+	Unchained int64       `json:"unchained"` // entries written before protection was enabled
+	FirstSeq  uint64      `json:"firstSeq"`  // above 1 when the oldest backups were removed by retention
+	LastSeq   uint64      `json:"lastSeq"`
+	LastHash  string      `json:"lastHash,omitempty"`
+	Break     *ChainBreak `json:"break,omitempty"`
+}
+
+// VerifyLog walks the execution log and its rotated backups, oldest first,
+// and reports the first entry that was modified, removed or inserted. The
+// chain may start after sequence 1 when retention removed the oldest
+// backups; entries written before protection was enabled are counted but
+// cannot be checked.
+func VerifyLog(config *LogConfig) (*ChainVerification, error) {
+	key, err := decryptIntegrityKey(config.Integrity.Key)
+	if err != nil {
+		return nil, err
+	}
+	file := config.File
+	if file == "" {
+		file = defaultLogFile
+	}
+	files, err := historyFiles(file)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ChainVerification{Files: []string{}}
+	var prevHash string
+	stop := errors.New("chain broken")
+	for _, file := range files {
+		result.Files = append(result.Files, file.path)
+		err := readLogLines(file.path, func(line []byte, number int) error {
+			fail := func(seq uint64, format string, args ...interface{}) error {
+				result.Break = &ChainBreak{File: file.path, Line: number, Seq: seq, Reason: fmt.Sprintf(format, args...)}
+				return stop
+			}
+
+			entry, ok, err := parseChainLine(line)
+			if err != nil {
+				return fail(0, "unreadable entry: %v", err)
+			}
+			if !ok {
+				return nil
+			}
+			if entry[chainHash] == nil {
+				if result.Entries > 0 {
+					return fail(0, "entry without chain fields after seq %d", result.LastSeq)
+				}
+				result.Unchained++
+				return nil
+			}
+
+			seq, ok := chainNumber(entry[chainSeq])
+			if !ok {
+				return fail(0, "invalid seq")
+			}
+			hash, _ := entry[chainHash].(string)
+			prev, _ := entry[chainPrevHash].(string)
+			mac, _ := entry[chainHMAC].(string)
+			if result.Entries > 0 {
+				if seq != result.LastSeq+1 {
+					return fail(seq, "expected seq %d, entries are missing or reordered", result.LastSeq+1)
+				}
+				if prev != prevHash {
+					return fail(seq, "prev_hash does not match the hash of seq %d", result.LastSeq)
+				}
+			} else {
+				result.FirstSeq = seq
+			}
+			if chainEntryHash(entry) != hash {
+				return fail(seq, "entry was modified")
+			}
+			if !hmac.Equal([]byte(chainEntryHMAC(hash, key)), []byte(mac)) {
+				return fail(seq, "hmac mismatch, the entry was forged or the key changed")
+			}
+
+			result.Entries++
+			result.LastSeq = seq
+			result.LastHash = hash
+			prevHash = hash
+			return nil
+		})
+		if err == stop {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	result.Valid = true
+	return result, nil
+}
+
+// VerifyChain verifies the log like VerifyLog and also checks that it ends
+// with the last entry this process wrote, which detects a truncated log or a
+// removed current file.
+func (l *ExecutionLogger) VerifyChain() (*ChainVerification, error) {
+	if l.chain == nil {
+		return nil, NewNotSupportedError("log.integrity is not enabled")
+	}
+	l.chain.mu.Lock()
+	seq, hash := l.chain.seq, l.chain.hash
+	l.chain.mu.Unlock()
+
+	result, err := VerifyLog(l.config)
+	if err != nil || !result.Valid {
+		return result, err
+	}
+	if result.LastSeq < seq || result.LastSeq == seq && result.LastHash != hash {
+		result.Valid = false
+		result.Break = &ChainBreak{
+			File:   l.config.File,
+			Seq:    seq,
+			Reason: fmt.Sprintf("log ends at seq %d, but seq %d was written", result.LastSeq, seq),
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,171 @@
+package device
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// integrityLogger opens a protected execution log at file, resuming its
+// chain from disk like a restart does
+func integrityLogger(t *testing.T, file string) *ExecutionLogger {
+	t.Helper()
+	chains.Lock()
+	chains.m = nil
+	chains.Unlock()
+	execLogger, err := NewExecutionLogger(&LogConfig{
+		Enabled:   true,
+		File:      file,
+		Integrity: IntegrityConfig{Enabled: true, Key: "chain-key"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return execLogger
+}
+
+// rotate moves the log file to a compressed backup the way lumberjack does
+func rotate(t *testing.T, file string, at time.Time) {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write(data)
+	_ = gz.Close()
+	backup := strings.TrimSuffix(file, ".log") + "-" + at.UTC().Format(backupTimeFormat) + ".log.gz"
+	if err := os.WriteFile(backup, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeChain writes a protected log of five entries over a backup and the
+// current file, after an entry written before protection was enabled
+func writeChain(t *testing.T) (*ExecutionLogger, string) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "command.log")
+	plain, err := NewExecutionLogger(&LogConfig{Enabled: true, File: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = plain.Log(&ExecutionLog{Timestamp: time.Now().Unix(), Command: "show clock"})
+	_ = plain.Close()
+
+	execLogger := integrityLogger(t, file)
+	for _, cmd := range []string{"show version", "show vlan <1-10>"} {
+		_ = execLogger.Log(&ExecutionLog{Timestamp: time.Now().Unix(), Command: cmd, Duration: 12})
+	}
+	_ = execLogger.Close()
+	rotate(t, file, time.Now())
+
+	// a restart resumes the chain from the backup
+	execLogger = integrityLogger(t, file)
+	for _, cmd := range []string{"configure terminal", "vlan 10", "end"} {
+		_ = execLogger.LogTranscript(&ExecutionLog{Timestamp: time.Now().Unix(), Command: cmd, Output: "ok\x00\xff"})
+	}
+	t.Cleanup(func() { _ = execLogger.Close() })
+	return execLogger, file
+}
+
+func TestVerifyLog(t *testing.T) {
+	execLogger, _ := writeChain(t)
+	result, err := execLogger.VerifyChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid || result.Entries != 5 || result.FirstSeq != 1 || result.LastSeq != 5 {
+		t.Fatalf("result = %+v, break = %+v", result, result.Break)
+	}
+	if result.Unchained != 1 || len(result.Files) != 2 {
+		t.Errorf("unchained = %d, files = %v", result.Unchained, result.Files)
+	}
+}
+
+// editLine rewrites line n (from 1) of the current log file
+func editLine(t *testing.T, file string, n int, edit func(string) string) {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	lines[n-1] = edit(lines[n-1])
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "")), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyLogTampered(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   int
+		edit   func(string) string
+		reason string
+	}{
+		{"modified", 2, func(l string) string { return strings.Replace(l, "vlan 10", "vlan 20", 1) }, "modified"},
+		{"removed", 2, func(string) string { return "" }, "expected seq 4"},
+		{"forged", 1, func(l string) string {
+			// an attacker without the key can recompute the hashes but not the hmac
+			entry, _, _ := parseChainLine([]byte(l))
+			entry["command"] = "show running-config"
+			return strings.Replace(strings.Replace(l, "configure terminal", "show running-config", 1),
+				entry[chainHash].(string), chainEntryHash(entry), 1)
+		}, "hmac mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			execLogger, file := writeChain(t)
+			editLine(t, file, tt.line, tt.edit)
+
+			result, err := execLogger.VerifyChain()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Valid || result.Break == nil || !strings.Contains(result.Break.Reason, tt.reason) {
+				t.Fatalf("result = %+v, break = %+v, want %q", result, result.Break, tt.reason)
+			}
+			if result.Break.File != file || result.Break.Line != tt.line {
+				t.Errorf("break at %s line %d, want line %d", result.Break.File, result.Break.Line, tt.line)
+			}
+		})
+	}
+}
+
+func TestVerifyLogTruncated(t *testing.T) {
+	execLogger, file := writeChain(t)
+	editLine(t, file, 3, func(string) string { return "" })
+
+	// the remaining entries are a valid chain, only the logger knows more
+	// was written
+	result, err := VerifyLog(execLogger.config)
+	if err != nil || !result.Valid {
+		t.Fatalf("VerifyLog = %+v, %v", result, err)
+	}
+	result, err = execLogger.VerifyChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid || !strings.Contains(result.Break.Reason, "log ends at seq 4") {
+		t.Errorf("result = %+v, break = %+v", result, result.Break)
+	}
+}
+
+func TestIntegrityKeyRequired(t *testing.T) {
+	_, err := NewExecutionLogger(&LogConfig{
+		Enabled:   true,
+		File:      filepath.Join(t.TempDir(), "command.log"),
+		Integrity: IntegrityConfig{Enabled: true},
+	})
+	if err == nil {
+		t.Error("protected log without key accepted")
+	}
+}
@@ -0,0 +1,383 @@
+package device
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Job states
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed" // every command ran, successfully or not
+	JobFailed    = "failed"    // the commands could not be queued
+	JobCancelled = "cancelled"
+)
+
+// Job event types
+const (
+	JobEventResult = "result"
+	JobEventStatus = "status"
+)
+
+// JobConfig holds the asynchronous command job settings
+type JobConfig struct {
+	ResultTTL int `yaml:"result_ttl" mapstructure:"result_ttl"` // seconds a finished job is kept
+	MaxJobs   int `yaml:"max_jobs" mapstructure:"max_jobs"`     // queued, running and retained jobs
+}
+
+// JobEvent is sent to the subscribers of a job when a command finishes and
+// when the job changes state
+type JobEvent struct {
+	Type   string         `json:"type"`
+	Index  int            `json:"index"` // index of the command of a result event
+	Result *CommandResult `json:"result,omitempty"`
+	Status string         `json:"status"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// JobSnapshot is the state of a job at one point in time
+type JobSnapshot struct {
+	ID         string           `json:"id"`
+	DeviceID   int              `json:"deviceId"`
+	UserID     string           `json:"userId,omitempty"`
+	Username   string           `json:"username,omitempty"`
+	Status     string           `json:"status"`
+	Commands   []string         `json:"commands"`
+	Results    []*CommandResult `json:"results"`
+	Total      int              `json:"total"`
+	Success    int              `json:"success"`
+	Failed     int              `json:"failed"`
+	Error      string           `json:"error,omitempty"`
+	CreatedAt  int64            `json:"createdAt"`
+	StartedAt  int64            `json:"startedAt,omitempty"`
+	FinishedAt int64            `json:"finishedAt,omitempty"`
+}
+
+// Job is a list of commands run on a device in the background
+type Job struct {
+	id        string
+	deviceID  int
+	principal *Principal
+	commands  []string
+	cancel    context.CancelFunc
+
+	mu       sync.Mutex
+	status   string
+	results  []*CommandResult
+	err      string
+	created  time.Time
+	started  time.Time
+	finished time.Time
+	subs     map[chan JobEvent]struct{}
+}
+
+// ID returns the job id
+func (j *Job) ID() string {
+	return j.id
+}
+
+// UserID returns the id of the user who submitted the job
+func (j *Job) UserID() string {
+	if j.principal == nil {
+		return ""
+	}
+	return j.principal.UserID
+}
+
+// Snapshot returns the current state of the job
+func (j *Job) Snapshot() JobSnapshot {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.snapshot()
+}
+
+func (j *Job) snapshot() JobSnapshot {
+	s := JobSnapshot{
+		ID:        j.id,
+		DeviceID:  j.deviceID,
+		Status:    j.status,
+		Commands:  j.commands,
+		Results:   append([]*CommandResult(nil), j.results...),
+		Total:     len(j.commands),
+		Error:     j.err,
+		CreatedAt: j.created.Unix(),
+	}
+	if j.principal != nil {
+		s.UserID, s.Username = j.principal.UserID, j.principal.Username
+	}
+	for _, r := range j.results {
+		if r.Success {
+			s.Success++
+		} else {
+			s.Failed++
+		}
+	}
+	if !j.started.IsZero() {
+		s.StartedAt = j.started.Unix()
+	}
+	if !j.finished.IsZero() {
+		s.FinishedAt = j.finished.Unix()
+	}
+	return s
+}
+
+// Subscribe returns the current state of the job and a channel receiving
+// the events that follow it. The channel is closed when the job finishes or
+// unsubscribe is called. Events are dropped for subscribers that fall behind.
+func (j *Job) Subscribe() (JobSnapshot, <-chan JobEvent, func()) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	ch := make(chan JobEvent, len(j.commands)+4)
+	if j.done() {
+		close(ch)
+		return j.snapshot(), ch, func() {}
+	}
+	j.subs[ch] = struct{}{}
+	unsubscribe := func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if _, ok := j.subs[ch]; ok {
+			delete(j.subs, ch)
+			close(ch)
+		}
+	}
+	return j.snapshot(), ch, unsubscribe
+}
+
+// Cancel stops the job. Commands that have not run yet are skipped and the
+// running command is interrupted.
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+func (j *Job) done() bool {
+	return j.status == JobCompleted || j.status == JobFailed || j.status == JobCancelled
+}
+
+// publish sends an event to the subscribers, j.mu must be held
+func (j *Job) publish(e JobEvent) {
+	for ch := range j.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+func (j *Job) markRunning() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status != JobQueued {
+		return
+	}
+	j.status = JobRunning
+	j.started = time.Now()
+	j.publish(JobEvent{Type: JobEventStatus, Status: j.status})
+}
+
+func (j *Job) addResult(r *CommandResult) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.results = append(j.results, r)
+	j.publish(JobEvent{Type: JobEventResult, Index: len(j.results) - 1, Result: r, Status: j.status})
+}
+
+func (j *Job) finish(status, errMsg string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.done() {
+		return
+	}
+	j.status = status
+	j.err = errMsg
+	j.finished = time.Now()
+	j.publish(JobEvent{Type: JobEventStatus, Status: status, Error: errMsg})
+	for ch := range j.subs {
+		close(ch)
+	}
+	j.subs = nil
+	j.cancel()
+}
+
+// JobManager runs command jobs through the queues of the connection pools
+// and keeps finished jobs for the result TTL
+type JobManager struct {
+	config JobConfig
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewJobManager creates a job manager and starts removing expired jobs
+func NewJobManager(config JobConfig) *JobManager {
+	m := &JobManager{
+		config: config.withDefaults(),
+		jobs:   make(map[string]*Job),
+		stop:   make(chan struct{}),
+	}
+	go m.reap()
+	return m
+}
+
+// SetConfig replaces the job settings. Jobs already submitted are kept even
+// if they exceed the new limit.
+func (m *JobManager) SetConfig(config JobConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.config = config.withDefaults()
+}
+
+// withDefaults fills in the defaults of the job settings
+func (c JobConfig) withDefaults() JobConfig {
+	if c.ResultTTL <= 0 {
+		c.ResultTTL = 3600
+	}
+	if c.MaxJobs <= 0 {
+		c.MaxJobs = 1000
+	}
+	return c
+}
+
+// Submit checks the commands against the command policy for the principal
+// of ctx and queues them on the pool of device deviceID in the background.
+// Like Execute, policy denials and confirmations are returned immediately.
+func (m *JobManager) Submit(ctx context.Context, deviceID int, pool *ConnectionPool, commands []string, timeout time.Duration) (*Job, error) {
+	if err := pool.Authorize(ctx, commands); err != nil {
+		return nil, err
+	}
+
+	principal, _ := PrincipalFrom(ctx)
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	job := &Job{
+		id:        newJobID(),
+		deviceID:  deviceID,
+		principal: principal,
+		commands:  commands,
+		cancel:    cancel,
+		status:    JobQueued,
+		created:   time.Now(),
+		subs:      make(map[chan JobEvent]struct{}),
+	}
+
+	m.mu.Lock()
+	m.expire(time.Now())
+	if len(m.jobs) >= m.config.MaxJobs {
+		m.mu.Unlock()
+		cancel()
+		return nil, NewQueueFullError()
+	}
+	m.jobs[job.id] = job
+	m.mu.Unlock()
+
+	go m.run(jobCtx, job, pool, timeout)
+	return job, nil
+}
+
+func (m *JobManager) run(ctx context.Context, job *Job, pool *ConnectionPool, timeout time.Duration) {
+	task := &CommandTask{
+		Commands: job.commands,
+		Timeout:  timeout,
+		ResultCh: make(chan *CommandResult, len(job.commands)),
+		UserID:   job.UserID(),
+		Priority: PriorityFrom(ctx),
+		ctx:      ctx,
+		started:  job.markRunning,
+	}
+	if err := pool.enqueue(ctx, task); err != nil {
+		if ctx.Err() != nil {
+			job.finish(JobCancelled, "")
+		} else {
+			job.finish(JobFailed, err.Error())
+		}
+		return
+	}
+
+	for range job.commands {
+		select {
+		case result := <-task.ResultCh:
+			job.addResult(result)
+			if logger := GetLogger(); logger != nil {
+				p := job.principal
+				if p == nil {
+					p = &Principal{}
+				}
+				_ = logger.LogFromResult(result, job.deviceID, p.UserID, p.Username, p.ClientIP)
+			}
+		case <-ctx.Done():
+			job.finish(JobCancelled, "")
+			return
+		}
+	}
+	if ctx.Err() != nil {
+		job.finish(JobCancelled, "")
+		return
+	}
+	job.finish(JobCompleted, "")
+}
+
+// Get returns a queued, running or retained job
+func (m *JobManager) Get(id string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(time.Now())
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, NewJobNotFoundError(id)
+	}
+	return job, nil
+}
+
+// Stop cancels the unfinished jobs and stops the expiry of finished ones
+func (m *JobManager) Stop() {
+	m.once.Do(func() {
+		close(m.stop)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for _, job := range m.jobs {
+			job.Cancel()
+		}
+	})
+}
+
+func (m *JobManager) reap() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			m.expire(now)
+			m.mu.Unlock()
+		}
+	}
+}
+
+// expire removes the jobs that finished more than the result TTL ago, m.mu
+// must be held
+func (m *JobManager) expire(now time.Time) {
+	ttl := time.Duration(m.config.ResultTTL) * time.Second
+	for id, job := range m.jobs {
+		job.mu.Lock()
+		expired := job.done() && now.Sub(job.finished) > ttl
+		job.mu.Unlock()
+		if expired {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func newJobID() string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return fmt.Sprintf("%x-%s", time.Now().Unix(), hex.EncodeToString(buf))
+}
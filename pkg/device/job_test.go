@@ -0,0 +1,113 @@
+package device
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// jobTestAdapter answers commands instantly, except "wait" which blocks until
+// the command context ends
+type jobTestAdapter struct{}
+
+func (jobTestAdapter) Connect(ctx context.Context, config *ConnectionConfig) error { return nil }
+func (jobTestAdapter) Disconnect(ctx context.Context) error                        { return nil }
+func (jobTestAdapter) IsConnected() bool                                           { return true }
+func (jobTestAdapter) ProtocolType() ProtocolType                                  { return ProtocolSSH }
+
+func (jobTestAdapter) ExecuteCommand(ctx context.Context, cmd string) (*CommandResult, error) {
+	if cmd == "wait" {
+		<-ctx.Done()
+		return nil, NewCommandFailedError(ctx.Err())
+	}
+	return &CommandResult{Command: cmd, Output: "out " + cmd, Success: true, Timestamp: time.Now().Unix()}, nil
+}
+
+func newJobTestPool(t *testing.T) *ConnectionPool {
+	cfg := &DeviceConfig{Connection: ConnectionConfig{Protocol: string(ProtocolSSH)}}
+	applyDefaults(cfg)
+	cfg.Pool.MinConnections = 0
+	pool, err := NewConnectionPool(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.newAdapter = func() ProtocolAdapter { return jobTestAdapter{} }
+	if err := pool.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Stop() })
+	return pool
+}
+
+func TestJobManager(t *testing.T) {
+	pool := newJobTestPool(t)
+	m := NewJobManager(JobConfig{ResultTTL: 60, MaxJobs: 2})
+	defer m.Stop()
+	ctx := WithPrincipal(context.Background(), &Principal{UserID: "7"})
+
+	job, err := m.Submit(ctx, 1, pool, []string{"show a", "show b"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, events, unsubscribe := job.Subscribe()
+	defer unsubscribe()
+	var results int
+	for e := range events {
+		if e.Type == JobEventResult {
+			results++
+		}
+	}
+	s := job.Snapshot()
+	if s.Status != JobCompleted || results != 2 || s.Success != 2 || s.UserID != "7" {
+		t.Errorf("finished job = %+v after %d result events", s, results)
+	}
+	if got, err := m.Get(job.ID()); err != nil || got != job {
+		t.Errorf("Get = %v, %v", got, err)
+	}
+
+	// finished jobs expire after the TTL
+	m.mu.Lock()
+	m.expire(time.Now().Add(2 * time.Minute))
+	m.mu.Unlock()
+	if _, err := m.Get(job.ID()); !isDeviceError(err, ErrJobNotFound) {
+		t.Errorf("expired job lookup error = %v", err)
+	}
+}
+
+func TestJobManagerCancel(t *testing.T) {
+	pool := newJobTestPool(t)
+	m := NewJobManager(JobConfig{ResultTTL: 60, MaxJobs: 1})
+	defer m.Stop()
+
+	job, err := m.Submit(context.Background(), 1, pool, []string{"show a", "wait", "show c"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Submit(context.Background(), 1, pool, []string{"show a"}, time.Minute); !isDeviceError(err, ErrQueueFull) {
+		t.Errorf("submit beyond max jobs error = %v", err)
+	}
+
+	_, events, unsubscribe := job.Subscribe()
+	defer unsubscribe()
+	for e := range events {
+		if e.Type == JobEventResult && e.Index == 0 {
+			job.Cancel()
+		}
+	}
+
+	s := job.Snapshot()
+	if s.Status != JobCancelled || s.FinishedAt == 0 {
+		t.Errorf("cancelled job = %+v", s)
+	}
+	if len(s.Results) == 0 || !s.Results[0].Success {
+		t.Errorf("results before cancel = %+v", s.Results)
+	}
+
+	// the worker is free again once the running command was interrupted
+	deadline, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results, err := pool.Execute(deadline, []string{"show d"}, time.Second)
+	if err != nil || len(results) != 1 || !results[0].Success {
+		t.Errorf("Execute after cancel = %+v, %v", results, err)
+	}
+}
@@ -0,0 +1,224 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+// ProtocolLocal runs the CLI of the switch opt-switch is running on
+const ProtocolLocal ProtocolType = "local"
+
+// LocalAdapter implements ProtocolAdapter by starting the CLI binary of the
+// switch on a pseudo terminal. It needs no network access and no
+// credentials; the device profile of the vendor drives the CLI like a Telnet
+// session.
+type LocalAdapter struct {
+	config    *ConnectionConfig
+	proc      *localProcess
+	session   *cliSession
+	profile   *DeviceProfile
+	connected bool
+}
+
+// NewLocalAdapter creates a new local CLI adapter
+func NewLocalAdapter() *LocalAdapter {
+	return &LocalAdapter{}
+}
+
+// localProcess is a CLI process on a pseudo terminal
+type localProcess struct {
+	cmd    *exec.Cmd
+	tty    *os.File
+	exited chan struct{} // closed when the process exits
+	once   sync.Once
+}
+
+// startLocalProcess starts the CLI configured in config on a new pseudo
+// terminal of the given size
+func startLocalProcess(config *ConnectionConfig, cols, rows int) (*localProcess, error) {
+	if config.CLIPath == "" {
+		return nil, NewInvalidConfigError("connection.cli_path is required for the local protocol")
+	}
+	cmd := exec.Command(config.CLIPath, config.CLIArgs...)
+	cmd.Env = append(os.Environ(), "TERM=vt100")
+	tty, err := pty.StartWithSize(cmd, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+	if err != nil {
+		return nil, err
+	}
+
+	p := &localProcess{cmd: cmd, tty: tty, exited: make(chan struct{})}
+	go func() {
+		_ = cmd.Wait()
+		close(p.exited)
+	}()
+	return p, nil
+}
+
+// alive reports whether the process is still running
+func (p *localProcess) alive() bool {
+	select {
+	case <-p.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// close kills the process and releases the pseudo terminal
+func (p *localProcess) close() error {
+	var err error
+	p.once.Do(func() {
+		if p.alive() {
+			_ = p.cmd.Process.Kill()
+		}
+		err = p.tty.Close()
+		<-p.exited
+	})
+	return err
+}
+
+// Connect starts the CLI and prepares it as described by the device profile.
+// The CLI is expected to start logged in; the context bounds the wait for the
+// first prompt.
+func (a *LocalAdapter) Connect(ctx context.Context, config *ConnectionConfig) error {
+	creds, err := config.credentials()
+	if err != nil {
+		return err
+	}
+	proc, err := startLocalProcess(config, 511, 0)
+	if err != nil {
+		return NewConnectionError(err)
+	}
+
+	a.config = config
+	a.proc = proc
+	a.profile = LookupProfile(config.Vendor)
+	a.session = newCLISession(proc.tty, proc.tty, a.profile, "\n", time.Duration(config.Timeout)*time.Second)
+	a.connected = true
+
+	if _, _, err := a.session.expect(ctx, a.profile.prompt); err != nil {
+		a.Disconnect(ctx)
+		return NewConnectionError(err)
+	}
+	if err := a.session.prepare(ctx, creds.enable()); err != nil {
+		a.Disconnect(ctx)
+		return NewConnectionError(err)
+	}
+	return nil
+}
+
+// Disconnect stops the CLI process
+func (a *LocalAdapter) Disconnect(ctx context.Context) error {
+	if a.proc != nil {
+		a.session.close()
+		err := a.proc.close()
+		a.proc = nil
+		a.session = nil
+		a.connected = false
+		return err
+	}
+	return nil
+}
+
+// ExecuteCommand executes a single command. A command whose output matches
+// an error pattern of the device profile is unsuccessful, but leaves the
+// CLI usable.
+func (a *LocalAdapter) ExecuteCommand(ctx context.Context, cmd string) (*CommandResult, error) {
+	if !a.IsConnected() {
+		return nil, NewConnectionError(fmt.Errorf("not connected"))
+	}
+
+	startTime := time.Now()
+	output, err := a.session.run(ctx, cmd)
+	duration := time.Since(startTime)
+
+	result := &CommandResult{
+		Command:   cmd,
+		Output:    output,
+		Duration:  duration.Milliseconds(),
+		Success:   err == nil,
+		Timestamp: time.Now().Unix(),
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		// the rest of the output would be read as the output of the next
+		// command, unless the CLI gets back to the prompt
+		if ctx.Err() == nil || a.session.interrupt() != nil {
+			a.Disconnect(ctx)
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, NewCommandTimeoutError()
+		}
+		return result, NewCommandFailedError(err)
+	}
+
+	if err := a.profile.CheckOutput(output); err != nil {
+		result.Success = false
+		result.Error = err.Error()
+	}
+
+	return result, nil
+}
+
+// Keepalive fails once the CLI process has exited
+func (a *LocalAdapter) Keepalive(ctx context.Context) error {
+	if !a.IsConnected() {
+		return NewConnectionError(fmt.Errorf("CLI process exited"))
+	}
+	return nil
+}
+
+// IsConnected returns whether the CLI process is running
+func (a *LocalAdapter) IsConnected() bool {
+	return a.connected && a.proc != nil && a.proc.alive()
+}
+
+// AdapterCapabilities reports the local CLI capabilities. All commands share
+// one CLI process.
+func (a *LocalAdapter) AdapterCapabilities() AdapterCapabilities {
+	return AdapterCapabilities{ConfigSession: true, Streaming: true}
+}
+
+// ProtocolType returns the protocol type
+func (a *LocalAdapter) ProtocolType() ProtocolType {
+	return ProtocolLocal
+}
+
+// OpenTerminal starts a separate CLI process for an interactive terminal.
+// The adapter only needs to hold the configuration for it.
+func (a *LocalAdapter) OpenTerminal(ctx context.Context, cols, rows int) (TerminalSession, error) {
+	if !a.IsConnected() {
+		return nil, NewConnectionError(fmt.Errorf("not connected"))
+	}
+	proc, err := startLocalProcess(a.config, cols, rows)
+	if err != nil {
+		return nil, NewCommandFailedError(err)
+	}
+	return &localTerminal{proc: proc}, nil
+}
+
+// localTerminal is an interactive CLI process
+type localTerminal struct {
+	proc *localProcess
+}
+
+func (t *localTerminal) Read(p []byte) (int, error)  { return t.proc.tty.Read(p) }
+func (t *localTerminal) Write(p []byte) (int, error) { return t.proc.tty.Write(p) }
+func (t *localTerminal) Close() error                { return t.proc.close() }
+
+// Resize changes the window size of the pseudo terminal
+func (t *localTerminal) Resize(cols, rows int) error {
+	return pty.Setsize(t.proc.tty, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+}
+
+// NewLocalAdapterFunc creates a new local CLI adapter (factory function)
+func NewLocalAdapterFunc() ProtocolAdapter {
+	return NewLocalAdapter()
+}
@@ -0,0 +1,127 @@
+package device
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestLocalCLIHelper is the switch CLI started by the local adapter tests.
+// It only runs as a child process.
+func TestLocalCLIHelper(t *testing.T) {
+	if os.Getenv("OPT_SWITCH_LOCAL_CLI") != "1" {
+		return
+	}
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, syscall.SIGINT)
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- strings.TrimSpace(scanner.Text())
+		}
+		os.Exit(0)
+	}()
+	for {
+		fmt.Print("switch# ")
+		switch <-lines {
+		case "show version":
+			fmt.Println("Local Switch 1.0")
+		case "hang":
+			// runs until interrupted with Ctrl-C
+			<-interrupts
+			fmt.Println("^C")
+		case "exit":
+			os.Exit(0)
+		}
+	}
+}
+
+func localTestConfig(t *testing.T) *ConnectionConfig {
+	t.Setenv("OPT_SWITCH_LOCAL_CLI", "1")
+	return &ConnectionConfig{
+		Protocol: string(ProtocolLocal),
+		CLIPath:  os.Args[0],
+		CLIArgs:  []string{"-test.run=^TestLocalCLIHelper$"},
+		Timeout:  5,
+	}
+}
+
+func TestLocalAdapter(t *testing.T) {
+	a := NewLocalAdapter()
+	ctx := context.Background()
+	if err := a.Connect(ctx, localTestConfig(t)); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Disconnect(ctx)
+
+	result, err := a.ExecuteCommand(ctx, "show version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Output != "Local Switch 1.0" {
+		t.Errorf("output = %q", result.Output)
+	}
+
+	// a timed out command is interrupted and the CLI stays usable
+	timeoutCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if _, err := a.ExecuteCommand(timeoutCtx, "hang"); err == nil {
+		t.Fatal("hanging command succeeded")
+	}
+	if !a.IsConnected() {
+		t.Fatal("interrupted CLI was closed")
+	}
+	if result, err := a.ExecuteCommand(ctx, "show version"); err != nil || result.Output != "Local Switch 1.0" {
+		t.Fatalf("after interrupt: result = %+v, err = %v", result, err)
+	}
+
+	// the adapter notices the CLI exiting
+	_, _ = a.ExecuteCommand(ctx, "exit")
+	deadline := time.Now().Add(5 * time.Second)
+	for a.IsConnected() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := a.Keepalive(ctx); err == nil {
+		t.Error("keepalive succeeded after the CLI exited")
+	}
+}
+
+func TestLocalConfigNeedsNoCredentials(t *testing.T) {
+	cfg := &DeviceConfig{Connection: ConnectionConfig{Protocol: string(ProtocolLocal)}}
+	if _, err := NewConfigManager(cfg).LoadConfig(); err == nil {
+		t.Error("local protocol without cli_path accepted")
+	}
+	cfg.Connection.CLIPath = "/usr/bin/switch-cli"
+	if _, err := NewConfigManager(cfg).LoadConfig(); err != nil {
+		t.Errorf("local protocol without address or password rejected: %v", err)
+	}
+}
+
+func TestInventoryDeviceInheritsLocalCLI(t *testing.T) {
+	shared := &DeviceConfig{Connection: ConnectionConfig{
+		Protocol:       string(ProtocolLocal),
+		CLIPath:        "/usr/bin/switch-cli",
+		CLIArgs:        []string{"-q"},
+		KnownHostsFile: "/etc/opt-switch/known_hosts",
+	}}
+	cfg := withShared(ConnectionConfig{Protocol: string(ProtocolLocal)}, shared)
+	if cfg.Connection.CLIPath != "/usr/bin/switch-cli" || len(cfg.Connection.CLIArgs) != 1 {
+		t.Errorf("cli = %q %v, want the settings file command", cfg.Connection.CLIPath, cfg.Connection.CLIArgs)
+	}
+	if cfg.Connection.KnownHostsFile != "/etc/opt-switch/known_hosts" {
+		t.Errorf("known hosts = %q", cfg.Connection.KnownHostsFile)
+	}
+
+	cfg = withShared(ConnectionConfig{Protocol: string(ProtocolLocal), CLIPath: "/opt/cli"}, shared)
+	if cfg.Connection.CLIPath != "/opt/cli" || cfg.Connection.CLIArgs != nil {
+		t.Errorf("cli = %q %v, want the device command", cfg.Connection.CLIPath, cfg.Connection.CLIArgs)
+	}
+}
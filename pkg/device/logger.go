@@ -1,7 +1,6 @@
 package device
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -15,21 +14,27 @@ import (
 
 // ExecutionLog represents a command execution log entry
 type ExecutionLog struct {
-	Timestamp   int64  `json:"timestamp"`
-	UserID      string `json:"user_id,omitempty"`
-	Username    string `json:"username,omitempty"`
-	Command     string `json:"command"`
-	Output      string `json:"output,omitempty"`
-	OutputSize  int    `json:"output_size"`
-	Success     bool   `json:"success"`
-	Error       string `json:"error,omitempty"`
-	Duration    int64  `json:"duration_ms"`
-	ClientIP    string `json:"client_ip,omitempty"`
+	Timestamp  int64  `json:"timestamp"`
+	DeviceID   int    `json:"device_id,omitempty"`
+	UserID     string `json:"user_id,omitempty"`
+	Username   string `json:"username,omitempty"`
+	Command    string `json:"command"`
+	Output     string `json:"output,omitempty"`
+	OutputSize int    `json:"output_size"`
+	Success    bool   `json:"success"`
+	Error      string `json:"error,omitempty"`
+	Duration   int64  `json:"duration_ms"`
+	ClientIP   string `json:"client_ip,omitempty"`
+	SessionID  string `json:"session_id,omitempty"`
+	Policy     string `json:"policy,omitempty"` // deny or confirm when the command policy rejected the command
 }
 
 // ExecutionLogger handles command execution logging
 type ExecutionLogger struct {
 	logger *zap.Logger
+	syslog *syslogForwarder // nil unless log.syslog is set
+	chain  *chainState      // nil unless log.integrity is enabled
+	key    []byte           // HMAC key of the chain
 	config *LogConfig
 	mu     sync.RWMutex
 }
@@ -42,9 +47,32 @@ func NewExecutionLogger(config *LogConfig) (*ExecutionLogger, error) {
 		}, nil
 	}
 
+	key, err := integrityKey(&config.Integrity)
+	if err != nil {
+		return nil, err
+	}
+	var chain *chainState
+	if key != nil {
+		chain = getChain(config.File)
+		chain.mu.Lock()
+		err := chain.load(config.File)
+		chain.mu.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("failed to resume the log hash chain: %w", err)
+		}
+	}
+
+	forwarder, err := newSyslogForwarder(config.Syslog)
+	if err != nil {
+		return nil, err
+	}
+
 	// Ensure log directory exists
 	logDir := filepath.Dir(config.File)
 	if err := os.MkdirAll(logDir, 0755); err != nil {
+		if forwarder != nil {
+			forwarder.Close()
+		}
 		return nil, fmt.Errorf("failed to create log directory: %w", err)
 	}
 
@@ -83,6 +111,9 @@ func NewExecutionLogger(config *LogConfig) (*ExecutionLogger, error) {
 
 	return &ExecutionLogger{
 		logger: logger,
+		syslog: forwarder,
+		chain:  chain,
+		key:    key,
 		config: config,
 	}, nil
 }
@@ -93,18 +124,38 @@ func (l *ExecutionLogger) Log(log *ExecutionLog) error {
 		return nil
 	}
 
-	l.mu.Lock()
-	defer l.mu.Unlock()
-
 	// Truncate output if needed
 	output := log.Output
 	if l.config.MaxOutputSize > 0 && len(output) > l.config.MaxOutputSize {
 		output = output[:l.config.MaxOutputSize] + "... (truncated)"
 	}
+	if !l.config.IncludeOutput {
+		output = ""
+	}
+
+	l.write(log, output)
+	return nil
+}
+
+// LogTranscript logs a chunk of an interactive terminal session. Transcripts
+// are recorded in full, regardless of the output size and inclusion settings.
+func (l *ExecutionLogger) LogTranscript(log *ExecutionLog) error {
+	if !l.config.Enabled {
+		return nil
+	}
+
+	l.write(log, log.Output)
+	return nil
+}
+
+func (l *ExecutionLogger) write(log *ExecutionLog, output string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
 	// Create log entry
 	logEntry := map[string]interface{}{
 		"timestamp":   time.Unix(log.Timestamp, 0).Format(time.RFC3339),
+		"device_id":   log.DeviceID,
 		"user_id":     log.UserID,
 		"username":    log.Username,
 		"command":     log.Command,
@@ -114,7 +165,7 @@ func (l *ExecutionLogger) Log(log *ExecutionLog) error {
 		"client_ip":   log.ClientIP,
 	}
 
-	if l.config.IncludeOutput && len(output) > 0 {
+	if len(output) > 0 {
 		logEntry["output"] = output
 	}
 
@@ -122,18 +173,39 @@ func (l *ExecutionLogger) Log(log *ExecutionLog) error {
 		logEntry["error"] = log.Error
 	}
 
-	// Log as JSON
+	if log.SessionID != "" {
+		logEntry["session_id"] = log.SessionID
+	}
+
+	if log.Policy != "" {
+		logEntry["policy"] = log.Policy
+	}
+
+	// Log as JSON, linked to the previous entry when the log is protected
 	if l.logger != nil {
-		l.logger.Info("command_execution", zap.Any("data", logEntry))
+		if l.chain != nil {
+			l.chain.mu.Lock()
+			l.chain.link(logEntry, l.key)
+			l.logger.Info("command_execution", zap.Any("data", logEntry))
+			l.chain.mu.Unlock()
+		} else {
+			l.logger.Info("command_execution", zap.Any("data", logEntry))
+		}
 	}
 
-	return nil
+	entry := *log
+	entry.Output = output
+	if l.syslog != nil {
+		l.syslog.Forward(entry)
+	}
+	recordHistory(entry)
 }
 
 // LogFromResult logs a command execution from CommandResult
-func (l *ExecutionLogger) LogFromResult(result *CommandResult, userID, username, clientIP string) error {
+func (l *ExecutionLogger) LogFromResult(result *CommandResult, deviceID int, userID, username, clientIP string) error {
 	return l.Log(&ExecutionLog{
 		Timestamp:  result.Timestamp,
+		DeviceID:   deviceID,
 		UserID:     userID,
 		Username:   username,
 		Command:    result.Command,
@@ -146,156 +218,57 @@ func (l *ExecutionLogger) LogFromResult(result *CommandResult, userID, username,
 	})
 }
 
-// GetHistory retrieves execution history from log file
-func (l *ExecutionLogger) GetHistory(limit, offset int) ([]ExecutionLog, error) {
+// GetHistory returns a page of the command history matching q, newest
+// first, and the number of matching entries. It is answered by the history
+// store when one is installed and from the log file and its rotated backups
+// otherwise.
+func (l *ExecutionLogger) GetHistory(q *HistoryQuery) ([]ExecutionLog, int64, error) {
+	if err := q.Compile(); err != nil {
+		return nil, 0, err
+	}
+	if store := GetHistoryStore(); store != nil {
+		return store.Query(q)
+	}
 	if !l.config.Enabled {
-		return []ExecutionLog{}, nil
+		return []ExecutionLog{}, 0, nil
 	}
 
-	l.mu.RLock()
-	defer l.mu.RUnlock()
-
-	// Open log file
-	file, err := os.Open(l.config.File)
+	// Reading does not hold back the writes, a line being appended fails to
+	// parse and is skipped
+	logs, total, err := queryHistoryFiles(l.config, q)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open log file: %w", err)
+		return nil, 0, fmt.Errorf("failed to read log file: %w", err)
 	}
-	defer file.Close()
-
-	// Read file line by line from the end
-	var logs []ExecutionLog
-	scanner := newReverseScanner(file)
-
-	count := 0
-	skipped := 0
-
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		// Skip empty lines
-		if line == "" {
-			continue
-		}
-
-		// Parse JSON log entry
-		var logEntry struct {
-			Data ExecutionLog `json:"data"`
-		}
-
-		if err := json.Unmarshal([]byte(line), &logEntry); err != nil {
-			continue // Skip invalid JSON
-		}
-
-		// Skip entries before offset
-		if skipped < offset {
-			skipped++
-			continue
-		}
-
-		logs = append(logs, logEntry.Data)
-		count++
+	return logs, total, nil
+}
 
-		if count >= limit {
-			break
-		}
+// ScanHistory calls fn for every entry of the command history matching q,
+// oldest first, ignoring q.Limit and q.Offset. It stops at the first error
+// fn returns.
+func (l *ExecutionLogger) ScanHistory(q *HistoryQuery, fn func(ExecutionLog) error) error {
+	if err := q.Compile(); err != nil {
+		return err
 	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("failed to read log file: %w", err)
+	if store := GetHistoryStore(); store != nil {
+		return store.Scan(q, fn)
 	}
-
-	return logs, nil
+	if !l.config.Enabled {
+		return nil
+	}
+	return scanHistoryFiles(l.config, q, fn)
 }
 
-// Close closes the logger
+// Close closes the logger, sending the entries queued for syslog first
 func (l *ExecutionLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.syslog != nil {
+		l.syslog.Close()
+		l.syslog = nil
+	}
 	if l.logger != nil {
 		return l.logger.Sync()
 	}
 	return nil
 }
-
-// reverseScanner reads a file line by line from the end
-type reverseScanner struct {
-	file   *os.File
-	pos    int64
-	buffer []byte
-	line   string
-	err    error
-}
-
-func newReverseScanner(file *os.File) *reverseScanner {
-	// Get file size
-	stat, _ := file.Stat()
-	size := stat.Size()
-
-	return &reverseScanner{
-		file:   file,
-		pos:    size,
-		buffer: make([]byte, 4096),
-	}
-}
-
-func (s *reverseScanner) Scan() bool {
-	if s.pos <= 0 {
-		return false
-	}
-
-	var lines []string
-	currentLine := ""
-
-	// Read file backwards in chunks
-	for s.pos > 0 {
-		// Determine chunk size
-		chunkSize := int64(len(s.buffer))
-		if s.pos < chunkSize {
-			chunkSize = s.pos
-		}
-
-		// Seek to chunk position
-		s.pos -= chunkSize
-		if _, err := s.file.Seek(s.pos, 0); err != nil {
-			s.err = err
-			return false
-		}
-
-		// Read chunk
-		n, err := s.file.Read(s.buffer[:chunkSize])
-		if err != nil {
-			s.err = err
-			return false
-		}
-
-		// Process chunk backwards
-		for i := n - 1; i >= 0; i-- {
-			if s.buffer[i] == '\n' {
-				lines = append(lines, currentLine)
-				currentLine = ""
-			} else {
-				currentLine = string(s.buffer[i]) + currentLine
-			}
-		}
-
-		// If we have lines, return the first one
-		if len(lines) > 0 {
-			s.line = lines[len(lines)-1]
-			return true
-		}
-	}
-
-	// Return the last line if exists
-	if currentLine != "" {
-		s.line = currentLine
-		return true
-	}
-
-	return false
-}
-
-func (s *reverseScanner) Text() string {
-	return s.line
-}
-
-func (s *reverseScanner) Err() error {
-	return s.err
-}
@@ -0,0 +1,208 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Values of the code label of device_commands_total besides the DeviceError
+// codes
+const (
+	metricCodeOK        = "0"         // the command succeeded
+	metricCodeCancelled = "cancelled" // the caller went away
+	metricCodeOther     = "other"     // an error without a device error code
+)
+
+// deviceMetrics holds the Prometheus metrics of the device layer
+type deviceMetrics struct {
+	commands    *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+	queueWait   *prometheus.HistogramVec
+	connections *prometheus.CounterVec
+}
+
+// metrics is nil until EnableMetrics, the hooks do nothing then
+var metrics atomic.Pointer[deviceMetrics]
+
+func newDeviceMetrics() *deviceMetrics {
+	return &deviceMetrics{
+		commands: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "device_commands_total",
+			Help: "Commands run on managed devices by result and error code.",
+		}, []string{"device", "protocol", "success", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "device_command_duration_seconds",
+			Help:    "Time a command took on the device, excluding the queue wait.",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"device", "protocol"}),
+		queueWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "device_queue_wait_seconds",
+			Help:    "Time a task waited in the command queue before a worker took it, by priority class.",
+			Buckets: []float64{0.001, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30},
+		}, []string{"device", "priority"}),
+		connections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "device_connections_total",
+			Help: "Connection attempts to managed devices, including reconnects.",
+		}, []string{"device", "protocol", "result"}),
+	}
+}
+
+// droppedEntries reports the execution log entries a sink dropped
+func droppedEntries(d *dropCounter) prometheus.Collector {
+	return prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name:        "device_log_entries_dropped_total",
+		Help:        "Command log entries dropped by the syslog forwarder or the history store.",
+		ConstLabels: prometheus.Labels{"sink": d.sink},
+	}, func() float64 { return float64(d.total.Load()) })
+}
+
+// EnableMetrics registers the metrics of the device layer with reg: command
+// counts and latency, queue wait, connection attempts, dropped log entries,
+// and the utilisation and queue depth of every registered pool read at
+// scrape time.
+func EnableMetrics(reg prometheus.Registerer) error {
+	m := newDeviceMetrics()
+	for _, c := range []prometheus.Collector{
+		m.commands, m.duration, m.queueWait, m.connections,
+		droppedEntries(syslogDrops), droppedEntries(historyDrops),
+		&poolCollector{registry: GetRegistry},
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	metrics.Store(m)
+	return nil
+}
+
+// metricLabels returns the device and protocol labels of the pool
+func (p *ConnectionPool) metricLabels() (string, string) {
+	return strconv.Itoa(p.id), p.config.Connection.Protocol
+}
+
+// observeCommand records a command that ran for d. err is the error of the
+// adapter, nil when it returned a result.
+func (p *ConnectionPool) observeCommand(result *CommandResult, err error, d time.Duration) {
+	m := metrics.Load()
+	if m == nil {
+		return
+	}
+	device, protocol := p.metricLabels()
+	success := err == nil && result != nil && result.Success
+	m.commands.WithLabelValues(device, protocol, strconv.FormatBool(success), metricCode(result, err)).Inc()
+	m.duration.WithLabelValues(device, protocol).Observe(d.Seconds())
+}
+
+// observeFailedTask records the commands of a task that found no connection
+func (p *ConnectionPool) observeFailedTask(task *CommandTask, err error) {
+	m := metrics.Load()
+	if m == nil {
+		return
+	}
+	device, protocol := p.metricLabels()
+	m.commands.WithLabelValues(device, protocol, "false", metricCode(nil, err)).Add(float64(len(task.Commands)))
+}
+
+// observeQueueWait records the queue wait of a task taken by a worker
+func (p *ConnectionPool) observeQueueWait(task *CommandTask) {
+	if m := metrics.Load(); m != nil {
+		m.queueWait.WithLabelValues(strconv.Itoa(p.id), task.Priority.String()).Observe(task.waited.Seconds())
+	}
+}
+
+// observeConnect records a connection attempt
+func (p *ConnectionPool) observeConnect(err error) {
+	m := metrics.Load()
+	if m == nil {
+		return
+	}
+	device, protocol := p.metricLabels()
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.connections.WithLabelValues(device, protocol, result).Inc()
+}
+
+// metricCode returns the code label of a command outcome
+func metricCode(result *CommandResult, err error) string {
+	if err == nil {
+		if result != nil && result.Success {
+			return metricCodeOK
+		}
+		return strconv.Itoa(int(ErrCommandFailed))
+	}
+	var deviceErr *DeviceError
+	switch {
+	case errors.As(err, &deviceErr):
+		return strconv.Itoa(int(deviceErr.Code))
+	case errors.Is(err, context.Canceled):
+		return metricCodeCancelled
+	case errors.Is(err, context.DeadlineExceeded):
+		return strconv.Itoa(int(ErrCommandTimeout))
+	}
+	return metricCodeOther
+}
+
+// poolCollector reports the state of the registered pools when scraped
+type poolCollector struct {
+	registry func() *Registry
+}
+
+var (
+	poolInUseDesc = prometheus.NewDesc("device_pool_connections_in_use",
+		"Pooled connections checked out for a command or session.", []string{"device", "protocol"}, nil)
+	poolOpenDesc = prometheus.NewDesc("device_pool_connections_open",
+		"Connections held by the pool.", []string{"device", "protocol"}, nil)
+	poolMaxDesc = prometheus.NewDesc("device_pool_connections_max",
+		"Configured maximum connections of the pool.", []string{"device", "protocol"}, nil)
+	queueDepthDesc = prometheus.NewDesc("device_queue_depth",
+		"Tasks waiting in the command queue.", []string{"device"}, nil)
+	queueCapacityDesc = prometheus.NewDesc("device_queue_capacity",
+		"Configured size of the command queue.", []string{"device"}, nil)
+)
+
+// Describe implements prometheus.Collector
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{poolInUseDesc, poolOpenDesc, poolMaxDesc, queueDepthDesc, queueCapacityDesc} {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	registry := c.registry()
+	if registry == nil {
+		return
+	}
+	for _, id := range registry.IDs() {
+		pool, err := registry.Get(id)
+		if err != nil {
+			continue // unregistered meanwhile
+		}
+		inUse, open := pool.connectionCounts()
+		device, protocol := pool.metricLabels()
+		ch <- prometheus.MustNewConstMetric(poolInUseDesc, prometheus.GaugeValue, float64(inUse), device, protocol)
+		ch <- prometheus.MustNewConstMetric(poolOpenDesc, prometheus.GaugeValue, float64(open), device, protocol)
+		ch <- prometheus.MustNewConstMetric(poolMaxDesc, prometheus.GaugeValue, float64(pool.config.Pool.MaxConnections), device, protocol)
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(pool.queue.len()), device)
+		ch <- prometheus.MustNewConstMetric(queueCapacityDesc, prometheus.GaugeValue, float64(pool.config.Pool.MaxQueueSize), device)
+	}
+}
+
+// connectionCounts returns the checked out and the open connections
+func (p *ConnectionPool) connectionCounts() (inUse, open int) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, conn := range p.connections {
+		if atomic.LoadInt32(&conn.InUse) == 1 {
+			inUse++
+		}
+	}
+	return inUse, len(p.connections)
+}
@@ -0,0 +1,86 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPoolMetrics(t *testing.T) {
+	if err := EnableMetrics(prometheus.NewRegistry()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { metrics.Store(nil) })
+	m := metrics.Load()
+
+	pool, _ := newFakePool(t, 2)
+	if _, err := pool.Execute(context.Background(), []string{"show a", "show b"}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := testutil.ToFloat64(m.commands.WithLabelValues("0", "fake", "true", "0")); got != 2 {
+		t.Errorf("successful commands = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.connections.WithLabelValues("0", "fake", "success")); got < 1 {
+		t.Errorf("connections = %v, want at least 1", got)
+	}
+	if n := testutil.CollectAndCount(m.queueWait, "device_queue_wait_seconds"); n != 1 {
+		t.Errorf("queue wait series = %d, want 1", n)
+	}
+	// polls are told apart from the commands of users
+	if _, err := pool.Execute(WithPriority(context.Background(), PriorityMonitoring), []string{"show c"}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(m.queueWait, "device_queue_wait_seconds"); n != 2 {
+		t.Errorf("queue wait series = %d, want 2", n)
+	}
+	for _, priority := range []string{"bulk", "monitoring"} {
+		if !m.queueWait.DeleteLabelValues("0", priority) {
+			t.Errorf("no queue wait series of the %s class", priority)
+		}
+	}
+
+	registry := &Registry{pools: map[int]*ConnectionPool{DefaultDeviceID: pool}}
+	collector := &poolCollector{registry: func() *Registry { return registry }}
+	want := `
+# HELP device_pool_connections_max Configured maximum connections of the pool.
+# TYPE device_pool_connections_max gauge
+device_pool_connections_max{device="0",protocol="fake"} 2
+# HELP device_queue_depth Tasks waiting in the command queue.
+# TYPE device_queue_depth gauge
+device_queue_depth{device="0"} 0
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want), "device_pool_connections_max", "device_queue_depth"); err != nil {
+		t.Error(err)
+	}
+	// no registry before the device layer is initialized
+	if n := testutil.CollectAndCount(&poolCollector{registry: func() *Registry { return nil }}); n != 0 {
+		t.Errorf("collected %d metrics without a registry", n)
+	}
+}
+
+func TestMetricCode(t *testing.T) {
+	tests := []struct {
+		result *CommandResult
+		err    error
+		want   string
+	}{
+		{&CommandResult{Success: true}, nil, "0"},
+		{&CommandResult{Success: false}, nil, "1201"},
+		{nil, NewCommandTimeoutError(), "1202"},
+		{nil, fmt.Errorf("checkout: %w", NewConnectionError(errors.New("refused"))), "1001"},
+		{nil, context.Canceled, "cancelled"},
+		{nil, errors.New("eof"), "other"},
+	}
+	for _, tt := range tests {
+		if got := metricCode(tt.result, tt.err); got != tt.want {
+			t.Errorf("metricCode(%+v, %v) = %q, want %q", tt.result, tt.err, got, tt.want)
+		}
+	}
+}
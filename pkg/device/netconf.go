@@ -0,0 +1,554 @@
+package device
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	netconfNamespace = "urn:ietf:params:xml:ns:netconf:base:1.0"
+	netconfBase10    = "urn:ietf:params:netconf:base:1.0"
+	netconfBase11    = "urn:ietf:params:netconf:base:1.1"
+	netconfEOM       = "]]>]]>"
+	netconfSubsystem = "netconf"
+
+	// netconfMaxChunkSize bounds a single 1.1 chunk (RFC 6242 allows up to 4294967295)
+	netconfMaxChunkSize = 16 * 1024 * 1024
+)
+
+// NETCONF datastores
+const (
+	DatastoreRunning   = "running"
+	DatastoreCandidate = "candidate"
+	DatastoreStartup   = "startup"
+)
+
+// RPCError represents a NETCONF <rpc-error> element
+type RPCError struct {
+	Type     string `xml:"error-type" json:"type"`
+	Tag      string `xml:"error-tag" json:"tag"`
+	Severity string `xml:"error-severity" json:"severity"`
+	Path     string `xml:"error-path" json:"path,omitempty"`
+	Message  string `xml:"error-message" json:"message,omitempty"`
+}
+
+// Error implements the error interface
+func (e RPCError) Error() string {
+	msg := strings.TrimSpace(e.Message)
+	if msg == "" {
+		msg = e.Tag
+	}
+	return fmt.Sprintf("netconf %s error: %s", e.Type, msg)
+}
+
+// RPCReply represents a NETCONF <rpc-reply>
+type RPCReply struct {
+	MessageID string     `json:"messageId"`
+	Ok        bool       `json:"ok"`
+	Data      string     `json:"data,omitempty"`
+	Errors    []RPCError `json:"errors,omitempty"`
+	Raw       string     `json:"-"`
+}
+
+// Err returns the first error-severity rpc-error, if any
+func (r *RPCReply) Err() error {
+	for _, e := range r.Errors {
+		if e.Severity != "warning" {
+			return e
+		}
+	}
+	return nil
+}
+
+// rpcReplyXML is the wire representation used to decode an rpc-reply
+type rpcReplyXML struct {
+	XMLName   xml.Name   `xml:"rpc-reply"`
+	MessageID string     `xml:"message-id,attr"`
+	Ok        *struct{}  `xml:"ok"`
+	Errors    []RPCError `xml:"rpc-error"`
+	Data      struct {
+		Inner string `xml:",innerxml"`
+	} `xml:"data"`
+}
+
+// helloXML is the wire representation of a <hello> message
+type helloXML struct {
+	XMLName      xml.Name `xml:"hello"`
+	Capabilities []string `xml:"capabilities>capability"`
+	SessionID    string   `xml:"session-id"`
+}
+
+// NETCONFAdapter implements ProtocolAdapter for NETCONF over SSH (RFC 6241/6242)
+type NETCONFAdapter struct {
+	client       *ssh.Client
+	session      *ssh.Session
+	stdin        io.WriteCloser
+	reader       *bufio.Reader
+	connected    bool
+	chunked      bool
+	sessionID    string
+	capabilities []string
+	messageID    uint64
+	mu           sync.Mutex
+}
+
+// NewNETCONFAdapter creates a new NETCONF adapter
+func NewNETCONFAdapter() *NETCONFAdapter {
+	return &NETCONFAdapter{}
+}
+
+// Connect establishes the SSH transport, starts the netconf subsystem and exchanges hellos
+func (a *NETCONFAdapter) Connect(ctx context.Context, config *ConnectionConfig) error {
+	creds, err := config.credentials()
+	if err != nil {
+		return err
+	}
+	client, err := dialSSH(config, creds)
+	if err != nil {
+		return err
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return NewConnectionError(err)
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		client.Close()
+		return NewConnectionError(err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		client.Close()
+		return NewConnectionError(err)
+	}
+
+	if err := session.RequestSubsystem(netconfSubsystem); err != nil {
+		session.Close()
+		client.Close()
+		return NewConnectionError(fmt.Errorf("netconf subsystem: %w", err))
+	}
+
+	a.client = client
+	a.session = session
+	a.stdin = stdin
+	a.reader = bufio.NewReader(stdout)
+	a.chunked = false
+
+	if err := a.exchangeHello(ctx); err != nil {
+		a.Disconnect(ctx)
+		return NewConnectionError(err)
+	}
+
+	a.connected = true
+	return nil
+}
+
+// exchangeHello sends our hello and parses the server's capabilities.
+// Hellos are always framed with the 1.0 end-of-message marker.
+func (a *NETCONFAdapter) exchangeHello(ctx context.Context) error {
+	hello := `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<hello xmlns="` + netconfNamespace + `"><capabilities>` +
+		`<capability>` + netconfBase10 + `</capability>` +
+		`<capability>` + netconfBase11 + `</capability>` +
+		`</capabilities></hello>`
+	if err := writeNetconfMessage(a.stdin, hello, false); err != nil {
+		return fmt.Errorf("send hello: %w", err)
+	}
+
+	msg, err := a.readWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("read hello: %w", err)
+	}
+
+	var serverHello helloXML
+	if err := xml.Unmarshal([]byte(msg), &serverHello); err != nil {
+		return fmt.Errorf("parse hello: %w", err)
+	}
+
+	a.capabilities = make([]string, 0, len(serverHello.Capabilities))
+	for _, c := range serverHello.Capabilities {
+		c = strings.TrimSpace(c)
+		a.capabilities = append(a.capabilities, c)
+		if c == netconfBase11 {
+			a.chunked = true
+		}
+	}
+	a.sessionID = strings.TrimSpace(serverHello.SessionID)
+	return nil
+}
+
+// Disconnect closes the NETCONF session and SSH transport
+func (a *NETCONFAdapter) Disconnect(ctx context.Context) error {
+	if a.stdin != nil && a.connected {
+		// Best effort, the server may already be gone
+		_ = writeNetconfMessage(a.stdin, a.wrapRPC(atomic.AddUint64(&a.messageID, 1), "<close-session/>"), a.chunked)
+	}
+	a.connected = false
+	if a.session != nil {
+		a.session.Close()
+		a.session = nil
+	}
+	a.stdin = nil
+	a.reader = nil
+	if a.client != nil {
+		err := a.client.Close()
+		a.client = nil
+		return err
+	}
+	return nil
+}
+
+// ExecuteCommand sends cmd as the body of an <rpc> and returns the raw reply.
+// An rpc-error in the reply yields Success=false with the reply kept as output.
+func (a *NETCONFAdapter) ExecuteCommand(ctx context.Context, cmd string) (*CommandResult, error) {
+	startTime := time.Now()
+	reply, err := a.RPC(ctx, cmd)
+	duration := time.Since(startTime)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CommandResult{
+		Command:   cmd,
+		Output:    reply.Raw,
+		Duration:  duration.Milliseconds(),
+		Success:   true,
+		Timestamp: time.Now().Unix(),
+	}
+	if rpcErr := reply.Err(); rpcErr != nil {
+		result.Success = false
+		result.Error = rpcErr.Error()
+	}
+	return result, nil
+}
+
+// RPC sends an operation (the inner XML of <rpc>) and waits for its reply
+func (a *NETCONFAdapter) RPC(ctx context.Context, operation string) (*RPCReply, error) {
+	if !a.IsConnected() {
+		return nil, NewConnectionError(fmt.Errorf("not connected"))
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	id := atomic.AddUint64(&a.messageID, 1)
+	if err := writeNetconfMessage(a.stdin, a.wrapRPC(id, operation), a.chunked); err != nil {
+		a.connected = false
+		return nil, NewCommandFailedError(err)
+	}
+
+	msg, err := a.readWithContext(ctx)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, NewCommandTimeoutError()
+		}
+		return nil, NewCommandFailedError(err)
+	}
+
+	reply, err := parseRPCReply(msg)
+	if err != nil {
+		return nil, NewCommandFailedError(err)
+	}
+	if reply.MessageID != "" && reply.MessageID != strconv.FormatUint(id, 10) {
+		return nil, NewCommandFailedError(fmt.Errorf("unexpected message-id %s, want %d", reply.MessageID, id))
+	}
+	return reply, nil
+}
+
+// Get retrieves running configuration and state data
+func (a *NETCONFAdapter) Get(ctx context.Context, filter string) (*RPCReply, error) {
+	return a.RPC(ctx, NetconfGet(filter))
+}
+
+// GetConfig retrieves all or part of a configuration datastore
+func (a *NETCONFAdapter) GetConfig(ctx context.Context, source, filter string) (*RPCReply, error) {
+	return a.RPC(ctx, NetconfGetConfig(source, filter))
+}
+
+// EditConfig loads configuration into the target datastore
+func (a *NETCONFAdapter) EditConfig(ctx context.Context, target, config, defaultOperation string) (*RPCReply, error) {
+	return a.RPC(ctx, NetconfEditConfig(target, config, defaultOperation))
+}
+
+// Commit commits the candidate datastore to running
+func (a *NETCONFAdapter) Commit(ctx context.Context) (*RPCReply, error) {
+	return a.RPC(ctx, "<commit/>")
+}
+
+// DiscardChanges reverts the candidate datastore to the running configuration
+func (a *NETCONFAdapter) DiscardChanges(ctx context.Context) (*RPCReply, error) {
+	return a.RPC(ctx, "<discard-changes/>")
+}
+
+// Lock locks a datastore for this session
+func (a *NETCONFAdapter) Lock(ctx context.Context, target string) (*RPCReply, error) {
+	return a.RPC(ctx, NetconfLock(target))
+}
+
+// Unlock releases a datastore lock held by this session
+func (a *NETCONFAdapter) Unlock(ctx context.Context, target string) (*RPCReply, error) {
+	return a.RPC(ctx, NetconfUnlock(target))
+}
+
+// Capabilities returns the capabilities advertised by the server
+func (a *NETCONFAdapter) Capabilities() []string {
+	return a.capabilities
+}
+
+// HasCapability reports whether the server advertised a capability. Matching is
+// by substring so both ":candidate" and full capability URNs can be used.
+func (a *NETCONFAdapter) HasCapability(capability string) bool {
+	for _, c := range a.capabilities {
+		if strings.Contains(c, capability) {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionID returns the session-id assigned by the server
+func (a *NETCONFAdapter) SessionID() string {
+	return a.sessionID
+}
+
+// Keepalive sends an SSH keepalive request on the transport of the session
+func (a *NETCONFAdapter) Keepalive(ctx context.Context) error {
+	if !a.IsConnected() {
+		return NewConnectionError(fmt.Errorf("not connected"))
+	}
+	return sshKeepalive(ctx, a.client)
+}
+
+// IsConnected returns whether the NETCONF session is active
+func (a *NETCONFAdapter) IsConnected() bool {
+	return a.connected && a.session != nil
+}
+
+// AdapterCapabilities reports the NETCONF capabilities. Locks and candidate
+// changes last for the session, replies are XML.
+func (a *NETCONFAdapter) AdapterCapabilities() AdapterCapabilities {
+	return AdapterCapabilities{ConfigSession: true, StructuredData: true}
+}
+
+// ProtocolType returns the protocol type
+func (a *NETCONFAdapter) ProtocolType() ProtocolType {
+	return ProtocolNETCONF
+}
+
+// wrapRPC wraps an operation into an <rpc> envelope
+func (a *NETCONFAdapter) wrapRPC(id uint64, operation string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?><rpc message-id="%d" xmlns="%s">%s</rpc>`,
+		id, netconfNamespace, operation)
+}
+
+// readWithContext reads one message, abandoning the session if ctx ends first
+func (a *NETCONFAdapter) readWithContext(ctx context.Context) (string, error) {
+	type readResult struct {
+		msg string
+		err error
+	}
+
+	reader, chunked := a.reader, a.chunked
+	ch := make(chan readResult, 1)
+	go func() {
+		msg, err := readNetconfMessage(reader, chunked)
+		ch <- readResult{msg: msg, err: err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.msg, r.err
+	case <-ctx.Done():
+		// The reply may still arrive later and would desynchronise the
+		// session, so the only safe option is to drop it.
+		a.connected = false
+		if a.session != nil {
+			a.session.Close()
+		}
+		return "", ctx.Err()
+	}
+}
+
+// NewNETCONFAdapterFunc creates a new NETCONF adapter (factory function)
+func NewNETCONFAdapterFunc() ProtocolAdapter {
+	return NewNETCONFAdapter()
+}
+
+// NetconfGet builds a <get> operation with an optional subtree filter
+func NetconfGet(filter string) string {
+	return "<get>" + netconfFilter(filter) + "</get>"
+}
+
+// NetconfGetConfig builds a <get-config> operation
+func NetconfGetConfig(source, filter string) string {
+	if source == "" {
+		source = DatastoreRunning
+	}
+	return "<get-config><source><" + source + "/></source>" + netconfFilter(filter) + "</get-config>"
+}
+
+// NetconfEditConfig builds an <edit-config> operation. config may be given with
+// or without its enclosing <config> element.
+func NetconfEditConfig(target, config, defaultOperation string) string {
+	if target == "" {
+		target = DatastoreRunning
+	}
+	var b strings.Builder
+	b.WriteString("<edit-config><target><" + target + "/></target>")
+	if defaultOperation != "" {
+		b.WriteString("<default-operation>" + defaultOperation + "</default-operation>")
+	}
+	config = strings.TrimSpace(config)
+	if strings.HasPrefix(config, "<config") {
+		b.WriteString(config)
+	} else {
+		b.WriteString("<config>" + config + "</config>")
+	}
+	b.WriteString("</edit-config>")
+	return b.String()
+}
+
+// NetconfLock builds a <lock> operation
+func NetconfLock(target string) string {
+	if target == "" {
+		target = DatastoreRunning
+	}
+	return "<lock><target><" + target + "/></target></lock>"
+}
+
+// NetconfUnlock builds an <unlock> operation
+func NetconfUnlock(target string) string {
+	if target == "" {
+		target = DatastoreRunning
+	}
+	return "<unlock><target><" + target + "/></target></unlock>"
+}
+
+// netconfFilter wraps a subtree filter unless the caller already supplied a <filter> element
+func netconfFilter(filter string) string {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return ""
+	}
+	if strings.HasPrefix(filter, "<filter") {
+		return filter
+	}
+	return `<filter type="subtree">` + filter + `</filter>`
+}
+
+// parseRPCReply decodes an rpc-reply message
+func parseRPCReply(msg string) (*RPCReply, error) {
+	var r rpcReplyXML
+	if err := xml.Unmarshal([]byte(msg), &r); err != nil {
+		return nil, fmt.Errorf("parse rpc-reply: %w", err)
+	}
+	return &RPCReply{
+		MessageID: r.MessageID,
+		Ok:        r.Ok != nil,
+		Data:      strings.TrimSpace(r.Data.Inner),
+		Errors:    r.Errors,
+		Raw:       msg,
+	}, nil
+}
+
+// writeNetconfMessage frames and writes a message, using chunked framing
+// (RFC 6242 section 4.2) for base:1.1 and the end-of-message marker for 1.0
+func writeNetconfMessage(w io.Writer, msg string, chunked bool) error {
+	var err error
+	if chunked {
+		_, err = fmt.Fprintf(w, "\n#%d\n%s\n##\n", len(msg), msg)
+	} else {
+		_, err = io.WriteString(w, msg+netconfEOM)
+	}
+	return err
+}
+
+// readNetconfMessage reads one framed message
+func readNetconfMessage(r *bufio.Reader, chunked bool) (string, error) {
+	if chunked {
+		return readChunkedMessage(r)
+	}
+	return readEOMMessage(r)
+}
+
+// readEOMMessage reads until the ]]>]]> end-of-message marker
+func readEOMMessage(r *bufio.Reader) (string, error) {
+	var msg strings.Builder
+	for {
+		part, err := r.ReadString('>')
+		msg.WriteString(part)
+		if strings.HasSuffix(msg.String(), netconfEOM) {
+			out := msg.String()
+			return strings.TrimSpace(out[:len(out)-len(netconfEOM)]), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// readChunkedMessage reads chunks until the end-of-chunks marker
+func readChunkedMessage(r *bufio.Reader) (string, error) {
+	var msg strings.Builder
+	for {
+		// Each chunk header is LF HASH size LF; the terminator is LF HASH HASH LF
+		if err := expectByte(r, '\n'); err != nil {
+			return "", err
+		}
+		if err := expectByte(r, '#'); err != nil {
+			return "", err
+		}
+
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "#" {
+			return msg.String(), nil
+		}
+
+		size, err := strconv.Atoi(line)
+		if err != nil || size <= 0 || size > netconfMaxChunkSize {
+			return "", fmt.Errorf("invalid chunk size %q", line)
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return "", err
+		}
+		msg.Write(chunk)
+	}
+}
+
+// expectByte reads one byte and fails if it is not want. Leading whitespace
+// before the first chunk is tolerated since some servers emit a newline after hello.
+func expectByte(r *bufio.Reader, want byte) error {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == want {
+			return nil
+		}
+		if want == '\n' && (b == ' ' || b == '\r' || b == '\t') {
+			continue
+		}
+		return fmt.Errorf("invalid chunk framing: got %q, want %q", b, want)
+	}
+}
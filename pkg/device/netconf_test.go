@@ -0,0 +1,325 @@
+package device
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// netconfHandler produces the body of an rpc-reply for the inner XML of an rpc
+type netconfHandler func(operation string) string
+
+// startNetconfServer starts an in-process NETCONF over SSH server stub and
+// returns a ConnectionConfig pointing at it
+func startNetconfServer(t *testing.T, base11 bool, handle netconfHandler) *ConnectionConfig {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "admin" && string(pass) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	}
+	serverConfig.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveNetconfConn(conn, serverConfig, base11, handle)
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return &ConnectionConfig{
+		Protocol: string(ProtocolNETCONF),
+		Host:     "127.0.0.1",
+		Port:     addr.Port,
+		Username: "admin",
+		Password: "secret",
+		Timeout:  5,
+
+		KnownHostsFile: filepath.Join(t.TempDir(), "known_hosts"),
+	}
+}
+
+func serveNetconfConn(conn net.Conn, config *ssh.ServerConfig, base11 bool, handle netconfHandler) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newCh := range chans {
+		if newCh.ChannelType() != "session" {
+			newCh.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		ch, chReqs, err := newCh.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range chReqs {
+				var payload struct{ Name string }
+				ok := req.Type == "subsystem" && ssh.Unmarshal(req.Payload, &payload) == nil && payload.Name == netconfSubsystem
+				req.Reply(ok, nil)
+				if ok {
+					go serveNetconfSession(ch, base11, handle)
+				}
+			}
+		}()
+	}
+}
+
+func serveNetconfSession(ch ssh.Channel, base11 bool, handle netconfHandler) {
+	defer ch.Close()
+
+	caps := "<capability>" + netconfBase10 + "</capability>" +
+		"<capability>urn:ietf:params:netconf:capability:candidate:1.0</capability>"
+	if base11 {
+		caps += "<capability>" + netconfBase11 + "</capability>"
+	}
+	hello := `<hello xmlns="` + netconfNamespace + `"><capabilities>` + caps + `</capabilities><session-id>42</session-id></hello>`
+	if err := writeNetconfMessage(ch, hello, false); err != nil {
+		return
+	}
+
+	r := bufio.NewReader(ch)
+	if _, err := readNetconfMessage(r, false); err != nil {
+		return
+	}
+
+	for {
+		msg, err := readNetconfMessage(r, base11)
+		if err != nil {
+			return
+		}
+		var rpc struct {
+			MessageID string `xml:"message-id,attr"`
+			Inner     string `xml:",innerxml"`
+		}
+		if err := xml.Unmarshal([]byte(msg), &rpc); err != nil {
+			return
+		}
+
+		body := "<ok/>"
+		closing := strings.HasPrefix(rpc.Inner, "<close-session")
+		if !closing {
+			body = handle(rpc.Inner)
+		}
+		reply := fmt.Sprintf(`<rpc-reply message-id="%s" xmlns="%s">%s</rpc-reply>`, rpc.MessageID, netconfNamespace, body)
+		if err := writeNetconfMessage(ch, reply, base11); err != nil || closing {
+			return
+		}
+	}
+}
+
+// switchHandler emulates a small device: get-config returns a hostname, an
+// edit-config containing "invalid" is rejected and everything else is ok
+func switchHandler(operation string) string {
+	switch {
+	case strings.HasPrefix(operation, "<get-config>"), strings.HasPrefix(operation, "<get>"):
+		return `<data><system xmlns="urn:example:system"><hostname>sw1</hostname></system></data>`
+	case strings.HasPrefix(operation, "<edit-config>") && strings.Contains(operation, "invalid"):
+		return `<rpc-error><error-type>application</error-type><error-tag>invalid-value</error-tag>` +
+			`<error-severity>error</error-severity><error-message>bad hostname</error-message></rpc-error>`
+	case strings.HasPrefix(operation, "<sleep"):
+		time.Sleep(2 * time.Second)
+		return "<ok/>"
+	default:
+		return "<ok/>"
+	}
+}
+
+func TestNETCONFAdapter(t *testing.T) {
+	for _, base11 := range []bool{false, true} {
+		t.Run(fmt.Sprintf("base11=%v", base11), func(t *testing.T) {
+			config := startNetconfServer(t, base11, switchHandler)
+			ctx := context.Background()
+
+			a := NewNETCONFAdapter()
+			if err := a.Connect(ctx, config); err != nil {
+				t.Fatalf("Connect: %v", err)
+			}
+			defer a.Disconnect(ctx)
+
+			if a.chunked != base11 {
+				t.Errorf("chunked framing = %v, want %v", a.chunked, base11)
+			}
+			if a.SessionID() != "42" {
+				t.Errorf("SessionID = %q, want 42", a.SessionID())
+			}
+			if !a.HasCapability(":candidate") {
+				t.Errorf("candidate capability not reported: %v", a.Capabilities())
+			}
+
+			reply, err := a.GetConfig(ctx, DatastoreRunning, `<system xmlns="urn:example:system"/>`)
+			if err != nil {
+				t.Fatalf("GetConfig: %v", err)
+			}
+			if !strings.Contains(reply.Data, "<hostname>sw1</hostname>") {
+				t.Errorf("GetConfig data = %q", reply.Data)
+			}
+
+			for _, op := range []func() (*RPCReply, error){
+				func() (*RPCReply, error) { return a.Lock(ctx, DatastoreCandidate) },
+				func() (*RPCReply, error) {
+					return a.EditConfig(ctx, DatastoreCandidate, "<system><hostname>sw2</hostname></system>", "merge")
+				},
+				func() (*RPCReply, error) { return a.Commit(ctx) },
+				func() (*RPCReply, error) { return a.Unlock(ctx, DatastoreCandidate) },
+			} {
+				reply, err := op()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reply.Ok || reply.Err() != nil {
+					t.Errorf("expected <ok/>, got %q", reply.Raw)
+				}
+			}
+
+			reply, err = a.EditConfig(ctx, DatastoreRunning, "<system><hostname>invalid</hostname></system>", "")
+			if err != nil {
+				t.Fatalf("EditConfig: %v", err)
+			}
+			if reply.Err() == nil || reply.Errors[0].Tag != "invalid-value" {
+				t.Errorf("expected invalid-value rpc-error, got %q", reply.Raw)
+			}
+
+			result, err := a.ExecuteCommand(ctx, NetconfEditConfig(DatastoreRunning, "<x>invalid</x>", ""))
+			if err != nil {
+				t.Fatalf("ExecuteCommand: %v", err)
+			}
+			if result.Success || !strings.Contains(result.Error, "bad hostname") {
+				t.Errorf("ExecuteCommand result = %+v", result)
+			}
+		})
+	}
+}
+
+func TestNETCONFAdapterAuthFailure(t *testing.T) {
+	config := startNetconfServer(t, true, switchHandler)
+	config.Password = "wrong"
+
+	a := NewNETCONFAdapter()
+	err := a.Connect(context.Background(), config)
+	var deviceErr *DeviceError
+	if !errors.As(err, &deviceErr) || deviceErr.Code != ErrAuthFailed {
+		t.Fatalf("Connect error = %v, want authentication failure", err)
+	}
+	if a.IsConnected() {
+		t.Error("adapter reports connected after failed login")
+	}
+}
+
+func TestNETCONFAdapterTimeout(t *testing.T) {
+	config := startNetconfServer(t, true, switchHandler)
+
+	a := NewNETCONFAdapter()
+	if err := a.Connect(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Disconnect(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := a.RPC(ctx, "<sleep/>")
+	var deviceErr *DeviceError
+	if !errors.As(err, &deviceErr) || deviceErr.Code != ErrCommandTimeout {
+		t.Fatalf("RPC error = %v, want command timeout", err)
+	}
+	if a.IsConnected() {
+		t.Error("session must be dropped after an abandoned reply")
+	}
+}
+
+func TestNetconfFraming(t *testing.T) {
+	tests := []struct {
+		name    string
+		wire    string
+		chunked bool
+		want    string
+		wantErr bool
+	}{
+		{name: "eom", wire: "<rpc-reply/>]]>]]>", want: "<rpc-reply/>"},
+		{name: "eom with markup", wire: "<a>]]></a>\n]]>]]>", want: "<a>]]></a>"},
+		{name: "single chunk", wire: "\n#5\n<ok/>\n##\n", chunked: true, want: "<ok/>"},
+		{name: "multiple chunks", wire: "\n#3\n<ok\n#2\n/>\n##\n", chunked: true, want: "<ok/>"},
+		{name: "bad chunk size", wire: "\n#x\n<ok/>\n##\n", chunked: true, wantErr: true},
+		{name: "missing header", wire: "<ok/>\n##\n", chunked: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readNetconfMessage(bufio.NewReader(strings.NewReader(tt.wire)), tt.chunked)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	for _, chunked := range []bool{false, true} {
+		var b strings.Builder
+		if err := writeNetconfMessage(&b, "<hello/>", chunked); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readNetconfMessage(bufio.NewReader(strings.NewReader(b.String())), chunked)
+		if err != nil || got != "<hello/>" {
+			t.Errorf("round trip chunked=%v: got %q, %v", chunked, got, err)
+		}
+	}
+}
+
+func TestNetconfOperations(t *testing.T) {
+	if got := NetconfGetConfig("", ""); got != "<get-config><source><running/></source></get-config>" {
+		t.Errorf("NetconfGetConfig = %q", got)
+	}
+	if got := NetconfEditConfig("candidate", "<config><a/></config>", "replace"); got !=
+		"<edit-config><target><candidate/></target><default-operation>replace</default-operation><config><a/></config></edit-config>" {
+		t.Errorf("NetconfEditConfig = %q", got)
+	}
+	if got := NetconfGet(`<filter type="xpath" select="/a"/>`); got != `<get><filter type="xpath" select="/a"/></get>` {
+		t.Errorf("NetconfGet = %q", got)
+	}
+}
@@ -0,0 +1,99 @@
+package device
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ParserFunc turns the raw output of a command into a JSON serializable value
+type ParserFunc func(output string) (interface{}, error)
+
+// parserEntry is a parser registered for the commands matching pattern on
+// devices of vendor, every vendor when vendor is empty
+type parserEntry struct {
+	vendor  string
+	pattern *regexp.Regexp
+	parse   ParserFunc
+}
+
+// parsers holds the registered output parsers, see RegisterParser
+var parsers = struct {
+	sync.RWMutex
+	entries []parserEntry
+}{}
+
+// RegisterParser registers fn for the commands matching pattern. Commands are
+// lower-cased and their whitespace collapsed before matching, so patterns are
+// written against e.g. "show interfaces gi1/0/1"; they are anchored at both
+// ends. An empty vendor registers a generic parser. Vendor specific parsers
+// are preferred over generic ones and later registrations over earlier ones,
+// which lets deployments replace the built-in parsers.
+func RegisterParser(vendor, pattern string, fn ParserFunc) error {
+	re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+	if err != nil {
+		return NewInvalidConfigError(fmt.Sprintf("parser pattern %q: %v", pattern, err))
+	}
+	if fn == nil {
+		return NewInvalidConfigError(fmt.Sprintf("parser %q: nil parser func", pattern))
+	}
+
+	parsers.Lock()
+	defer parsers.Unlock()
+	parsers.entries = append(parsers.entries, parserEntry{
+		vendor:  strings.ToLower(vendor),
+		pattern: re,
+		parse:   fn,
+	})
+	return nil
+}
+
+// mustRegisterParser registers the built-in parsers
+func mustRegisterParser(vendor, pattern string, fn ParserFunc) {
+	if err := RegisterParser(vendor, pattern, fn); err != nil {
+		panic(err)
+	}
+}
+
+// LookupParser returns the parser for a command on devices of vendor
+func LookupParser(vendor, command string) (ParserFunc, bool) {
+	vendor = strings.ToLower(vendor)
+	command = strings.ToLower(strings.Join(strings.Fields(command), " "))
+
+	parsers.RLock()
+	defer parsers.RUnlock()
+
+	var generic ParserFunc
+	for i := len(parsers.entries) - 1; i >= 0; i-- {
+		e := &parsers.entries[i]
+		if !e.pattern.MatchString(command) {
+			continue
+		}
+		if e.vendor == vendor && vendor != "" {
+			return e.parse, true
+		}
+		if e.vendor == "" && generic == nil {
+			generic = e.parse
+		}
+	}
+	return generic, generic != nil
+}
+
+// ParseOutput parses the output of a command run on a device of vendor. It
+// returns ErrNotSupported when no parser is registered for the command and
+// ErrParseFailed when the output is not in the expected format.
+func ParseOutput(vendor, command, output string) (interface{}, error) {
+	parse, ok := LookupParser(vendor, command)
+	if !ok {
+		return nil, NewNotSupportedError(fmt.Sprintf("no output parser for %q", command))
+	}
+	if err := LookupProfile(vendor).CheckOutput(output); err != nil {
+		return nil, NewParseFailedError(command, err)
+	}
+	v, err := parse(output)
+	if err != nil {
+		return nil, NewParseFailedError(command, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,193 @@
+package device
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The health parsers read the CPU, memory and environment commands of the
+// Cisco IOS style CLIs and of Huawei VRP, whose output they mostly share.
+// They feed the telemetry collector but are available to ParseOutput too.
+func init() {
+	show := abbrev("show", 2)
+	display := abbrev("display", 3)
+	mustRegisterParser("", show+` `+abbrev("processes", 4)+` cpu( (sorted|history))?|`+display+` cpu(-usage)?`, parseCPU)
+	mustRegisterParser("", show+` `+abbrev("processes", 4)+` `+abbrev("memory", 3)+`( sorted)?|`+show+` `+abbrev("memory", 3)+` `+abbrev("statistics", 4)+`|`+display+` memory(-usage)?`, parseMemory)
+	mustRegisterParser("", show+` `+abbrev("environment", 3)+`( all)?`, parseEnvironment)
+}
+
+// CPUInfo is the parsed CPU utilisation in percent
+type CPUInfo struct {
+	FiveSeconds float64 `json:"fiveSeconds"`
+	OneMinute   float64 `json:"oneMinute"`
+	FiveMinutes float64 `json:"fiveMinutes"`
+}
+
+var (
+	cpuWindowsRe = regexp.MustCompile(`(?i)five seconds\s*:\s*(\d+(?:\.\d+)?)%.*?one minute\s*:\s*(\d+(?:\.\d+)?)%.*?five minutes\s*:\s*(\d+(?:\.\d+)?)%`)
+	cpuUsageRe   = regexp.MustCompile(`(?i)^\s*CPU (?:Usage|utilization)\s*:\s*(\d+(?:\.\d+)?)%`)
+)
+
+func parseCPU(output string) (interface{}, error) {
+	if m := cpuWindowsRe.FindStringSubmatch(output); m != nil {
+		info := &CPUInfo{}
+		info.FiveSeconds, _ = strconv.ParseFloat(m[1], 64)
+		info.OneMinute, _ = strconv.ParseFloat(m[2], 64)
+		info.FiveMinutes, _ = strconv.ParseFloat(m[3], 64)
+		return info, nil
+	}
+	// a single reading, e.g. the CPU Usage line of display cpu-usage
+	for _, line := range strings.Split(output, "\n") {
+		if m := cpuUsageRe.FindStringSubmatch(line); m != nil {
+			usage, _ := strconv.ParseFloat(m[1], 64)
+			return &CPUInfo{FiveSeconds: usage, OneMinute: usage, FiveMinutes: usage}, nil
+		}
+	}
+	return nil, fmt.Errorf("no CPU utilization found")
+}
+
+// MemoryInfo is the parsed memory usage of the main processor
+type MemoryInfo struct {
+	Total        int64   `json:"totalBytes"`
+	Used         int64   `json:"usedBytes"`
+	Free         int64   `json:"freeBytes"`
+	UsagePercent float64 `json:"usagePercent"`
+}
+
+var (
+	// Processor Pool Total:  838807352 Used:  283207220 Free:  555600132
+	memPoolRe = regexp.MustCompile(`(?i)^\s*Processor(?: Pool)?\s+Total:\s*(\d+)\s+Used:\s*(\d+)\s+Free:\s*(\d+)`)
+	// Processor   7F1B5A3010   838807352   283207220   555600132 ... (show memory statistics)
+	memStatsRe = regexp.MustCompile(`(?i)^\s*Processor\s+[0-9a-f]+\s+(\d+)\s+(\d+)\s+(\d+)`)
+	// System memory  : 16287996K total, 7123456K used, 9164540K free
+	memSystemRe = regexp.MustCompile(`(?i)^\s*System memory\s*:\s*(\d+)K total,\s*(\d+)K used,\s*(\d+)K free`)
+	// System Total Memory Is: 536870912 bytes / Total Memory Used Is: 200000000 bytes
+	memHuaweiTotalRe   = regexp.MustCompile(`(?i)^\s*System Total Memory Is:\s*(\d+) bytes`)
+	memHuaweiUsedRe    = regexp.MustCompile(`(?i)^\s*Total Memory Used Is:\s*(\d+) bytes`)
+	memHuaweiPercentRe = regexp.MustCompile(`(?i)^\s*Memory Using Percentage Is:\s*(\d+(?:\.\d+)?)%`)
+)
+
+func parseMemory(output string) (interface{}, error) {
+	info := &MemoryInfo{}
+	found := false
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() && !found {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		switch {
+		case memPoolRe.MatchString(line):
+			m := memPoolRe.FindStringSubmatch(line)
+			info.Total, info.Used, info.Free = atoi64(m[1]), atoi64(m[2]), atoi64(m[3])
+			found = true
+		case memStatsRe.MatchString(line):
+			m := memStatsRe.FindStringSubmatch(line)
+			info.Total, info.Used, info.Free = atoi64(m[1]), atoi64(m[2]), atoi64(m[3])
+			found = true
+		case memSystemRe.MatchString(line):
+			m := memSystemRe.FindStringSubmatch(line)
+			info.Total, info.Used, info.Free = atoi64(m[1])*1024, atoi64(m[2])*1024, atoi64(m[3])*1024
+			found = true
+		case memHuaweiTotalRe.MatchString(line):
+			info.Total = atoi64(memHuaweiTotalRe.FindStringSubmatch(line)[1])
+		case memHuaweiUsedRe.MatchString(line):
+			info.Used = atoi64(memHuaweiUsedRe.FindStringSubmatch(line)[1])
+		case memHuaweiPercentRe.MatchString(line):
+			info.UsagePercent, _ = strconv.ParseFloat(memHuaweiPercentRe.FindStringSubmatch(line)[1], 64)
+		}
+	}
+	if info.Total == 0 {
+		return nil, fmt.Errorf("no memory usage found")
+	}
+	if info.Free == 0 && info.Used <= info.Total {
+		info.Free = info.Total - info.Used
+	}
+	if info.UsagePercent == 0 {
+		info.UsagePercent = float64(info.Used) * 100 / float64(info.Total)
+	}
+	return info, nil
+}
+
+// EnvironmentInfo is the parsed output of show environment
+type EnvironmentInfo struct {
+	Temperatures  []TemperatureReading `json:"temperatures"`
+	PowerSupplies []ComponentStatus    `json:"powerSupplies"`
+	Fans          []ComponentStatus    `json:"fans"`
+}
+
+// TemperatureReading is the reading of a temperature sensor
+type TemperatureReading struct {
+	Sensor  string  `json:"sensor"`
+	Celsius float64 `json:"celsius"`
+}
+
+// ComponentStatus is the state of a fan or power supply
+type ComponentStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	OK     bool   `json:"ok"`
+}
+
+var (
+	// FAN is OK, Switch 1 FAN 1 is OK, FAN PS-1 is OK, POWER is OK, RPS is NOT PRESENT
+	envStatusRe = regexp.MustCompile(`(?i)^\s*(.*?\b(?:fan|power|ps|psu|rps|power supply)\b.*?) is ([a-z][a-z ]*?)\s*$`)
+	// Temperature Value: 35 Degree Celsius, Temp: Coretemp 1 GOOD 45 Celsius, Inlet Temperature 28 C
+	envTempRe  = regexp.MustCompile(`(?i)^\s*(.*?\btemp\w*\b.*?)[\s:=]+(-?\d+(?:\.\d+)?)\s*(?:°|degrees?)?\s*(?:c|celsius)\b`)
+	envStateRe = regexp.MustCompile(`(?i)\s+(ok|good|normal|green|yellow|red|warning|critical|\d+)$`)
+)
+
+// componentOK reports whether a status means the component works
+func componentOK(status string) bool {
+	switch strings.ToLower(status) {
+	case "ok", "good", "normal", "green", "on", "present":
+		return true
+	}
+	return false
+}
+
+func parseEnvironment(output string) (interface{}, error) {
+	env := &EnvironmentInfo{
+		Temperatures:  make([]TemperatureReading, 0),
+		PowerSupplies: make([]ComponentStatus, 0),
+		Fans:          make([]ComponentStatus, 0),
+	}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		if m := envTempRe.FindStringSubmatch(line); m != nil {
+			celsius, _ := strconv.ParseFloat(m[2], 64)
+			env.Temperatures = append(env.Temperatures, TemperatureReading{Sensor: sensorName(m[1]), Celsius: celsius})
+			continue
+		}
+		m := envStatusRe.FindStringSubmatch(line)
+		if m == nil || strings.EqualFold(m[2], "not present") {
+			continue
+		}
+		c := ComponentStatus{Name: strings.Join(strings.Fields(m[1]), " "), Status: m[2], OK: componentOK(m[2])}
+		if strings.Contains(strings.ToLower(c.Name), "fan") {
+			env.Fans = append(env.Fans, c)
+		} else {
+			env.PowerSupplies = append(env.PowerSupplies, c)
+		}
+	}
+	if len(env.Temperatures)+len(env.PowerSupplies)+len(env.Fans) == 0 && strings.TrimSpace(output) != "" {
+		return nil, fmt.Errorf("no environment readings found")
+	}
+	return env, nil
+}
+
+// sensorName cleans the text before a temperature reading: the colon, the
+// state and slot columns of tables and the word value are dropped
+func sensorName(s string) string {
+	s = strings.TrimRight(strings.TrimSpace(s), ":= ")
+	for {
+		trimmed := envStateRe.ReplaceAllString(s, "")
+		if trimmed == s {
+			break
+		}
+		s = trimmed
+	}
+	s = strings.TrimSuffix(strings.TrimSuffix(s, " Value"), " value")
+	return strings.Join(strings.Fields(strings.TrimRight(s, ":= ")), " ")
+}
@@ -0,0 +1,291 @@
+package device
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The built-in parsers are generic and read the Cisco IOS style output that
+// most switch CLIs imitate. Vendors that differ register their own parsers
+// with RegisterParser.
+func init() {
+	show := abbrev("show", 2)
+	mustRegisterParser("", show+` `+abbrev("version", 3), parseShowVersion)
+	mustRegisterParser("", show+` `+abbrev("interfaces", 3)+`( [a-z][a-z-]*\s?\d+(/\d+)*(\.\d+)?)?`, parseShowInterfaces)
+	mustRegisterParser("", show+` `+abbrev("vlan", 4)+`( `+abbrev("brief", 2)+`)?`, parseShowVLAN)
+	mustRegisterParser("", show+` mac[ -]address-table( (dynamic|static|vlan \d+|interface \S+|address \S+))*`, parseShowMACAddressTable)
+}
+
+// abbrev returns a pattern matching word abbreviated to at least min letters,
+// the way switch CLIs accept "sh int" for "show interfaces"
+func abbrev(word string, min int) string {
+	pattern := word[:min]
+	for _, r := range word[min:] {
+		pattern += "(?:" + string(r)
+	}
+	return pattern + strings.Repeat(")?", len(word)-min)
+}
+
+// VersionInfo is the parsed output of show version
+type VersionInfo struct {
+	Hostname      string `json:"hostname,omitempty"`
+	Software      string `json:"software,omitempty"`
+	Version       string `json:"version"`
+	Model         string `json:"model,omitempty"`
+	SerialNumber  string `json:"serialNumber,omitempty"`
+	Image         string `json:"image,omitempty"`
+	Uptime        string `json:"uptime,omitempty"`
+	UptimeSeconds int64  `json:"uptimeSeconds,omitempty"`
+}
+
+var (
+	versionSoftwareRe = regexp.MustCompile(`^(.*Software.*?),\s+Version\s+([^\s,]+)`)
+	versionRe         = regexp.MustCompile(`(?i)\bversion[:\s]+(\d[\w.()\-]*)`)
+	versionUptimeRe   = regexp.MustCompile(`^(\S+) uptime is (.+)$`)
+	versionModelRe    = regexp.MustCompile(`^(?i:model number)\s*:\s*(\S+)`)
+	versionCPURe      = regexp.MustCompile(`^(?i:cisco) (\S+) \(.*\) processor`)
+	versionSerialRe   = regexp.MustCompile(`^(?i:system serial number)\s*:\s*(\S+)`)
+	versionBoardRe    = regexp.MustCompile(`^Processor board ID (\S+)`)
+	versionImageRe    = regexp.MustCompile(`^System image file is "([^"]+)"`)
+	uptimePartRe      = regexp.MustCompile(`(\d+)\s+(year|week|day|hour|minute|second)s?`)
+)
+
+var uptimeUnits = map[string]int64{
+	"year":   365 * 24 * 3600,
+	"week":   7 * 24 * 3600,
+	"day":    24 * 3600,
+	"hour":   3600,
+	"minute": 60,
+	"second": 1,
+}
+
+func parseShowVersion(output string) (interface{}, error) {
+	v := &VersionInfo{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		if m := versionSoftwareRe.FindStringSubmatch(line); m != nil && v.Software == "" {
+			v.Software, v.Version = strings.TrimSpace(m[1]), m[2]
+		} else if m := versionRe.FindStringSubmatch(line); m != nil && v.Version == "" {
+			v.Version = m[1]
+		}
+		if m := versionUptimeRe.FindStringSubmatch(line); m != nil && v.Uptime == "" {
+			v.Hostname, v.Uptime = m[1], m[2]
+			for _, p := range uptimePartRe.FindAllStringSubmatch(m[2], -1) {
+				n, _ := strconv.ParseInt(p[1], 10, 64)
+				v.UptimeSeconds += n * uptimeUnits[p[2]]
+			}
+		}
+		// the model number line is more specific than the processor line
+		if m := versionModelRe.FindStringSubmatch(line); m != nil {
+			v.Model = m[1]
+		} else if m := versionCPURe.FindStringSubmatch(line); m != nil && v.Model == "" {
+			v.Model = m[1]
+		}
+		if m := versionSerialRe.FindStringSubmatch(line); m != nil {
+			v.SerialNumber = m[1]
+		} else if m := versionBoardRe.FindStringSubmatch(line); m != nil && v.SerialNumber == "" {
+			v.SerialNumber = m[1]
+		}
+		if m := versionImageRe.FindStringSubmatch(line); m != nil {
+			v.Image = m[1]
+		}
+	}
+	if v.Version == "" {
+		return nil, fmt.Errorf("no software version found")
+	}
+	return v, nil
+}
+
+// InterfaceInfo is an interface of the parsed output of show interfaces
+type InterfaceInfo struct {
+	Name            string `json:"name"`
+	LinkStatus      string `json:"linkStatus"`
+	ProtocolStatus  string `json:"protocolStatus"`
+	Hardware        string `json:"hardware,omitempty"`
+	MACAddress      string `json:"macAddress,omitempty"`
+	Description     string `json:"description,omitempty"`
+	IPAddress       string `json:"ipAddress,omitempty"`
+	MTU             int    `json:"mtu,omitempty"`
+	Bandwidth       int64  `json:"bandwidthKbps,omitempty"`
+	Duplex          string `json:"duplex,omitempty"`
+	Speed           string `json:"speed,omitempty"`
+	MediaType       string `json:"mediaType,omitempty"`
+	InputRate       int64  `json:"inputRateBps"`
+	OutputRate      int64  `json:"outputRateBps"`
+	InputPackets    int64  `json:"inputPackets"`
+	InputBytes      int64  `json:"inputBytes"`
+	InputErrors     int64  `json:"inputErrors"`
+	CRCErrors       int64  `json:"crcErrors"`
+	OutputPackets   int64  `json:"outputPackets"`
+	OutputBytes     int64  `json:"outputBytes"`
+	OutputErrors    int64  `json:"outputErrors"`
+	Collisions      int64  `json:"collisions"`
+	InterfaceResets int64  `json:"interfaceResets"`
+}
+
+var (
+	ifHeaderRe    = regexp.MustCompile(`^(\S+) is (administratively down|up|down|deleted)(?: \([^)]*\))?, line protocol is (\w+)`)
+	ifHardwareRe  = regexp.MustCompile(`^\s+Hardware is (.+?)(?:, address is ([0-9a-fA-F.:-]+))?(?: \(bia [^)]*\))?$`)
+	ifDescRe      = regexp.MustCompile(`^\s+Description: (.*)$`)
+	ifAddressRe   = regexp.MustCompile(`^\s+Internet address is (\S+)`)
+	ifMTURe       = regexp.MustCompile(`^\s+MTU (\d+) bytes(?:, BW (\d+) Kbit)?`)
+	ifDuplexRe    = regexp.MustCompile(`^\s+(\w+)[- ]duplex, ([^,]+)(?:.*media type is (.+))?`)
+	ifRateRe      = regexp.MustCompile(`^\s+\d+ (?:minute|second) (input|output) rate (\d+) bits/sec`)
+	ifInputRe     = regexp.MustCompile(`^\s+(\d+) packets input, (\d+) bytes`)
+	ifInErrorsRe  = regexp.MustCompile(`^\s+(\d+) input errors, (\d+) CRC`)
+	ifOutputRe    = regexp.MustCompile(`^\s+(\d+) packets output, (\d+) bytes`)
+	ifOutErrorsRe = regexp.MustCompile(`^\s+(\d+) output errors, (?:(\d+) collisions, )?(\d+) interface resets`)
+)
+
+func parseShowInterfaces(output string) (interface{}, error) {
+	interfaces := make([]InterfaceInfo, 0)
+	var cur *InterfaceInfo
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		if m := ifHeaderRe.FindStringSubmatch(line); m != nil {
+			interfaces = append(interfaces, InterfaceInfo{Name: m[1], LinkStatus: m[2], ProtocolStatus: m[3]})
+			cur = &interfaces[len(interfaces)-1]
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		switch {
+		case ifHardwareRe.MatchString(line):
+			m := ifHardwareRe.FindStringSubmatch(line)
+			cur.Hardware, cur.MACAddress = m[1], m[2]
+		case ifDescRe.MatchString(line):
+			cur.Description = ifDescRe.FindStringSubmatch(line)[1]
+		case ifAddressRe.MatchString(line):
+			cur.IPAddress = ifAddressRe.FindStringSubmatch(line)[1]
+		case ifMTURe.MatchString(line):
+			m := ifMTURe.FindStringSubmatch(line)
+			cur.MTU, _ = strconv.Atoi(m[1])
+			cur.Bandwidth = atoi64(m[2])
+		case ifDuplexRe.MatchString(line):
+			m := ifDuplexRe.FindStringSubmatch(line)
+			cur.Duplex, cur.Speed, cur.MediaType = strings.ToLower(m[1]), m[2], m[3]
+		case ifRateRe.MatchString(line):
+			m := ifRateRe.FindStringSubmatch(line)
+			if m[1] == "input" {
+				cur.InputRate = atoi64(m[2])
+			} else {
+				cur.OutputRate = atoi64(m[2])
+			}
+		case ifInputRe.MatchString(line):
+			m := ifInputRe.FindStringSubmatch(line)
+			cur.InputPackets, cur.InputBytes = atoi64(m[1]), atoi64(m[2])
+		case ifInErrorsRe.MatchString(line):
+			m := ifInErrorsRe.FindStringSubmatch(line)
+			cur.InputErrors, cur.CRCErrors = atoi64(m[1]), atoi64(m[2])
+		case ifOutputRe.MatchString(line):
+			m := ifOutputRe.FindStringSubmatch(line)
+			cur.OutputPackets, cur.OutputBytes = atoi64(m[1]), atoi64(m[2])
+		case ifOutErrorsRe.MatchString(line):
+			m := ifOutErrorsRe.FindStringSubmatch(line)
+			cur.OutputErrors, cur.Collisions, cur.InterfaceResets = atoi64(m[1]), atoi64(m[2]), atoi64(m[3])
+		}
+	}
+	if len(interfaces) == 0 && strings.TrimSpace(output) != "" {
+		return nil, fmt.Errorf("no interfaces found")
+	}
+	return interfaces, nil
+}
+
+// VLANInfo is a VLAN of the parsed output of show vlan
+type VLANInfo struct {
+	ID     int      `json:"vlanId"`
+	Name   string   `json:"name"`
+	Status string   `json:"status"`
+	Ports  []string `json:"ports"`
+}
+
+var (
+	vlanRowRe  = regexp.MustCompile(`^(\d{1,4})\s+(\S+)\s+(\S+)\s*(.*)$`)
+	vlanPortRe = regexp.MustCompile(`^\s{8,}(\S.*)$`)
+	// vlanEndRe matches the headers of the tables following the VLAN list
+	vlanEndRe = regexp.MustCompile(`^(VLAN\s+Type|Remote SPAN|Primary\s+Secondary)`)
+)
+
+func parseShowVLAN(output string) (interface{}, error) {
+	vlans := make([]VLANInfo, 0)
+	header := false
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		if !header {
+			header = strings.HasPrefix(line, "VLAN") && strings.Contains(line, "Status")
+			continue
+		}
+		if vlanEndRe.MatchString(line) {
+			break
+		}
+		if m := vlanRowRe.FindStringSubmatch(line); m != nil {
+			id, _ := strconv.Atoi(m[1])
+			vlans = append(vlans, VLANInfo{ID: id, Name: m[2], Status: m[3], Ports: splitPorts(m[4])})
+		} else if m := vlanPortRe.FindStringSubmatch(line); m != nil && len(vlans) > 0 {
+			last := &vlans[len(vlans)-1]
+			last.Ports = append(last.Ports, splitPorts(m[1])...)
+		}
+	}
+	if !header {
+		return nil, fmt.Errorf("no VLAN table found")
+	}
+	return vlans, nil
+}
+
+func splitPorts(s string) []string {
+	ports := make([]string, 0)
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			ports = append(ports, p)
+		}
+	}
+	return ports
+}
+
+// MACEntry is an entry of the parsed output of show mac address-table
+type MACEntry struct {
+	VLAN       string `json:"vlan"` // VLAN id, "All" for entries of every VLAN
+	MACAddress string `json:"macAddress"`
+	Type       string `json:"type"`
+	Port       string `json:"port"`
+}
+
+var macAddressRe = regexp.MustCompile(`^[0-9a-fA-F]{4}\.[0-9a-fA-F]{4}\.[0-9a-fA-F]{4}$`)
+
+func parseShowMACAddressTable(output string) (interface{}, error) {
+	entries := make([]MACEntry, 0)
+	header := false
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && strings.EqualFold(fields[0], "vlan") && strings.EqualFold(fields[1], "mac") {
+			header = true
+			continue
+		}
+		if len(fields) < 4 || !macAddressRe.MatchString(fields[1]) {
+			continue
+		}
+		entries = append(entries, MACEntry{
+			VLAN:       fields[0],
+			MACAddress: strings.ToLower(fields[1]),
+			Type:       strings.ToLower(fields[2]),
+			Port:       fields[len(fields)-1],
+		})
+	}
+	if !header && len(entries) == 0 {
+		return nil, fmt.Errorf("no MAC address table found")
+	}
+	return entries, nil
+}
+
+func atoi64(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
@@ -0,0 +1,217 @@
+package device
+
+import (
+	"reflect"
+	"testing"
+)
+
+const showVersionOutput = `Cisco IOS Software, C2960X Software (C2960X-UNIVERSALK9-M), Version 15.2(4)E10, RELEASE SOFTWARE (fc2)
+Technical Support: http://www.cisco.com/techsupport
+
+ROM: Bootstrap program is C2960X boot loader
+sw-core-01 uptime is 1 year, 2 weeks, 3 days, 4 hours, 5 minutes
+System image file is "flash:c2960x-universalk9-mz.152-4.E10.bin"
+
+cisco WS-C2960X-48TS-L (APM86XXX) processor (revision V02) with 524288K bytes of memory.
+Processor board ID FOC1234X5YZ
+
+Model number                    : WS-C2960X-48TS-L
+System serial number            : FOC1234X5YZ
+`
+
+const showInterfacesOutput = `GigabitEthernet1/0/1 is up, line protocol is up (connected)
+  Hardware is Gigabit Ethernet, address is 0011.2233.4401 (bia 0011.2233.4401)
+  Description: uplink to core
+  MTU 1500 bytes, BW 1000000 Kbit/sec, DLY 10 usec,
+     reliability 255/255, txload 1/255, rxload 1/255
+  Full-duplex, 1000Mb/s, media type is 10/100/1000BaseTX
+  5 minute input rate 2000 bits/sec, 3 packets/sec
+  5 minute output rate 4000 bits/sec, 5 packets/sec
+     123456 packets input, 98765432 bytes, 0 no buffer
+     2 input errors, 1 CRC, 0 frame, 0 overrun, 0 ignored
+     654321 packets output, 12345678 bytes, 0 underruns
+     0 output errors, 0 collisions, 1 interface resets
+GigabitEthernet1/0/2 is administratively down, line protocol is down (disabled)
+  Hardware is Gigabit Ethernet, address is 0011.2233.4402 (bia 0011.2233.4402)
+  MTU 1500 bytes, BW 10000 Kbit/sec, DLY 1000 usec,
+  Auto-duplex, Auto-speed, media type is 10/100/1000BaseTX
+`
+
+const showVLANOutput = `
+VLAN Name                             Status    Ports
+---- -------------------------------- --------- -------------------------------
+1    default                          active    Gi1/0/3, Gi1/0/4, Gi1/0/5
+                                                Gi1/0/6
+10   users                            active    Gi1/0/7
+20   voice                            active
+1002 fddi-default                     act/unsup
+
+VLAN Type  SAID       MTU   Parent RingNo BridgeNo Stp  BrdgMode Trans1 Trans2
+---- ----- ---------- ----- ------ ------ -------- ---- -------- ------ ------
+1    enet  100001     1500  -      -      -        -    -        0      0
+`
+
+const showMACOutput = `          Mac Address Table
+-------------------------------------------
+
+Vlan    Mac Address       Type        Ports
+----    -----------       --------    -----
+ All    0100.0ccc.cccc    STATIC      CPU
+  10    0011.2233.44AA    DYNAMIC     Gi1/0/7
+Total Mac Addresses for this criterion: 2
+`
+
+func TestParseOutput(t *testing.T) {
+	v, err := ParseOutput("", "sh ver", showVersionOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantVersion := &VersionInfo{
+		Hostname:      "sw-core-01",
+		Software:      "Cisco IOS Software, C2960X Software (C2960X-UNIVERSALK9-M)",
+		Version:       "15.2(4)E10",
+		Model:         "WS-C2960X-48TS-L",
+		SerialNumber:  "FOC1234X5YZ",
+		Image:         "flash:c2960x-universalk9-mz.152-4.E10.bin",
+		Uptime:        "1 year, 2 weeks, 3 days, 4 hours, 5 minutes",
+		UptimeSeconds: 365*86400 + 14*86400 + 3*86400 + 4*3600 + 5*60,
+	}
+	if !reflect.DeepEqual(v, wantVersion) {
+		t.Errorf("show version = %+v, want %+v", v, wantVersion)
+	}
+
+	v, err = ParseOutput("", "show interfaces", showInterfacesOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ifs := v.([]InterfaceInfo)
+	if len(ifs) != 2 {
+		t.Fatalf("show interfaces parsed %d interfaces", len(ifs))
+	}
+	wantIf := InterfaceInfo{
+		Name: "GigabitEthernet1/0/1", LinkStatus: "up", ProtocolStatus: "up",
+		Hardware: "Gigabit Ethernet", MACAddress: "0011.2233.4401", Description: "uplink to core",
+		MTU: 1500, Bandwidth: 1000000, Duplex: "full", Speed: "1000Mb/s", MediaType: "10/100/1000BaseTX",
+		InputRate: 2000, OutputRate: 4000, InputPackets: 123456, InputBytes: 98765432, InputErrors: 2, CRCErrors: 1,
+		OutputPackets: 654321, OutputBytes: 12345678, InterfaceResets: 1,
+	}
+	if !reflect.DeepEqual(ifs[0], wantIf) {
+		t.Errorf("show interfaces[0] = %+v, want %+v", ifs[0], wantIf)
+	}
+	if ifs[1].LinkStatus != "administratively down" || ifs[1].Duplex != "auto" {
+		t.Errorf("show interfaces[1] = %+v", ifs[1])
+	}
+
+	v, err = ParseOutput("", "show vlan brief", showVLANOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantVLANs := []VLANInfo{
+		{ID: 1, Name: "default", Status: "active", Ports: []string{"Gi1/0/3", "Gi1/0/4", "Gi1/0/5", "Gi1/0/6"}},
+		{ID: 10, Name: "users", Status: "active", Ports: []string{"Gi1/0/7"}},
+		{ID: 20, Name: "voice", Status: "active", Ports: []string{}},
+		{ID: 1002, Name: "fddi-default", Status: "act/unsup", Ports: []string{}},
+	}
+	if !reflect.DeepEqual(v, wantVLANs) {
+		t.Errorf("show vlan = %+v, want %+v", v, wantVLANs)
+	}
+
+	v, err = ParseOutput("", "show mac address-table dynamic vlan 10", showMACOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMAC := []MACEntry{
+		{VLAN: "All", MACAddress: "0100.0ccc.cccc", Type: "static", Port: "CPU"},
+		{VLAN: "10", MACAddress: "0011.2233.44aa", Type: "dynamic", Port: "Gi1/0/7"},
+	}
+	if !reflect.DeepEqual(v, wantMAC) {
+		t.Errorf("show mac address-table = %+v, want %+v", v, wantMAC)
+	}
+}
+
+const showEnvironmentOutput = `FAN is OK
+TEMPERATURE is OK
+Temperature Value: 35 Degree Celsius
+Temperature State: GREEN
+POWER is OK
+RPS is NOT PRESENT
+Switch 2 FAN 1 is FAULTY
+Sensor          Location        State       Reading       Range(min-max)
+PS1 Vout        1               GOOD        56845 mV      na
+Temp: Coretemp  1               GOOD        45 Celsius    na
+`
+
+func TestParseHealth(t *testing.T) {
+	tests := []struct {
+		vendor, command, output string
+		want                    interface{}
+	}{
+		{"", "show processes cpu sorted", "CPU utilization for five seconds: 7%/1%; one minute: 6%; five minutes: 5%\n PID Runtime(ms)",
+			&CPUInfo{FiveSeconds: 7, OneMinute: 6, FiveMinutes: 5}},
+		{"huawei_vrp", "display cpu-usage", "CPU Usage Stat. Cycle: 60 (Second)\nCPU Usage            : 12% Max: 40%\n",
+			&CPUInfo{FiveSeconds: 12, OneMinute: 12, FiveMinutes: 12}},
+		{"", "sh proc mem", "Processor Pool Total:  800 Used:  200 Free:  600\n      I/O Pool Total:  100 Used:  50 Free:  50\n",
+			&MemoryInfo{Total: 800, Used: 200, Free: 600, UsagePercent: 25}},
+		{"", "show processes memory", "System memory  : 1000K total, 400K used, 600K free\n",
+			&MemoryInfo{Total: 1024000, Used: 409600, Free: 614400, UsagePercent: 40}},
+		{"huawei_vrp", "display memory-usage", "System Total Memory Is: 1000 bytes\nTotal Memory Used Is: 370 bytes\nMemory Using Percentage Is: 37%\n",
+			&MemoryInfo{Total: 1000, Used: 370, Free: 630, UsagePercent: 37}},
+		{"", "show env all", showEnvironmentOutput, &EnvironmentInfo{
+			Temperatures:  []TemperatureReading{{Sensor: "Temperature", Celsius: 35}, {Sensor: "Temp: Coretemp", Celsius: 45}},
+			PowerSupplies: []ComponentStatus{{Name: "POWER", Status: "OK", OK: true}},
+			Fans:          []ComponentStatus{{Name: "FAN", Status: "OK", OK: true}, {Name: "Switch 2 FAN 1", Status: "FAULTY"}},
+		}},
+	}
+	for _, tt := range tests {
+		v, err := ParseOutput(tt.vendor, tt.command, tt.output)
+		if err != nil {
+			t.Errorf("%s: %v", tt.command, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.want) {
+			t.Errorf("%s = %+v, want %+v", tt.command, v, tt.want)
+		}
+	}
+
+	if _, err := ParseOutput("", "show processes cpu", "no numbers here"); !isDeviceError(err, ErrParseFailed) {
+		t.Errorf("unexpected cpu output error = %v, want parse failure", err)
+	}
+}
+
+func TestParseOutputErrors(t *testing.T) {
+	for _, cmd := range []string{"show interfaces status", "show running-config", "show vlan id 10"} {
+		if _, err := ParseOutput("", cmd, ""); !isDeviceError(err, ErrNotSupported) {
+			t.Errorf("ParseOutput(%q) error = %v, want not supported", cmd, err)
+		}
+	}
+
+	_, err := ParseOutput("", "show version", "                ^\n% Invalid input detected at '^' marker.\n")
+	if !isDeviceError(err, ErrParseFailed) {
+		t.Errorf("rejected command error = %v, want parse failure", err)
+	}
+	if _, err := ParseOutput("", "show vlan", "garbage"); !isDeviceError(err, ErrParseFailed) {
+		t.Errorf("unexpected output error = %v, want parse failure", err)
+	}
+}
+
+func TestRegisterParserVendor(t *testing.T) {
+	defer func(entries []parserEntry) { parsers.entries = entries }(parsers.entries)
+
+	if err := RegisterParser("huawei", `show version`, func(string) (interface{}, error) { return "huawei", nil }); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := ParseOutput("Huawei", "show  version", ""); err != nil || v != "huawei" {
+		t.Errorf("vendor parser = %v, %v", v, err)
+	}
+	if _, err := ParseOutput("cisco_ios", "show version", showVersionOutput); err != nil {
+		t.Errorf("other vendors must fall back to the generic parser: %v", err)
+	}
+	if err := RegisterParser("", "(", nil); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func isDeviceError(err error, code ErrorCode) bool {
+	de, ok := err.(*DeviceError)
+	return ok && de.Code == code
+}
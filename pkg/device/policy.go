@@ -0,0 +1,318 @@
+package device
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Command policy actions
+const (
+	PolicyAllow   = "allow"
+	PolicyDeny    = "deny"
+	PolicyConfirm = "confirm"
+)
+
+// PolicyAnyRole is the role key of rules that apply to every role
+const PolicyAnyRole = "*"
+
+// Access that does not go through Execute is evaluated as a pseudo command,
+// so that rules allow, confirm or deny it like any other command. What is
+// typed into a terminal is not evaluated, see CommandPolicy.
+const TerminalCommand = "[terminal]"
+
+// NetconfCommand returns the pseudo command of a NETCONF operation, e.g.
+// "netconf edit-config"
+func NetconfCommand(operation string) string {
+	return "netconf " + operation
+}
+
+// confirmTokenTTL is how long a confirmation token can be redeemed
+const confirmTokenTTL = 2 * time.Minute
+
+// PolicyRule matches commands of a Casbin role by regular expression
+type PolicyRule struct {
+	ID      int
+	RoleKey string // Casbin role key, PolicyAnyRole for every role
+	Action  string // allow, deny or confirm
+	Pattern string
+}
+
+// PolicyDecision is the outcome of evaluating a command. Rule is nil when no
+// rule matched.
+type PolicyDecision struct {
+	Action string
+	Rule   *PolicyRule
+}
+
+// CommandPolicy decides which commands a role may run. For the rules that
+// apply to a role, a matching deny rule wins over a matching confirm rule,
+// which wins over a matching allow rule. Once a role has allow rules, commands
+// none of them matches are denied; without allow rules everything that is not
+// denied is allowed.
+//
+// The lines typed into a terminal cannot be evaluated reliably: the device
+// completes, recalls and edits them. A role the policy denies commands,
+// through a deny rule or through allow rules, therefore cannot open a
+// terminal at all. Rules that match TerminalCommand itself only decide on
+// the terminal. Confirm rules do not apply within a terminal, opening it is
+// the one confirmation.
+type CommandPolicy struct {
+	rules    []PolicyRule
+	patterns []*regexp.Regexp
+}
+
+// NewCommandPolicy compiles the rules of a policy
+func NewCommandPolicy(rules []PolicyRule) (*CommandPolicy, error) {
+	p := &CommandPolicy{
+		rules:    make([]PolicyRule, 0, len(rules)),
+		patterns: make([]*regexp.Regexp, 0, len(rules)),
+	}
+	for _, r := range rules {
+		switch r.Action {
+		case PolicyAllow, PolicyDeny, PolicyConfirm:
+		default:
+			return nil, NewInvalidConfigError(fmt.Sprintf("policy rule %d: unknown action %q", r.ID, r.Action))
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, NewInvalidConfigError(fmt.Sprintf("policy rule %d: invalid pattern %q: %v", r.ID, r.Pattern, err))
+		}
+		p.rules = append(p.rules, r)
+		p.patterns = append(p.patterns, re)
+	}
+	return p, nil
+}
+
+// Evaluate decides on a single command of a role. A command with control
+// characters is denied: the device would run every line of it, while the
+// rules only see the whole.
+func (p *CommandPolicy) Evaluate(roleKey, command string) PolicyDecision {
+	command = strings.TrimSpace(command)
+	if hasControl(command) {
+		return PolicyDecision{Action: PolicyDeny}
+	}
+
+	var confirm, allow *PolicyRule
+	hasAllow := false
+	for i := range p.rules {
+		r := &p.rules[i]
+		if r.RoleKey != roleKey && r.RoleKey != PolicyAnyRole {
+			continue
+		}
+		if r.Action == PolicyAllow {
+			hasAllow = true
+		}
+		if !p.patterns[i].MatchString(command) {
+			continue
+		}
+		switch r.Action {
+		case PolicyDeny:
+			return PolicyDecision{Action: PolicyDeny, Rule: r}
+		case PolicyConfirm:
+			if confirm == nil {
+				confirm = r
+			}
+		case PolicyAllow:
+			if allow == nil {
+				allow = r
+			}
+		}
+	}
+
+	switch {
+	case command == TerminalCommand && p.restricts(roleKey):
+		return PolicyDecision{Action: PolicyDeny}
+	case confirm != nil:
+		return PolicyDecision{Action: PolicyConfirm, Rule: confirm}
+	case allow != nil:
+		return PolicyDecision{Action: PolicyAllow, Rule: allow}
+	case hasAllow:
+		return PolicyDecision{Action: PolicyDeny}
+	default:
+		return PolicyDecision{Action: PolicyAllow}
+	}
+}
+
+// restricts reports whether roleKey has deny or allow rules on commands
+// other than TerminalCommand
+func (p *CommandPolicy) restricts(roleKey string) bool {
+	for i := range p.rules {
+		r := &p.rules[i]
+		if r.RoleKey != roleKey && r.RoleKey != PolicyAnyRole {
+			continue
+		}
+		if r.Action != PolicyConfirm && !p.patterns[i].MatchString(TerminalCommand) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasControl reports whether command contains a line break or another
+// control character
+func hasControl(command string) bool {
+	return strings.IndexFunc(command, unicode.IsControl) >= 0
+}
+
+// Principal identifies who submits commands. The API layer attaches it to the
+// context passed to ConnectionPool.Execute; work without a principal is
+// internal (scheduled backups, restores) and not subject to the policy.
+type Principal struct {
+	UserID       string
+	Username     string
+	RoleKey      string
+	ClientIP     string
+	ConfirmToken string // token of an earlier ConfirmationRequiredError
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the principal
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the principal attached to ctx
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// ConfirmationRequiredError is returned when commands match a confirm rule.
+// Submitting the same commands to the same device again with Token within
+// its lifetime runs them. A token can be used once.
+type ConfirmationRequiredError struct {
+	Token     string   `json:"confirmToken"`
+	Commands  []string `json:"commands"`
+	ExpiresAt int64    `json:"expiresAt"`
+}
+
+// Error implements the error interface
+func (e *ConfirmationRequiredError) Error() string {
+	return fmt.Sprintf("[%d] %s: %s", ErrConfirmRequired, errorMessages[ErrConfirmRequired], strings.Join(e.Commands, "; "))
+}
+
+// confirmations holds the outstanding confirmation tokens
+var confirmations = struct {
+	sync.Mutex
+	tokens map[string]confirmation
+}{tokens: make(map[string]confirmation)}
+
+type confirmation struct {
+	key     string
+	expires time.Time
+}
+
+// confirmKey binds a token to the user, device and exact command list
+func confirmKey(deviceID int, p *Principal, commands []string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\x00%s\x00%s", deviceID, p.UserID, strings.Join(commands, "\n"))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func issueConfirmation(key string, now time.Time) (string, time.Time) {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	token := hex.EncodeToString(buf)
+	expires := now.Add(confirmTokenTTL)
+
+	confirmations.Lock()
+	defer confirmations.Unlock()
+	for t, c := range confirmations.tokens {
+		if now.After(c.expires) {
+			delete(confirmations.tokens, t)
+		}
+	}
+	confirmations.tokens[token] = confirmation{key: key, expires: expires}
+	return token, expires
+}
+
+// redeemConfirmation consumes a token issued for key
+func redeemConfirmation(token, key string, now time.Time) bool {
+	confirmations.Lock()
+	defer confirmations.Unlock()
+
+	c, ok := confirmations.tokens[token]
+	if !ok || c.key != key || now.After(c.expires) {
+		return false
+	}
+	delete(confirmations.tokens, token)
+	return true
+}
+
+// checkPolicy evaluates commands submitted to a device against the command
+// policy. Denied commands and commands awaiting confirmation are recorded in
+// the execution log.
+func checkPolicy(ctx context.Context, deviceID int, commands []string) error {
+	principal, ok := PrincipalFrom(ctx)
+	if !ok {
+		return nil
+	}
+	// one line per command, also when no policy is set, so that the
+	// history shows what the device ran
+	for _, cmd := range commands {
+		if hasControl(strings.TrimSpace(cmd)) {
+			err := NewInvalidParamError(fmt.Sprintf("command %q contains a line break or control character", cmd))
+			logPolicyViolation(deviceID, principal, cmd, PolicyDeny, err.Error())
+			return err
+		}
+	}
+	policy := GetCommandPolicy()
+	if policy == nil {
+		return nil
+	}
+
+	var confirm []string
+	for _, cmd := range commands {
+		decision := policy.Evaluate(principal.RoleKey, cmd)
+		switch decision.Action {
+		case PolicyDeny:
+			err := NewCommandDeniedError(cmd, decision.Rule)
+			logPolicyViolation(deviceID, principal, cmd, PolicyDeny, err.Error())
+			return err
+		case PolicyConfirm:
+			confirm = append(confirm, cmd)
+		}
+	}
+	if len(confirm) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	key := confirmKey(deviceID, principal, commands)
+	if principal.ConfirmToken != "" && redeemConfirmation(principal.ConfirmToken, key, now) {
+		return nil
+	}
+
+	token, expires := issueConfirmation(key, now)
+	err := &ConfirmationRequiredError{Token: token, Commands: confirm, ExpiresAt: expires.Unix()}
+	for _, cmd := range confirm {
+		logPolicyViolation(deviceID, principal, cmd, PolicyConfirm, errorMessages[ErrConfirmRequired])
+	}
+	return err
+}
+
+func logPolicyViolation(deviceID int, p *Principal, command, action, reason string) {
+	logger := GetLogger()
+	if logger == nil {
+		return
+	}
+	_ = logger.Log(&ExecutionLog{
+		Timestamp: time.Now().Unix(),
+		DeviceID:  deviceID,
+		UserID:    p.UserID,
+		Username:  p.Username,
+		Command:   command,
+		Error:     reason,
+		ClientIP:  p.ClientIP,
+		Policy:    action,
+	})
+}
@@ -0,0 +1,149 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCommandPolicyEvaluate(t *testing.T) {
+	policy, err := NewCommandPolicy([]PolicyRule{
+		{ID: 1, RoleKey: PolicyAnyRole, Action: PolicyConfirm, Pattern: `^rel(o(a(d)?)?)?(\s|$)`},
+		{ID: 2, RoleKey: "common", Action: PolicyAllow, Pattern: `^show\s`},
+		{ID: 3, RoleKey: "common", Action: PolicyDeny, Pattern: `^show\s+running-config`},
+		{ID: 4, RoleKey: "common", Action: PolicyAllow, Pattern: `^reload$`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		role, command, action string
+		rule                  int
+	}{
+		{"admin", "reload", PolicyConfirm, 1},
+		{"admin", "configure terminal", PolicyAllow, 0},
+		{"common", "show version", PolicyAllow, 2},
+		{"common", " show running-config ", PolicyDeny, 3},
+		{"common", "configure terminal", PolicyDeny, 0},
+		{"common", "reload", PolicyConfirm, 1},
+		// the device would run both lines
+		{"common", "show clock\nreload", PolicyDeny, 0},
+		{"admin", "show clock\r\nconfigure terminal", PolicyDeny, 0},
+		{"common", "show \x03version", PolicyDeny, 0},
+		// a shell would let common run what its rules deny
+		{"common", TerminalCommand, PolicyDeny, 0},
+		{"admin", TerminalCommand, PolicyAllow, 0},
+	}
+	for _, tt := range tests {
+		d := policy.Evaluate(tt.role, tt.command)
+		rule := 0
+		if d.Rule != nil {
+			rule = d.Rule.ID
+		}
+		if d.Action != tt.action || rule != tt.rule {
+			t.Errorf("Evaluate(%q, %q) = %s by rule %d, want %s by rule %d", tt.role, tt.command, d.Action, rule, tt.action, tt.rule)
+		}
+	}
+
+	if _, err := NewCommandPolicy([]PolicyRule{{ID: 1, Action: "audit", Pattern: "x"}}); err == nil {
+		t.Error("expected error for unknown action")
+	}
+	if _, err := NewCommandPolicy([]PolicyRule{{ID: 1, Action: PolicyDeny, Pattern: "("}}); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestCheckPolicyConfirmation(t *testing.T) {
+	policy, err := NewCommandPolicy([]PolicyRule{
+		{ID: 1, RoleKey: PolicyAnyRole, Action: PolicyConfirm, Pattern: `^reload`},
+		{ID: 2, RoleKey: PolicyAnyRole, Action: PolicyDeny, Pattern: `^erase`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetCommandPolicy(policy)
+	defer SetCommandPolicy(nil)
+
+	cmds := []string{"show clock", "reload"}
+	principal := &Principal{UserID: "1", RoleKey: "admin"}
+	ctx := WithPrincipal(context.Background(), principal)
+
+	if err := checkPolicy(context.Background(), 1, cmds); err != nil {
+		t.Fatalf("internal work must not be checked, got %v", err)
+	}
+
+	err = checkPolicy(ctx, 1, cmds)
+	var confirm *ConfirmationRequiredError
+	if !errors.As(err, &confirm) {
+		t.Fatalf("expected confirmation, got %v", err)
+	}
+	if len(confirm.Commands) != 1 || confirm.Commands[0] != "reload" {
+		t.Errorf("confirm commands = %q", confirm.Commands)
+	}
+
+	// the token is bound to the device and the command list
+	principal.ConfirmToken = confirm.Token
+	if err := checkPolicy(ctx, 2, cmds); err == nil {
+		t.Error("token accepted for another device")
+	}
+	if err := checkPolicy(ctx, 1, cmds); err != nil {
+		t.Errorf("confirmed commands rejected: %v", err)
+	}
+	if err := checkPolicy(ctx, 1, cmds); err == nil {
+		t.Error("token accepted twice")
+	}
+
+	err = checkPolicy(ctx, 1, []string{"erase startup-config"})
+	if de, ok := err.(*DeviceError); !ok || de.Code != ErrCommandDenied {
+		t.Errorf("expected denial, got %v", err)
+	}
+}
+
+func TestCheckPolicyRejectsLineBreaks(t *testing.T) {
+	ctx := WithPrincipal(context.Background(), &Principal{UserID: "1", RoleKey: "admin"})
+	// without a policy as well
+	for _, cmds := range [][]string{{"show clock\nreload"}, {"show version", "show clock\rreload"}} {
+		err := checkPolicy(ctx, 1, cmds)
+		if de, ok := err.(*DeviceError); !ok || de.Code != ErrInvalidParam {
+			t.Errorf("checkPolicy(%q) = %v, want invalid parameter", cmds, err)
+		}
+	}
+	if err := checkPolicy(ctx, 1, []string{"show clock\n"}); err != nil {
+		t.Errorf("trailing line break rejected: %v", err)
+	}
+}
+
+func TestCommandPolicyTerminal(t *testing.T) {
+	policy, err := NewCommandPolicy([]PolicyRule{
+		{ID: 1, RoleKey: "ops", Action: PolicyConfirm, Pattern: `^\[terminal\]$`},
+		{ID: 2, RoleKey: "ops", Action: PolicyConfirm, Pattern: `^reload`},
+		{ID: 3, RoleKey: "audit", Action: PolicyDeny, Pattern: `^reload`},
+		{ID: 4, RoleKey: "viewer", Action: PolicyAllow, Pattern: `^show\s`},
+		{ID: 5, RoleKey: "viewer", Action: PolicyAllow, Pattern: `^\[terminal\]$`},
+		{ID: 6, RoleKey: "root", Action: PolicyAllow, Pattern: `.*`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		role, action string
+		rule         int
+	}{
+		{"ops", PolicyConfirm, 1}, // confirm rules do not restrict the shell
+		{"audit", PolicyDeny, 0},
+		{"viewer", PolicyDeny, 0}, // allowing the terminal would allow any command
+		{"root", PolicyAllow, 6},
+	}
+	for _, tt := range tests {
+		d := policy.Evaluate(tt.role, TerminalCommand)
+		rule := 0
+		if d.Rule != nil {
+			rule = d.Rule.ID
+		}
+		if d.Action != tt.action || rule != tt.rule {
+			t.Errorf("Evaluate(%q, terminal) = %s by rule %d, want %s by rule %d", tt.role, d.Action, rule, tt.action, tt.rule)
+		}
+	}
+}
@@ -6,15 +6,37 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"golang.org/x/sync/semaphore"
 )
 
 // Connection represents a device connection
 type Connection struct {
 	ID        string
 	Adapter   ProtocolAdapter
-	CreatedAt time.Time
-	LastUsed  time.Time
-	InUse     int32 // atomic
+	CreatedAt time.Time // written by the holder only, the status reads the health snapshot
+	InUse     int32     // atomic
+
+	lastUsed atomic.Int64 // unix nanoseconds
+	health   connectionHealth
+}
+
+// LastUsed returns when the connection last ran a command
+func (c *Connection) LastUsed() time.Time {
+	return time.Unix(0, c.lastUsed.Load())
+}
+
+// touch notes that the connection ran a command at t
+func (c *Connection) touch(t time.Time) {
+	c.lastUsed.Store(t.UnixNano())
+}
+
+// release returns a checked out connection to the pool. The adapter state is
+// copied to the health snapshot first: only the holder may look at the
+// adapter, so the pool status reads the snapshot instead.
+func (c *Connection) release() {
+	c.health.snapshot(c)
+	atomic.StoreInt32(&c.InUse, 0)
 }
 
 // CommandTask represents a command execution task
@@ -22,19 +44,31 @@ type CommandTask struct {
 	Commands []string
 	Timeout  time.Duration
 	ResultCh chan *CommandResult
-	UserID   string
+	UserID   string // tasks of different users take turns within a priority class
+	Priority Priority
+
+	ctx     context.Context // cancels the commands not run yet, nil for none
+	started func()          // called when a worker picks the task up
+	waited  time.Duration   // time spent in the queue, set when dispatched
 }
 
 // ConnectionPool manages device connections using semaphore pattern
 type ConnectionPool struct {
-	config    *DeviceConfig
-	adapter   ProtocolAdapter
-	semaphore chan struct{} // Semaphore for connection limiting
-	queue     chan *CommandTask
+	id          int // inventory device id, set by the registry
+	config      *DeviceConfig
+	newAdapter  AdapterFactory      // one adapter per connection
+	semaphore   chan struct{}       // Semaphore for connection limiting
+	gate        *semaphore.Weighted // Shared by regular work, taken whole by Exclusive
+	gateSize    int64
+	queue       *scheduler
 	connections map[string]*Connection
-	mu        sync.RWMutex
-	running   int32
-	wg        sync.WaitGroup
+	dialing     int  // connections being opened, counted against the limit
+	closed      bool // set by shutdown, connections opened after it are closed
+	mu          sync.RWMutex
+	running     int32
+	workers     sync.WaitGroup // the queue workers
+	wg          sync.WaitGroup // the maintainer
+	stop        chan struct{}  // stops the maintainer
 }
 
 // NewConnectionPool creates a new connection pool
@@ -43,30 +77,22 @@ func NewConnectionPool(config *DeviceConfig) (*ConnectionPool, error) {
 		return nil, NewInvalidConfigError("config is nil")
 	}
 
-	// Create protocol adapter based on type
-	var adapter ProtocolAdapter
-	switch ProtocolType(config.Connection.Protocol) {
-	case ProtocolSSH:
-		adapter = NewSSHAdapterFunc()
-	case ProtocolTelnet:
-		adapter = NewTelnetAdapterFunc()
-	default:
+	// Select the protocol adapter based on type
+	newAdapter, ok := LookupAdapter(ProtocolType(config.Connection.Protocol))
+	if !ok {
 		return nil, NewInvalidConfigError(fmt.Sprintf("unsupported protocol: %s", config.Connection.Protocol))
 	}
 
 	pool := &ConnectionPool{
 		config:      config,
-		adapter:     adapter,
+		newAdapter:  newAdapter,
 		semaphore:   make(chan struct{}, config.Pool.MaxConnections),
-		queue:       make(chan *CommandTask, config.Pool.MaxQueueSize),
+		gate:        semaphore.NewWeighted(int64(config.Pool.MaxConnections)),
+		gateSize:    int64(config.Pool.MaxConnections),
+		queue:       newScheduler(config.Pool.MaxQueueSize),
 		connections: make(map[string]*Connection),
 	}
 
-	// Initialize semaphore with available slots
-	for i := 0; i < config.Pool.MinConnections; i++ {
-		pool.semaphore <- struct{}{}
-	}
-
 	return pool, nil
 }
 
@@ -75,20 +101,34 @@ func (p *ConnectionPool) Start(ctx context.Context) error {
 	if !atomic.CompareAndSwapInt32(&p.running, 0, 1) {
 		return nil // Already running
 	}
+	p.mu.Lock()
+	p.closed = false
+	p.mu.Unlock()
 
 	// Start worker goroutines
 	for i := 0; i < p.config.Pool.MaxConnections; i++ {
-		p.wg.Add(1)
+		p.workers.Add(1)
 		go p.worker(ctx, i)
 	}
 
-	// Establish initial connections
-	for i := 0; i < p.config.Pool.MinConnections; i++ {
-		if _, err := p.getConnection(ctx); err != nil {
-			// Log error but continue
-			fmt.Printf("Failed to establish initial connection: %v\n", err)
+	// Keep the idle connections healthy
+	p.stop = make(chan struct{})
+	p.wg.Add(1)
+	go p.maintain(ctx)
+
+	// Establish initial connections in the background so that an
+	// unreachable device does not block startup or inventory changes
+	go func() {
+		for i := 0; i < p.config.Pool.MinConnections; i++ {
+			conn, err := p.getConnection(ctx)
+			if err != nil {
+				// Log error but continue
+				fmt.Printf("Failed to establish initial connection: %v\n", err)
+				continue
+			}
+			p.releaseConnection(conn)
 		}
-	}
+	}()
 
 	return nil
 }
@@ -98,11 +138,55 @@ func (p *ConnectionPool) Stop() error {
 	if !atomic.CompareAndSwapInt32(&p.running, 1, 0) {
 		return nil // Already stopped
 	}
+	p.shutdown()
+	return nil
+}
 
-	// Close queue
-	close(p.queue)
+// Drain stops the pool after its queued tasks, checkouts and terminals
+// finished. New work is refused at once. If the work is not done within
+// timeout the pool is stopped anyway: running commands still complete, but
+// checked out connections are closed. Drain reports whether the pool drained
+// in time.
+func (p *ConnectionPool) Drain(timeout time.Duration) bool {
+	if !atomic.CompareAndSwapInt32(&p.running, 1, 0) {
+		return true // Already stopped
+	}
+	p.queue.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	drained := make(chan struct{})
+	go func() {
+		p.workers.Wait()
+		close(drained)
+	}()
+	ok := true
+	select {
+	case <-drained:
+		// Checkouts and exclusive operations hold the gate
+		if err := p.gate.Acquire(ctx, p.gateSize); err != nil {
+			ok = false
+		} else {
+			p.gate.Release(p.gateSize)
+		}
+	case <-ctx.Done():
+		ok = false
+	}
+
+	p.shutdown()
+	return ok
+}
+
+// shutdown closes the queue, waits for the workers and the maintainer and
+// closes all connections
+func (p *ConnectionPool) shutdown() {
+	// Close queue and stop the maintainer
+	p.queue.close()
+	close(p.stop)
 
 	// Wait for workers to finish
+	p.workers.Wait()
 	p.wg.Wait()
 
 	// Close all connections
@@ -111,9 +195,8 @@ func (p *ConnectionPool) Stop() error {
 		_ = conn.Adapter.Disconnect(context.Background())
 	}
 	p.connections = make(map[string]*Connection)
+	p.closed = true
 	p.mu.Unlock()
-
-	return nil
 }
 
 // Execute submits a command for execution
@@ -122,6 +205,11 @@ func (p *ConnectionPool) Execute(ctx context.Context, commands []string, timeout
 		return nil, NewConnectionClosed()
 	}
 
+	// Evaluate the command policy before anything reaches the queue
+	if err := p.Authorize(ctx, commands); err != nil {
+		return nil, err
+	}
+
 	// Create result channel
 	resultCh := make(chan *CommandResult, len(commands))
 
@@ -130,23 +218,32 @@ func (p *ConnectionPool) Execute(ctx context.Context, commands []string, timeout
 		Commands: commands,
 		Timeout:  timeout,
 		ResultCh: resultCh,
+		Priority: PriorityFrom(ctx),
+		ctx:      ctx,
+	}
+	if principal, ok := PrincipalFrom(ctx); ok {
+		task.UserID = principal.UserID
 	}
 
 	// Try to submit to queue
-	select {
-	case p.queue <- task:
-		// Task submitted successfully
-	case <-time.After(time.Duration(p.config.Pool.QueueTimeout) * time.Second):
-		return nil, NewQueueTimeoutError()
+	if err := p.enqueue(ctx, task); err != nil {
+		return nil, err
 	}
 
-	// Collect results
+	// Collect results until the caller goes away; the worker drops or
+	// interrupts the rest of the task then
+	wait := timeout + time.Duration(p.config.Pool.CommandTimeout)*time.Second
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
 	results := make([]*CommandResult, 0, len(commands))
 	for i := 0; i < len(commands); i++ {
 		select {
 		case result := <-resultCh:
 			results = append(results, result)
-		case <-time.After(timeout + time.Duration(p.config.Pool.CommandTimeout)*time.Second):
+			timer.Reset(wait)
+		case <-ctx.Done():
+			return results, ctx.Err()
+		case <-timer.C:
 			return results, NewCommandTimeoutError()
 		}
 	}
@@ -154,126 +251,341 @@ func (p *ConnectionPool) Execute(ctx context.Context, commands []string, timeout
 	return results, nil
 }
 
+// Authorize evaluates commands against the command policy for the principal
+// of ctx. Execute does this itself; callers queueing work in the background
+// use it to report denials and confirmations synchronously.
+func (p *ConnectionPool) Authorize(ctx context.Context, commands []string) error {
+	return checkPolicy(ctx, p.id, commands)
+}
+
+// enqueue waits up to the queue timeout for room in the queue
+func (p *ConnectionPool) enqueue(ctx context.Context, task *CommandTask) error {
+	if !p.IsRunning() {
+		return NewConnectionClosed()
+	}
+	return p.queue.push(ctx, task, time.Duration(p.config.Pool.QueueTimeout)*time.Second)
+}
+
 // worker processes commands from the queue
 func (p *ConnectionPool) worker(ctx context.Context, workerID int) {
-	defer p.wg.Done()
+	defer p.workers.Done()
 
 	for {
-		select {
-		case <-ctx.Done():
+		// Queue closed and drained, or pool context done
+		task, ok := p.queue.pop(ctx)
+		if !ok {
 			return
-		case task, ok := <-p.queue:
-			if !ok {
-				// Queue closed
-				return
-			}
-			if task == nil {
-				continue
-			}
+		}
 
-			// Acquire semaphore (wait for available connection slot)
-			p.semaphore <- struct{}{}
-			func() {
-				defer func() { <-p.semaphore }() // Release semaphore
-
-				// Execute commands
-				for _, cmd := range task.Commands {
-					result, err := p.executeCommand(ctx, cmd, task.Timeout)
-					if err != nil {
-						result = &CommandResult{
-							Command:   cmd,
-							Error:     err.Error(),
-							Success:   false,
-							Timestamp: time.Now().Unix(),
-						}
-					}
-					task.ResultCh <- result
-				}
-			}()
+		// Wait while an exclusive operation holds the device. A pool
+		// stopping meanwhile still answers the task it popped.
+		if err := p.gate.Acquire(ctx, 1); err != nil {
+			cancelRemaining(task, 0, err)
+			return
 		}
+
+		// Acquire semaphore (wait for available connection slot)
+		p.semaphore <- struct{}{}
+		func() {
+			defer func() { <-p.semaphore }() // Release semaphore
+			defer p.gate.Release(1)
+			p.runTask(ctx, task)
+		}()
 	}
 }
 
-// executeCommand executes a single command
-func (p *ConnectionPool) executeCommand(ctx context.Context, cmd string, timeout time.Duration) (*CommandResult, error) {
-	// Get or create connection
+// runTask executes all commands of a task on a single connection so that
+// session state (CLI mode, NETCONF locks) carries over between them
+func (p *ConnectionPool) runTask(ctx context.Context, task *CommandTask) {
+	if task.ctx != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		stop := context.AfterFunc(task.ctx, cancel)
+		defer stop()
+	}
+	if task.started != nil {
+		task.started()
+	}
+	p.observeQueueWait(task)
+
+	if ctx.Err() != nil {
+		cancelRemaining(task, 0, ctx.Err())
+		return
+	}
 	conn, err := p.getConnection(ctx)
 	if err != nil {
-		return nil, err
+		p.observeFailedTask(task, err)
+		for _, cmd := range task.Commands {
+			task.ResultCh <- &CommandResult{
+				Command:   cmd,
+				Error:     err.Error(),
+				Success:   false,
+				Timestamp: time.Now().Unix(),
+			}
+		}
+		return
 	}
+	defer func() {
+		if ctx.Err() != nil {
+			p.recycleConnection(conn)
+		}
+		p.releaseConnection(conn)
+	}()
 
-	// Execute command
+	for i, cmd := range task.Commands {
+		if ctx.Err() != nil {
+			cancelRemaining(task, i, ctx.Err())
+			return
+		}
+		result, err := p.executeCommand(ctx, conn, cmd, task.Timeout)
+		if err != nil {
+			result = &CommandResult{
+				Command:   cmd,
+				Error:     err.Error(),
+				Success:   false,
+				Timestamp: time.Now().Unix(),
+			}
+		}
+		task.ResultCh <- result
+	}
+}
+
+// cancelRemaining fails the commands of a task from index from on
+func cancelRemaining(task *CommandTask, from int, cause error) {
+	for _, cmd := range task.Commands[from:] {
+		task.ResultCh <- &CommandResult{
+			Command:   cmd,
+			Error:     "cancelled: " + cause.Error(),
+			Success:   false,
+			Timestamp: time.Now().Unix(),
+		}
+	}
+}
+
+// executeCommand executes a single command on a checked out connection
+func (p *ConnectionPool) executeCommand(ctx context.Context, conn *Connection, cmd string, timeout time.Duration) (*CommandResult, error) {
 	execCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
+	start := time.Now()
 	result, err := conn.Adapter.ExecuteCommand(execCtx, cmd)
+	p.observeCommand(result, err, time.Since(start))
 	if err != nil {
-		// Mark connection as potentially stale
-		atomic.StoreInt32(&conn.InUse, 0)
 		return nil, err
 	}
 
 	// Update last used time
-	conn.LastUsed = time.Now()
-	atomic.StoreInt32(&conn.InUse, 0)
+	conn.touch(time.Now())
 
 	return result, nil
 }
 
-// getConnection gets or creates a connection
+// WithConnection runs fn on a pooled connection outside the command queue,
+// holding a connection slot until fn returns. It is meant for protocol
+// specific operations (e.g. NETCONF RPCs) that need the adapter itself.
+func (p *ConnectionPool) WithConnection(ctx context.Context, fn func(conn *Connection) error) error {
+	conn, release, err := p.Checkout(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return fn(conn)
+}
+
+// Checkout takes a connection out of the pool for exclusive use, e.g. an
+// interactive terminal. The connection slot is held until release is called.
+func (p *ConnectionPool) Checkout(ctx context.Context) (*Connection, func(), error) {
+	if !p.IsRunning() {
+		return nil, nil, NewConnectionClosed()
+	}
+
+	if err := p.acquireGate(ctx, 1); err != nil {
+		return nil, nil, err
+	}
+	// The pool may have been drained while waiting
+	if !p.IsRunning() {
+		p.gate.Release(1)
+		return nil, nil, NewConnectionClosed()
+	}
+
+	select {
+	case p.semaphore <- struct{}{}:
+	case <-ctx.Done():
+		p.gate.Release(1)
+		return nil, nil, ctx.Err()
+	case <-time.After(time.Duration(p.config.Pool.QueueTimeout) * time.Second):
+		p.gate.Release(1)
+		return nil, nil, NewQueueTimeoutError()
+	}
+
+	conn, err := p.getConnection(ctx)
+	if err != nil {
+		<-p.semaphore
+		p.gate.Release(1)
+		return nil, nil, err
+	}
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			p.releaseConnection(conn)
+			<-p.semaphore
+			p.gate.Release(1)
+		})
+	}
+	return conn, release, nil
+}
+
+// Exclusive runs fn on a pooled connection while nothing else uses the
+// device: it waits for running commands, checkouts and terminals to finish
+// and holds back new ones until fn returns.
+func (p *ConnectionPool) Exclusive(ctx context.Context, fn func(conn *Connection) error) error {
+	if !p.IsRunning() {
+		return NewConnectionClosed()
+	}
+
+	if err := p.acquireGate(ctx, p.gateSize); err != nil {
+		return err
+	}
+	defer p.gate.Release(p.gateSize)
+	if !p.IsRunning() {
+		return NewConnectionClosed()
+	}
+
+	conn, err := p.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.releaseConnection(conn)
+
+	return fn(conn)
+}
+
+// acquireGate takes n units of the access gate, waiting at most the queue timeout
+func (p *ConnectionPool) acquireGate(ctx context.Context, n int64) error {
+	waitCtx, cancel := context.WithTimeout(ctx, time.Duration(p.config.Pool.QueueTimeout)*time.Second)
+	defer cancel()
+
+	if err := p.gate.Acquire(waitCtx, n); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return NewQueueTimeoutError()
+	}
+	return nil
+}
+
+// releaseConnection returns a checked out connection to the pool
+func (p *ConnectionPool) releaseConnection(conn *Connection) {
+	conn.touch(time.Now())
+	conn.release()
+}
+
+// recycleConnection removes a connection an interrupted command left
+// unusable, so that the next task opens a fresh one
+func (p *ConnectionPool) recycleConnection(conn *Connection) {
+	if !conn.Adapter.IsConnected() {
+		p.removeConnection(conn)
+	}
+}
+
+// getConnection checks out an idle connection, or opens a new one while the
+// pool is below its limit. p.mu is only held to pick a connection or reserve
+// a slot for a new one; probing and dialing happen outside of it, so that a
+// slow or unreachable device does not block the other callers or the status.
 func (p *ConnectionPool) getConnection(ctx context.Context) (*Connection, error) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	// Try to find an available connection
+	var idle *Connection
 	for _, conn := range p.connections {
 		if atomic.CompareAndSwapInt32(&conn.InUse, 0, 1) {
-			// Verify connection is still alive
-			if conn.Adapter.IsConnected() {
-				return conn, nil
-			}
-			// Connection is dead, recreate it
-			p.recreateConnection(ctx, conn)
-			return conn, nil
+			idle = conn
+			break
 		}
 	}
+	reserved := idle == nil && len(p.connections)+p.dialing < p.config.Pool.MaxConnections
+	if reserved {
+		p.dialing++
+	}
+	p.mu.Unlock()
 
-	// No available connection, create a new one if under limit
-	if len(p.connections) < p.config.Pool.MaxConnections {
-		conn := &Connection{
-			ID:        fmt.Sprintf("conn-%d", time.Now().UnixNano()),
-			Adapter:   p.adapter,
-			CreatedAt: time.Now(),
-			LastUsed:  time.Now(),
+	if idle != nil {
+		// Verify connection is still alive
+		if err := p.checkConnection(ctx, idle); err == nil {
+			return idle, nil
 		}
-
-		// Establish connection
-		connCtx, cancel := context.WithTimeout(ctx, time.Duration(p.config.Connection.Timeout)*time.Second)
-		defer cancel()
-
-		if err := conn.Adapter.Connect(connCtx, &p.config.Connection); err != nil {
+		// Connection is dead, recreate it
+		if err := p.recreateConnection(ctx, idle); err != nil {
+			idle.release()
 			return nil, NewConnectionError(err)
 		}
+		return idle, nil
+	}
+	if !reserved {
+		// Wait for an available connection
+		return nil, NewQueueFullError()
+	}
+	return p.openConnection(ctx)
+}
+
+// openConnection dials a new connection in a slot reserved by getConnection
+// and adds it to the pool checked out. A connection established after the
+// pool shut down is closed again.
+func (p *ConnectionPool) openConnection(ctx context.Context) (*Connection, error) {
+	conn := &Connection{
+		ID:        fmt.Sprintf("conn-%d", time.Now().UnixNano()),
+		Adapter:   p.newAdapter(),
+		CreatedAt: time.Now(),
+		InUse:     1,
+	}
+	conn.touch(conn.CreatedAt)
+
+	connCtx, cancel := context.WithTimeout(ctx, time.Duration(p.config.Connection.Timeout)*time.Second)
+	defer cancel()
+	err := conn.Adapter.Connect(connCtx, &p.config.Connection)
+	p.observeConnect(err)
 
-		atomic.StoreInt32(&conn.InUse, 1)
+	p.mu.Lock()
+	p.dialing--
+	closed := p.closed
+	if err == nil && !closed {
 		p.connections[conn.ID] = conn
-		return conn, nil
 	}
+	p.mu.Unlock()
 
-	// Wait for an available connection
-	return nil, NewQueueFullError()
+	if err != nil {
+		return nil, NewConnectionError(err)
+	}
+	if closed {
+		_ = conn.Adapter.Disconnect(context.Background())
+		return nil, NewConnectionError(fmt.Errorf("connection pool stopped"))
+	}
+	return conn, nil
 }
 
-// recreateConnection recreates a stale connection
-func (p *ConnectionPool) recreateConnection(ctx context.Context, conn *Connection) {
+// recreateConnection reconnects a dead connection the caller has checked
+// out. Failures are counted and back off the maintainer's next attempt.
+func (p *ConnectionPool) recreateConnection(ctx context.Context, conn *Connection) error {
 	conn.Adapter.Disconnect(context.Background())
 
 	connCtx, cancel := context.WithTimeout(ctx, time.Duration(p.config.Connection.Timeout)*time.Second)
 	defer cancel()
 
-	if err := conn.Adapter.Connect(connCtx, &p.config.Connection); err != nil {
-		fmt.Printf("Failed to recreate connection %s: %v\n", conn.ID, err)
+	err := conn.Adapter.Connect(connCtx, &p.config.Connection)
+	p.observeConnect(err)
+	conn.health.record(err, time.Now())
+	if err == nil {
+		conn.CreatedAt = time.Now()
 	}
+	return err
+}
+
+// Config returns the device configuration used by the pool
+func (p *ConnectionPool) Config() *DeviceConfig {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.config
 }
 
 // IsRunning returns whether the pool is running
@@ -297,22 +609,11 @@ func (p *ConnectionPool) GetStatus() map[string]interface{} {
 		"running":            p.IsRunning(),
 		"total_connections":  len(p.connections),
 		"active_connections": activeConnections,
-		"queue_size":         len(p.queue),
+		"queue_size":         p.queue.len(),
+		"queued_tasks":       p.queue.snapshot(),
+		"wait_stats":         p.queue.waitStats(),
 		"max_connections":    p.config.Pool.MaxConnections,
 		"max_queue_size":     p.config.Pool.MaxQueueSize,
+		"connections":        p.connectionHealth(),
 	}
 }
-
-// ReloadConfig reloads the configuration
-func (p *ConnectionPool) ReloadConfig(newConfig *DeviceConfig) error {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	// Update config
-	p.config = newConfig
-
-	// Recreate adapter if protocol changed
-	// (For simplicity, we just update the config, actual reconnection happens on next use)
-
-	return nil
-}
@@ -0,0 +1,324 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExecuteCancel(t *testing.T) {
+	pool := newJobTestPool(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	results, err := pool.Execute(ctx, []string{"show a", "wait", "show b"}, 10*time.Second)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("Execute did not return on cancellation")
+	}
+	if len(results) != 1 || !results[0].Success {
+		t.Errorf("results = %+v, want the first command only", results)
+	}
+
+	// the interrupted task releases its worker and connection
+	results, err = pool.Execute(context.Background(), []string{"show c"}, time.Second)
+	if err != nil || len(results) != 1 || !results[0].Success {
+		t.Fatalf("after cancel: results = %+v, err = %v", results, err)
+	}
+}
+
+// fakeProtocol is registered for the concurrency tests
+const fakeProtocol ProtocolType = "fake"
+
+// fakeAdapter is an independent fake connection. Commands named "parallel"
+// wait until want commands of the load have run at the same time.
+type fakeAdapter struct {
+	load      *fakeLoad
+	connected atomic.Bool
+	running   atomic.Int32 // commands running on this adapter
+}
+
+// fakeLoad tracks the commands running on all fake adapters of a test
+type fakeLoad struct {
+	want     int32
+	active   atomic.Int32
+	max      atomic.Int32
+	overlaps atomic.Int32 // commands that found their adapter busy
+	reached  atomic.Bool  // want commands ran at the same time
+	mu       sync.Mutex
+	adapters []*fakeAdapter
+}
+
+func (l *fakeLoad) factory() ProtocolAdapter {
+	a := &fakeAdapter{load: l}
+	l.mu.Lock()
+	l.adapters = append(l.adapters, a)
+	l.mu.Unlock()
+	return a
+}
+
+func (a *fakeAdapter) Connect(ctx context.Context, config *ConnectionConfig) error {
+	a.connected.Store(true)
+	return nil
+}
+
+func (a *fakeAdapter) Disconnect(ctx context.Context) error {
+	a.connected.Store(false)
+	return nil
+}
+
+func (a *fakeAdapter) IsConnected() bool          { return a.connected.Load() }
+func (a *fakeAdapter) ProtocolType() ProtocolType { return fakeProtocol }
+
+func (a *fakeAdapter) ExecuteCommand(ctx context.Context, cmd string) (*CommandResult, error) {
+	if a.running.Add(1) > 1 {
+		a.load.overlaps.Add(1)
+	}
+	defer a.running.Add(-1)
+
+	n := a.load.active.Add(1)
+	defer a.load.active.Add(-1)
+	for {
+		m := a.load.max.Load()
+		if n <= m || a.load.max.CompareAndSwap(m, n) {
+			break
+		}
+	}
+
+	if n >= a.load.want {
+		a.load.reached.Store(true)
+	}
+
+	if cmd == "parallel" {
+		for !a.load.reached.Load() {
+			select {
+			case <-ctx.Done():
+				return nil, NewCommandTimeoutError()
+			case <-time.After(time.Millisecond):
+			}
+		}
+	} else {
+		time.Sleep(time.Millisecond)
+	}
+	return &CommandResult{Command: cmd, Success: true, Timestamp: time.Now().Unix()}, nil
+}
+
+// newFakePool starts a pool of max connections on fake adapters
+func newFakePool(t *testing.T, max int) (*ConnectionPool, *fakeLoad) {
+	load := &fakeLoad{want: int32(max)}
+	if err := RegisterAdapter(fakeProtocol, load.factory); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &DeviceConfig{Connection: ConnectionConfig{Protocol: string(fakeProtocol)}}
+	applyDefaults(cfg)
+	cfg.Pool.MaxConnections = max
+	cfg.Pool.MinConnections = 1
+	pool, err := NewConnectionPool(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Stop() })
+	return pool, load
+}
+
+func TestPoolParallelCommands(t *testing.T) {
+	const max = 4
+	pool, load := newFakePool(t, max)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, max)
+	for i := 0; i < max; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := pool.Execute(context.Background(), []string{"parallel"}, 2*time.Second)
+			if err == nil && !results[0].Success {
+				err = errors.New(results[0].Error)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("command did not run alongside the others: %v", err)
+		}
+	}
+
+	if got := load.max.Load(); got != max {
+		t.Errorf("max parallel commands = %d, want %d", got, max)
+	}
+	if n := load.overlaps.Load(); n != 0 {
+		t.Errorf("%d commands shared an adapter with a running one", n)
+	}
+	load.mu.Lock()
+	adapters := len(load.adapters)
+	load.mu.Unlock()
+	if adapters != max {
+		t.Errorf("adapters = %d, want one per connection (%d)", adapters, max)
+	}
+}
+
+func TestPoolAdaptersIndependent(t *testing.T) {
+	pool, load := newFakePool(t, 2)
+	first, releaseFirst, err := pool.Checkout(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, releaseSecond, err := pool.Checkout(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Adapter == second.Adapter {
+		t.Fatal("connections share an adapter")
+	}
+
+	// closing one connection leaves the other connected
+	_ = first.Adapter.Disconnect(context.Background())
+	if !second.Adapter.IsConnected() {
+		t.Error("disconnecting one connection closed the other")
+	}
+	releaseFirst()
+	releaseSecond()
+
+	// the dead connection is reconnected on its next use
+	results, err := pool.Execute(context.Background(), []string{"show a", "show b"}, time.Second)
+	if err != nil || len(results) != 2 {
+		t.Fatalf("results = %+v, err = %v", results, err)
+	}
+	load.mu.Lock()
+	defer load.mu.Unlock()
+	if len(load.adapters) != 2 {
+		t.Errorf("adapters = %d, want 2", len(load.adapters))
+	}
+}
+
+func TestPoolConcurrentLoad(t *testing.T) {
+	const max = 3
+	pool, load := newFakePool(t, max)
+
+	var wg sync.WaitGroup
+	var failed atomic.Int32
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%4 == 0 {
+				// checkouts share the connection limit with queued commands
+				conn, release, err := pool.Checkout(context.Background())
+				if err != nil {
+					failed.Add(1)
+					return
+				}
+				defer release()
+				if _, err := conn.Adapter.ExecuteCommand(context.Background(), "show c"); err != nil {
+					failed.Add(1)
+				}
+				return
+			}
+			results, err := pool.Execute(context.Background(), []string{"show a", "show b"}, time.Second)
+			if err != nil || len(results) != 2 || !results[0].Success || !results[1].Success {
+				failed.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := failed.Load(); n != 0 {
+		t.Errorf("%d requests failed", n)
+	}
+	if got := load.max.Load(); got > max {
+		t.Errorf("max parallel commands = %d, above the limit %d", got, max)
+	}
+	if n := load.overlaps.Load(); n != 0 {
+		t.Errorf("%d commands shared an adapter with a running one", n)
+	}
+}
+
+func TestPoolStatusDuringCommands(t *testing.T) {
+	pool, _ := newFakePool(t, 2)
+
+	// the status is read from snapshots, not from connections in use
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				pool.GetStatus()
+			}
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		if _, err := pool.Execute(context.Background(), []string{"show clock"}, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	<-done
+
+	conns, _ := pool.GetStatus()["connections"].([]ConnectionHealth)
+	if len(conns) == 0 || !conns[0].Connected || conns[0].LastUsed == 0 {
+		t.Errorf("connections = %+v", conns)
+	}
+}
+
+func TestWorkerAnswersTaskWhenStopped(t *testing.T) {
+	load := &fakeLoad{want: 1}
+	if err := RegisterAdapter(fakeProtocol, load.factory); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &DeviceConfig{Connection: ConnectionConfig{Protocol: string(fakeProtocol)}}
+	applyDefaults(cfg)
+	cfg.Pool.MaxConnections = 1
+	pool, err := NewConnectionPool(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := pool.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Stop() })
+
+	// an exclusive operation holds the device while the task is popped
+	held := make(chan struct{})
+	release := make(chan struct{})
+	go pool.Exclusive(context.Background(), func(*Connection) error {
+		close(held)
+		<-release
+		return nil
+	})
+	defer close(release)
+	<-held
+
+	done := make(chan []*CommandResult)
+	go func() {
+		results, _ := pool.Execute(context.Background(), []string{"show a", "show b"}, time.Second)
+		done <- results
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case results := <-done:
+		if len(results) != 2 || results[0].Success || results[1].Success {
+			t.Errorf("results = %+v, want both commands cancelled", results)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the task popped by a stopping worker was not answered")
+	}
+}
@@ -0,0 +1,247 @@
+package device
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// GenericProfile is the profile of devices without vendor
+const GenericProfile = "generic"
+
+// DeviceProfile describes how to drive the CLI of a kind of device. Profiles
+// are selected by the vendor of the connection; devices of vendors without a
+// profile use the generic one. Patterns match a single line: the prompt
+// patterns are applied to the line the cursor is on.
+type DeviceProfile struct {
+	Name             string   `yaml:"name" mapstructure:"name"`
+	Base             string   `yaml:"base" mapstructure:"base"`                           // profile whose settings fill the unset fields
+	Prompt           string   `yaml:"prompt" mapstructure:"prompt"`                       // CLI prompt
+	PrivilegedPrompt string   `yaml:"privileged_prompt" mapstructure:"privileged_prompt"` // prompt in privileged mode, EnableCommand runs when the prompt does not match
+	UsernamePrompt   string   `yaml:"username_prompt" mapstructure:"username_prompt"`
+	PasswordPrompt   string   `yaml:"password_prompt" mapstructure:"password_prompt"`
+	MorePrompt       string   `yaml:"more_prompt" mapstructure:"more_prompt"` // pager prompt, answered with a space
+	EnableCommand    string   `yaml:"enable_command" mapstructure:"enable_command"`
+	DisablePaging    []string `yaml:"disable_paging" mapstructure:"disable_paging"` // commands run once after login
+	ErrorPatterns    []string `yaml:"error_patterns" mapstructure:"error_patterns"` // output lines that mean the device rejected the command
+	LineEnding       string   `yaml:"line_ending" mapstructure:"line_ending"`       // sent after commands, "\r\n" for Telnet and "\n" for SSH when empty
+	Shell            bool     `yaml:"shell" mapstructure:"shell"`                   // run SSH commands in an interactive shell instead of exec channels, implied by EnableCommand and DisablePaging
+
+	prompt, privileged, username, password, more *regexp.Regexp
+	errors                                       []*regexp.Regexp
+}
+
+// builtinProfiles are registered at startup, custom profiles may replace them
+var builtinProfiles = []DeviceProfile{
+	{
+		Name:           GenericProfile,
+		Prompt:         `^[\w.\-@()/:~\[\]<]{1,64}[#>$%\]]\s*$`,
+		UsernamePrompt: `(?i)(user ?name|login):\s*$`,
+		PasswordPrompt: `(?i)password:\s*$`,
+		MorePrompt:     `(?i)-+ ?\(?more\b.*$`,
+		ErrorPatterns: []string{
+			`^\s*% ?(Invalid|Incomplete|Ambiguous|Unrecognized|Unknown|Error)`,
+			`^\s*Error:`,
+		},
+	},
+	{
+		Name:             "cisco_ios",
+		Base:             GenericProfile,
+		Prompt:           `^[\w.\-@()/:]{1,63}[>#]\s*$`,
+		PrivilegedPrompt: `#\s*$`,
+		EnableCommand:    "enable",
+		DisablePaging:    []string{"terminal length 0", "terminal width 511"},
+	},
+	{
+		Name:          "cisco_nxos",
+		Base:          GenericProfile,
+		Prompt:        `^[\w.\-@()/:]{1,63}[>#]\s*$`,
+		DisablePaging: []string{"terminal length 0", "terminal width 511"},
+		ErrorPatterns: []string{
+			`^\s*% ?(Invalid|Incomplete|Ambiguous|Permission denied)`,
+			`^\s*Syntax error`,
+		},
+	},
+	{
+		Name:             "arista_eos",
+		Base:             GenericProfile,
+		Prompt:           `^[\w.\-@()/:]{1,63}[>#]\s*$`,
+		PrivilegedPrompt: `#\s*$`,
+		EnableCommand:    "enable",
+		DisablePaging:    []string{"terminal length 0", "terminal width 32767"},
+	},
+	{
+		Name:          "huawei_vrp",
+		Base:          GenericProfile,
+		Prompt:        `^(<[\w.\-@/:~]+>|\[[~*]?[\w.\-@/:~]+\])\s*$`,
+		MorePrompt:    `-+ ?More ?-+`,
+		DisablePaging: []string{"screen-length 0 temporary"},
+		ErrorPatterns: []string{
+			`^\s*Error:`,
+			`Unrecognized command found`,
+			`Incomplete command found`,
+			`Wrong parameter found`,
+			`Too many parameters found`,
+		},
+		Shell: true,
+	},
+	{
+		Name:          "h3c_comware",
+		Base:          "huawei_vrp",
+		DisablePaging: []string{"screen-length disable"},
+	},
+	{
+		Name:          "juniper_junos",
+		Base:          GenericProfile,
+		Prompt:        `^[\w.\-@()/:]{1,63}[>#%]\s*$`,
+		DisablePaging: []string{"set cli screen-length 0", "set cli screen-width 0"},
+		ErrorPatterns: []string{
+			`^\s*(unknown command|syntax error|error:)`,
+		},
+	},
+}
+
+// profiles holds the registered device profiles by name
+var profiles = struct {
+	sync.RWMutex
+	byName map[string]*DeviceProfile
+}{byName: make(map[string]*DeviceProfile)}
+
+func init() {
+	for i := range builtinProfiles {
+		if err := RegisterProfile(builtinProfiles[i]); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterProfile validates a profile and registers it under its name,
+// replacing a profile of the same name. Fields left unset are taken from the
+// base profile, which has to be registered first.
+func RegisterProfile(p DeviceProfile) error {
+	p.Name = strings.ToLower(strings.TrimSpace(p.Name))
+	if p.Name == "" {
+		return NewInvalidConfigError("device profile without name")
+	}
+	if p.Base != "" {
+		base, ok := lookupProfile(p.Base)
+		if !ok {
+			return NewInvalidConfigError(fmt.Sprintf("device profile %s: unknown base profile %q", p.Name, p.Base))
+		}
+		p.inherit(base)
+	}
+	if p.Prompt == "" {
+		return NewInvalidConfigError(fmt.Sprintf("device profile %s: prompt is required", p.Name))
+	}
+	if err := p.compile(); err != nil {
+		return NewInvalidConfigError(fmt.Sprintf("device profile %s: %v", p.Name, err))
+	}
+
+	profiles.Lock()
+	defer profiles.Unlock()
+	profiles.byName[p.Name] = &p
+	return nil
+}
+
+// LookupProfile returns the profile of a vendor, the generic profile when the
+// vendor has none
+func LookupProfile(vendor string) *DeviceProfile {
+	if p, ok := lookupProfile(vendor); ok {
+		return p
+	}
+	p, _ := lookupProfile(GenericProfile)
+	return p
+}
+
+func lookupProfile(name string) (*DeviceProfile, bool) {
+	profiles.RLock()
+	defer profiles.RUnlock()
+	p, ok := profiles.byName[strings.ToLower(name)]
+	return p, ok
+}
+
+// ProfileNames returns the names of the registered profiles
+func ProfileNames() []string {
+	profiles.RLock()
+	defer profiles.RUnlock()
+	names := make([]string, 0, len(profiles.byName))
+	for name := range profiles.byName {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (p *DeviceProfile) inherit(base *DeviceProfile) {
+	fill := func(v *string, b string) {
+		if *v == "" {
+			*v = b
+		}
+	}
+	fill(&p.Prompt, base.Prompt)
+	fill(&p.PrivilegedPrompt, base.PrivilegedPrompt)
+	fill(&p.UsernamePrompt, base.UsernamePrompt)
+	fill(&p.PasswordPrompt, base.PasswordPrompt)
+	fill(&p.MorePrompt, base.MorePrompt)
+	fill(&p.EnableCommand, base.EnableCommand)
+	fill(&p.LineEnding, base.LineEnding)
+	if p.DisablePaging == nil {
+		p.DisablePaging = base.DisablePaging
+	}
+	if p.ErrorPatterns == nil {
+		p.ErrorPatterns = base.ErrorPatterns
+	}
+	p.Shell = p.Shell || base.Shell
+}
+
+func (p *DeviceProfile) compile() error {
+	var err error
+	compile := func(field, pattern string) *regexp.Regexp {
+		if pattern == "" || err != nil {
+			return nil
+		}
+		re, cerr := regexp.Compile(pattern)
+		if cerr != nil {
+			err = fmt.Errorf("invalid %s %q: %v", field, pattern, cerr)
+		}
+		return re
+	}
+	p.prompt = compile("prompt", p.Prompt)
+	p.privileged = compile("privileged_prompt", p.PrivilegedPrompt)
+	p.username = compile("username_prompt", p.UsernamePrompt)
+	p.password = compile("password_prompt", p.PasswordPrompt)
+	p.more = compile("more_prompt", p.MorePrompt)
+	p.errors = make([]*regexp.Regexp, 0, len(p.ErrorPatterns))
+	for _, pattern := range p.ErrorPatterns {
+		p.errors = append(p.errors, compile("error pattern", pattern))
+	}
+	return err
+}
+
+// CheckOutput returns an error naming the first output line that matches one
+// of the error patterns of the profile
+func (p *DeviceProfile) CheckOutput(output string) error {
+	for _, line := range strings.Split(output, "\n") {
+		for _, re := range p.errors {
+			if re.MatchString(line) {
+				return fmt.Errorf("device rejected the command: %s", strings.TrimSpace(line))
+			}
+		}
+	}
+	return nil
+}
+
+// usesShell reports whether SSH commands run in an interactive shell. Exec
+// channels start a new CLI session for every command, so profiles that enter
+// privileged mode or disable paging need the shell for that to persist.
+func (p *DeviceProfile) usesShell() bool {
+	return p.Shell || p.EnableCommand != "" || len(p.DisablePaging) > 0
+}
+
+// lineEnding returns the line ending sent after commands
+func (p *DeviceProfile) lineEnding(def string) string {
+	if p.LineEnding != "" {
+		return p.LineEnding
+	}
+	return def
+}
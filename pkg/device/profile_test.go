@@ -0,0 +1,293 @@
+package device
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeIOS serves a single Telnet session of an IOS like CLI that asks for
+// credentials, requires enable and pages output until paging is disabled
+func fakeIOS(t *testing.T) (string, int, <-chan []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan []string, 1)
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		received <- serveIOS(conn, true)
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, received
+}
+
+// fakeSSHIOS serves the IOS like CLI in the shell of a single SSH session
+// and rejects exec requests, which would not keep privileged mode or paging
+func fakeSSHIOS(t *testing.T) (*ConnectionConfig, <-chan []string) {
+	hostKey, _ := newTestSigner(t)
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if c.User() == "admin" && string(password) == "pass" {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	}
+	serverConfig.AddHostKey(hostKey)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan []string, 1)
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		sconn, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		defer sconn.Close()
+		go ssh.DiscardRequests(reqs)
+		for newCh := range chans {
+			if newCh.ChannelType() != "session" {
+				newCh.Reject(ssh.UnknownChannelType, "session only")
+				continue
+			}
+			ch, requests, err := newCh.Accept()
+			if err != nil {
+				return
+			}
+			for req := range requests {
+				switch req.Type {
+				case "pty-req":
+					req.Reply(true, nil)
+				case "shell":
+					req.Reply(true, nil)
+					go func() {
+						received <- serveIOS(ch, false)
+						ch.Close()
+					}()
+				default:
+					req.Reply(false, nil)
+				}
+			}
+		}
+	}()
+	return &ConnectionConfig{
+		Host:           "127.0.0.1",
+		Port:           ln.Addr().(*net.TCPAddr).Port,
+		Vendor:         "cisco_ios",
+		Username:       "admin",
+		Password:       "pass",
+		EnablePassword: "secret",
+		Timeout:        5,
+		KnownHostsFile: filepath.Join(t.TempDir(), "known_hosts"),
+	}, received
+}
+
+// serveIOS runs the IOS like CLI on rw until the client goes away and
+// returns the lines it received. With login it asks for credentials first.
+func serveIOS(rw io.ReadWriter, login bool) (lines []string) {
+	r := bufio.NewReader(rw)
+	readLine := func() (string, bool) {
+		line, err := r.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		lines = append(lines, line)
+		return line, err == nil
+	}
+
+	if login {
+		fmt.Fprint(rw, "\r\nUser Access Verification\r\n\r\nUsername: ")
+		if user, _ := readLine(); user != "admin" {
+			return
+		}
+		fmt.Fprint(rw, "Password: ")
+		readLine()
+	}
+	prompt, paging := "sw1>", true
+	fmt.Fprint(rw, "\r\n"+prompt)
+	for {
+		cmd, ok := readLine()
+		if !ok {
+			return
+		}
+		fmt.Fprint(rw, cmd+"\r\n")
+		switch cmd {
+		case "enable":
+			fmt.Fprint(rw, "Password: ")
+			if secret, _ := readLine(); secret == "secret" {
+				prompt = "sw1#"
+			}
+			fmt.Fprint(rw, "\r\n")
+		case "terminal length 0":
+			paging = false
+		case "terminal width 511":
+		case "show clock":
+			if paging {
+				fmt.Fprint(rw, "page 1\r\n --More-- ")
+				if b, _ := r.ReadByte(); b != ' ' {
+					return
+				}
+				fmt.Fprint(rw, "\r         \r")
+			}
+			fmt.Fprint(rw, "*10:00:00.000 UTC Mon Oct 12 2026\r\n")
+		default:
+			fmt.Fprint(rw, "                ^\r\n% Invalid input detected at '^' marker.\r\n\r\n")
+		}
+		fmt.Fprint(rw, prompt)
+	}
+}
+
+func TestTelnetAdapterProfile(t *testing.T) {
+	host, port, received := fakeIOS(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a := NewTelnetAdapter()
+	err := a.Connect(ctx, &ConnectionConfig{
+		Host: host, Port: port, Vendor: "cisco_ios",
+		Username: "admin", Password: "pass", EnablePassword: "secret", Timeout: 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := a.ExecuteCommand(ctx, "show clock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Success || r.Output != "*10:00:00.000 UTC Mon Oct 12 2026" {
+		t.Errorf("show clock = %+v", r)
+	}
+
+	r, err = a.ExecuteCommand(ctx, "show clok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Success || !strings.Contains(r.Error, "% Invalid input") {
+		t.Errorf("rejected command = %+v, want failure", r)
+	}
+
+	a.Disconnect(ctx)
+	lines := <-received
+	want := []string{"admin", "pass", "enable", "secret", "terminal length 0", "terminal width 511", "show clock", "show clok"}
+	if strings.Join(lines[:len(want)], "|") != strings.Join(want, "|") {
+		t.Errorf("device received %q, want %q", lines, want)
+	}
+}
+
+func TestSSHAdapterProfile(t *testing.T) {
+	config, received := fakeSSHIOS(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the profile does not set shell, enable and paging need one anyway
+	a := NewSSHAdapter()
+	if err := a.Connect(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	r, err := a.ExecuteCommand(ctx, "show clock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Success || r.Output != "*10:00:00.000 UTC Mon Oct 12 2026" {
+		t.Errorf("show clock = %+v", r)
+	}
+
+	a.Disconnect(ctx)
+	lines := <-received
+	want := []string{"enable", "secret", "terminal length 0", "terminal width 511", "show clock"}
+	if strings.Join(lines[:len(want)], "|") != strings.Join(want, "|") {
+		t.Errorf("device received %q, want %q", lines, want)
+	}
+}
+
+func TestCLISessionPager(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	s := newCLISession(client, client, LookupProfile("cisco_ios"), "\n", time.Second)
+	defer s.close()
+
+	go func() {
+		r := bufio.NewReader(server)
+		r.ReadString('\n')
+		fmt.Fprint(server, "show vlan\r\nline 1\r\n --More-- ")
+		for i := 2; i <= 3; i++ {
+			if b, _ := r.ReadByte(); b != ' ' {
+				return
+			}
+			fmt.Fprint(server, "\x1b[10D\x1b[Kline "+strconv.Itoa(i)+"\r\n")
+			if i < 3 {
+				fmt.Fprint(server, " --More-- ")
+			}
+		}
+		fmt.Fprint(server, "sw1#")
+	}()
+
+	out, err := s.run(context.Background(), "show vlan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "line 1\nline 2\nline 3" {
+		t.Errorf("run = %q", out)
+	}
+}
+
+func TestRegisterProfile(t *testing.T) {
+	defer func() {
+		profiles.Lock()
+		delete(profiles.byName, "test_vrp")
+		profiles.Unlock()
+	}()
+
+	err := RegisterProfile(DeviceProfile{Name: "Test_VRP", Base: "huawei_vrp", DisablePaging: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := LookupProfile("test_vrp")
+	if !p.Shell || len(p.DisablePaging) != 0 || !p.prompt.MatchString("<HUAWEI>") {
+		t.Errorf("profile does not inherit from its base: %+v", p)
+	}
+	if err := p.CheckOutput("Error: Unrecognized command found at '^' position."); err == nil {
+		t.Error("expected error output to be detected")
+	}
+	if LookupProfile("unknown").Name != GenericProfile {
+		t.Error("unknown vendors must use the generic profile")
+	}
+
+	invalid := []DeviceProfile{
+		{Name: ""},
+		{Name: "x", Base: "missing"},
+		{Name: "x"},
+		{Name: "x", Prompt: "("},
+		{Name: "x", Prompt: "#$", ErrorPatterns: []string{"["}},
+	}
+	for _, p := range invalid {
+		if err := RegisterProfile(p); err == nil {
+			t.Errorf("RegisterProfile(%+v) succeeded", p)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultDeviceID is the id of the device seeded from the settings file.
+// Requests that do not name a device are routed to it.
+const DefaultDeviceID = 1
+
+// Registry holds one connection pool per managed device
+type Registry struct {
+	pools map[int]*ConnectionPool
+	mu    sync.RWMutex
+}
+
+// NewRegistry creates an empty device registry
+func NewRegistry() *Registry {
+	return &Registry{
+		pools: make(map[int]*ConnectionPool),
+	}
+}
+
+// Register validates cfg, starts a pool for the device and replaces any pool
+// previously registered under the same id
+func (r *Registry) Register(ctx context.Context, id int, cfg *DeviceConfig) error {
+	pool, err := r.start(ctx, id, cfg)
+	if err != nil {
+		return err
+	}
+
+	if old := r.swap(id, pool); old != nil {
+		return old.Stop()
+	}
+	return nil
+}
+
+// Reload replaces the pool of a device like Register, but lets the previous
+// pool finish its queued tasks, checkouts and terminals for up to drain
+// before it is stopped. New work goes to the new pool right away. Reload
+// reports whether the previous pool drained in time; on error it keeps
+// serving the device.
+func (r *Registry) Reload(ctx context.Context, id int, cfg *DeviceConfig, drain time.Duration) (bool, error) {
+	pool, err := r.start(ctx, id, cfg)
+	if err != nil {
+		return false, err
+	}
+
+	if old := r.swap(id, pool); old != nil {
+		return old.Drain(drain), nil
+	}
+	return true, nil
+}
+
+// start validates cfg and starts a pool for the device
+func (r *Registry) start(ctx context.Context, id int, cfg *DeviceConfig) (*ConnectionPool, error) {
+	if id <= 0 {
+		return nil, NewInvalidConfigError(fmt.Sprintf("invalid device id %d", id))
+	}
+
+	if _, err := NewConfigManager(cfg).LoadConfig(); err != nil {
+		return nil, err
+	}
+
+	pool, err := NewConnectionPool(cfg)
+	if err != nil {
+		return nil, err
+	}
+	pool.id = id
+	if err := pool.Start(ctx); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// swap registers pool under id and returns the pool it replaces
+func (r *Registry) swap(id int, pool *ConnectionPool) *ConnectionPool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.pools[id]
+	r.pools[id] = pool
+	return old
+}
+
+// Unregister stops and removes the pool of a device
+func (r *Registry) Unregister(id int) error {
+	r.mu.Lock()
+	pool, ok := r.pools[id]
+	delete(r.pools, id)
+	r.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return pool.Stop()
+}
+
+// Get returns the pool of a device. id 0 selects the default device.
+func (r *Registry) Get(id int) (*ConnectionPool, error) {
+	if id == 0 {
+		id = DefaultDeviceID
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pool, ok := r.pools[id]
+	if !ok {
+		return nil, NewDeviceNotFoundError(id)
+	}
+	return pool, nil
+}
+
+// IDs returns the registered device ids in ascending order
+func (r *Registry) IDs() []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := make([]int, 0, len(r.pools))
+	for id := range r.pools {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// StopAll stops every registered pool
+func (r *Registry) StopAll() error {
+	r.mu.Lock()
+	pools := r.pools
+	r.pools = make(map[int]*ConnectionPool)
+	r.mu.Unlock()
+
+	var firstErr error
+	for _, pool := range pools {
+		if err := pool.Stop(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,335 @@
+package device
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"go.uber.org/zap"
+
+	"opt-switch/config"
+)
+
+// ReloadConfig holds the hot reload settings
+type ReloadConfig struct {
+	WatchInterval int `yaml:"watch_interval" mapstructure:"watch_interval"` // seconds between checks of the settings file, 0 disables
+	DrainTimeout  int `yaml:"drain_timeout" mapstructure:"drain_timeout"`   // seconds a replaced pool may finish its work
+}
+
+// Reload sources
+const (
+	ReloadSourceFile = "file" // the settings file changed
+	ReloadSourceAPI  = "api"  // PUT /api/v1/device/config
+)
+
+// ConfigChange is a setting changed by a reload. Secrets are masked.
+type ConfigChange struct {
+	Field string `json:"field"` // e.g. pool.max_connections
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// ReloadResult reports the outcome of a configuration reload
+type ReloadResult struct {
+	Source         string         `json:"source"`
+	Time           time.Time      `json:"time"`
+	Changes        []ConfigChange `json:"changes"`
+	Devices        []int          `json:"devices"`          // devices whose pool was rebuilt
+	Forced         []int          `json:"forced,omitempty"` // devices whose previous pool was stopped before its work finished
+	LoggerReopened bool           `json:"loggerReopened"`
+	Errors         map[int]string `json:"errors,omitempty"` // devices that kept their previous pool
+}
+
+var (
+	reloadMu   sync.Mutex
+	lastReload atomic.Pointer[ReloadResult]
+)
+
+// secretFields are masked in the reported changes
+var secretFields = map[string]bool{
+	"password":               true,
+	"enable_password":        true,
+	"private_key":            true,
+	"private_key_passphrase": true,
+	"key":                    true, // log.integrity.key
+}
+
+// ReloadSettings applies the device block of the settings file without a
+// restart. The configuration is validated first and nothing is changed when
+// it is invalid. Then
+//   - the custom profiles are registered again,
+//   - the execution logger is reopened when the log settings changed,
+//   - the pool of every device whose settings changed is rebuilt, the
+//     settings file device with its new connection and the inventory devices
+//     with the new shared settings. The previous pool finishes its queued
+//     tasks and terminals for up to reload.drain_timeout before it stops.
+//
+// Devices whose new pool does not start keep the previous one and are
+// reported in Errors. Removed profiles stay registered and a device removed
+// from the settings file keeps running until the next restart.
+func ReloadSettings(s config.DeviceConfig, source string) (*ReloadResult, error) {
+	if !IsInitialized() {
+		return nil, NewDeviceNotConfiguredError()
+	}
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	cfg := ConfigFromSettings(s)
+	if HasDevice(cfg) {
+		if _, err := NewConfigManager(cfg).LoadConfig(); err != nil {
+			return nil, err
+		}
+		if _, ok := LookupAdapter(ProtocolType(cfg.Connection.Protocol)); !ok {
+			return nil, NewInvalidConfigError(fmt.Sprintf("unsupported protocol: %s", cfg.Connection.Protocol))
+		}
+	} else {
+		applyDefaults(cfg)
+	}
+	if err := registerProfiles(s.Profiles); err != nil {
+		return nil, err
+	}
+
+	old := GetConfig()
+	result := &ReloadResult{
+		Source:  source,
+		Time:    time.Now(),
+		Changes: diffConfig(old, cfg),
+		Devices: []int{},
+	}
+	if len(result.Changes) == 0 {
+		lastReload.Store(result)
+		return result, nil
+	}
+
+	if !reflect.DeepEqual(old.Log, cfg.Log) {
+		execLogger, err := NewExecutionLogger(&cfg.Log)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reopen execution logger: %w", err)
+		}
+		if prev := globalLogger.Swap(execLogger); prev != nil {
+			_ = prev.Close()
+		}
+		result.LoggerReopened = true
+	}
+
+	// Devices registered from now on already get the new settings
+	globalConfig.Store(cfg)
+	configManager.Store(NewConfigManager(cfg))
+	if globalJobs != nil {
+		globalJobs.SetConfig(cfg.Jobs)
+	}
+	if globalTelemetry != nil {
+		globalTelemetry.SetConfig(cfg.Telemetry)
+	}
+
+	reloadPools(old, cfg, result)
+	lastReload.Store(result)
+	return result, nil
+}
+
+// LastReload returns the outcome of the last reload, nil before the first one
+func LastReload() *ReloadResult {
+	return lastReload.Load()
+}
+
+// reloadPools rebuilds the pools whose configuration changed from old to
+// cfg, draining the previous pools in parallel
+func reloadPools(old, cfg *DeviceConfig, result *ReloadResult) {
+	drain := time.Duration(cfg.Reload.DrainTimeout) * time.Second
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	rebuild := func(id int, next *DeviceConfig) {
+		defer wg.Done()
+		drained, err := globalRegistry.Reload(context.Background(), id, next, drain)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			if result.Errors == nil {
+				result.Errors = make(map[int]string)
+			}
+			result.Errors[id] = err.Error()
+			return
+		}
+		result.Devices = append(result.Devices, id)
+		if !drained {
+			result.Forced = append(result.Forced, id)
+		}
+	}
+
+	for _, id := range globalRegistry.IDs() {
+		pool, err := globalRegistry.Get(id)
+		if err != nil {
+			continue // unregistered meanwhile
+		}
+		current := pool.Config()
+		conn := current.Connection
+		// The settings file device follows the file until the inventory
+		// replaces it with a connection of its own
+		if id == DefaultDeviceID && HasDevice(cfg) && reflect.DeepEqual(conn, old.Connection) {
+			conn = cfg.Connection
+		}
+		next := withShared(conn, cfg)
+		if reflect.DeepEqual(next, current) {
+			continue
+		}
+		wg.Add(1)
+		go rebuild(id, next)
+	}
+
+	// A device added to the settings file
+	if HasDevice(cfg) && !HasDevice(old) {
+		if _, err := globalRegistry.Get(DefaultDeviceID); err != nil {
+			wg.Add(1)
+			go rebuild(DefaultDeviceID, cfg)
+		}
+	}
+	wg.Wait()
+
+	sort.Ints(result.Devices)
+	sort.Ints(result.Forced)
+}
+
+// diffConfig lists the settings that differ between old and cfg
+func diffConfig(old, cfg *DeviceConfig) []ConfigChange {
+	changes := []ConfigChange{}
+	ov, nv := reflect.ValueOf(old).Elem(), reflect.ValueOf(cfg).Elem()
+	for i := 0; i < ov.NumField(); i++ {
+		section := fieldName(ov.Type().Field(i))
+		changes = diffSection(changes, section, ov.Field(i), nv.Field(i))
+	}
+	return changes
+}
+
+// diffSection appends the changed fields of a settings section, descending
+// into nested sections such as log.syslog
+func diffSection(changes []ConfigChange, prefix string, oldSection, newSection reflect.Value) []ConfigChange {
+	for j := 0; j < oldSection.NumField(); j++ {
+		name := fieldName(oldSection.Type().Field(j))
+		a, b := oldSection.Field(j), newSection.Field(j)
+		if reflect.DeepEqual(a.Interface(), b.Interface()) {
+			continue
+		}
+		if a.Kind() == reflect.Struct {
+			changes = diffSection(changes, prefix+"."+name, a, b)
+			continue
+		}
+		change := ConfigChange{Field: prefix + "." + name, Old: fmt.Sprint(a.Interface()), New: fmt.Sprint(b.Interface())}
+		if secretFields[name] {
+			change.Old, change.New = maskSecret(change.Old), maskSecret(change.New)
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// fieldName returns the settings file name of a field, its yaml name or
+// else its name in snake case
+func fieldName(f reflect.StructField) string {
+	if tag, _, _ := strings.Cut(f.Tag.Get("yaml"), ","); tag != "" {
+		return tag
+	}
+	var b strings.Builder
+	runes := []rune(f.Name)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) &&
+			(unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// maskSecret hides a secret but shows whether it is set
+func maskSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "******"
+}
+
+// WatchSettings reloads the device block of the settings file at path when
+// the file changes, checking every reload.watch_interval seconds until ctx is
+// done. It returns at once when the interval is 0; a reload setting the
+// interval to 0 stops it.
+func WatchSettings(ctx context.Context, path string, logger *zap.Logger) {
+	if !IsInitialized() {
+		return
+	}
+	last, err := fileDigest(path)
+	if err != nil {
+		logger.Warn("Failed to read settings file", zap.String("file", path), zap.Error(err))
+	}
+
+	for {
+		interval := time.Duration(GetConfig().Reload.WatchInterval) * time.Second
+		if interval <= 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		digest, err := fileDigest(path)
+		if err != nil {
+			logger.Warn("Failed to read settings file", zap.String("file", path), zap.Error(err))
+			continue
+		}
+		if digest == last {
+			continue
+		}
+		last = digest
+
+		s, found, err := config.LoadDeviceConfig(path)
+		if err != nil {
+			logger.Error("Failed to parse settings file", zap.String("file", path), zap.Error(err))
+			continue
+		}
+		if !found {
+			logger.Warn("Settings file has no device block, keeping the device configuration", zap.String("file", path))
+			continue
+		}
+		result, err := ReloadSettings(s, ReloadSourceFile)
+		if err != nil {
+			logger.Error("Device configuration not reloaded", zap.String("file", path), zap.Error(err))
+			continue
+		}
+		if len(result.Changes) == 0 {
+			continue
+		}
+		logger.Info("Device configuration reloaded",
+			zap.String("file", path),
+			zap.Any("changes", result.Changes),
+			zap.Ints("devices", result.Devices),
+			zap.Ints("forced", result.Forced),
+			zap.Bool("logger_reopened", result.LoggerReopened),
+		)
+		for id, msg := range result.Errors {
+			logger.Error("Device kept its previous configuration", zap.Int("device_id", id), zap.String("error", msg))
+		}
+	}
+}
+
+// fileDigest returns the SHA-256 of a file, the watcher compares contents
+// rather than modification times
+func fileDigest(path string) ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
@@ -0,0 +1,222 @@
+package device
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"opt-switch/config"
+)
+
+func TestPoolDrain(t *testing.T) {
+	pool, _ := newFakePool(t, 2)
+	_, release, err := pool.Checkout(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan bool)
+	go func() { done <- pool.Drain(5 * time.Second) }()
+
+	// new work is refused while the terminal finishes
+	time.Sleep(20 * time.Millisecond)
+	if _, err := pool.Execute(context.Background(), []string{"show a"}, time.Second); err == nil {
+		t.Error("draining pool accepted a command")
+	}
+	select {
+	case <-done:
+		t.Fatal("Drain returned before the checkout was released")
+	default:
+	}
+
+	release()
+	select {
+	case drained := <-done:
+		if !drained {
+			t.Error("Drain reported a forced stop")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Drain did not return after the release")
+	}
+	if pool.IsRunning() {
+		t.Error("pool still running after Drain")
+	}
+}
+
+func TestPoolDrainTimeout(t *testing.T) {
+	pool, _ := newFakePool(t, 1)
+	conn, release, err := pool.Checkout(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	if pool.Drain(50 * time.Millisecond) {
+		t.Error("Drain reported success with a connection checked out")
+	}
+	if conn.Adapter.IsConnected() {
+		t.Error("forced Drain left the checked out connection open")
+	}
+}
+
+// reloadSettings returns a settings file device block for the fake protocol
+func reloadSettings(dir string) config.DeviceConfig {
+	var s config.DeviceConfig
+	s.Connection.Protocol = string(fakeProtocol)
+	s.Connection.Host = "switch-a"
+	s.Connection.Port = 22
+	s.Connection.Username = "admin"
+	s.Connection.Password = "s3cret"
+	s.Pool.MaxConnections = 2
+	s.Log.Enabled = true
+	s.Log.File = filepath.Join(dir, "command.log")
+	s.Reload.DrainTimeout = 5
+	return s
+}
+
+// initReloadTest sets up the device layer with s as the settings file device
+// and an inventory device #2
+func initReloadTest(t *testing.T, s config.DeviceConfig) {
+	load := &fakeLoad{}
+	if err := RegisterAdapter(fakeProtocol, load.factory); err != nil {
+		t.Fatal(err)
+	}
+	cfg := ConfigFromSettings(s)
+	applyDefaults(cfg)
+	execLogger, err := NewExecutionLogger(&cfg.Log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	globalRegistry = NewRegistry()
+	globalConfig.Store(cfg)
+	globalLogger.Store(execLogger)
+	t.Cleanup(func() {
+		globalRegistry.StopAll()
+		globalRegistry = nil
+		globalConfig.Store(nil)
+		globalLogger.Store(nil)
+		lastReload.Store(nil)
+	})
+
+	if err := globalRegistry.Register(context.Background(), DefaultDeviceID, cfg); err != nil {
+		t.Fatal(err)
+	}
+	conn := cfg.Connection
+	conn.Host = "switch-b"
+	if err := RegisterDevice(2, conn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadSettings(t *testing.T) {
+	dir := t.TempDir()
+	s := reloadSettings(dir)
+	initReloadTest(t, s)
+	before, _ := GetDevicePool(2)
+	execLogger := GetLogger()
+
+	// unchanged settings leave the pools alone
+	result, err := ReloadSettings(s, ReloadSourceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Changes) != 0 || len(result.Devices) != 0 {
+		t.Fatalf("unchanged reload = %+v", result)
+	}
+
+	s.Connection.Host = "switch-c"
+	s.Connection.Password = "n3w"
+	s.Pool.MaxConnections = 4
+	s.Log.File = filepath.Join(dir, "other.log")
+	result, err = ReloadSettings(s, ReloadSourceAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := make(map[string]ConfigChange)
+	for _, c := range result.Changes {
+		changes[c.Field] = c
+	}
+	if c := changes["pool.max_connections"]; c.Old != "2" || c.New != "4" {
+		t.Errorf("pool.max_connections change = %+v", c)
+	}
+	if c := changes["connection.password"]; c.Old != "******" || c.New != "******" {
+		t.Errorf("password change not masked: %+v", c)
+	}
+	if _, ok := changes["log.file"]; !ok || !result.LoggerReopened || GetLogger() == execLogger {
+		t.Error("execution logger not reopened for the new log file")
+	}
+	if len(result.Devices) != 2 || len(result.Forced) != 0 || len(result.Errors) != 0 {
+		t.Fatalf("result = %+v, want both devices rebuilt", result)
+	}
+
+	// the settings file device follows the file, the inventory device keeps
+	// its connection and gets the shared settings
+	pool, _ := GetDevicePool(DefaultDeviceID)
+	if got := pool.Config().Connection.Host; got != "switch-c" {
+		t.Errorf("default device host = %q, want switch-c", got)
+	}
+	after, _ := GetDevicePool(2)
+	if after == before || before.IsRunning() {
+		t.Error("inventory device pool not replaced")
+	}
+	if got := after.Config().Connection.Host; got != "switch-b" {
+		t.Errorf("inventory device host = %q, want switch-b", got)
+	}
+	if got := cap(after.semaphore); got != 4 {
+		t.Errorf("inventory device connection limit = %d, want 4", got)
+	}
+	if LastReload() != result {
+		t.Error("LastReload does not return the last result")
+	}
+}
+
+func TestReloadSettingsInvalid(t *testing.T) {
+	s := reloadSettings(t.TempDir())
+	initReloadTest(t, s)
+	before := GetConfig()
+
+	s.Connection.Username = ""
+	if _, err := ReloadSettings(s, ReloadSourceAPI); err == nil {
+		t.Fatal("reloaded a configuration without username")
+	}
+	s = reloadSettings(t.TempDir())
+	s.Connection.Protocol = "carrier-pigeon"
+	_, err := ReloadSettings(s, ReloadSourceAPI)
+	if err == nil || !strings.Contains(err.Error(), "unsupported protocol") {
+		t.Fatalf("err = %v, want unsupported protocol", err)
+	}
+	if GetConfig() != before || LastReload() != nil {
+		t.Error("invalid configuration was applied")
+	}
+}
+
+func TestDiffConfigFieldNames(t *testing.T) {
+	old := &DeviceConfig{}
+	cfg := &DeviceConfig{Connection: ConnectionConfig{CLIPath: "/usr/bin/cli", PrivateKeyPassphrase: "x"}}
+	cfg.Terminal.MaxSessionsPerUser = 3
+	cfg.Log.Integrity.Key = "chain-key"
+
+	got := make(map[string]ConfigChange)
+	for _, c := range diffConfig(old, cfg) {
+		got[c.Field] = c
+	}
+	if len(got) != 4 {
+		t.Fatalf("changes = %+v", got)
+	}
+	if c := got["connection.cli_path"]; c.New != "/usr/bin/cli" {
+		t.Errorf("cli_path change = %+v", c)
+	}
+	if c := got["connection.private_key_passphrase"]; c.Old != "" || c.New != "******" {
+		t.Errorf("passphrase change = %+v", c)
+	}
+	if c := got["log.integrity.key"]; c.New != "******" {
+		t.Errorf("nested secret change = %+v", c)
+	}
+	if _, ok := got["terminal.max_sessions_per_user"]; !ok {
+		t.Errorf("terminal change missing: %+v", got)
+	}
+}
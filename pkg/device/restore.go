@@ -0,0 +1,225 @@
+package device
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// configNode is a configuration line with the lines indented below it
+type configNode struct {
+	line     string
+	children []*configNode
+}
+
+// parseConfig builds the section tree of an indented configuration. Comment
+// and separator lines, the trailing "end" and lines matching one of the
+// ignore patterns are dropped.
+func parseConfig(config string, ignore []*regexp.Regexp) []*configNode {
+	type level struct {
+		indent int
+		node   *configNode
+	}
+	root := &configNode{}
+	stack := []level{{indent: -1, node: root}}
+
+	for _, raw := range strings.Split(config, "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "!") || line == "#" || matchAny(ignore, raw) {
+			continue
+		}
+		indent := len(raw) - len(strings.TrimLeft(raw, " "))
+		if indent == 0 && (line == "end" || line == "return") {
+			continue
+		}
+
+		for len(stack) > 1 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		node := &configNode{line: line}
+		parent := stack[len(stack)-1].node
+		parent.children = append(parent.children, node)
+		stack = append(stack, level{indent: indent, node: node})
+	}
+	return root.children
+}
+
+// ConfigDelta returns the configuration mode commands that turn the current
+// configuration into the target one. Lines are compared section by section:
+// surplus lines are negated with "no", then missing lines are added under
+// their parent section. The commands do not include entering or leaving
+// configuration mode.
+func ConfigDelta(current, target string, ignore []string) ([]string, error) {
+	patterns, err := compilePatterns(ignore)
+	if err != nil {
+		return nil, err
+	}
+	return deltaNodes(parseConfig(current, patterns), parseConfig(target, patterns), 0), nil
+}
+
+func deltaNodes(current, target []*configNode, depth int) []string {
+	indent := strings.Repeat(" ", depth)
+
+	currentByLine := make(map[string]*configNode, len(current))
+	for _, n := range current {
+		currentByLine[n.line] = n
+	}
+	targetByLine := make(map[string]bool, len(target))
+	for _, n := range target {
+		targetByLine[n.line] = true
+	}
+
+	// Remove surplus lines first, so that a setting the device holds a single
+	// value of (hostname, description, ip address) is negated before its new
+	// value is set rather than after, which would clear it. They go in reverse
+	// order, so that dependent lines go before the lines they depend on.
+	var cmds []string
+	for i := len(current) - 1; i >= 0; i-- {
+		if !targetByLine[current[i].line] {
+			cmds = append(cmds, indent+negateLine(current[i].line))
+		}
+	}
+
+	for _, t := range target {
+		c, ok := currentByLine[t.line]
+		if !ok {
+			cmds = append(cmds, renderNode(t, depth)...)
+			continue
+		}
+		if sub := deltaNodes(c.children, t.children, depth+1); len(sub) > 0 {
+			cmds = append(cmds, indent+t.line)
+			cmds = append(cmds, sub...)
+		}
+	}
+	return cmds
+}
+
+func renderNode(n *configNode, depth int) []string {
+	cmds := []string{strings.Repeat(" ", depth) + n.line}
+	for _, child := range n.children {
+		cmds = append(cmds, renderNode(child, depth+1)...)
+	}
+	return cmds
+}
+
+func negateLine(line string) string {
+	if strings.HasPrefix(line, "no ") {
+		return strings.TrimPrefix(line, "no ")
+	}
+	return "no " + line
+}
+
+// RunConfigSession sends cmds to the device in a single CLI session, so that
+// configuration mode carries over between them, and returns the session
+// output. Telnet connections are a single session already; other adapters
+// need to support interactive terminals.
+func RunConfigSession(ctx context.Context, adapter ProtocolAdapter, cmds []string) (*CommandResult, error) {
+	start := time.Now()
+	result := &CommandResult{
+		Command:   strings.Join(cmds, "\n"),
+		Timestamp: start.Unix(),
+	}
+
+	var output string
+	var err error
+	if s, ok := adapter.(sessionAdapter); ok && s.inSession() {
+		output, err = runSessionCommands(ctx, adapter, cmds)
+	} else if t, ok := adapter.(TerminalOpener); ok {
+		output, err = runTerminalSession(ctx, t, cmds)
+		if err == nil {
+			err = checkSessionOutput(adapter, output)
+		}
+	} else {
+		return nil, NewNotSupportedError(fmt.Sprintf("%s sessions cannot run CLI commands", adapter.ProtocolType()))
+	}
+
+	result.Output = output
+	result.Duration = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		if ctx.Err() == context.DeadlineExceeded {
+			return result, NewCommandTimeoutError()
+		}
+		return result, NewCommandFailedError(err)
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+// sessionAdapter is implemented by adapters that run every command of a
+// connection in the same CLI session
+type sessionAdapter interface {
+	inSession() bool
+}
+
+func (a *TelnetAdapter) inSession() bool { return true }
+
+func (a *SSHAdapter) inSession() bool { return a.shell != nil }
+
+// runSessionCommands runs cmds one by one and stops at the first command the
+// device rejects
+func runSessionCommands(ctx context.Context, adapter ProtocolAdapter, cmds []string) (string, error) {
+	var out strings.Builder
+	for _, cmd := range cmds {
+		r, err := adapter.ExecuteCommand(ctx, cmd)
+		if r != nil {
+			out.WriteString(r.Output)
+			out.WriteString("\n")
+		}
+		if err != nil {
+			return out.String(), err
+		}
+		if !r.Success {
+			return out.String(), fmt.Errorf("%s: %s", cmd, r.Error)
+		}
+	}
+	return out.String(), nil
+}
+
+// checkSessionOutput checks the output of a whole terminal session against
+// the error patterns of the device profile
+func checkSessionOutput(adapter ProtocolAdapter, output string) error {
+	profile := LookupProfile("")
+	if a, ok := adapter.(*SSHAdapter); ok && a.profile != nil {
+		profile = a.profile
+	}
+	return profile.CheckOutput(output)
+}
+
+// runTerminalSession types the commands into a shell and logs out, then
+// collects the output until the device closes the session
+func runTerminalSession(ctx context.Context, opener TerminalOpener, cmds []string) (string, error) {
+	term, err := opener.OpenTerminal(ctx, 512, 24)
+	if err != nil {
+		return "", err
+	}
+	defer term.Close()
+
+	var buf bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(&buf, term)
+		done <- err
+	}()
+
+	input := strings.Join(cmds, "\n") + "\nexit\n"
+	if _, err := io.WriteString(term, input); err != nil {
+		term.Close()
+		<-done
+		return buf.String(), err
+	}
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		term.Close()
+		<-done
+		err = ctx.Err()
+	}
+	return buf.String(), err
+}
@@ -0,0 +1,83 @@
+package device
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfigDelta(t *testing.T) {
+	current := "! Last configuration change at 11:00\n" +
+		"hostname sw2\n" +
+		"!\n" +
+		"interface Gi0/1\n" +
+		" description uplink\n" +
+		" shutdown\n" +
+		"!\n" +
+		"vlan 30\n" +
+		"!\n" +
+		"no ip domain-lookup\n" +
+		"end"
+	target := "! Last configuration change at 10:00\n" +
+		"hostname sw1\n" +
+		"!\n" +
+		"interface Gi0/1\n" +
+		" description uplink\n" +
+		"!\n" +
+		"vlan 10\n" +
+		" name users\n" +
+		"!\n" +
+		"end"
+
+	got, err := ConfigDelta(current, target, []string{`^! Last configuration change`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ip domain-lookup",
+		"no vlan 30",
+		"no hostname sw2",
+		"hostname sw1",
+		"interface Gi0/1",
+		" no shutdown",
+		"vlan 10",
+		" name users",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ConfigDelta =\n%q\nwant\n%q", got, want)
+	}
+
+	if got, _ := ConfigDelta(target, target, nil); len(got) != 0 {
+		t.Errorf("identical configurations produced %q", got)
+	}
+}
+
+func TestConfigDeltaReplacesSettings(t *testing.T) {
+	current := "hostname a\n" +
+		"interface Vlan1\n" +
+		" description foo\n" +
+		" ip address 10.0.0.1 255.255.255.0\n" +
+		" ip address 10.0.1.1 255.255.255.0 secondary\n"
+	target := "hostname b\n" +
+		"interface Vlan1\n" +
+		" description bar\n" +
+		" ip address 10.0.0.2 255.255.255.0\n" +
+		" ip address 10.0.1.1 255.255.255.0 secondary\n"
+
+	got, err := ConfigDelta(current, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the old values are cleared before the new ones are set
+	want := []string{
+		"no hostname a",
+		"hostname b",
+		"interface Vlan1",
+		" no ip address 10.0.0.1 255.255.255.0",
+		" no description foo",
+		" description bar",
+		" ip address 10.0.0.2 255.255.255.0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ConfigDelta =\n%q\nwant\n%q", got, want)
+	}
+}
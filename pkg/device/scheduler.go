@@ -0,0 +1,340 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Priority is the scheduling class of a command task. Queued tasks of a
+// higher class always run first; within a class the users take turns.
+type Priority int
+
+// Priority classes, highest first
+const (
+	PriorityInteractive Priority = iota // a user waiting for the answer
+	PriorityMonitoring                  // periodic polls
+	PriorityBulk                        // batch changes, jobs and backups
+	priorityCount
+)
+
+var priorityNames = [priorityCount]string{"interactive", "monitoring", "bulk"}
+
+// String returns the name of the class
+func (p Priority) String() string {
+	if p < 0 || p >= priorityCount {
+		return fmt.Sprintf("priority(%d)", int(p))
+	}
+	return priorityNames[p]
+}
+
+// ParsePriority returns the class named s. An empty name selects def.
+func ParsePriority(s string, def Priority) (Priority, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return def, nil
+	}
+	for i, name := range priorityNames {
+		if name == s {
+			return Priority(i), nil
+		}
+	}
+	return def, NewInvalidParamError(fmt.Sprintf("unknown priority %q, expected one of %s", s, strings.Join(priorityNames[:], ", ")))
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context scheduling the work submitted with it in
+// class p
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFrom returns the class attached to ctx. Work without one is
+// interactive when a user submitted it and bulk otherwise.
+func PriorityFrom(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok && p >= 0 && p < priorityCount {
+		return p
+	}
+	if _, ok := PrincipalFrom(ctx); ok {
+		return PriorityInteractive
+	}
+	return PriorityBulk
+}
+
+// QueuedTask describes a task waiting in the queue
+type QueuedTask struct {
+	Position int    `json:"position"` // 1 runs next
+	UserID   string `json:"userId,omitempty"`
+	Priority string `json:"priority"`
+	Commands int    `json:"commands"`
+	Waiting  int64  `json:"waitingMs"`
+}
+
+// WaitStats summarizes the queue wait of the tasks of a class that were
+// dispatched to a worker
+type WaitStats struct {
+	Count int64   `json:"count"`
+	Avg   float64 `json:"avgMs"`
+	Max   float64 `json:"maxMs"`
+	Total float64 `json:"totalMs"`
+}
+
+type queuedTask struct {
+	task     *CommandTask
+	priority Priority
+	enqueued time.Time
+	stop     func() bool // stops the removal on cancellation of the task context
+}
+
+// classQueue holds the tasks of one class per user. users is the turn order
+// of the users with queued tasks.
+type classQueue struct {
+	users []string
+	tasks map[string][]*queuedTask
+}
+
+func (q *classQueue) push(t *queuedTask) {
+	if len(q.tasks[t.task.UserID]) == 0 {
+		q.users = append(q.users, t.task.UserID)
+	}
+	q.tasks[t.task.UserID] = append(q.tasks[t.task.UserID], t)
+}
+
+// pop takes the oldest task of the user whose turn it is and moves the user
+// to the end of the turn order
+func (q *classQueue) pop() *queuedTask {
+	if len(q.users) == 0 {
+		return nil
+	}
+	user := q.users[0]
+	q.users = q.users[1:]
+	tasks := q.tasks[user]
+	t := tasks[0]
+	if len(tasks) == 1 {
+		delete(q.tasks, user)
+	} else {
+		q.tasks[user] = tasks[1:]
+		q.users = append(q.users, user)
+	}
+	return t
+}
+
+// remove takes t out of the queue, reporting whether it was still queued
+func (q *classQueue) remove(t *queuedTask) bool {
+	user := t.task.UserID
+	tasks := q.tasks[user]
+	for i, queued := range tasks {
+		if queued != t {
+			continue
+		}
+		if len(tasks) > 1 {
+			q.tasks[user] = append(tasks[:i:i], tasks[i+1:]...)
+			return true
+		}
+		delete(q.tasks, user)
+		for j, u := range q.users {
+			if u == user {
+				q.users = append(q.users[:j:j], q.users[j+1:]...)
+				break
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// scheduler is the bounded command queue of a pool. Workers receive a token
+// from ready per queued task and then take the task that is due. A task
+// whose context ends while queued is dropped together with a token. Tokens
+// are interchangeable: there are always at least as many tokens, queued or
+// held by workers about to call next, as queued tasks.
+type scheduler struct {
+	slots chan struct{} // one per queued task, bounds the queue
+	ready chan struct{} // one per queued task, closed on close
+	done  chan struct{}
+
+	mu      sync.Mutex
+	closed  bool
+	classes [priorityCount]classQueue
+	waits   [priorityCount]WaitStats
+}
+
+func newScheduler(size int) *scheduler {
+	s := &scheduler{
+		slots: make(chan struct{}, size),
+		ready: make(chan struct{}, size),
+		done:  make(chan struct{}),
+	}
+	for i := range s.classes {
+		s.classes[i].tasks = make(map[string][]*queuedTask)
+	}
+	return s
+}
+
+// push queues task in its class, waiting up to timeout for room in the queue
+func (s *scheduler) push(ctx context.Context, task *CommandTask, timeout time.Duration) error {
+	p := task.Priority
+	if p < 0 || p >= priorityCount {
+		p = PriorityBulk
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case s.slots <- struct{}{}:
+	case <-s.done:
+		return NewConnectionClosed()
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return NewQueueTimeoutError()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		<-s.slots
+		return NewConnectionClosed()
+	}
+	t := &queuedTask{task: task, priority: p, enqueued: time.Now()}
+	if task.ctx != nil {
+		t.stop = context.AfterFunc(task.ctx, func() { s.drop(t) })
+	}
+	s.classes[p].push(t)
+	// a full channel already has a token for every queued task; blocking
+	// here would hold s.mu
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// drop removes a task whose context ended before a worker took it and fails
+// its commands
+func (s *scheduler) drop(t *queuedTask) {
+	s.mu.Lock()
+	removed := s.classes[t.priority].remove(t)
+	if removed {
+		<-s.slots
+		// take its token unless a worker holds it already, in which case
+		// that worker's next finds one task less
+		select {
+		case <-s.ready:
+		default:
+		}
+	}
+	s.mu.Unlock()
+	if removed {
+		cancelRemaining(t.task, 0, context.Cause(t.task.ctx))
+	}
+}
+
+// pop waits for the next task. It returns false once the scheduler is closed
+// and drained or ctx is done.
+func (s *scheduler) pop(ctx context.Context) (*CommandTask, bool) {
+	for {
+		select {
+		case _, ok := <-s.ready:
+			if !ok {
+				return nil, false
+			}
+		case <-ctx.Done():
+			return nil, false
+		}
+		// a spare token finds nothing to run
+		if task := s.next(); task != nil {
+			return task, true
+		}
+	}
+}
+
+// next takes the task that is due out of the queue
+func (s *scheduler) next() *CommandTask {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p := range s.classes {
+		t := s.classes[p].pop()
+		if t == nil {
+			continue
+		}
+		if t.stop != nil {
+			t.stop()
+		}
+		<-s.slots
+		w := &s.waits[p]
+		t.task.waited = time.Since(t.enqueued)
+		wait := float64(t.task.waited) / float64(time.Millisecond)
+		w.Count++
+		w.Total += wait
+		if wait > w.Max {
+			w.Max = wait
+		}
+		return t.task
+	}
+	return nil
+}
+
+// close rejects new tasks; the queued ones are still handed to workers
+func (s *scheduler) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.done)
+	close(s.ready)
+}
+
+// len returns the number of queued tasks
+func (s *scheduler) len() int {
+	return len(s.slots)
+}
+
+// snapshot lists the queued tasks in the order they will be dispatched,
+// assuming nothing else is queued meanwhile
+func (s *scheduler) snapshot() []QueuedTask {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var list []QueuedTask
+	for p := range s.classes {
+		// replay the turns on a copy of the class
+		q := classQueue{
+			users: append([]string(nil), s.classes[p].users...),
+			tasks: make(map[string][]*queuedTask, len(s.classes[p].tasks)),
+		}
+		for user, tasks := range s.classes[p].tasks {
+			q.tasks[user] = tasks
+		}
+		for t := q.pop(); t != nil; t = q.pop() {
+			list = append(list, QueuedTask{
+				Position: len(list) + 1,
+				UserID:   t.task.UserID,
+				Priority: t.priority.String(),
+				Commands: len(t.task.Commands),
+				Waiting:  now.Sub(t.enqueued).Milliseconds(),
+			})
+		}
+	}
+	return list
+}
+
+// waitStats returns the wait statistics per class name
+func (s *scheduler) waitStats() map[string]WaitStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make(map[string]WaitStats, priorityCount)
+	for p, w := range s.waits {
+		if w.Count > 0 {
+			w.Avg = w.Total / float64(w.Count)
+		}
+		stats[Priority(p).String()] = w
+	}
+	return stats
+}
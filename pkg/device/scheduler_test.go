@@ -0,0 +1,152 @@
+package device
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSchedulerOrder(t *testing.T) {
+	s := newScheduler(10)
+	push := func(user string, p Priority) {
+		t.Helper()
+		task := &CommandTask{Commands: []string{user}, UserID: user, Priority: p}
+		if err := s.push(context.Background(), task, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	push("a", PriorityBulk)
+	push("a", PriorityBulk)
+	push("a", PriorityBulk)
+	push("b", PriorityBulk)
+	push("c", PriorityMonitoring)
+	push("d", PriorityInteractive)
+
+	// interactive first, then monitoring, then the bulk users take turns
+	want := []string{"d", "c", "a", "b", "a", "a"}
+	snapshot := s.snapshot()
+	if len(snapshot) != len(want) {
+		t.Fatalf("snapshot = %+v", snapshot)
+	}
+	for i, user := range want {
+		if snapshot[i].UserID != user || snapshot[i].Position != i+1 {
+			t.Errorf("snapshot[%d] = %+v, want user %s", i, snapshot[i], user)
+		}
+		task, ok := s.pop(context.Background())
+		if !ok || task.UserID != user {
+			t.Fatalf("pop %d = %v, want user %s", i, task, user)
+		}
+	}
+	if s.len() != 0 {
+		t.Errorf("len = %d after draining", s.len())
+	}
+	if stats := s.waitStats(); stats["bulk"].Count != 4 || stats["interactive"].Count != 1 {
+		t.Errorf("wait stats = %+v", stats)
+	}
+}
+
+func TestSchedulerFullAndClose(t *testing.T) {
+	s := newScheduler(1)
+	task := &CommandTask{Commands: []string{"show a"}}
+	if err := s.push(context.Background(), task, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	err := s.push(context.Background(), task, 10*time.Millisecond)
+	if de, ok := err.(*DeviceError); !ok || de.Code != ErrQueueTimeout {
+		t.Fatalf("push to full queue = %v", err)
+	}
+
+	s.close()
+	if err := s.push(context.Background(), task, time.Second); err == nil {
+		t.Fatal("push after close succeeded")
+	}
+	// queued tasks are still handed out after close
+	if _, ok := s.pop(context.Background()); !ok {
+		t.Fatal("queued task lost on close")
+	}
+	if _, ok := s.pop(context.Background()); ok {
+		t.Fatal("pop on closed, drained scheduler returned a task")
+	}
+}
+
+func TestPriorityFrom(t *testing.T) {
+	if p := PriorityFrom(context.Background()); p != PriorityBulk {
+		t.Errorf("background = %s", p)
+	}
+	ctx := WithPrincipal(context.Background(), &Principal{UserID: "7"})
+	if p := PriorityFrom(ctx); p != PriorityInteractive {
+		t.Errorf("user = %s", p)
+	}
+	if p := PriorityFrom(WithPriority(ctx, PriorityMonitoring)); p != PriorityMonitoring {
+		t.Errorf("explicit = %s", p)
+	}
+	if _, err := ParsePriority("urgent", PriorityBulk); err == nil {
+		t.Error("unknown priority accepted")
+	}
+}
+
+func TestSchedulerDropsCancelled(t *testing.T) {
+	s := newScheduler(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	gone := &CommandTask{Commands: []string{"show a"}, ResultCh: make(chan *CommandResult, 1), ctx: ctx}
+	kept := &CommandTask{Commands: []string{"show b"}, ResultCh: make(chan *CommandResult, 1)}
+	for _, task := range []*CommandTask{gone, kept} {
+		if err := s.push(context.Background(), task, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cancel()
+	select {
+	case r := <-gone.ResultCh:
+		if r.Success {
+			t.Errorf("dropped task result = %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cancelled task not failed")
+	}
+	if s.len() != 1 {
+		t.Errorf("len = %d, want 1", s.len())
+	}
+	if task, ok := s.pop(context.Background()); !ok || task != kept {
+		t.Fatalf("pop = %v", task)
+	}
+}
+
+func TestSchedulerRefillsAfterCancel(t *testing.T) {
+	s := newScheduler(2)
+	for round := 0; round < 3; round++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		gone := &CommandTask{Commands: []string{"show a"}, ResultCh: make(chan *CommandResult, 1), ctx: ctx}
+		if err := s.push(context.Background(), gone, time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.push(context.Background(), &CommandTask{Commands: []string{"show b"}}, time.Second); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		<-gone.ResultCh
+
+		// the freed slot takes a task without waiting for a token to drain
+		done := make(chan error, 1)
+		go func() {
+			done <- s.push(context.Background(), &CommandTask{Commands: []string{"show c"}}, 100*time.Millisecond)
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("round %d: push = %v", round, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("round %d: push to the freed slot hangs", round)
+		}
+		if n := len(s.snapshot()); n != 2 {
+			t.Fatalf("round %d: %d tasks queued, want 2", round, n)
+		}
+		for i := 0; i < 2; i++ {
+			if _, ok := s.pop(context.Background()); !ok {
+				t.Fatalf("round %d: pop %d failed", round, i)
+			}
+		}
+	}
+}
@@ -8,10 +8,14 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-// SSHAdapter implements ProtocolAdapter for SSH protocol
+// SSHAdapter implements ProtocolAdapter for SSH protocol. Commands run in
+// exec channels, or in one interactive shell for device profiles that need
+// it to enter privileged mode or disable paging.
 type SSHAdapter struct {
 	client    *ssh.Client
 	session   *ssh.Session
+	shell     *cliSession
+	profile   *DeviceProfile
 	connected bool
 }
 
@@ -22,28 +26,70 @@ func NewSSHAdapter() *SSHAdapter {
 
 // Connect establishes an SSH connection
 func (a *SSHAdapter) Connect(ctx context.Context, config *ConnectionConfig) error {
-	sshConfig := &ssh.ClientConfig{
-		User: config.Username,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(config.Password),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         time.Duration(config.Timeout) * time.Second,
+	creds, err := config.credentials()
+	if err != nil {
+		return err
 	}
-
-	address := fmt.Sprintf("%s:%d", config.Host, config.Port)
-	client, err := ssh.Dial("tcp", address, sshConfig)
+	client, err := dialSSH(config, creds)
 	if err != nil {
-		return NewConnectionError(err)
+		return err
 	}
 
 	a.client = client
+	a.profile = LookupProfile(config.Vendor)
 	a.connected = true
+
+	if a.profile.usesShell() {
+		if err := a.startShell(ctx, config, creds.enable()); err != nil {
+			a.Disconnect(ctx)
+			return NewConnectionError(err)
+		}
+	}
 	return nil
 }
 
+// startShell opens the interactive shell commands run in and prepares it as
+// described by the device profile
+func (a *SSHAdapter) startShell(ctx context.Context, config *ConnectionConfig, enablePassword string) error {
+	session, err := a.client.NewSession()
+	if err != nil {
+		return err
+	}
+	a.session = session
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          0,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty("vt100", 0, 511, modes); err != nil {
+		return err
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := session.Shell(); err != nil {
+		return err
+	}
+
+	a.shell = newCLISession(stdout, stdin, a.profile, "\n", time.Duration(config.Timeout)*time.Second)
+	if _, _, err := a.shell.expect(ctx, a.profile.prompt); err != nil {
+		return err
+	}
+	return a.shell.prepare(ctx, enablePassword)
+}
+
 // Disconnect closes the SSH connection
 func (a *SSHAdapter) Disconnect(ctx context.Context) error {
+	if a.shell != nil {
+		a.shell.close()
+		a.shell = nil
+	}
 	if a.session != nil {
 		a.session.Close()
 		a.session = nil
@@ -57,35 +103,31 @@ func (a *SSHAdapter) Disconnect(ctx context.Context) error {
 	return nil
 }
 
-// ExecuteCommand executes a single command
+// ExecuteCommand executes a single command. A command whose output matches
+// an error pattern of the device profile is unsuccessful, but leaves the
+// connection usable.
 func (a *SSHAdapter) ExecuteCommand(ctx context.Context, cmd string) (*CommandResult, error) {
 	if !a.connected {
 		return nil, NewConnectionError(fmt.Errorf("not connected"))
 	}
 
-	session, err := a.client.NewSession()
-	if err != nil {
-		return nil, NewCommandFailedError(err)
-	}
-	defer session.Close()
-
-	modes := ssh.TerminalModes{
-		ssh.ECHO:          0,
-		ssh.TTY_OP_ISPEED: 14400,
-		ssh.TTY_OP_OSPEED: 14400,
-	}
-
-	if err := session.RequestPty("xterm", 80, 40, modes); err != nil {
-		return nil, NewCommandFailedError(err)
-	}
-
 	startTime := time.Now()
-	output, err := session.Output(cmd)
+	var output string
+	var err error
+	if a.shell != nil {
+		output, err = a.shell.run(ctx, cmd)
+		if err != nil && (ctx.Err() == nil || a.shell.interrupt() != nil) {
+			// the rest of the output would be read as the output of the next command
+			defer a.Disconnect(ctx)
+		}
+	} else {
+		output, err = a.exec(ctx, cmd)
+	}
 	duration := time.Since(startTime)
 
 	result := &CommandResult{
 		Command:   cmd,
-		Output:    string(output),
+		Output:    output,
 		Duration:  duration.Milliseconds(),
 		Success:   err == nil,
 		Timestamp: time.Now().Unix(),
@@ -99,14 +141,83 @@ func (a *SSHAdapter) ExecuteCommand(ctx context.Context, cmd string) (*CommandRe
 		return result, NewCommandFailedError(err)
 	}
 
+	if err := a.profile.CheckOutput(output); err != nil {
+		result.Success = false
+		result.Error = err.Error()
+	}
+
 	return result, nil
 }
 
+// exec runs a command in its own exec channel. The command is sent SIGINT
+// and its channel closed when ctx ends first.
+func (a *SSHAdapter) exec(ctx context.Context, cmd string) (string, error) {
+	session, err := a.client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          0,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+
+	if err := session.RequestPty("xterm", 80, 40, modes); err != nil {
+		return "", err
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = session.Signal(ssh.SIGINT)
+		session.Close()
+	})
+	defer stop()
+
+	output, err := session.Output(cmd)
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return string(output), err
+}
+
+// Keepalive sends an SSH keepalive request the server must answer
+func (a *SSHAdapter) Keepalive(ctx context.Context) error {
+	if !a.IsConnected() {
+		return NewConnectionError(fmt.Errorf("not connected"))
+	}
+	return sshKeepalive(ctx, a.client)
+}
+
+// sshKeepalive sends a keepalive global request on client and waits for the
+// reply. Servers answer unknown requests with a failure, which still proves
+// the transport alive.
+func sshKeepalive(ctx context.Context, client *ssh.Client) error {
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		errCh <- err
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // IsConnected returns whether the SSH connection is active
 func (a *SSHAdapter) IsConnected() bool {
 	return a.connected && a.client != nil
 }
 
+// AdapterCapabilities reports the SSH capabilities. Commands run in separate
+// exec channels unless the device profile asks for a shell, so configuration
+// mode does not carry over in general.
+func (a *SSHAdapter) AdapterCapabilities() AdapterCapabilities {
+	return AdapterCapabilities{Streaming: true}
+}
+
 // ProtocolType returns the protocol type
 func (a *SSHAdapter) ProtocolType() ProtocolType {
 	return ProtocolSSH
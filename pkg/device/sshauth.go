@@ -0,0 +1,147 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultKnownHostsFile stores the host keys when the connection does not
+// configure a known_hosts file
+const DefaultKnownHostsFile = "config/known_hosts"
+
+// knownHostsFile returns the known_hosts file of the connection
+func (c *ConnectionConfig) knownHostsFile() string {
+	if c.KnownHostsFile != "" {
+		return c.KnownHostsFile
+	}
+	return DefaultKnownHostsFile
+}
+
+// hostKeyPolicy returns the host key policy of the connection
+func (c *ConnectionConfig) hostKeyPolicy() string {
+	if c.HostKeyPolicy == "" {
+		return HostKeyTOFU
+	}
+	return strings.ToLower(c.HostKeyPolicy)
+}
+
+// address returns the host:port the connection dials
+func (c *ConnectionConfig) address() string {
+	return net.JoinHostPort(c.Host, fmt.Sprint(c.Port))
+}
+
+// sshClientConfig builds the SSH client configuration shared by the SSH and
+// NETCONF adapters. Public key authentication is tried first, then the
+// password, which also answers keyboard-interactive prompts.
+func sshClientConfig(config *ConnectionConfig, creds *credentials) (*ssh.ClientConfig, error) {
+	var auth []ssh.AuthMethod
+	if config.PrivateKeyFile != "" || creds.privateKey != "" {
+		signer, err := privateKeySigner(config.PrivateKeyFile, creds)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if creds.password != "" {
+		password := creds.password
+		auth = append(auth,
+			ssh.Password(password),
+			ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = password
+				}
+				return answers, nil
+			}),
+		)
+	}
+
+	sshConfig := &ssh.ClientConfig{
+		User:    config.Username,
+		Auth:    auth,
+		Timeout: time.Duration(config.Timeout) * time.Second,
+	}
+
+	store := GetHostKeyStore(config.knownHostsFile())
+	switch policy := config.hostKeyPolicy(); {
+	case policy == HostKeyInsecure:
+		sshConfig.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	case config.HostKeyFingerprint != "":
+		sshConfig.HostKeyCallback = pinnedHostKey(store, config.HostKeyFingerprint)
+	case policy == HostKeyTOFU || policy == HostKeyStrict:
+		sshConfig.HostKeyCallback = store.Callback(policy)
+		sshConfig.HostKeyAlgorithms = store.KeyAlgorithms(config.address())
+	default:
+		return nil, NewInvalidConfigError(fmt.Sprintf("unknown host key policy %q", config.HostKeyPolicy))
+	}
+	return sshConfig, nil
+}
+
+// privateKeySigner parses the private key of the connection, read from file
+// when it is set
+func privateKeySigner(file string, creds *credentials) (ssh.Signer, error) {
+	pem := []byte(creds.privateKey)
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, NewInvalidConfigError(fmt.Sprintf("failed to read private key: %v", err))
+		}
+		pem = data
+	}
+
+	signer, err := ssh.ParsePrivateKey(pem)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if creds.privateKeyPassphrase == "" {
+			return nil, NewInvalidConfigError("private key is encrypted, private_key_passphrase is required")
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(creds.privateKeyPassphrase))
+	}
+	if err != nil {
+		return nil, NewInvalidConfigError(fmt.Sprintf("failed to parse private key: %v", err))
+	}
+	return signer, nil
+}
+
+// pinnedHostKey accepts only the host key with the given SHA256 fingerprint.
+// A different key is recorded as pending in store so that it can be reviewed.
+func pinnedHostKey(store *HostKeyStore, fingerprint string) ssh.HostKeyCallback {
+	if !strings.HasPrefix(fingerprint, "SHA256:") {
+		fingerprint = "SHA256:" + fingerprint
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if ssh.FingerprintSHA256(key) == fingerprint {
+			return nil
+		}
+		store.reject(hostname, key)
+		return NewHostKeyError(fmt.Sprintf("host key of %s is %s, pinned %s", hostname, ssh.FingerprintSHA256(key), fingerprint))
+	}
+}
+
+// dialSSH opens the SSH transport of the connection. Host key and
+// authentication failures keep their own error codes.
+func dialSSH(config *ConnectionConfig, creds *credentials) (*ssh.Client, error) {
+	sshConfig, err := sshClientConfig(config, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := ssh.Dial("tcp", config.address(), sshConfig)
+	if err != nil {
+		var deviceErr *DeviceError
+		if errors.As(err, &deviceErr) {
+			return nil, deviceErr
+		}
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			return nil, NewAuthError(err)
+		}
+		return nil, NewConnectionError(err)
+	}
+	return client, nil
+}
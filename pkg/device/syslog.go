@@ -0,0 +1,269 @@
+package device
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SyslogConfig holds the remote syslog forwarding settings
+type SyslogConfig struct {
+	Network            string `yaml:"network" mapstructure:"network"`                           // udp, tcp or tls; empty disables forwarding
+	Address            string `yaml:"address" mapstructure:"address"`                           // host:port of the collector
+	Facility           string `yaml:"facility" mapstructure:"facility"`                         // e.g. local0 (default), auth, user
+	AppName            string `yaml:"app_name" mapstructure:"app_name"`                         // default opt-switch
+	CAFile             string `yaml:"ca_file" mapstructure:"ca_file"`                           // tls: CA certificates of the collector, system roots when empty
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" mapstructure:"insecure_skip_verify"` // tls: do not verify the collector
+}
+
+// syslogFacilities are the RFC 5424 facility codes by name
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Syslog severities of the forwarded entries
+const (
+	syslogWarning = 4 // failed or rejected commands
+	syslogInfo    = 6
+)
+
+const (
+	syslogBuffer      = 1024 // entries waiting to be sent
+	syslogTimeout     = 5 * time.Second
+	syslogRetry       = 10 * time.Second // entries are dropped this long after a failed connection
+	syslogMsgID       = "command_execution"
+	syslogDefaultApp  = "opt-switch"
+	syslogMaxAppName  = 48
+	syslogMaxHostname = 255
+	syslogMaxDatagram = 65000 // below the UDP payload limit, longer messages are truncated
+)
+
+// errSyslogBusy is the reason of entries dropped while the queue is full
+var errSyslogBusy = errors.New("syslog forwarder busy")
+
+// syslogForwarder sends execution log entries to a remote syslog collector
+// as RFC 5424 messages, over UDP or over TCP or TLS with octet counting
+// framing (RFC 6587, RFC 5425). Entries are sent in the background and
+// dropped rather than slowing commands down when the collector is
+// unreachable; drops are counted in syslogDrops.
+type syslogForwarder struct {
+	config    SyslogConfig
+	facility  int
+	hostname  string
+	appName   string
+	procID    string
+	tlsConfig *tls.Config
+
+	entries chan ExecutionLog
+	done    chan struct{}
+	once    sync.Once
+
+	// owned by run
+	conn     net.Conn
+	nextDial time.Time
+	dropped  int // since the collector became unreachable
+}
+
+// newSyslogForwarder checks config and starts a forwarder, nil when
+// forwarding is disabled. The collector is connected on the first entry.
+func newSyslogForwarder(config SyslogConfig) (*syslogForwarder, error) {
+	if config.Network == "" {
+		return nil, nil
+	}
+	switch config.Network {
+	case "udp", "tcp", "tls":
+	default:
+		return nil, NewInvalidConfigError(fmt.Sprintf("log.syslog.network must be udp, tcp or tls, not %q", config.Network))
+	}
+	if _, _, err := net.SplitHostPort(config.Address); err != nil {
+		return nil, NewInvalidConfigError(fmt.Sprintf("log.syslog.address: %v", err))
+	}
+
+	f := &syslogForwarder{
+		config:   config,
+		facility: syslogFacilities["local0"],
+		hostname: syslogField(hostname(), syslogMaxHostname),
+		appName:  syslogField(config.AppName, syslogMaxAppName),
+		procID:   strconv.Itoa(os.Getpid()),
+		entries:  make(chan ExecutionLog, syslogBuffer),
+		done:     make(chan struct{}),
+	}
+	if config.AppName == "" {
+		f.appName = syslogDefaultApp
+	}
+	if config.Facility != "" {
+		facility, ok := syslogFacilities[strings.ToLower(config.Facility)]
+		if !ok {
+			return nil, NewInvalidConfigError(fmt.Sprintf("unknown log.syslog.facility %q", config.Facility))
+		}
+		f.facility = facility
+	}
+	if config.Network == "tls" {
+		host, _, _ := net.SplitHostPort(config.Address)
+		f.tlsConfig = &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: config.InsecureSkipVerify,
+			MinVersion:         tls.VersionTLS12,
+		}
+		if config.CAFile != "" {
+			pem, err := os.ReadFile(config.CAFile)
+			if err != nil {
+				return nil, NewInvalidConfigError(fmt.Sprintf("log.syslog.ca_file: %v", err))
+			}
+			roots := x509.NewCertPool()
+			if !roots.AppendCertsFromPEM(pem) {
+				return nil, NewInvalidConfigError(fmt.Sprintf("log.syslog.ca_file %s holds no certificate", config.CAFile))
+			}
+			f.tlsConfig.RootCAs = roots
+		}
+	}
+
+	go f.run()
+	return f, nil
+}
+
+// Forward queues an entry for the collector
+func (f *syslogForwarder) Forward(entry ExecutionLog) {
+	select {
+	case f.entries <- entry:
+	default:
+		syslogDrops.add(1, errSyslogBusy)
+	}
+}
+
+// Close sends the queued entries and disconnects. Forward must not be
+// called afterwards.
+func (f *syslogForwarder) Close() {
+	f.once.Do(func() { close(f.entries) })
+	<-f.done
+	syslogDrops.flush()
+}
+
+// run sends the queued entries until the forwarder is closed
+func (f *syslogForwarder) run() {
+	defer close(f.done)
+	defer func() {
+		if f.conn != nil {
+			_ = f.conn.Close()
+		}
+	}()
+
+	for entry := range f.entries {
+		if err := f.send(f.format(&entry)); err != nil {
+			f.dropped++
+			syslogDrops.add(1, fmt.Errorf("forward to %s: %w", f.config.Address, err))
+			continue
+		}
+		if f.dropped > 0 {
+			syslogDrops.flush()
+			getServiceLogger().Info("Syslog collector reachable again",
+				zap.String("address", f.config.Address),
+				zap.Int("dropped", f.dropped),
+			)
+			f.dropped = 0
+		}
+	}
+}
+
+// send writes a message, connecting first when needed. A broken stream
+// connection is dialed again once.
+func (f *syslogForwarder) send(msg []byte) error {
+	if f.config.Network != "udp" {
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+	for attempt := 0; ; attempt++ {
+		if f.conn == nil {
+			if time.Now().Before(f.nextDial) {
+				return fmt.Errorf("collector unreachable, retrying at %s", f.nextDial.Format(time.TimeOnly))
+			}
+			conn, err := f.dial()
+			if err != nil {
+				f.nextDial = time.Now().Add(syslogRetry)
+				return err
+			}
+			f.conn = conn
+		}
+
+		_ = f.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+		_, err := f.conn.Write(msg)
+		if err == nil {
+			return nil
+		}
+		_ = f.conn.Close()
+		f.conn = nil
+		if attempt > 0 || f.config.Network == "udp" {
+			return err
+		}
+	}
+}
+
+// dial connects to the collector
+func (f *syslogForwarder) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogTimeout}
+	if f.config.Network == "tls" {
+		return tls.DialWithDialer(dialer, "tcp", f.config.Address, f.tlsConfig)
+	}
+	return dialer.Dial(f.config.Network, f.config.Address)
+}
+
+// format renders an entry as an RFC 5424 message whose MSG is the entry as
+// JSON
+func (f *syslogForwarder) format(entry *ExecutionLog) []byte {
+	severity := syslogInfo
+	if !entry.Success || entry.Policy != "" {
+		severity = syslogWarning
+	}
+	timestamp := "-"
+	if entry.Timestamp > 0 {
+		timestamp = time.Unix(entry.Timestamp, 0).UTC().Format(time.RFC3339)
+	}
+	data, _ := json.Marshal(entry)
+
+	msg := fmt.Sprintf("<%d>1 %s %s %s %s %s - ",
+		f.facility*8+severity, timestamp, f.hostname, f.appName, f.procID, syslogMsgID)
+	out := append([]byte(msg), data...)
+	if f.config.Network == "udp" && len(out) > syslogMaxDatagram {
+		out = out[:syslogMaxDatagram]
+	}
+	return out
+}
+
+// hostname returns the host name reported to the collector
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// syslogField makes s a valid header field: printable ASCII without spaces,
+// at most max characters, "-" when empty
+func syslogField(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+		return r
+	}, s)
+	if len(s) > max {
+		s = s[:max]
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
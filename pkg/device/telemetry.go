@@ -0,0 +1,653 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TelemetryConfig holds the switch telemetry settings. The collector runs
+// the commands on every registered device each interval, turns the parsed
+// output into series and keeps them at three resolutions: the samples
+// themselves, 5 minute and hourly rollups, each with its own retention.
+type TelemetryConfig struct {
+	Enabled   bool               `yaml:"enabled" mapstructure:"enabled"`
+	Interval  int                `yaml:"interval" mapstructure:"interval"` // seconds between collections
+	Commands  []string           `yaml:"commands" mapstructure:"commands"` // commands with an output parser, see telemetryValues
+	Retention TelemetryRetention `yaml:"retention" mapstructure:"retention"`
+}
+
+// TelemetryRetention holds how long each resolution is kept
+type TelemetryRetention struct {
+	Raw        int `yaml:"raw" mapstructure:"raw"`                 // hours of samples
+	FiveMinute int `yaml:"five_minute" mapstructure:"five_minute"` // days of 5 minute rollups
+	Hourly     int `yaml:"hourly" mapstructure:"hourly"`           // days of hourly rollups
+}
+
+// defaultTelemetryCommands cover interface counters, CPU, memory and the
+// environment of the CLIs the built-in parsers read
+var defaultTelemetryCommands = []string{
+	"show interfaces",
+	"show processes cpu",
+	"show processes memory",
+	"show environment",
+}
+
+// withDefaults fills in the defaults of the telemetry settings
+func (c TelemetryConfig) withDefaults() TelemetryConfig {
+	if c.Interval <= 0 {
+		c.Interval = 60
+	}
+	if len(c.Commands) == 0 {
+		c.Commands = defaultTelemetryCommands
+	}
+	if c.Retention.Raw <= 0 {
+		c.Retention.Raw = 24
+	}
+	if c.Retention.FiveMinute <= 0 {
+		c.Retention.FiveMinute = 7
+	}
+	if c.Retention.Hourly <= 0 {
+		c.Retention.Hourly = 90
+	}
+	return c
+}
+
+// Resolutions of the stored points in seconds
+const (
+	TelemetryRaw        = 0 // a sample at the collection interval
+	TelemetryFiveMinute = 300
+	TelemetryHourly     = 3600
+)
+
+// telemetryTier is a resolution and how far back it reaches
+type telemetryTier struct {
+	resolution int
+	period     time.Duration // time covered by a point
+	retention  time.Duration
+}
+
+// tiers returns the resolutions from the finest to the coarsest
+func (c TelemetryConfig) tiers() []telemetryTier {
+	return []telemetryTier{
+		{TelemetryRaw, time.Duration(c.Interval) * time.Second, time.Duration(c.Retention.Raw) * time.Hour},
+		{TelemetryFiveMinute, TelemetryFiveMinute * time.Second, time.Duration(c.Retention.FiveMinute) * 24 * time.Hour},
+		{TelemetryHourly, TelemetryHourly * time.Second, time.Duration(c.Retention.Hourly) * 24 * time.Hour},
+	}
+}
+
+// TelemetryPoint is a stored point of a series: a sample, or the aggregate
+// of the samples of a rollup period. Points of the same period are merged
+// when queried, so a rollup flushed early by a restart is not lost.
+type TelemetryPoint struct {
+	DeviceID   int
+	Name       string    // e.g. interface_in_bps
+	Label      string    // the instance, e.g. the interface, empty for device wide series
+	Resolution int       // TelemetryRaw, TelemetryFiveMinute or TelemetryHourly
+	Time       time.Time // the sample time or the start of the period
+	Count      int64
+	Sum        float64
+	Min        float64
+	Max        float64
+}
+
+// add merges a sample or a point into p
+func (p *TelemetryPoint) add(count int64, sum, min, max float64) {
+	if p.Count == 0 || min < p.Min {
+		p.Min = min
+	}
+	if p.Count == 0 || max > p.Max {
+		p.Max = max
+	}
+	p.Count += count
+	p.Sum += sum
+}
+
+// TelemetryStore keeps the telemetry points, e.g. in a database table.
+// Query returns the points of a resolution within [q.From, q.To] matching
+// the device, name and label of q.
+type TelemetryStore interface {
+	Append(points []TelemetryPoint) error
+	Query(q *TelemetryQuery, resolution int) ([]TelemetryPoint, error)
+	Prune(resolution int, before time.Time) error
+}
+
+var telemetry struct {
+	sync.RWMutex
+	store TelemetryStore
+}
+
+// SetTelemetryStore installs the store the collector writes to and queries
+// read from. nil stops storing telemetry.
+func SetTelemetryStore(store TelemetryStore) {
+	telemetry.Lock()
+	defer telemetry.Unlock()
+	telemetry.store = store
+}
+
+// GetTelemetryStore returns the installed telemetry store, nil for none
+func GetTelemetryStore() TelemetryStore {
+	telemetry.RLock()
+	defer telemetry.RUnlock()
+	return telemetry.store
+}
+
+// TelemetryQuery selects a series and the time range of a chart
+type TelemetryQuery struct {
+	DeviceID int
+	Name     string
+	Label    string // all instances when empty
+	From     time.Time
+	To       time.Time
+	Step     time.Duration // width of a chart point, chosen from the range when zero
+}
+
+const (
+	telemetryPoints    = 300   // chart points when no step is given
+	telemetryMaxPoints = 11000 // chart points of a series at most
+)
+
+// SeriesPoint is a chart point: the samples within [Time, Time+step)
+type SeriesPoint struct {
+	Time int64   `json:"t"` // unix seconds
+	Avg  float64 `json:"avg"`
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+}
+
+// TelemetrySeries is the chart of one instance of a series
+type TelemetrySeries struct {
+	Label  string        `json:"label"`
+	Points []SeriesPoint `json:"points"`
+}
+
+// TelemetryResult is the answer to a TelemetryQuery
+type TelemetryResult struct {
+	Name       string            `json:"name"`
+	DeviceID   int               `json:"deviceId"`
+	From       int64             `json:"from"`
+	To         int64             `json:"to"`
+	Step       int64             `json:"step"`       // seconds
+	Resolution int               `json:"resolution"` // resolution the points were read from
+	Series     []TelemetrySeries `json:"series"`
+}
+
+// QueryTelemetry returns the series of q, one per instance, with a point per
+// step. It reads the coarsest resolution that is still finer than the step
+// and reaches back to q.From, and merges its points into steps.
+func QueryTelemetry(q *TelemetryQuery) (*TelemetryResult, error) {
+	store := GetTelemetryStore()
+	if store == nil {
+		return nil, NewNotSupportedError("telemetry storage is not available, run the database migration")
+	}
+	cfg := TelemetryConfig{}
+	if c := GetConfig(); c != nil {
+		cfg = c.Telemetry
+	}
+	return queryTelemetry(store, cfg.withDefaults(), q, time.Now())
+}
+
+func queryTelemetry(store TelemetryStore, cfg TelemetryConfig, q *TelemetryQuery, now time.Time) (*TelemetryResult, error) {
+	if q.Name == "" {
+		return nil, NewInvalidParamError("name is required")
+	}
+	if q.DeviceID == 0 {
+		q.DeviceID = DefaultDeviceID
+	}
+	if q.To.IsZero() {
+		q.To = now
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-time.Hour)
+	}
+	if !q.From.Before(q.To) {
+		return nil, NewInvalidParamError("from must be before to")
+	}
+	span := q.To.Sub(q.From)
+	if q.Step == 0 {
+		q.Step = (span / telemetryPoints).Truncate(time.Second)
+		if min := time.Duration(cfg.Interval) * time.Second; q.Step < min {
+			q.Step = min
+		}
+	}
+	if q.Step < time.Second {
+		return nil, NewInvalidParamError("step must be at least one second")
+	}
+	if span/q.Step > telemetryMaxPoints {
+		return nil, NewInvalidParamError(fmt.Sprintf("the range holds more than %d steps, use a larger step", telemetryMaxPoints))
+	}
+
+	tier := selectTier(cfg.tiers(), q, now)
+	points, err := store.Query(q, tier.resolution)
+	if err != nil {
+		return nil, err
+	}
+	return &TelemetryResult{
+		Name:       q.Name,
+		DeviceID:   q.DeviceID,
+		From:       q.From.Unix(),
+		To:         q.To.Unix(),
+		Step:       int64(q.Step / time.Second),
+		Resolution: tier.resolution,
+		Series:     downsample(points, q.Step),
+	}, nil
+}
+
+// selectTier returns the coarsest tier whose points are no wider than the
+// step among those still holding q.From, the finest of those when all are
+// wider, and the coarsest tier when none reaches back far enough
+func selectTier(tiers []telemetryTier, q *TelemetryQuery, now time.Time) telemetryTier {
+	best := -1
+	for i, t := range tiers {
+		if q.From.Before(now.Add(-t.retention)) {
+			continue
+		}
+		if best == -1 || t.period <= q.Step {
+			best = i
+		}
+	}
+	if best == -1 {
+		best = len(tiers) - 1
+	}
+	return tiers[best]
+}
+
+// downsample merges the points into steps aligned to the unix epoch, one
+// series per label
+func downsample(points []TelemetryPoint, step time.Duration) []TelemetrySeries {
+	width := int64(step / time.Second)
+	byLabel := make(map[string]map[int64]*TelemetryPoint)
+	for i := range points {
+		p := &points[i]
+		steps := byLabel[p.Label]
+		if steps == nil {
+			steps = make(map[int64]*TelemetryPoint)
+			byLabel[p.Label] = steps
+		}
+		t := p.Time.Unix()
+		t -= t % width
+		merged := steps[t]
+		if merged == nil {
+			merged = &TelemetryPoint{Time: time.Unix(t, 0)}
+			steps[t] = merged
+		}
+		merged.add(p.Count, p.Sum, p.Min, p.Max)
+	}
+
+	series := make([]TelemetrySeries, 0, len(byLabel))
+	for label, steps := range byLabel {
+		s := TelemetrySeries{Label: label, Points: make([]SeriesPoint, 0, len(steps))}
+		for t, p := range steps {
+			s.Points = append(s.Points, SeriesPoint{Time: t, Avg: p.Sum / float64(p.Count), Min: p.Min, Max: p.Max})
+		}
+		sort.Slice(s.Points, func(i, j int) bool { return s.Points[i].Time < s.Points[j].Time })
+		series = append(series, s)
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].Label < series[j].Label })
+	return series
+}
+
+// telemetryValue is a value read from the parsed output of a command
+type telemetryValue struct {
+	name    string
+	label   string
+	value   float64
+	counter bool // a monotonic counter, stored as its rate per second
+}
+
+// telemetryValues turns the parsed output of a command into values. Commands
+// whose output parses into another type yield none.
+func telemetryValues(parsed interface{}) []telemetryValue {
+	var values []telemetryValue
+	switch v := parsed.(type) {
+	case []InterfaceInfo:
+		for _, itf := range v {
+			up := 0.0
+			if itf.ProtocolStatus == "up" {
+				up = 1
+			}
+			values = append(values,
+				telemetryValue{name: "interface_up", label: itf.Name, value: up},
+				telemetryValue{name: "interface_in_bps", label: itf.Name, value: float64(itf.InputBytes) * 8, counter: true},
+				telemetryValue{name: "interface_out_bps", label: itf.Name, value: float64(itf.OutputBytes) * 8, counter: true},
+				telemetryValue{name: "interface_in_errors", label: itf.Name, value: float64(itf.InputErrors), counter: true},
+				telemetryValue{name: "interface_out_errors", label: itf.Name, value: float64(itf.OutputErrors), counter: true},
+			)
+		}
+	case *CPUInfo:
+		values = append(values, telemetryValue{name: "cpu_usage_percent", value: v.OneMinute})
+	case *MemoryInfo:
+		values = append(values,
+			telemetryValue{name: "memory_used_bytes", value: float64(v.Used)},
+			telemetryValue{name: "memory_free_bytes", value: float64(v.Free)},
+			telemetryValue{name: "memory_usage_percent", value: v.UsagePercent},
+		)
+	case *EnvironmentInfo:
+		for _, t := range v.Temperatures {
+			values = append(values, telemetryValue{name: "temperature_celsius", label: t.Sensor, value: t.Celsius})
+		}
+		for _, c := range v.PowerSupplies {
+			values = append(values, telemetryValue{name: "psu_ok", label: c.Name, value: boolValue(c.OK)})
+		}
+		for _, c := range v.Fans {
+			values = append(values, telemetryValue{name: "fan_ok", label: c.Name, value: boolValue(c.OK)})
+		}
+	}
+	return uniqueLabels(values)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// uniqueLabels numbers the instances of a series that share a label, e.g.
+// the sensors of the members of a stack
+func uniqueLabels(values []telemetryValue) []telemetryValue {
+	seen := make(map[string]int, len(values))
+	for i := range values {
+		key := values[i].name + "\x00" + values[i].label
+		seen[key]++
+		if n := seen[key]; n > 1 {
+			values[i].label = fmt.Sprintf("%s #%d", values[i].label, n)
+		}
+	}
+	return values
+}
+
+// seriesKey identifies a series of a device
+type seriesKey struct {
+	deviceID int
+	name     string
+	label    string
+}
+
+// counterSample is the last reading of a counter
+type counterSample struct {
+	value float64
+	time  time.Time
+}
+
+// rollupKey identifies an open rollup period of a series
+type rollupKey struct {
+	seriesKey
+	resolution int
+}
+
+// TelemetryCollector runs the telemetry commands on the registered devices
+// and writes the samples and rollups to the telemetry store
+type TelemetryCollector struct {
+	mu       sync.Mutex
+	config   TelemetryConfig
+	counters map[seriesKey]counterSample
+	rollups  map[rollupKey]*TelemetryPoint
+	errors   map[string]string // last error per device and command, reported once
+	pruned   time.Time
+	reset    chan struct{}
+	ctx      context.Context // cancelled by Stop, ends the running collection
+	cancel   context.CancelFunc
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewTelemetryCollector starts a collector. It only collects while enabled
+// and a store is installed.
+func NewTelemetryCollector(config TelemetryConfig) *TelemetryCollector {
+	c := &TelemetryCollector{
+		config:   config.withDefaults(),
+		counters: make(map[seriesKey]counterSample),
+		rollups:  make(map[rollupKey]*TelemetryPoint),
+		errors:   make(map[string]string),
+		reset:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	go c.run()
+	return c
+}
+
+// SetConfig replaces the telemetry settings, a new interval applies from
+// the next collection
+func (c *TelemetryCollector) SetConfig(config TelemetryConfig) {
+	c.mu.Lock()
+	c.config = config.withDefaults()
+	c.mu.Unlock()
+	select {
+	case c.reset <- struct{}{}:
+	default:
+	}
+}
+
+// Config returns the telemetry settings with their defaults
+func (c *TelemetryCollector) Config() TelemetryConfig {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.config
+}
+
+// Stop stops collecting and writes the open rollups
+func (c *TelemetryCollector) Stop() {
+	c.once.Do(func() {
+		c.cancel()
+		<-c.done
+		if store := GetTelemetryStore(); store != nil {
+			c.mu.Lock()
+			points := c.flush(time.Time{})
+			c.mu.Unlock()
+			c.write(store, points)
+		}
+	})
+}
+
+func (c *TelemetryCollector) run() {
+	defer close(c.done)
+	for {
+		timer := time.NewTimer(time.Duration(c.Config().Interval) * time.Second)
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			return
+		case <-c.reset:
+			timer.Stop()
+		case now := <-timer.C:
+			c.Collect(c.ctx, now)
+		}
+	}
+}
+
+// Collect runs one collection on every registered device, writes the samples
+// and the rollups whose period ended, and removes the points past their
+// retention once an hour
+func (c *TelemetryCollector) Collect(ctx context.Context, now time.Time) {
+	c.collect(ctx, GetRegistry(), GetTelemetryStore(), now)
+}
+
+func (c *TelemetryCollector) collect(ctx context.Context, registry *Registry, store TelemetryStore, now time.Time) {
+	cfg := c.Config()
+	if !cfg.Enabled || store == nil || registry == nil {
+		return
+	}
+	now = now.Truncate(time.Second)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Interval)*time.Second)
+	defer cancel()
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		samples = make(map[int][]telemetryValue)
+	)
+	for _, id := range registry.IDs() {
+		pool, err := registry.Get(id)
+		if err != nil {
+			continue // unregistered meanwhile
+		}
+		wg.Add(1)
+		go func(id int, pool *ConnectionPool) {
+			defer wg.Done()
+			values := c.collectDevice(ctx, id, pool, cfg.Commands)
+			mu.Lock()
+			samples[id] = values
+			mu.Unlock()
+		}(id, pool)
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	points := c.flush(now)
+	for id, values := range samples {
+		points = append(points, c.record(id, values, now)...)
+	}
+	c.expireCounters(now, 3*time.Duration(cfg.Interval)*time.Second)
+	prune := now.Sub(c.pruned) >= time.Hour
+	if prune {
+		c.pruned = now
+	}
+	c.mu.Unlock()
+
+	c.write(store, points)
+	if prune {
+		for _, tier := range cfg.tiers() {
+			if err := store.Prune(tier.resolution, now.Add(-tier.retention)); err != nil {
+				getServiceLogger().Warn("Failed to remove expired telemetry", zap.Error(err))
+			}
+		}
+	}
+}
+
+// collectDevice runs the commands on a device and returns the values of the
+// outputs that parsed. Failures are reported when they first occur.
+func (c *TelemetryCollector) collectDevice(ctx context.Context, id int, pool *ConnectionPool, commands []string) []telemetryValue {
+	cfg := pool.Config()
+	timeout := time.Duration(cfg.Pool.CommandTimeout) * time.Second
+	// Polls yield to operators and jobs waiting for the device
+	results, err := pool.Execute(WithPriority(ctx, PriorityMonitoring), commands, timeout)
+	if err != nil {
+		c.report(id, "", err.Error())
+		return nil
+	}
+	c.report(id, "", "")
+
+	var values []telemetryValue
+	for _, result := range results {
+		if !result.Success {
+			c.report(id, result.Command, result.Error)
+			continue
+		}
+		parsed, err := ParseOutput(cfg.Connection.Vendor, result.Command, result.Output)
+		if err != nil {
+			c.report(id, result.Command, err.Error())
+			continue
+		}
+		c.report(id, result.Command, "")
+		values = append(values, telemetryValues(parsed)...)
+	}
+	return values
+}
+
+// report prints a collection error of a device the first time it occurs
+// and when it clears; an empty msg clears it
+func (c *TelemetryCollector) report(id int, command, msg string) {
+	key := fmt.Sprintf("%d\x00%s", id, command)
+	c.mu.Lock()
+	prev := c.errors[key]
+	if msg == "" {
+		delete(c.errors, key)
+	} else {
+		c.errors[key] = msg
+	}
+	c.mu.Unlock()
+
+	if msg == prev {
+		return
+	}
+	if command == "" {
+		command = "telemetry commands"
+	}
+	if msg == "" {
+		getServiceLogger().Info("Telemetry recovered", zap.Int("device_id", id), zap.String("command", command))
+		return
+	}
+	getServiceLogger().Warn("Telemetry failed",
+		zap.Int("device_id", id),
+		zap.String("command", command),
+		zap.String("error", msg),
+	)
+}
+
+// record turns the values of a device into samples and adds them to the
+// open rollups. Counters become rates from their previous reading, the first
+// reading and a reset yield none. c.mu must be held.
+func (c *TelemetryCollector) record(id int, values []telemetryValue, now time.Time) []TelemetryPoint {
+	points := make([]TelemetryPoint, 0, len(values))
+	for _, v := range values {
+		key := seriesKey{deviceID: id, name: v.name, label: v.label}
+		value := v.value
+		if v.counter {
+			prev, ok := c.counters[key]
+			c.counters[key] = counterSample{value: v.value, time: now}
+			elapsed := now.Sub(prev.time).Seconds()
+			if !ok || v.value < prev.value || elapsed <= 0 {
+				continue
+			}
+			value = (v.value - prev.value) / elapsed
+		}
+
+		points = append(points, TelemetryPoint{
+			DeviceID: id, Name: v.name, Label: v.label, Resolution: TelemetryRaw,
+			Time: now, Count: 1, Sum: value, Min: value, Max: value,
+		})
+		for _, resolution := range []int{TelemetryFiveMinute, TelemetryHourly} {
+			rk := rollupKey{seriesKey: key, resolution: resolution}
+			r := c.rollups[rk]
+			if r == nil {
+				start := now.Unix()
+				r = &TelemetryPoint{
+					DeviceID: id, Name: v.name, Label: v.label, Resolution: resolution,
+					Time: time.Unix(start-start%int64(resolution), 0),
+				}
+				c.rollups[rk] = r
+			}
+			r.add(1, value, value, value)
+		}
+	}
+	return points
+}
+
+// flush removes and returns the rollups whose period ended by now, all of
+// them when now is zero. c.mu must be held.
+func (c *TelemetryCollector) flush(now time.Time) []TelemetryPoint {
+	var points []TelemetryPoint
+	for key, r := range c.rollups {
+		end := r.Time.Add(time.Duration(r.Resolution) * time.Second)
+		if now.IsZero() || !now.Before(end) {
+			points = append(points, *r)
+			delete(c.rollups, key)
+		}
+	}
+	return points
+}
+
+// expireCounters forgets the counters not read for longer than age, e.g.
+// those of removed interfaces and devices. c.mu must be held.
+func (c *TelemetryCollector) expireCounters(now time.Time, age time.Duration) {
+	for key, s := range c.counters {
+		if now.Sub(s.time) > age {
+			delete(c.counters, key)
+		}
+	}
+}
+
+func (c *TelemetryCollector) write(store TelemetryStore, points []TelemetryPoint) {
+	if len(points) == 0 {
+		return
+	}
+	if err := store.Append(points); err != nil {
+		getServiceLogger().Warn("Failed to store telemetry points", zap.Int("points", len(points)), zap.Error(err))
+	}
+}
@@ -0,0 +1,198 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// telemetryAdapter is a switch whose interface counters grow by 7500 bytes
+// per reading and whose environment command is rejected
+type telemetryAdapter struct {
+	bytes *atomic.Int64
+}
+
+func (telemetryAdapter) Connect(ctx context.Context, config *ConnectionConfig) error { return nil }
+func (telemetryAdapter) Disconnect(ctx context.Context) error                        { return nil }
+func (telemetryAdapter) IsConnected() bool                                           { return true }
+func (telemetryAdapter) ProtocolType() ProtocolType                                  { return ProtocolSSH }
+
+func (a telemetryAdapter) ExecuteCommand(ctx context.Context, cmd string) (*CommandResult, error) {
+	result := &CommandResult{Command: cmd, Success: true, Timestamp: time.Now().Unix()}
+	switch cmd {
+	case "show interfaces":
+		n := a.bytes.Add(7500)
+		result.Output = fmt.Sprintf("Gi1/0/1 is up, line protocol is up\n     10 packets input, %d bytes, 0 no buffer\n", n)
+	case "show processes cpu":
+		result.Output = "CPU utilization for five seconds: 9%/0%; one minute: 8%; five minutes: 7%\n"
+	default:
+		result.Success, result.Error = false, "% Invalid input detected"
+	}
+	return result, nil
+}
+
+// memoryTelemetry is a telemetry store in memory
+type memoryTelemetry struct {
+	mu     sync.Mutex
+	points []TelemetryPoint
+}
+
+func (m *memoryTelemetry) Append(points []TelemetryPoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.points = append(m.points, points...)
+	return nil
+}
+
+func (m *memoryTelemetry) Query(q *TelemetryQuery, resolution int) ([]TelemetryPoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var points []TelemetryPoint
+	for _, p := range m.points {
+		if p.DeviceID == q.DeviceID && p.Name == q.Name && p.Resolution == resolution &&
+			!p.Time.Before(q.From) && !p.Time.After(q.To) && (q.Label == "" || p.Label == q.Label) {
+			points = append(points, p)
+		}
+	}
+	return points, nil
+}
+
+func (m *memoryTelemetry) Prune(resolution int, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.points[:0]
+	for _, p := range m.points {
+		if p.Resolution != resolution || !p.Time.Before(before) {
+			kept = append(kept, p)
+		}
+	}
+	m.points = kept
+	return nil
+}
+
+// find returns the stored points of a series at a resolution
+func (m *memoryTelemetry) find(name string, resolution int) []TelemetryPoint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var points []TelemetryPoint
+	for _, p := range m.points {
+		if p.Name == name && p.Resolution == resolution {
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+func newTelemetryRegistry(t *testing.T) *Registry {
+	t.Helper()
+	cfg := &DeviceConfig{Connection: ConnectionConfig{Protocol: string(ProtocolSSH)}}
+	applyDefaults(cfg)
+	cfg.Pool.MinConnections = 0
+	pool, err := NewConnectionPool(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := &atomic.Int64{}
+	pool.newAdapter = func() ProtocolAdapter { return telemetryAdapter{bytes: counter} }
+	pool.id = DefaultDeviceID
+	if err := pool.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Stop() })
+	return &Registry{pools: map[int]*ConnectionPool{DefaultDeviceID: pool}}
+}
+
+func TestTelemetryCollector(t *testing.T) {
+	store := &memoryTelemetry{}
+	SetTelemetryStore(store)
+	t.Cleanup(func() { SetTelemetryStore(nil) })
+	registry := newTelemetryRegistry(t)
+
+	cfg := TelemetryConfig{Enabled: true, Commands: []string{"show interfaces", "show processes cpu", "show environment"}}
+	c := NewTelemetryCollector(cfg)
+	base := time.Unix(1800000000-1800000000%3600, 0)
+	for i := 0; i <= 5; i++ {
+		c.collect(context.Background(), registry, store, base.Add(time.Duration(i)*time.Minute))
+	}
+
+	if raw := store.find("cpu_usage_percent", TelemetryRaw); len(raw) != 6 || raw[0].Sum != 8 {
+		t.Fatalf("cpu samples = %+v, want 6 of 8%%", raw)
+	}
+	// the first reading of a counter has no rate
+	raw := store.find("interface_in_bps", TelemetryRaw)
+	if len(raw) != 5 || raw[0].Label != "Gi1/0/1" || raw[0].Sum != 1000 {
+		t.Fatalf("interface samples = %+v, want 5 of 1000 bps", raw)
+	}
+	// the 5 minute period ended with the last collection, the hour did not
+	rollups := store.find("cpu_usage_percent", TelemetryFiveMinute)
+	if len(rollups) != 1 || rollups[0].Count != 5 || !rollups[0].Time.Equal(base) {
+		t.Errorf("5 minute rollups = %+v", rollups)
+	}
+	if hourly := store.find("cpu_usage_percent", TelemetryHourly); len(hourly) != 0 {
+		t.Errorf("hourly rollups before the hour ended = %+v", hourly)
+	}
+	if len(store.find("temperature_celsius", TelemetryRaw)) != 0 {
+		t.Error("stored values of a rejected command")
+	}
+
+	c.Stop()
+	if hourly := store.find("cpu_usage_percent", TelemetryHourly); len(hourly) != 1 || hourly[0].Count != 6 {
+		t.Errorf("hourly rollups after stop = %+v", hourly)
+	}
+
+	result, err := queryTelemetry(store, cfg.withDefaults(), &TelemetryQuery{
+		Name: "interface_in_bps", From: base, To: base.Add(5 * time.Minute), Step: 2 * time.Minute,
+	}, base.Add(5*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Resolution != TelemetryRaw || len(result.Series) != 1 || len(result.Series[0].Points) != 3 {
+		t.Fatalf("result = %+v", result)
+	}
+	if p := result.Series[0].Points[1]; p.Time != base.Unix()+120 || p.Avg != 1000 || p.Max != 1000 {
+		t.Errorf("point = %+v", p)
+	}
+}
+
+func TestTelemetryQuery(t *testing.T) {
+	cfg := TelemetryConfig{}.withDefaults()
+	now := time.Unix(1800000000, 0)
+	tests := []struct {
+		name string
+		from time.Duration // before now
+		step time.Duration
+		want int
+	}{
+		{"recent", time.Hour, time.Minute, TelemetryRaw},
+		{"recent wide steps", 6 * time.Hour, 10 * time.Minute, TelemetryFiveMinute},
+		{"past raw retention", 2 * 24 * time.Hour, time.Minute, TelemetryFiveMinute},
+		{"hourly steps", 2 * 24 * time.Hour, time.Hour, TelemetryHourly},
+		{"past every retention", 200 * 24 * time.Hour, time.Minute, TelemetryHourly},
+	}
+	for _, tt := range tests {
+		q := &TelemetryQuery{From: now.Add(-tt.from), To: now, Step: tt.step}
+		if got := selectTier(cfg.tiers(), q, now).resolution; got != tt.want {
+			t.Errorf("%s: resolution = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	store := &memoryTelemetry{}
+	for _, q := range []TelemetryQuery{
+		{},
+		{Name: "cpu_usage_percent", From: now, To: now.Add(-time.Hour)},
+		{Name: "cpu_usage_percent", From: now.Add(-30 * 24 * time.Hour), To: now, Step: time.Second},
+	} {
+		if _, err := queryTelemetry(store, cfg, &q, now); !isDeviceError(err, ErrInvalidParam) {
+			t.Errorf("query %+v error = %v, want invalid parameter", q, err)
+		}
+	}
+
+	// about 300 points of at least the interval by default
+	result, err := queryTelemetry(store, cfg, &TelemetryQuery{Name: "cpu_usage_percent"}, now)
+	if err != nil || result.Step != 60 || result.From != now.Unix()-3600 || result.DeviceID != DefaultDeviceID {
+		t.Errorf("default query = %+v, %v", result, err)
+	}
+}
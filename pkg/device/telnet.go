@@ -1,39 +1,43 @@
 package device
 
 import (
-	"bufio"
 	"context"
 	"fmt"
-	"io"
 	"net"
-	"strings"
 	"time"
 )
 
-const telnetTimeout = 10 * time.Second
+// Telnet command bytes
+const (
+	telnetIAC = 255 // interpret as command
+	telnetNOP = 241 // no operation
+)
 
 // TelnetAdapter implements ProtocolAdapter for Telnet protocol
 type TelnetAdapter struct {
 	conn      net.Conn
-	reader    *bufio.Reader
-	writer    io.Writer
+	session   *cliSession
+	profile   *DeviceProfile
 	connected bool
-	prompt    string
 }
 
 // NewTelnetAdapter creates a new Telnet adapter
 func NewTelnetAdapter() *TelnetAdapter {
-	return &TelnetAdapter{
-		prompt: "#|>|\\$",
-	}
+	return &TelnetAdapter{}
 }
 
-// Connect establishes a Telnet connection
+// Connect establishes a Telnet connection, logs in and prepares the CLI as
+// described by the device profile of the connection vendor
 func (a *TelnetAdapter) Connect(ctx context.Context, config *ConnectionConfig) error {
+	creds, err := config.credentials()
+	if err != nil {
+		return err
+	}
 	address := fmt.Sprintf("%s:%d", config.Host, config.Port)
+	timeout := time.Duration(config.Timeout) * time.Second
 
 	dialer := net.Dialer{
-		Timeout: time.Duration(config.Timeout) * time.Second,
+		Timeout: timeout,
 	}
 
 	conn, err := dialer.DialContext(ctx, "tcp", address)
@@ -42,39 +46,17 @@ func (a *TelnetAdapter) Connect(ctx context.Context, config *ConnectionConfig) e
 	}
 
 	a.conn = conn
-	a.reader = bufio.NewReader(conn)
-	a.writer = conn
+	a.profile = LookupProfile(config.Vendor)
+	a.session = newCLISession(conn, conn, a.profile, "\r\n", timeout)
 	a.connected = true
 
-	if config.Username != "" {
-		if err := a.login(ctx, config); err != nil {
-			a.Disconnect(ctx)
-			return err
-		}
-	}
-
-	return nil
-}
-
-func (a *TelnetAdapter) login(ctx context.Context, config *ConnectionConfig) error {
-	if err := a.waitFor(ctx, "ogin:"); err != nil {
-		return NewAuthError(err)
-	}
-
-	if _, err := fmt.Fprintf(a.writer, "%s\r\n", config.Username); err != nil {
+	if err := a.session.login(ctx, config.Username, creds.password); err != nil {
+		a.Disconnect(ctx)
 		return NewAuthError(err)
 	}
-
-	if err := a.waitFor(ctx, "assword:"); err != nil {
-		return NewAuthError(err)
-	}
-
-	if _, err := fmt.Fprintf(a.writer, "%s\r\n", config.Password); err != nil {
-		return NewAuthError(err)
-	}
-
-	if err := a.waitForPrompt(ctx); err != nil {
-		return NewAuthError(err)
+	if err := a.session.prepare(ctx, creds.enable()); err != nil {
+		a.Disconnect(ctx)
+		return NewConnectionError(err)
 	}
 
 	return nil
@@ -83,32 +65,26 @@ func (a *TelnetAdapter) login(ctx context.Context, config *ConnectionConfig) err
 // Disconnect closes the Telnet connection
 func (a *TelnetAdapter) Disconnect(ctx context.Context) error {
 	if a.conn != nil {
+		a.session.close()
 		err := a.conn.Close()
 		a.conn = nil
-		a.reader = nil
-		a.writer = nil
+		a.session = nil
 		a.connected = false
 		return err
 	}
 	return nil
 }
 
-// ExecuteCommand executes a single command
+// ExecuteCommand executes a single command. A command whose output matches
+// an error pattern of the device profile is unsuccessful, but leaves the
+// connection usable.
 func (a *TelnetAdapter) ExecuteCommand(ctx context.Context, cmd string) (*CommandResult, error) {
 	if !a.connected {
 		return nil, NewConnectionError(fmt.Errorf("not connected"))
 	}
 
-	if _, err := fmt.Fprintf(a.writer, "%s\r\n", cmd); err != nil {
-		return nil, NewCommandFailedError(err)
-	}
-
-	if _, err := a.reader.ReadString('\n'); err != nil {
-		return nil, NewCommandFailedError(err)
-	}
-
 	startTime := time.Now()
-	output, err := a.readUntilPrompt(ctx)
+	output, err := a.session.run(ctx, cmd)
 	duration := time.Since(startTime)
 
 	result := &CommandResult{
@@ -121,114 +97,37 @@ func (a *TelnetAdapter) ExecuteCommand(ctx context.Context, cmd string) (*Comman
 
 	if err != nil {
 		result.Error = err.Error()
+		// the rest of the output would be read as the output of the next
+		// command, unless the device gets back to the prompt
+		if ctx.Err() == nil || a.session.interrupt() != nil {
+			a.Disconnect(ctx)
+		}
 		if ctx.Err() == context.DeadlineExceeded {
 			return nil, NewCommandTimeoutError()
 		}
 		return result, NewCommandFailedError(err)
 	}
 
-	return result, nil
-}
-
-func (a *TelnetAdapter) waitFor(ctx context.Context, waitStr string) error {
-	timeout := time.After(telnetTimeout)
-	buf := make([]byte, 1)
-
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-timeout:
-			return fmt.Errorf("timeout waiting for '%s'", waitStr)
-		default:
-			n, err := a.reader.Read(buf)
-			if err != nil {
-				return err
-			}
-			if n > 0 && strings.Contains(string(buf), waitStr) {
-				return nil
-			}
-		}
+	if err := a.profile.CheckOutput(output); err != nil {
+		result.Success = false
+		result.Error = err.Error()
 	}
-}
 
-func (a *TelnetAdapter) waitForPrompt(ctx context.Context) error {
-	timeout := time.After(telnetTimeout)
-	buf := make([]byte, 4096)
-	output := ""
-
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-timeout:
-			return fmt.Errorf("timeout waiting for prompt")
-		default:
-			a.conn.SetReadDeadline(time.Now().Add(1 * time.Second))
-			n, err := a.reader.Read(buf)
-			if err != nil {
-				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-					continue
-				}
-				return err
-			}
-			if n > 0 {
-				output += string(buf[:n])
-				if strings.Contains(output, "#") || strings.Contains(output, ">") || strings.Contains(output, "$") {
-					return nil
-				}
-			}
-		}
-	}
+	return result, nil
 }
 
-func (a *TelnetAdapter) readUntilPrompt(ctx context.Context) (string, error) {
-	timeout := time.After(telnetTimeout)
-	buf := make([]byte, 4096)
-	var output strings.Builder
-
-	for {
-		select {
-		case <-ctx.Done():
-			return output.String(), ctx.Err()
-		case <-timeout:
-			return output.String(), fmt.Errorf("timeout reading output")
-		default:
-			a.conn.SetReadDeadline(time.Now().Add(1 * time.Second))
-			n, err := a.reader.Read(buf)
-			if err != nil {
-				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-					out := output.String()
-					if strings.Contains(out, "#") || strings.Contains(out, ">") || strings.Contains(out, "$") {
-						lines := strings.Split(out, "\n")
-						if len(lines) > 0 {
-							lastLine := strings.TrimSpace(lines[len(lines)-1])
-							if len(lastLine) <= 3 && (strings.HasSuffix(lastLine, "#") || strings.HasSuffix(lastLine, ">") || strings.HasSuffix(lastLine, "$")) {
-								out = strings.Join(lines[:len(lines)-1], "\n")
-							}
-						}
-						return out, nil
-					}
-					continue
-				}
-				return output.String(), err
-			}
-			if n > 0 {
-				output.Write(buf[:n])
-				out := output.String()
-				if strings.Contains(out, "#") || strings.Contains(out, ">") || strings.Contains(out, "$") {
-					lines := strings.Split(out, "\n")
-					if len(lines) > 0 {
-						lastLine := strings.TrimSpace(lines[len(lines)-1])
-						if len(lastLine) <= 3 && (strings.HasSuffix(lastLine, "#") || strings.HasSuffix(lastLine, ">") || strings.HasSuffix(lastLine, "$")) {
-							out = strings.Join(lines[:len(lines)-1], "\n")
-						}
-					}
-					return out, nil
-				}
-			}
-		}
+// Keepalive sends a Telnet NOP, which the device ignores. It detects a
+// connection the device or the network has dropped.
+func (a *TelnetAdapter) Keepalive(ctx context.Context) error {
+	if !a.IsConnected() {
+		return NewConnectionError(fmt.Errorf("not connected"))
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = a.conn.SetWriteDeadline(deadline)
+		defer a.conn.SetWriteDeadline(time.Time{})
 	}
+	_, err := a.conn.Write([]byte{telnetIAC, telnetNOP})
+	return err
 }
 
 // IsConnected returns whether the Telnet connection is active
@@ -236,6 +135,12 @@ func (a *TelnetAdapter) IsConnected() bool {
 	return a.connected && a.conn != nil
 }
 
+// AdapterCapabilities reports the Telnet capabilities. All commands share the
+// login session.
+func (a *TelnetAdapter) AdapterCapabilities() AdapterCapabilities {
+	return AdapterCapabilities{ConfigSession: true, Streaming: true}
+}
+
 // ProtocolType returns the protocol type
 func (a *TelnetAdapter) ProtocolType() ProtocolType {
 	return ProtocolTelnet
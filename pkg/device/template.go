@@ -0,0 +1,284 @@
+package device
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Template parameter types
+const (
+	ParamString    = "string"
+	ParamInt       = "int"
+	ParamEnum      = "enum"
+	ParamIPv4      = "ipv4"
+	ParamCIDR      = "cidr"
+	ParamInterface = "interface"
+)
+
+// defaultInterfacePattern matches interface names such as GigabitEthernet0/1,
+// Gi1/0/24, Vlan10, Port-channel1 or Ethernet1/1.100
+const defaultInterfacePattern = `^[A-Za-z][A-Za-z-]*[ ]?\d+(/\d+)*(\.\d+)?$`
+
+var (
+	paramNamePattern      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	defaultInterfaceRegex = regexp.MustCompile(defaultInterfacePattern)
+)
+
+// templateFuncs are available in template bodies in addition to the
+// text/template builtins
+var templateFuncs = template.FuncMap{
+	// ip returns the address part of a CIDR value
+	"ip": func(cidr string) (string, error) {
+		ip, _, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return "", err
+		}
+		return ip.String(), nil
+	},
+	// mask returns the dotted netmask of a CIDR value
+	"mask": func(cidr string) (string, error) {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return "", err
+		}
+		return net.IP(n.Mask).String(), nil
+	},
+	// network returns the network address of a CIDR value
+	"network": func(cidr string) (string, error) {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return "", err
+		}
+		return n.IP.String(), nil
+	},
+}
+
+// TemplateParam describes a typed command template parameter
+type TemplateParam struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"` // string, int, enum, ipv4, cidr or interface
+	Label    string   `json:"label,omitempty"`
+	Required bool     `json:"required"`
+	Default  string   `json:"default,omitempty"`
+	Min      *int     `json:"min,omitempty"`     // int only
+	Max      *int     `json:"max,omitempty"`     // int only
+	Options  []string `json:"options,omitempty"` // enum only
+	Pattern  string   `json:"pattern,omitempty"` // string and interface, interface has a default
+
+	pattern *regexp.Regexp // Pattern matching the whole value, set by Validate
+}
+
+// CommandTemplate is a named CLI snippet rendered with text/template. Every
+// non-blank line of the rendered body is one command.
+type CommandTemplate struct {
+	Name   string
+	Body   string
+	Params []TemplateParam
+}
+
+// Validate checks the template body and the parameter definitions and
+// compiles the parameter patterns. A pattern has to match the whole value.
+func (t *CommandTemplate) Validate() error {
+	if _, err := t.parse(); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(t.Params))
+	for i := range t.Params {
+		p := &t.Params[i]
+		if !paramNamePattern.MatchString(p.Name) {
+			return NewInvalidTemplateError(fmt.Sprintf("invalid parameter name %q", p.Name))
+		}
+		if seen[p.Name] {
+			return NewInvalidTemplateError(fmt.Sprintf("duplicate parameter %q", p.Name))
+		}
+		seen[p.Name] = true
+
+		switch p.Type {
+		case ParamString, ParamIPv4, ParamCIDR, ParamInterface:
+		case ParamInt:
+			if p.Min != nil && p.Max != nil && *p.Min > *p.Max {
+				return NewInvalidTemplateError(fmt.Sprintf("parameter %q: min is greater than max", p.Name))
+			}
+		case ParamEnum:
+			if len(p.Options) == 0 {
+				return NewInvalidTemplateError(fmt.Sprintf("parameter %q: enum without options", p.Name))
+			}
+		default:
+			return NewInvalidTemplateError(fmt.Sprintf("parameter %q: unknown type %q", p.Name, p.Type))
+		}
+		p.pattern = nil
+		if p.Pattern != "" {
+			re, err := regexp.Compile(`^(?:` + p.Pattern + `)$`)
+			if err != nil {
+				return NewInvalidTemplateError(fmt.Sprintf("parameter %q: invalid pattern: %v", p.Name, err))
+			}
+			p.pattern = re
+		} else if p.Type == ParamInterface {
+			p.pattern = defaultInterfaceRegex
+		}
+		if p.Default != "" {
+			if _, err := p.convert(p.Default); err != nil {
+				return NewInvalidTemplateError(fmt.Sprintf("parameter %q: invalid default: %v", p.Name, err))
+			}
+		}
+	}
+	return nil
+}
+
+// Render validates values against the parameter definitions and returns the
+// commands of the rendered body. Values may be JSON decoded, numbers are
+// accepted for int parameters either as numbers or as strings. Optional
+// parameters without value and default render as an empty string. Render
+// validates the template first, so a template must not be rendered
+// concurrently.
+func (t *CommandTemplate) Render(values map[string]interface{}) ([]string, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	tmpl, err := t.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	data := make(map[string]interface{}, len(t.Params))
+	for i := range t.Params {
+		p := &t.Params[i]
+		raw, err := paramString(values[p.Name])
+		if err != nil {
+			return nil, NewInvalidParamError(fmt.Sprintf("%s: %v", p.Name, err))
+		}
+		if raw == "" {
+			raw = p.Default
+		}
+		if raw == "" {
+			if p.Required {
+				return nil, NewInvalidParamError(fmt.Sprintf("%s is required", p.Name))
+			}
+			data[p.Name] = ""
+			continue
+		}
+		v, err := p.convert(raw)
+		if err != nil {
+			return nil, NewInvalidParamError(fmt.Sprintf("%s: %v", p.Name, err))
+		}
+		data[p.Name] = v
+	}
+	for name := range values {
+		if _, ok := data[name]; !ok {
+			return nil, NewInvalidParamError(fmt.Sprintf("unknown parameter %q", name))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, NewInvalidTemplateError(err.Error())
+	}
+
+	var cmds []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			cmds = append(cmds, line)
+		}
+	}
+	if len(cmds) == 0 {
+		return nil, NewInvalidTemplateError(fmt.Sprintf("template %q rendered no commands", t.Name))
+	}
+	return cmds, nil
+}
+
+func (t *CommandTemplate) parse() (*template.Template, error) {
+	tmpl, err := template.New(t.Name).
+		Funcs(templateFuncs).
+		Option("missingkey=error").
+		Parse(t.Body)
+	if err != nil {
+		return nil, NewInvalidTemplateError(err.Error())
+	}
+	return tmpl, nil
+}
+
+// convert validates a raw value and returns it as the value passed to the
+// template: int for int parameters, the string otherwise. The parameter must
+// have been validated.
+func (p *TemplateParam) convert(raw string) (interface{}, error) {
+	// values end up on the device CLI, a line break would inject a command
+	if strings.IndexFunc(raw, func(r rune) bool { return r < 0x20 || r == 0x7f }) >= 0 {
+		return nil, fmt.Errorf("control characters are not allowed")
+	}
+
+	switch p.Type {
+	case ParamInt:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", raw)
+		}
+		if p.Min != nil && n < *p.Min {
+			return nil, fmt.Errorf("%d is less than %d", n, *p.Min)
+		}
+		if p.Max != nil && n > *p.Max {
+			return nil, fmt.Errorf("%d is greater than %d", n, *p.Max)
+		}
+		return n, nil
+	case ParamEnum:
+		for _, o := range p.Options {
+			if raw == o {
+				return raw, nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not one of %s", raw, strings.Join(p.Options, ", "))
+	case ParamIPv4:
+		if ip := net.ParseIP(raw); ip == nil || ip.To4() == nil || strings.Contains(raw, ":") {
+			return nil, fmt.Errorf("%q is not an IPv4 address", raw)
+		}
+		return raw, nil
+	case ParamCIDR:
+		ip, _, err := net.ParseCIDR(raw)
+		if err != nil || ip.To4() == nil || strings.Contains(raw, ":") {
+			return nil, fmt.Errorf("%q is not an IPv4 CIDR", raw)
+		}
+		return raw, nil
+	case ParamInterface:
+		if !p.pattern.MatchString(raw) {
+			return nil, fmt.Errorf("%q is not a valid interface name", raw)
+		}
+		return raw, nil
+	default:
+		if p.pattern != nil && !p.pattern.MatchString(raw) {
+			return nil, fmt.Errorf("%q does not match %s", raw, p.Pattern)
+		}
+		return raw, nil
+	}
+}
+
+// paramString converts a JSON decoded value to its string form
+func paramString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return strings.TrimSpace(v), nil
+	case float64:
+		if v != math.Trunc(v) || math.IsInf(v, 0) {
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		}
+		return strconv.FormatInt(int64(v), 10), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return "", fmt.Errorf("unsupported value type %T", v)
+	}
+}
@@ -0,0 +1,109 @@
+package device
+
+import (
+	"reflect"
+	"testing"
+)
+
+func intPtr(n int) *int { return &n }
+
+func TestCommandTemplateRender(t *testing.T) {
+	tmpl := &CommandTemplate{
+		Name: "set port vlan",
+		Body: "interface {{.port}}\n" +
+			" switchport mode {{.mode}}\n" +
+			" switchport access vlan {{.vlan}}\n" +
+			"{{if .address}} ip address {{ip .address}} {{mask .address}}\n{{end}}" +
+			"end",
+		Params: []TemplateParam{
+			{Name: "port", Type: ParamInterface, Required: true},
+			{Name: "vlan", Type: ParamInt, Required: true, Min: intPtr(1), Max: intPtr(4094)},
+			{Name: "mode", Type: ParamEnum, Options: []string{"access", "trunk"}, Default: "access"},
+			{Name: "address", Type: ParamCIDR},
+		},
+	}
+	if err := tmpl.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := tmpl.Render(map[string]interface{}{"port": "Gi1/0/24", "vlan": float64(10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"interface Gi1/0/24", "switchport mode access", "switchport access vlan 10", "end"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Render = %q, want %q", got, want)
+	}
+
+	got, err = tmpl.Render(map[string]interface{}{"port": "Vlan10", "vlan": "20", "address": "10.0.0.1/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[3] != "ip address 10.0.0.1 255.255.255.0" {
+		t.Errorf("Render address line = %q", got[3])
+	}
+
+	invalid := []map[string]interface{}{
+		{"vlan": 10},                                      // port missing
+		{"port": "Gi1/0/1", "vlan": 5000},                 // out of range
+		{"port": "Gi1/0/1", "vlan": 1.5},                  // not an integer
+		{"port": "Gi1/0/1", "vlan": 10, "mode": "hybrid"}, // not an option
+		{"port": "Gi1/0/1\nreload", "vlan": 10},           // injected command
+		{"port": "Gi1/0/1", "vlan": 10, "address": "10.0.0.1"},
+		{"port": "Gi1/0/1", "vlan": 10, "extra": "x"},
+	}
+	for _, values := range invalid {
+		_, err := tmpl.Render(values)
+		if de, ok := err.(*DeviceError); !ok || de.Code != ErrInvalidParam {
+			t.Errorf("Render(%v) error = %v, want invalid parameter", values, err)
+		}
+	}
+}
+
+func TestCommandTemplateValidate(t *testing.T) {
+	invalid := []*CommandTemplate{
+		{Name: "body", Body: "show {{.x"},
+		{Name: "type", Body: "show", Params: []TemplateParam{{Name: "x", Type: "float"}}},
+		{Name: "name", Body: "show", Params: []TemplateParam{{Name: "a-b", Type: ParamString}}},
+		{Name: "dup", Body: "show", Params: []TemplateParam{{Name: "x", Type: ParamString}, {Name: "x", Type: ParamInt}}},
+		{Name: "enum", Body: "show", Params: []TemplateParam{{Name: "x", Type: ParamEnum}}},
+		{Name: "range", Body: "show", Params: []TemplateParam{{Name: "x", Type: ParamInt, Min: intPtr(5), Max: intPtr(1)}}},
+		{Name: "default", Body: "show", Params: []TemplateParam{{Name: "x", Type: ParamIPv4, Default: "300.1.1.1"}}},
+	}
+	for _, tmpl := range invalid {
+		err := tmpl.Validate()
+		if de, ok := err.(*DeviceError); !ok || de.Code != ErrInvalidTemplate {
+			t.Errorf("Validate(%s) error = %v, want invalid template", tmpl.Name, err)
+		}
+	}
+}
+
+func TestCommandTemplatePatternMatchesWholeValue(t *testing.T) {
+	tmpl := &CommandTemplate{
+		Name: "describe",
+		Body: "interface {{.port}}\n description {{.text}}",
+		Params: []TemplateParam{
+			{Name: "port", Type: ParamInterface, Required: true, Pattern: `Gi1/0/\d+`},
+			{Name: "text", Type: ParamString, Pattern: `[a-z]+|[0-9]+`},
+		},
+	}
+	if err := tmpl.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tmpl.Render(map[string]interface{}{"port": "Gi1/0/24", "text": "uplink"}); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []map[string]interface{}{
+		{"port": "Gi1/0/24 shutdown"},                  // interface pattern matched a prefix
+		{"port": "xGi1/0/24"},                          // and a suffix
+		{"port": "Gi1/0/24", "text": "uplink; reload"}, // alternation anchored as a whole
+		{"port": "Gi1/0/24", "text": "1 a"},
+	}
+	for _, values := range invalid {
+		_, err := tmpl.Render(values)
+		if de, ok := err.(*DeviceError); !ok || de.Code != ErrInvalidParam {
+			t.Errorf("Render(%v) error = %v, want invalid parameter", values, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// TerminalSession is an interactive shell on a device. Reads return the raw
+// terminal output, writes send keystrokes.
+type TerminalSession interface {
+	io.ReadWriteCloser
+
+	// Resize changes the terminal window size
+	Resize(cols, rows int) error
+}
+
+// TerminalOpener is implemented by adapters that can open an interactive shell
+type TerminalOpener interface {
+	OpenTerminal(ctx context.Context, cols, rows int) (TerminalSession, error)
+}
+
+// TerminalConfig holds the interactive terminal configuration
+type TerminalConfig struct {
+	IdleTimeout        int `yaml:"idle_timeout" mapstructure:"idle_timeout"` // seconds
+	MaxSessionsPerUser int `yaml:"max_sessions_per_user" mapstructure:"max_sessions_per_user"`
+	// AllowedOrigins are the browser origins, e.g. https://noc.example.com,
+	// that may open a terminal besides the origin of the server itself
+	AllowedOrigins []string `yaml:"allowed_origins" mapstructure:"allowed_origins"`
+}
+
+// OpenTerminal allocates a PTY on a new SSH session and starts a shell
+func (a *SSHAdapter) OpenTerminal(ctx context.Context, cols, rows int) (TerminalSession, error) {
+	if !a.IsConnected() {
+		return nil, NewConnectionError(fmt.Errorf("not connected"))
+	}
+
+	session, err := a.client.NewSession()
+	if err != nil {
+		return nil, NewCommandFailedError(err)
+	}
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty("xterm", rows, cols, modes); err != nil {
+		session.Close()
+		return nil, NewCommandFailedError(err)
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, NewCommandFailedError(err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, NewCommandFailedError(err)
+	}
+
+	if err := session.Shell(); err != nil {
+		session.Close()
+		return nil, NewCommandFailedError(err)
+	}
+
+	return &sshTerminal{session: session, stdin: stdin, stdout: stdout}, nil
+}
+
+type sshTerminal struct {
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stdout  io.Reader
+	once    sync.Once
+}
+
+func (t *sshTerminal) Read(p []byte) (int, error) {
+	return t.stdout.Read(p)
+}
+
+func (t *sshTerminal) Write(p []byte) (int, error) {
+	return t.stdin.Write(p)
+}
+
+func (t *sshTerminal) Resize(cols, rows int) error {
+	return t.session.WindowChange(rows, cols)
+}
+
+// Close ends the shell session, the SSH connection stays usable
+func (t *sshTerminal) Close() error {
+	var err error
+	t.once.Do(func() {
+		err = t.session.Close()
+		if err == io.EOF {
+			err = nil
+		}
+	})
+	return err
+}
+
+// OpenTerminal hands the raw Telnet stream to the caller. The CLI state left
+// behind by the user is unknown, so the connection is dropped on close and
+// the pool reconnects on next use.
+func (a *TelnetAdapter) OpenTerminal(ctx context.Context, cols, rows int) (TerminalSession, error) {
+	if !a.IsConnected() {
+		return nil, NewConnectionError(fmt.Errorf("not connected"))
+	}
+	return &telnetTerminal{adapter: a, reader: a.session, writer: a.conn}, nil
+}
+
+type telnetTerminal struct {
+	adapter *TelnetAdapter
+	reader  io.Reader
+	writer  io.Writer
+	once    sync.Once
+}
+
+func (t *telnetTerminal) Read(p []byte) (int, error) {
+	return t.reader.Read(p)
+}
+
+func (t *telnetTerminal) Write(p []byte) (int, error) {
+	return t.writer.Write(p)
+}
+
+// Resize is a no-op, the adapter does not negotiate window size (NAWS)
+func (t *telnetTerminal) Resize(cols, rows int) error {
+	return nil
+}
+
+func (t *telnetTerminal) Close() error {
+	var err error
+	t.once.Do(func() {
+		err = t.adapter.Disconnect(context.Background())
+	})
+	return err
+}
@@ -0,0 +1,302 @@
+package device
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// secretPrefix marks an encrypted secret. Versioned secrets continue with
+// v<key id>: and the base64 AES-GCM nonce and ciphertext; legacy secrets
+// continue directly with the base64 AES-CFB IV and ciphertext.
+const secretPrefix = "encrypted:"
+
+// legacyKeyID is the key DEVICE_ENCRYPTION_KEY is known by
+const legacyKeyID = "1"
+
+var (
+	keyIDPattern     = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	secretPattern    = regexp.MustCompile(`encrypted:(?:v[A-Za-z0-9_-]+:)?[A-Za-z0-9+/]+=*`)
+	versionedPattern = regexp.MustCompile(`^v([A-Za-z0-9_-]+):(.*)$`)
+)
+
+// Vault encrypts and decrypts the device credentials with versioned AES keys.
+// Secrets are encrypted with the current key and decrypted with the key
+// named in their prefix, so that old secrets stay readable while the keys
+// rotate.
+type Vault struct {
+	keys    map[string][]byte
+	current string
+}
+
+// NewVault creates a vault encrypting with the key current. Keys are 16, 24
+// or 32 bytes long for AES-128, AES-192 or AES-256.
+func NewVault(current string, keys map[string][]byte) (*Vault, error) {
+	v := &Vault{keys: make(map[string][]byte, len(keys)), current: current}
+	for id, key := range keys {
+		if !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid encryption key id %q", id)
+		}
+		if _, err := aes.NewCipher(key); err != nil {
+			return nil, fmt.Errorf("encryption key %s: %w", id, err)
+		}
+		v.keys[id] = key
+	}
+	if current != "" && v.keys[current] == nil {
+		return nil, fmt.Errorf("encryption key %s is not configured", current)
+	}
+	return v, nil
+}
+
+// NewVaultFromEnv creates the vault of the environment.
+// DEVICE_ENCRYPTION_KEYS lists id:key pairs separated by commas, the first
+// one encrypts new secrets. DEVICE_ENCRYPTION_KEY is key 1, which also
+// decrypts the unversioned secrets of earlier releases.
+func NewVaultFromEnv() (*Vault, error) {
+	keys := make(map[string][]byte)
+	current := ""
+	if list := os.Getenv("DEVICE_ENCRYPTION_KEYS"); list != "" {
+		for _, entry := range strings.Split(list, ",") {
+			id, key, ok := strings.Cut(strings.TrimSpace(entry), ":")
+			if !ok {
+				return nil, fmt.Errorf("DEVICE_ENCRYPTION_KEYS: %q is not id:key", entry)
+			}
+			if _, dup := keys[id]; dup {
+				return nil, fmt.Errorf("DEVICE_ENCRYPTION_KEYS: duplicate key id %q", id)
+			}
+			keys[id] = []byte(key)
+			if current == "" {
+				current = id
+			}
+		}
+	}
+	if key := os.Getenv("DEVICE_ENCRYPTION_KEY"); key != "" {
+		if _, ok := keys[legacyKeyID]; !ok {
+			keys[legacyKeyID] = []byte(key)
+		}
+		if current == "" {
+			current = legacyKeyID
+		}
+	}
+	return NewVault(current, keys)
+}
+
+// CanEncrypt reports whether the vault has a key to encrypt with
+func (v *Vault) CanEncrypt() bool {
+	return v.current != ""
+}
+
+// CurrentKeyID returns the id of the key new secrets are encrypted with
+func (v *Vault) CurrentKeyID() string {
+	return v.current
+}
+
+// IsEncrypted reports whether s is an encrypted secret
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(s, secretPrefix)
+}
+
+// Encrypt encrypts plaintext with the current key
+func (v *Vault) Encrypt(plaintext string) (string, error) {
+	if !v.CanEncrypt() {
+		return "", fmt.Errorf("encryption key not set (DEVICE_ENCRYPTION_KEYS or DEVICE_ENCRYPTION_KEY environment variable)")
+	}
+	gcm, err := newGCM(v.keys[v.current])
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), []byte(v.current))
+	return secretPrefix + "v" + v.current + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plaintext of an encrypted secret. Other values are
+// returned unchanged.
+func (v *Vault) Decrypt(secret string) (string, error) {
+	if !IsEncrypted(secret) {
+		return secret, nil
+	}
+	body := strings.TrimPrefix(secret, secretPrefix)
+
+	m := versionedPattern.FindStringSubmatch(body)
+	if m == nil {
+		return v.decryptLegacy(body)
+	}
+	id, data := m[1], m[2]
+	key, ok := v.keys[id]
+	if !ok {
+		return "", fmt.Errorf("encryption key %s is not configured", id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode base64: %w", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt with key %s: %w", id, err)
+	}
+	return string(plaintext), nil
+}
+
+// decryptLegacy decrypts an unversioned AES-CFB secret with key 1
+func (v *Vault) decryptLegacy(body string) (string, error) {
+	key, ok := v.keys[legacyKeyID]
+	if !ok {
+		return "", fmt.Errorf("encryption key not set (DEVICE_ENCRYPTION_KEY environment variable)")
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode base64: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to create cipher: %w", err)
+	}
+	if len(ciphertext) < aes.BlockSize {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+
+	iv := ciphertext[:aes.BlockSize]
+	ciphertext = ciphertext[aes.BlockSize:]
+	cipher.NewCFBDecrypter(block, iv).XORKeyStream(ciphertext, ciphertext)
+	return string(ciphertext), nil
+}
+
+// Rotate re-encrypts a secret that is not encrypted with the current key.
+// It reports whether the secret changed; plain values are left alone.
+func (v *Vault) Rotate(secret string) (string, bool, error) {
+	if !IsEncrypted(secret) || strings.HasPrefix(secret, secretPrefix+"v"+v.current+":") {
+		return secret, false, nil
+	}
+	plaintext, err := v.Decrypt(secret)
+	if err != nil {
+		return "", false, err
+	}
+	rotated, err := v.Encrypt(plaintext)
+	if err != nil {
+		return "", false, err
+	}
+	return rotated, true, nil
+}
+
+// RotateText re-encrypts every secret found in a text such as a settings
+// file and returns the new text and the number of secrets re-encrypted
+func (v *Vault) RotateText(text []byte) ([]byte, int, error) {
+	var firstErr error
+	count := 0
+	out := secretPattern.ReplaceAllFunc(text, func(match []byte) []byte {
+		if firstErr != nil {
+			return match
+		}
+		rotated, changed, err := v.Rotate(string(match))
+		if err != nil {
+			firstErr = err
+			return match
+		}
+		if changed {
+			count++
+		}
+		return []byte(rotated)
+	})
+	if firstErr != nil {
+		return nil, 0, firstErr
+	}
+	return out, count, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+var globalVault struct {
+	sync.Mutex
+	vault *Vault
+	err   error
+}
+
+// GetVault returns the vault of the environment, read on first use
+func GetVault() (*Vault, error) {
+	globalVault.Lock()
+	defer globalVault.Unlock()
+	if globalVault.vault == nil && globalVault.err == nil {
+		globalVault.vault, globalVault.err = NewVaultFromEnv()
+	}
+	return globalVault.vault, globalVault.err
+}
+
+// SetVault replaces the vault used to decrypt the device credentials
+func SetVault(v *Vault) {
+	globalVault.Lock()
+	defer globalVault.Unlock()
+	globalVault.vault, globalVault.err = v, nil
+}
+
+// credentials are the decrypted secrets of a connection. They are only
+// held while connecting, the configuration keeps the encrypted values.
+type credentials struct {
+	password             string
+	enablePassword       string
+	privateKey           string
+	privateKeyPassphrase string
+}
+
+// credentials decrypts the secrets of the connection
+func (c *ConnectionConfig) credentials() (*credentials, error) {
+	creds := &credentials{}
+	fields := []struct {
+		name   string
+		secret string
+		plain  *string
+	}{
+		{"password", c.Password, &creds.password},
+		{"enable password", c.EnablePassword, &creds.enablePassword},
+		{"private key", c.PrivateKey, &creds.privateKey},
+		{"private key passphrase", c.PrivateKeyPassphrase, &creds.privateKeyPassphrase},
+	}
+	for _, f := range fields {
+		if !IsEncrypted(f.secret) {
+			*f.plain = f.secret
+			continue
+		}
+		vault, err := GetVault()
+		if err != nil {
+			return nil, NewInvalidConfigError(err.Error())
+		}
+		plain, err := vault.Decrypt(f.secret)
+		if err != nil {
+			return nil, NewInvalidConfigError(fmt.Sprintf("failed to decrypt %s: %v", f.name, err))
+		}
+		*f.plain = plain
+	}
+	return creds, nil
+}
+
+// enable returns the password for privileged mode, the login password when
+// no enable password is configured
+func (c *credentials) enable() string {
+	if c.enablePassword != "" {
+		return c.enablePassword
+	}
+	return c.password
+}
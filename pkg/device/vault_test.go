@@ -0,0 +1,139 @@
+package device
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+const (
+	testKey1 = "0123456789abcdef"
+	testKey2 = "abcdef0123456789abcdef0123456789"
+)
+
+// legacySecret encrypts plaintext the way earlier releases did, with AES-CFB
+// and the IV in front of the ciphertext
+func legacySecret(t *testing.T, key, plaintext string) string {
+	t.Helper()
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := []byte("fedcba9876543210")
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCFBEncrypter(block, iv).XORKeyStream(ciphertext, []byte(plaintext))
+	return "encrypted:" + base64.StdEncoding.EncodeToString(append(iv, ciphertext...))
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	v, err := NewVault("2", map[string][]byte{"1": []byte(testKey1), "2": []byte(testKey2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := v.Encrypt("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(secret, "encrypted:v2:") {
+		t.Fatalf("secret = %q, want key id 2 in the prefix", secret)
+	}
+	again, _ := v.Encrypt("s3cret")
+	if again == secret {
+		t.Error("two encryptions of the same password are equal")
+	}
+	if plain, err := v.Decrypt(secret); err != nil || plain != "s3cret" {
+		t.Fatalf("Decrypt = %q, %v", plain, err)
+	}
+
+	if plain, err := v.Decrypt(legacySecret(t, testKey1, "old")); err != nil || plain != "old" {
+		t.Fatalf("legacy Decrypt = %q, %v", plain, err)
+	}
+	if plain, err := v.Decrypt("admin"); err != nil || plain != "admin" {
+		t.Fatalf("plain Decrypt = %q, %v", plain, err)
+	}
+
+	// the key id is authenticated, a secret cannot be moved to another key
+	tampered := strings.Replace(secret, "encrypted:v2:", "encrypted:v1:", 1)
+	if _, err := v.Decrypt(tampered); err == nil {
+		t.Error("decrypted a secret whose key id was changed")
+	}
+	if _, err := v.Decrypt("encrypted:v9:AAAA"); err == nil {
+		t.Error("decrypted a secret of an unknown key")
+	}
+}
+
+func TestVaultRotate(t *testing.T) {
+	old, _ := NewVault("1", map[string][]byte{"1": []byte(testKey1)})
+	secret, _ := old.Encrypt("s3cret")
+
+	v, _ := NewVault("2", map[string][]byte{"1": []byte(testKey1), "2": []byte(testKey2)})
+	text := []byte("password: " + secret + "\nenable_password: \"" + legacySecret(t, testKey1, "en") + "\"\nusername: admin\n")
+	out, n, err := v.RotateText(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("rotated %d secrets, want 2:\n%s", n, out)
+	}
+	if strings.Count(string(out), "encrypted:v2:") != 2 || !strings.Contains(string(out), "username: admin\n") {
+		t.Fatalf("rotated text:\n%s", out)
+	}
+
+	// already rotated secrets are left alone
+	if _, n, _ := v.RotateText(out); n != 0 {
+		t.Errorf("second rotation re-encrypted %d secrets", n)
+	}
+
+	// without the old key the secrets cannot be rotated
+	next, _ := NewVault("2", map[string][]byte{"2": []byte(testKey2)})
+	if _, _, err := next.RotateText(text); err == nil {
+		t.Error("rotated secrets without their key")
+	}
+}
+
+func TestNewVaultFromEnv(t *testing.T) {
+	t.Setenv("DEVICE_ENCRYPTION_KEYS", "2:"+testKey2)
+	t.Setenv("DEVICE_ENCRYPTION_KEY", testKey1)
+	v, err := NewVaultFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.CurrentKeyID() != "2" {
+		t.Errorf("current key = %q, want 2", v.CurrentKeyID())
+	}
+	if plain, err := v.Decrypt(legacySecret(t, testKey1, "old")); err != nil || plain != "old" {
+		t.Errorf("legacy Decrypt = %q, %v", plain, err)
+	}
+
+	t.Setenv("DEVICE_ENCRYPTION_KEYS", "2:short")
+	if _, err := NewVaultFromEnv(); err == nil {
+		t.Error("accepted a key of invalid length")
+	}
+}
+
+func TestConnectionCredentials(t *testing.T) {
+	v, _ := NewVault("1", map[string][]byte{"1": []byte(testKey1)})
+	SetVault(v)
+	t.Cleanup(func() { SetVault(nil) })
+
+	password, _ := v.Encrypt("s3cret")
+	config := &ConnectionConfig{Password: password, EnablePassword: "enable"}
+	creds, err := config.credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.password != "s3cret" || creds.enable() != "enable" {
+		t.Errorf("credentials = %+v", creds)
+	}
+	if config.Password != password {
+		t.Error("credentials replaced the encrypted password")
+	}
+
+	config.Password = "encrypted:v1:AAAA"
+	if _, err := config.credentials(); err == nil {
+		t.Error("credentials accepted an undecryptable password")
+	}
+}
@@ -27,7 +27,7 @@ $headers = @{
 # Step 2: Test Device Info (no auth required)
 Write-Host "[2/6] Testing Device Info (health check)..." -ForegroundColor Yellow
 try {
-    $deviceInfo = Invoke-RestMethod -Uri "$baseUrl/device" -Method GET
+    $deviceInfo = Invoke-RestMethod -Uri "http://localhost:8000/device" -Method GET
     Write-Host "✓ Device Info: $($deviceInfo.data.status), $($deviceInfo.data.type)" -ForegroundColor Green
 } catch {
     Write-Host "✗ Device Info failed: $($_.Exception.Message)" -ForegroundColor Red
@@ -41,10 +41,10 @@ try {
     $status = $statusResponse.data
     Write-Host "✓ Device Status:" -ForegroundColor Green
     Write-Host "  Connected: $($status.connected)" -ForegroundColor DarkGray
-    Write-Host "  Total Connections: $($status.total_connections)" -ForegroundColor DarkGray
-    Write-Host "  Active Connections: $($status.active_connections)" -ForegroundColor DarkGray
-    Write-Host "  Queue Size: $($status.queue_size)" -ForegroundColor DarkGray
-    Write-Host "  Max Connections: $($status.max_connections)" -ForegroundColor DarkGray
+    Write-Host "  Total Connections: $($status.totalConnections)" -ForegroundColor DarkGray
+    Write-Host "  Active Connections: $($status.activeConnections)" -ForegroundColor DarkGray
+    Write-Host "  Queue Size: $($status.queueSize)" -ForegroundColor DarkGray
+    Write-Host "  Max Connections: $($status.maxConnections)" -ForegroundColor DarkGray
 
     if (-not $status.connected) {
         Write-Host "  ⚠ Device not connected. Check configuration!" -ForegroundColor Yellow
@@ -92,7 +92,7 @@ try {
 
     foreach ($item in $result.data.results) {
         $statusIcon = if ($item.success) { "✓" } else { "✗" }
-        Write-Host "  $statusIcon $($item.command): $($item.duration)ms" -ForegroundColor DarkGray
+        Write-Host "  $statusIcon $($item.command): $($item.durationMs)ms" -ForegroundColor DarkGray
     }
 } catch {
     Write-Host "✗ Batch execution failed: $($_.Exception.Message)" -ForegroundColor Red